@@ -2,94 +2,249 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"shared/dedup"
 	"strings"
+	"time"
 )
 
+// 用法:
+//
+//	go run dedup_unique_uids.go                                  # 只保留唯一出现的UID（原有逻辑）
+//	go run dedup_unique_uids.go -mode distinct                   # 每个UID保留一次
+//	go run dedup_unique_uids.go -mode duplicates -o dup.csv      # 重复出现的UID及出现次数
+//	go run dedup_unique_uids.go -mode minus -a ban.csv -b banned.csv -o todo.csv
+//	go run dedup_unique_uids.go -a all_users.csv -mem 256        # 内存预算 256MB，超出时分区写入临时文件
+//	go run dedup_unique_uids.go -bench 10000000 -mem 64          # 生成1000万行测试数据，对比原来的 map 实现和分区实现
 func main() {
-	// 读取CSV文件
-	inputFile := "rm-repeat-uid/uid.csv"
-	outputFile := "rm-repeat-uid/unique_uids.csv"
-
-	// 统计每个uid的出现次数
-	uidCounts := make(map[string]int)
-
-	file, err := os.Open(inputFile)
+	modeFlag := flag.String("mode", string(dedup.Singletons), "去重方式: distinct/singletons/duplicates/union/intersect/minus")
+	inputA := flag.String("a", "rm-repeat-uid/uid.csv", "输入名单（集合运算时为名单A）")
+	inputB := flag.String("b", "", "名单B，集合运算时必填")
+	outputFile := flag.String("o", "rm-repeat-uid/unique_uids.csv", "输出文件")
+	reportFile := flag.String("report", "", "报告文件，为空时不写报告")
+	memory := flag.Int64("mem", dedup.DefaultMemoryLimit>>20, "内存预算（MB），超出时按UID哈希分区写入临时文件")
+	benchLines := flag.Int("bench", 0, "生成指定行数的测试数据，对比各实现的耗时和内存")
+	benchStrings := flag.Bool("bench-strings", false, "测试数据使用非纯数字的UID")
+	flag.Parse()
+
+	mode, err := dedup.ParseMode(*modeFlag)
 	if err != nil {
-		fmt.Printf("打开文件失败: %v\n", err)
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if *benchLines > 0 {
+		if err := benchmark(mode, *benchLines, *benchStrings, *memory<<20); err != nil {
+			fmt.Printf("❌ 基准测试失败: %v\n", err)
+			os.Exit(1)
+		}
 		return
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	totalLines := 0
 
-	fmt.Println("正在读取和统计uid...")
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			uidCounts[line]++
-			totalLines++
+	inputs := []string{*inputA}
+	if mode.SetOperation() {
+		if *inputB == "" {
+			fmt.Printf("❌ %s 需要用 -b 指定名单B\n", string(mode))
+			os.Exit(1)
 		}
+		inputs = append(inputs, *inputB)
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("读取文件时出错: %v\n", err)
-		return
+	fmt.Printf("正在读取和统计uid: %s\n", mode)
+	result, err := dedup.Run(context.Background(), mode, inputs, *outputFile, dedup.Options{MemoryLimit: *memory << 20}, func(list int, done, total int64, lines int) {
+		if done < total {
+			fmt.Printf("\r名单%c 已读取 %d 行...", 'A'+list, lines)
+		}
+	})
+	if err != nil {
+		fmt.Printf("\n❌ 处理失败: %v\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("总共读取了 %d 行数据\n", totalLines)
-	fmt.Printf("发现 %d 个不同的uid\n", len(uidCounts))
-
-	// 统计重复情况
-	uniqueCount := 0
-	duplicateCount := 0
-
-	for _, count := range uidCounts {
-		if count == 1 {
-			uniqueCount++
-		} else {
-			duplicateCount++
+	fmt.Printf("\r%s\n", result.Summary())
+	if result.Partitions > 1 {
+		fmt.Printf("超出内存预算，按UID哈希分为 %d 个分区处理\n", result.Partitions)
+	}
+	if result.Resplit > 0 {
+		fmt.Printf("其中 %d 个分区超出内存预算，再次分区处理\n", result.Resplit)
+	}
+	if *reportFile != "" {
+		if err := result.WriteReport(*reportFile); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Printf("报告已写入 %s\n", *reportFile)
 	}
+	fmt.Printf("✅ 结果已保存到 %s\n", *outputFile)
+}
 
-	fmt.Printf("唯一uid数量: %d\n", uniqueCount)
-	fmt.Printf("重复uid数量: %d\n", duplicateCount)
+// benchmark 生成测试数据，分别用原来的 map[string]int 实现、内存中处理和分区处理去重，输出耗时和堆内存峰值
+func benchmark(mode dedup.Mode, lines int, strs bool, memory int64) error {
+	if mode.SetOperation() {
+		return fmt.Errorf("基准测试只支持单个名单的去重方式")
+	}
+	dir, err := os.MkdirTemp("", "dedup-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
 
-	// 创建输出文件，只写入唯一的uid
-	outputFileHandle, err := os.Create(outputFile)
+	input := filepath.Join(dir, "uid.csv")
+	if err := generateUIDs(input, lines, strs); err != nil {
+		return err
+	}
+	info, err := os.Stat(input)
 	if err != nil {
-		fmt.Printf("创建输出文件失败: %v\n", err)
-		return
+		return err
+	}
+	fmt.Printf("测试数据: %d 行, %.1f MB, 去重方式 %s\n\n", lines, float64(info.Size())/(1<<20), string(mode))
+
+	runs := []struct {
+		name string
+		run  func(output string) (int, error)
+	}{
+		{"map[string]int（原实现）", func(output string) (int, error) {
+			return legacySingletons(input, output)
+		}},
+		{"dedup 内存中处理", func(output string) (int, error) {
+			result, err := dedup.Run(context.Background(), mode, []string{input}, output, dedup.Options{MemoryLimit: 1 << 62}, nil)
+			if err != nil {
+				return 0, err
+			}
+			return result.Written, nil
+		}},
+		{fmt.Sprintf("dedup 分区处理（预算 %dMB）", memory>>20), func(output string) (int, error) {
+			result, err := dedup.Run(context.Background(), mode, []string{input}, output, dedup.Options{MemoryLimit: memory}, nil)
+			if err != nil {
+				return 0, err
+			}
+			fmt.Printf("  分区数: %d，再次分区: %d\n", result.Partitions, result.Resplit)
+			return result.Written, nil
+		}},
+	}
+	if mode != dedup.Singletons {
+		// 原实现只支持只保留唯一出现的UID
+		runs = runs[1:]
 	}
-	defer outputFileHandle.Close()
 
-	writer := bufio.NewWriter(outputFileHandle)
-	defer writer.Flush()
+	for i, r := range runs {
+		output := filepath.Join(dir, fmt.Sprintf("out-%d.csv", i))
+		fmt.Printf("%s\n", r.name)
+		var written int
+		elapsed, peak, err := measure(func() error {
+			var err error
+			written, err = r.run(output)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  耗时: %v, 堆内存峰值: %.1f MB, 结果: %d 个UID\n\n", elapsed.Round(time.Millisecond), float64(peak)/(1<<20), written)
+		os.Remove(output)
+	}
+	return nil
+}
 
-	// 写入唯一的uid
-	writtenCount := 0
-	for uid, count := range uidCounts {
-		if count == 1 {
-			_, err := writer.WriteString(uid + "\n")
-			if err != nil {
-				fmt.Printf("写入文件时出错: %v\n", err)
+// measure 运行 fn，返回耗时和运行期间的堆内存峰值
+func measure(fn func() error) (time.Duration, uint64, error) {
+	runtime.GC()
+	debug.FreeOSMemory()
+
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var m runtime.MemStats
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > peak {
+				peak = m.HeapInuse
+			}
+			select {
+			case <-done:
 				return
+			case <-ticker.C:
 			}
-			writtenCount++
 		}
+	}()
+
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	close(done)
+	<-sampled
+	return elapsed, peak, err
+}
+
+// generateUIDs 生成测试名单，约 80% 的UID只出现一次
+func generateUIDs(path string, lines int, strs bool) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	rng := rand.New(rand.NewSource(1))
+	space := int64(lines) * 4
+	for i := 0; i < lines; i++ {
+		uid := 1000000000 + rng.Int63n(space)
+		if strs {
+			fmt.Fprintf(w, "u%x\n", uid)
+		} else {
+			fmt.Fprintf(w, "%d\n", uid)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// legacySingletons 原来的实现：用 map[string]int 统计所有UID，写出只出现一次的UID（输出顺序不固定）
+func legacySingletons(input, output string) (int, error) {
+	file, err := os.Open(input)
+	if err != nil {
+		return 0, err
 	}
+	defer file.Close()
 
-	fmt.Printf("成功写入 %d 个唯一uid到 %s\n", writtenCount, outputFile)
+	uidCounts := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			uidCounts[line]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
 
-	// 显示一些重复uid的示例
-	fmt.Println("\n重复uid示例（前10个）:")
-	exampleCount := 0
+	out, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	written := 0
 	for uid, count := range uidCounts {
-		if count > 1 && exampleCount < 10 {
-			fmt.Printf("uid: %s, 出现次数: %d\n", uid, count)
-			exampleCount++
+		if count == 1 {
+			w.WriteString(uid + "\n")
+			written++
 		}
 	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return written, out.Close()
 }
@@ -3,6 +3,7 @@
 # Redis批量导入脚本
 # 使用方法: ./execute_redis_commands.sh <redis_host>
 # 例如: ./execute_redis_commands.sh 127.0.0.1
+# 执行前按同目录的 MANIFEST.json 校验所有文件，校验不通过时不会执行任何命令
 
 # 检查参数
 if [ $# -eq 0 ]; then
@@ -23,6 +24,79 @@ echo "Redis端口: $REDIS_PORT"
 echo "当前目录: $CURRENT_DIR"
 echo "================================"
 
+# 校验 MANIFEST.json：压缩包中的每个文件都必须存在且 SHA-256 一致，校验不通过时不执行任何命令
+verify_manifest() {
+    manifest="${CURRENT_DIR}/MANIFEST.json"
+    if [ ! -f "$manifest" ]; then
+        echo "错误: 没有找到 MANIFEST.json，无法校验命令文件，请使用完整的压缩包"
+        exit 1
+    fi
+
+    if command -v sha256sum >/dev/null 2>&1; then
+        checksum="sha256sum"
+    elif command -v shasum >/dev/null 2>&1; then
+        checksum="shasum -a 256"
+    else
+        echo "错误: 没有找到 sha256sum 或 shasum，无法校验命令文件"
+        exit 1
+    fi
+
+    # 清单中每个文件的记录占一行: {"name":"...","lines":N,"bytes":N,"sha256":"..."}
+    entries=$(sed -n 's/.*"name":"\([^"]*\)".*"sha256":"\([0-9a-f]\{64\}\)".*/\2 \1/p' "$manifest")
+    if [ -z "$entries" ]; then
+        echo "错误: MANIFEST.json 中没有文件记录"
+        exit 1
+    fi
+
+    echo "正在校验 MANIFEST.json..."
+    checked=0
+    bad=0
+    while read -r expected name; do
+        path="${CURRENT_DIR}/${name}"
+        # 已执行的文件会被重命名为 xxx_done 或 xxx_done.txt，校验重命名后的文件
+        if [ ! -f "$path" ] && [ -f "${path}_done" ]; then
+            path="${path}_done"
+        elif [ ! -f "$path" ] && [ -f "${path%.txt}_done.txt" ]; then
+            path="${path%.txt}_done.txt"
+        fi
+        if [ ! -f "$path" ]; then
+            echo "  ❌ 缺少文件: $name"
+            bad=$((bad + 1))
+            continue
+        fi
+        actual=$($checksum "$path" | cut -d' ' -f1)
+        if [ "$actual" != "$expected" ]; then
+            echo "  ❌ 校验失败: $name"
+            bad=$((bad + 1))
+            continue
+        fi
+        checked=$((checked + 1))
+    done <<< "$entries"
+
+    # 不在清单中的命令文件不能执行
+    for file in "${CURRENT_DIR}"/redis_commands_part_*; do
+        [ -f "$file" ] || continue
+        name=$(basename "$file")
+        case "$name" in
+            *_done) name="${name%_done}" ;;
+            *_done.txt) name="${name%_done.txt}.txt" ;;
+        esac
+        if ! grep -q "\"name\":\"${name}\"" "$manifest"; then
+            echo "  ❌ 文件不在清单中: $(basename "$file")"
+            bad=$((bad + 1))
+        fi
+    done
+
+    if [ $bad -gt 0 ]; then
+        echo "错误: 有 $bad 个文件校验失败，文件可能被修改或不完整，已停止执行"
+        exit 1
+    fi
+    echo "✅ MANIFEST.json 校验通过，共 $checked 个文件"
+    echo "================================"
+}
+
+verify_manifest
+
 # 统计变量
 total_files=0
 success_files=0
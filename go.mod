@@ -2,7 +2,10 @@ module csld-go
 
 go 1.23.3
 
-require github.com/xuri/excelize/v2 v2.9.1
+require (
+	github.com/xuri/excelize/v2 v2.9.1
+	shared v0.0.0
+)
 
 require (
 	github.com/richardlehane/mscfb v1.0.4 // indirect
@@ -14,3 +17,5 @@ require (
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 )
+
+replace shared => ./shared
@@ -2,13 +2,20 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"shared/kyc"
+	"shared/pack"
+	"shared/rediskey"
+	"shared/snapshot"
+	"shared/split"
 	"sort"
 	"strings"
 	"syscall"
@@ -45,13 +52,17 @@ func main() {
 		sqlLogParser()
 	}
 	if len(os.Args) > 1 && os.Args[1] == "4" {
-		// 切分 multi-redis包中的文件  1W 行一个文件
+		// 切分 multi-redis包中的文件，默认 1W 行一个文件，可按大小、份数或ID分组切分
 		splitMultiRedisFile()
 	}
 	if len(os.Args) > 1 && os.Args[1] == "5" {
 		// KYC审核处理
 		kycReviewProcessor()
 	}
+	if len(os.Args) > 1 && os.Args[1] == "6" {
+		// 打包 multi-redis-split 目录并生成 MANIFEST.json，执行脚本运行前按清单校验
+		packSplitDir()
+	}
 
 	// if len(os.Args) > 1 && os.Args[1] == "4" {
 	// 	balanceSqlLogParser()
@@ -414,23 +425,47 @@ func lockUser() {
 
 	log.Printf("找到 %d 个用户 ID", len(userIds))
 
+	// lock-user-csv/snapshot 目录中有 b_user 快照时，只为快照中存在且未锁定的用户生成 SQL
+	lockIds := userIds
+	users, err := loadSnapshot(csvDir, snapshot.LoadUsers)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	if users != nil {
+		var report *snapshot.Report
+		lockIds, report = snapshot.CheckLock(users, userIds)
+		if !writeSnapshotReport("lockuser-snapshot-check.csv", report) {
+			return
+		}
+	}
+
 	// 生成 SQL 文件
-	sqlContent := generateSQL(userIds)
+	sqlContent := generateSQL(lockIds)
 	err = os.WriteFile("lockUser-db_user库.sql", []byte(sqlContent), 0644)
 	if err != nil {
 		log.Printf("写入 SQL 文件失败: %v", err)
 		return
 	}
 
-	// 生成 Redis 命令文件
-	redisContent := generateRedisCommands(userIds)
-	err = os.WriteFile("lockUser-redis_db0.txt", []byte(redisContent), 0644)
+	// 按 DB 生成 Redis 命令文件
+	targets, err := loadLockUserRedisKeys()
 	if err != nil {
-		log.Printf("写入 Redis 命令文件失败: %v", err)
+		log.Printf("%v", err)
 		return
 	}
+	for _, target := range targets {
+		redisContent := generateRedisCommands(userIds, target.Templates)
+		redisFile := fmt.Sprintf("lockUser-redis_db%d.txt", target.DB)
+		err = os.WriteFile(redisFile, []byte(redisContent), 0644)
+		if err != nil {
+			log.Printf("写入 Redis 命令文件失败: %v", err)
+			return
+		}
+		log.Printf("已生成 %s (key 模板: %s)", redisFile, strings.Join(target.Templates, ", "))
+	}
 
-	log.Printf("已生成 lockUser.sql 和 lockUser_redis.txt 文件")
+	log.Printf("已生成 lockUser-db_user库.sql 和 %d 个 Redis 命令文件", len(targets))
 }
 
 // 生成 SQL 语句
@@ -445,16 +480,23 @@ func generateSQL(userIds []string) string {
 	return strings.Join(sqlStatements, "\n")
 }
 
-// 生成 Redis 删除命令
-func generateRedisCommands(userIds []string) string {
-	var redisCommands []string
+// 生成 Redis 删除命令，同一用户的命令相邻
+func generateRedisCommands(userIds []string, templates []string) string {
+	return strings.Join(rediskey.DelCommands(templates, userIds), "\n")
+}
 
-	for _, userId := range userIds {
-		command := fmt.Sprintf("del %s", userId)
-		redisCommands = append(redisCommands, command)
+// 从环境变量 LOCK_USER_REDIS_KEYS 读取锁定用户的 key 模板，未配置时使用默认值
+// 格式: "0=user:token:{uid},user:info:{uid};2=session:{uid}"，分号分隔 DB，逗号分隔模板
+func loadLockUserRedisKeys() ([]rediskey.Template, error) {
+	spec := os.Getenv("LOCK_USER_REDIS_KEYS")
+	if spec == "" {
+		spec = rediskey.DefaultLockUser
 	}
-
-	return strings.Join(redisCommands, "\n")
+	targets, err := rediskey.ParseTemplates(spec)
+	if err != nil {
+		return nil, fmt.Errorf("LOCK_USER_REDIS_KEYS 配置错误: %v", err)
+	}
+	return targets, nil
 }
 
 func LogTaceParser() {
@@ -644,8 +686,57 @@ func LogTaceParser() {
 	fmt.Printf("解析完成，数据已导出到 data.csv 文件\n")
 }
 
-// 切分 multi-redis 目录中的文件，每1万行一个文件
+// 打包目录中的文件并写入 MANIFEST.json，记录每个文件的行数和 SHA-256
+// 参数: go run main.go 6 [-dir multi-redis-split] [-out multi-redis-split.zip] [-op redisdel]
+func packSplitDir() {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	dir := fs.String("dir", "multi-redis-split", "需要打包的目录，只打包目录下的文件，不包含子目录")
+	out := fs.String("out", "multi-redis-split.zip", "压缩包路径")
+	op := fs.String("op", "redisdel", "生成文件的操作，写入 MANIFEST.json")
+	fs.Parse(os.Args[2:])
+
+	entries, err := os.ReadDir(*dir)
+	if err != nil {
+		log.Printf("读取目录失败: %v", err)
+		return
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == pack.ManifestName {
+			continue
+		}
+		files = append(files, filepath.Join(*dir, entry.Name()))
+	}
+	if len(files) == 0 {
+		log.Printf("%s 目录中没有找到文件", *dir)
+		return
+	}
+
+	manifest := &pack.Manifest{Operation: *op, Dir: filepath.Base(*dir)}
+	if err := manifest.Zip(*out, pack.Paths(files...)); err != nil {
+		log.Printf("打包失败: %v", err)
+		return
+	}
+	log.Printf("已打包 %d 个文件到 %s，清单: %s", len(files), *out, pack.ManifestName)
+}
+
+// 切分 multi-redis 目录中的文件，默认每1万行一个文件
+// 参数: go run main.go 4 [-mode lines|bytes|parts|key] [-size 行数/大小/份数] [-header auto|yes|no] [-col N] [-name 命名规则]
 func splitMultiRedisFile() {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	mode := fs.String("mode", "lines", "分割方式: lines 按行数, bytes 按大小, parts 按份数, key 按ID分组")
+	size := fs.String("size", "", "lines/key 为每个文件的行数，bytes 为每个文件的大小（如 10MB），parts 为份数")
+	header := fs.String("header", "auto", "CSV/Excel 第一行是否为表头: auto/yes/no，表头会写入每个分割文件")
+	col := fs.String("col", "", "按ID分组时 CSV/Excel 的ID列（从1开始），文本文件按Redis命令的哈希标签分组")
+	name := fs.String("name", split.DefaultPattern, "分割文件命名规则，{name} 原文件名、{n} 序号、{ext} 扩展名")
+	fs.Parse(os.Args[2:])
+
+	opts, err := split.ParseOptions(*mode, *size, *header, *col, *name)
+	if err != nil {
+		log.Printf("参数错误: %v", err)
+		return
+	}
+
 	// 查找 multi-redis 目录
 	multiRedisDir := "multi-redis"
 	if _, err := os.Stat(multiRedisDir); os.IsNotExist(err) {
@@ -681,6 +772,8 @@ func splitMultiRedisFile() {
 		}
 	}
 
+	log.Printf("分割方式: %s", opts)
+
 	// 处理每个文件
 	for _, filePath := range files {
 		// 检查是否是文件（而不是目录）
@@ -691,88 +784,16 @@ func splitMultiRedisFile() {
 
 		log.Printf("正在处理文件: %s", filePath)
 
-		file, err := os.Open(filePath)
-		if err != nil {
-			log.Printf("打开文件失败: %v", err)
-			continue
-		}
-		registerFile(file)
-
-		scanner := bufio.NewScanner(file)
-		// 增加缓冲区大小以处理超长的行
-		buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
-		scanner.Buffer(buf, 1024*1024)    // 最大 1MB
-
-		var currentFileIndex int = 1
-		var currentLineCount int = 0
-		var currentOutputFile *os.File
-
-		// 获取原文件名（不含路径）
-		baseFileName := filepath.Base(filePath)
-		// 获取原文件扩展名
-		fileExt := filepath.Ext(baseFileName)
-		// 去掉原文件扩展名
-		nameWithoutExt := strings.TrimSuffix(baseFileName, fileExt)
-
-		// 创建第一个输出文件
-		outputFileName := fmt.Sprintf("%s/%s_part_%04d%s", outputDir, nameWithoutExt, currentFileIndex, fileExt)
-		currentOutputFile, err = os.Create(outputFileName)
+		result, err := split.Run(context.Background(), filePath, outputDir, opts, nil)
 		if err != nil {
-			log.Printf("创建输出文件失败: %v", err)
-			file.Close()
+			log.Printf("文件 %s 切分失败: %v", filePath, err)
 			continue
 		}
-		registerFile(currentOutputFile)
-		log.Printf("创建输出文件: %s", outputFileName)
-
-		totalLines := 0
-		// 第一行插入换行符
-		_, err = currentOutputFile.WriteString("\n")
-		// 逐行读取并写入
-		for scanner.Scan() {
-			line := scanner.Text()
-			totalLines++
-			currentLineCount++
-
-			// 写入当前输出文件
-			_, err := currentOutputFile.WriteString(line + "\n")
-			if err != nil {
-				log.Printf("写入文件失败: %v", err)
-				break
-			}
-
-			// 如果当前文件已达到1万行，创建新文件
-			if currentLineCount >= 10000 {
-				currentOutputFile.Close()
-				currentFileIndex++
-				currentLineCount = 0
-
-				// 创建新的输出文件
-				outputFileName = fmt.Sprintf("%s/%s_part_%04d%s", outputDir, nameWithoutExt, currentFileIndex, fileExt)
-				currentOutputFile, err = os.Create(outputFileName)
-				_, err = currentOutputFile.WriteString("\n")
-				if err != nil {
-					log.Printf("创建输出文件失败: %v", err)
-					break
-				}
-				registerFile(currentOutputFile)
-				log.Printf("创建输出文件: %s", outputFileName)
-			}
-		}
-
-		// 关闭最后一个输出文件
-		if currentOutputFile != nil {
-			currentOutputFile.Close()
-		}
-
-		// 关闭输入文件
-		file.Close()
-
-		if err := scanner.Err(); err != nil {
-			log.Printf("读取文件时发生错误: %v", err)
+		for _, part := range result.Parts {
+			log.Printf("创建输出文件: %s（%d 行）", part.File, part.Rows)
 		}
 
-		log.Printf("文件 %s 处理完成，总共 %d 行，切分为 %d 个文件", baseFileName, totalLines, currentFileIndex)
+		log.Printf("文件 %s 处理完成，总共 %d 行，切分为 %d 个文件", filepath.Base(filePath), result.Rows, len(result.Parts))
 	}
 
 	log.Printf("所有文件处理完成，输出文件保存在 %s 目录中", outputDir)
@@ -819,127 +840,117 @@ func kycReviewProcessor() {
 	defer outputFile.Close()
 	registerFile(outputFile)
 
+	// kyc-review/snapshot 目录中有 b_kyc 快照时，只为会变更的记录生成 SQL
+	current, err := loadSnapshot(kycDir, kyc.LoadSnapshot)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+
 	var sqlCount int
+	total := &kyc.Batch{Counts: make(map[kyc.Decision]int)}
 
-	// 处理每个文件
+	// 处理每个文件，审核表格有误的文件整个跳过
 	for _, filePath := range allFiles {
 		log.Printf("正在处理文件: %s", filePath)
 
-		ext := filepath.Ext(filePath)
-		if ext == ".xlsx" {
-			count, err := processExcelFile(filePath, outputFile)
-			if err != nil {
-				log.Printf("处理 Excel 文件失败: %v", err)
-				continue
-			}
-			sqlCount += count
-		} else if ext == ".csv" {
-			count, err := processCSVFile(filePath, outputFile)
-			if err != nil {
-				log.Printf("处理 CSV 文件失败: %v", err)
-				continue
+		var rows [][]string
+		if filepath.Ext(filePath) == ".xlsx" {
+			rows, err = processExcelFile(filePath)
+		} else {
+			rows, err = processCSVFile(filePath)
+		}
+		if err != nil {
+			log.Printf("读取文件 %s 失败: %v", filePath, err)
+			continue
+		}
+		batch, err := kyc.Parse(rows)
+		if err != nil {
+			log.Printf("跳过文件 %s: %v", filePath, err)
+			continue
+		}
+		if current != nil {
+			report := batch.Check(current)
+			name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)) + "-snapshot-check.csv"
+			if !writeSnapshotReport(name, report) {
+				return
 			}
-			sqlCount += count
+		}
+		count, err := batch.WriteSQL(outputFile, currentTime)
+		if err != nil {
+			log.Printf("写入 SQL 失败: %v", err)
+			return
+		}
+		sqlCount += count
+		log.Printf("文件 %s: %s", filepath.Base(filePath), strings.ReplaceAll(batch.Summary(), "\n", "，"))
+
+		total.Records = append(total.Records, batch.Records...)
+		total.Duplicates += batch.Duplicates
+		for d, n := range batch.Counts {
+			total.Counts[d] += n
 		}
 	}
 
-	log.Printf("KYC审核处理完成，共生成 %d 条 SQL 语句，已保存到 %s 文件", sqlCount, filename)
+	summaryFile := fmt.Sprintf("kyc-summary-%s.csv", currentTime.Format("2006-01-02"))
+	if err := total.WriteSummary(summaryFile); err != nil {
+		log.Printf("%v", err)
+	}
+	log.Printf("KYC审核处理完成，共生成 %d 条 SQL 语句，已保存到 %s 文件，结论统计见 %s", sqlCount, filename, summaryFile)
 }
 
-// 处理 Excel 文件
-func processExcelFile(filePath string, outputFile *os.File) (int, error) {
-	f, err := excelize.OpenFile(filePath)
+// loadSnapshot 读取 dir/snapshot 目录中的快照 CSV，没有快照时返回 nil
+func loadSnapshot(dir string, load func(path string) (*snapshot.Snapshot, error)) (*snapshot.Snapshot, error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "snapshot", "*.csv"))
+	switch len(files) {
+	case 0:
+		return nil, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("%s 中只能有一个快照文件", filepath.Join(dir, "snapshot"))
+	}
+	s, err := load(files[0])
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("读取快照 %s 失败: %v", files[0], err)
 	}
-	defer f.Close()
+	log.Printf("对照快照 %s，共 %d 行", files[0], s.Rows)
+	return s, nil
+}
 
-	// 获取第一个工作表
-	sheetName := f.GetSheetName(0)
-	if sheetName == "" {
-		return 0, fmt.Errorf("无法获取工作表")
+// writeSnapshotReport 写出快照检查报告并输出各检查结果的数量
+func writeSnapshotReport(path string, report *snapshot.Report) bool {
+	if err := report.WriteCSV(path); err != nil {
+		log.Printf("%v", err)
+		return false
 	}
+	log.Printf("%s，未生成 SQL 的 ID 见 %s", strings.ReplaceAll(report.Summary(), "\n", "，"), path)
+	return true
+}
 
-	// 读取所有行
-	rows, err := f.GetRows(sheetName)
+// 读取 Excel 文件第一个工作表的所有行
+func processExcelFile(filePath string) ([][]string, error) {
+	f, err := excelize.OpenFile(filePath)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer f.Close()
 
-	// 跳过标题行，处理数据行
-	sqlCount := 0
-	for i, row := range rows {
-		// 跳过标题行（假设第一行是标题）
-		if i == 0 {
-			continue
-		}
-
-		// 确保行有足够的列数据
-		if len(row) >= 2 {
-			// 假设第1列是 user_id，第2列是 id（根据实际Excel结构调整）
-			userId := strings.TrimSpace(row[0])
-			recordId := strings.TrimSpace(row[1])
-
-			// 生成 SQL 语句
-			if userId != "" && recordId != "" {
-				sql := fmt.Sprintf("UPDATE b_kyc set audit_status = 1,audit_at = '%s' where audit_status = 2 and is_lock = 0 and user_id = %s and id = %s;\n",
-					time.Now().Format("2006-01-02 15:04:05"), userId, recordId)
-
-				_, err := outputFile.WriteString(sql)
-				if err != nil {
-					return sqlCount, err
-				}
-				sqlCount++
-			}
-		}
+	// 获取第一个工作表
+	sheetName := f.GetSheetName(0)
+	if sheetName == "" {
+		return nil, fmt.Errorf("无法获取工作表")
 	}
-
-	return sqlCount, nil
+	return f.GetRows(sheetName)
 }
 
-// 处理 CSV 文件
-func processCSVFile(filePath string, outputFile *os.File) (int, error) {
+// 读取 CSV 文件的所有行
+func processCSVFile(filePath string) ([][]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
-
-	// 读取所有记录
-	records, err := reader.ReadAll()
-	if err != nil {
-		return 0, err
-	}
-
-	// 跳过标题行，处理数据行
-	sqlCount := 0
-	for i, record := range records {
-		// 跳过标题行（假设第一行是标题）
-		if i == 0 {
-			continue
-		}
-
-		// 确保行有足够的列数据
-		if len(record) >= 2 {
-			// 假设第1列是 user_id，第2列是 id
-			userId := strings.TrimSpace(record[0])
-			recordId := strings.TrimSpace(record[1])
-
-			// 生成 SQL 语句
-			if userId != "" && recordId != "" {
-				sql := fmt.Sprintf("UPDATE b_kyc set audit_status = 1,audit_at = '%s' where audit_status = 2 and is_lock = 0 and user_id = %s and id = %s;\n",
-					time.Now().Format("2006-01-02 15:04:05"), userId, recordId)
-
-				_, err := outputFile.WriteString(sql)
-				if err != nil {
-					return sqlCount, err
-				}
-				sqlCount++
-			}
-		}
-	}
-
-	return sqlCount, nil
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
 }
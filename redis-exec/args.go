@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitArgs 按 redis-cli 的规则拆分一行命令
+// 支持双引号（含 \" \\ \n \r \t \xHH 转义）和单引号（含 \' 转义）
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	n := len(line)
+
+	for {
+		// 跳过空白
+		for i < n && isSpace(line[i]) {
+			i++
+		}
+		if i >= n {
+			return args, nil
+		}
+
+		var current strings.Builder
+		inDouble := false
+		inSingle := false
+		done := false
+
+		for !done {
+			if inDouble {
+				if i >= n {
+					return nil, fmt.Errorf("双引号未闭合")
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+3 < n && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					value, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current.WriteByte(byte(value))
+					i += 3
+				case c == '\\' && i+1 < n:
+					i++
+					switch line[i] {
+					case 'n':
+						current.WriteByte('\n')
+					case 'r':
+						current.WriteByte('\r')
+					case 't':
+						current.WriteByte('\t')
+					case 'b':
+						current.WriteByte('\b')
+					case 'a':
+						current.WriteByte('\a')
+					default:
+						current.WriteByte(line[i])
+					}
+				case c == '"':
+					// 闭合引号后必须是空白或行尾
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, fmt.Errorf("引号后缺少空白")
+					}
+					done = true
+				default:
+					current.WriteByte(c)
+				}
+			} else if inSingle {
+				if i >= n {
+					return nil, fmt.Errorf("单引号未闭合")
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+1 < n && line[i+1] == '\'':
+					i++
+					current.WriteByte('\'')
+				case c == '\'':
+					if i+1 < n && !isSpace(line[i+1]) {
+						return nil, fmt.Errorf("引号后缺少空白")
+					}
+					done = true
+				default:
+					current.WriteByte(c)
+				}
+			} else {
+				if i >= n {
+					break
+				}
+				c := line[i]
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current.WriteByte(c)
+				}
+			}
+			if i < n {
+				i++
+			}
+		}
+
+		args = append(args, current.String())
+	}
+}
+
+// isSpace 是否为空白字符
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// isHex 是否为十六进制字符
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config 执行器配置
+type Config struct {
+	Host     string
+	Port     int
+	DB       int
+	Username string
+	Password string
+
+	TLS           bool
+	TLSCAFile     string
+	TLSServerName string
+	TLSInsecure   bool
+
+	Rate            float64       // 每秒最多发送的命令数，0 表示不限速
+	PipelineSize    int           // 每批次 pipeline 的命令数
+	Timeout         time.Duration // 连接与读写超时
+	Dir             string        // 命令文件所在目录
+	Pattern         string        // 命令文件匹配模式
+	ContinueOnError bool          // 某个文件出现失败后是否继续执行后续文件
+	DryRun          bool          // 只读预演，不执行任何写命令
+	NoManifest      bool          // 不按 MANIFEST.json 校验命令文件
+}
+
+// defaultConfig 默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Port:         6379,
+		DB:           0,
+		PipelineSize: 500,
+		Timeout:      10 * time.Second,
+		Dir:          ".",
+		Pattern:      "redis_commands_part_*.txt",
+	}
+}
+
+// loadConfigFile 读取 KEY=VALUE 格式的配置文件（与 .env 文件格式一致）
+func loadConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开配置文件失败: %v", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("配置文件第 %d 行格式错误: %s", lineNum, line)
+		}
+		// 去掉行尾注释和引号
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = value[:idx]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		values[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	return values, nil
+}
+
+// applyValues 将配置项应用到配置结构体，后应用的来源覆盖先应用的来源
+func (c *Config) applyValues(lookup func(key string) (string, bool)) error {
+	if v, ok := lookup("REDIS_HOST"); ok && v != "" {
+		c.Host = v
+	}
+	if v, ok := lookup("REDIS_PORT"); ok && v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_PORT 格式错误: %s", v)
+		}
+		c.Port = port
+	}
+	if v, ok := lookup("REDIS_DB"); ok && v != "" {
+		db, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_DB 格式错误: %s", v)
+		}
+		c.DB = db
+	}
+	if v, ok := lookup("REDIS_USERNAME"); ok && v != "" {
+		c.Username = v
+	}
+	if v, ok := lookup("REDIS_PASSWORD"); ok && v != "" {
+		c.Password = v
+	}
+	if v, ok := lookup("REDIS_PASSWORD_FILE"); ok && v != "" {
+		password, err := readSecretFile(v)
+		if err != nil {
+			return err
+		}
+		c.Password = password
+	}
+	if v, ok := lookup("REDIS_TLS"); ok && v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_TLS 格式错误: %s", v)
+		}
+		c.TLS = enabled
+	}
+	if v, ok := lookup("REDIS_TLS_CA"); ok && v != "" {
+		c.TLSCAFile = v
+	}
+	if v, ok := lookup("REDIS_TLS_SERVER_NAME"); ok && v != "" {
+		c.TLSServerName = v
+	}
+	if v, ok := lookup("REDIS_TLS_INSECURE"); ok && v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_TLS_INSECURE 格式错误: %s", v)
+		}
+		c.TLSInsecure = insecure
+	}
+	if v, ok := lookup("REDIS_EXEC_RATE"); ok && v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("REDIS_EXEC_RATE 格式错误: %s", v)
+		}
+		c.Rate = rate
+	}
+	if v, ok := lookup("REDIS_EXEC_PIPELINE"); ok && v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_EXEC_PIPELINE 格式错误: %s", v)
+		}
+		c.PipelineSize = size
+	}
+	if v, ok := lookup("REDIS_EXEC_TIMEOUT"); ok && v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("REDIS_EXEC_TIMEOUT 格式错误: %s", v)
+		}
+		c.Timeout = timeout
+	}
+	return nil
+}
+
+// readSecretFile 从文件读取密钥，去掉首尾空白
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LoadConfig 按 默认值 → 配置文件 → 环境变量 的顺序加载配置
+func LoadConfig(configFile string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if configFile == "" {
+		configFile = os.Getenv("REDIS_EXEC_CONFIG")
+	}
+	if configFile != "" {
+		values, err := loadConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.applyValues(func(key string) (string, bool) {
+			v, ok := values[key]
+			return v, ok
+		})
+		if err != nil {
+			return nil, fmt.Errorf("配置文件 %s: %v", configFile, err)
+		}
+	}
+
+	if err := cfg.applyValues(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("环境变量: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("未指定 Redis 主机地址")
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("Redis 端口无效: %d", c.Port)
+	}
+	if c.DB < 0 {
+		return fmt.Errorf("Redis DB 无效: %d", c.DB)
+	}
+	if c.PipelineSize <= 0 {
+		return fmt.Errorf("pipeline 大小必须大于 0")
+	}
+	if c.Rate < 0 {
+		return fmt.Errorf("限速值不能为负数")
+	}
+	if c.Username != "" && c.Password == "" {
+		return fmt.Errorf("指定了用户名但没有提供密码")
+	}
+	return nil
+}
+
+// Address 返回 host:port 地址
+func (c *Config) Address() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 预演结果中的变更类型
+const (
+	changeMissing   = "missing"   // 删除不存在的 key，无实际变化
+	changeDelete    = "delete"    // 删除已存在的 key
+	changeOverwrite = "overwrite" // 覆盖已存在的 key
+	changeCreate    = "create"    // 新建原本不存在的 key
+	changeUnchanged = "unchanged" // 写入的值与当前值相同
+)
+
+// keySnapshot key 在 Redis 中的当前状态
+type keySnapshot struct {
+	Exists bool
+	Value  string
+	TTL    int64  // -1 表示永不过期，-2 表示不存在
+	GetErr string // 非字符串类型时 GET 返回的错误
+}
+
+// keyState 按顺序模拟命令后的 key 状态
+type keyState struct {
+	Exists bool
+	Value  string
+}
+
+// KeyDiff 单个 key 的变更
+type KeyDiff struct {
+	Key    string
+	Change string
+	Old    keySnapshot
+	New    keyState
+	Bytes  int
+}
+
+// DryRunReport 预演报告
+type DryRunReport struct {
+	Files       int
+	Lines       int
+	ParseErrors int
+	Unsupported map[string]int // 无法预演的命令类型及数量
+	Diffs       []KeyDiff
+	Counts      map[string]int
+	TotalBytes  int
+}
+
+// DryRunner 只读预演执行器，只向 Redis 发送 EXISTS/GET/TTL
+type DryRunner struct {
+	client  *Client
+	cfg     *Config
+	limiter *rateLimiter
+
+	keys     []string // 按首次出现的顺序记录
+	states   map[string]*keyState
+	touched  map[string]bool
+	snapshot map[string]keySnapshot
+	report   *DryRunReport
+}
+
+// NewDryRunner 创建预演执行器
+func NewDryRunner(client *Client, cfg *Config) *DryRunner {
+	return &DryRunner{
+		client:   client,
+		cfg:      cfg,
+		limiter:  &rateLimiter{rate: cfg.Rate},
+		states:   make(map[string]*keyState),
+		touched:  make(map[string]bool),
+		snapshot: make(map[string]keySnapshot),
+		report: &DryRunReport{
+			Unsupported: make(map[string]int),
+			Counts:      make(map[string]int),
+		},
+	}
+}
+
+// Run 逐个读取命令文件，按 pipeline 大小分批处理，最后对比模拟前后的状态生成变更报告
+// 与执行器一样流式读取，不会把全部命令读入内存，只保留涉及的 key 的当前值和模拟后的值
+func (d *DryRunner) Run(files []string) (*DryRunReport, error) {
+	for _, path := range files {
+		d.report.Files++
+		if err := d.runFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	d.buildDiffs()
+	return d.report, nil
+}
+
+// runFile 流式解析单个命令文件，每 PipelineSize 条命令处理一批
+func (d *DryRunner) runFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
+	scanner.Buffer(buf, 1024*1024)
+
+	batch := make([][]string, 0, d.cfg.PipelineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d.report.Lines++
+
+		args, err := splitArgs(line)
+		if err != nil || len(args) == 0 {
+			d.report.ParseErrors++
+			continue
+		}
+		batch = append(batch, args)
+		if len(batch) >= d.cfg.PipelineSize {
+			if err := d.flush(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取文件时发生错误: %v", err)
+	}
+	if len(batch) > 0 {
+		return d.flush(batch)
+	}
+	return nil
+}
+
+// flush 先查询这批命令中首次出现的 key 的当前状态，再按顺序模拟
+// 之前批次出现过的 key 使用模拟后的状态，结果与一次读入全部命令相同
+func (d *DryRunner) flush(batch [][]string) error {
+	var keys []string
+	for _, args := range batch {
+		for _, key := range commandKeys(args) {
+			if !d.touched[key] {
+				d.touched[key] = true
+				d.keys = append(d.keys, key)
+				keys = append(keys, key)
+			}
+		}
+	}
+	if err := d.fetchSnapshot(keys); err != nil {
+		return err
+	}
+
+	for _, args := range batch {
+		d.apply(args)
+	}
+	return nil
+}
+
+// commandKeys 返回命令涉及的 key，不支持预演的命令返回 nil
+func commandKeys(args []string) []string {
+	switch strings.ToLower(args[0]) {
+	case "del", "unlink":
+		return args[1:]
+	case "set":
+		if len(args) >= 3 {
+			return args[1:2]
+		}
+	}
+	return nil
+}
+
+// fetchSnapshot 以 pipeline 方式查询 key 的 EXISTS/GET/TTL，并以当前值作为模拟的初始状态
+func (d *DryRunner) fetchSnapshot(all []string) error {
+	batchKeys := d.cfg.PipelineSize / 3
+	if batchKeys < 1 {
+		batchKeys = 1
+	}
+
+	for start := 0; start < len(all); start += batchKeys {
+		end := start + batchKeys
+		if end > len(all) {
+			end = len(all)
+		}
+		keys := all[start:end]
+
+		commands := make([][]string, 0, len(keys)*3)
+		for _, key := range keys {
+			commands = append(commands,
+				[]string{"EXISTS", key},
+				[]string{"GET", key},
+				[]string{"TTL", key})
+		}
+
+		d.limiter.Wait(len(commands))
+		replies, err := d.client.Pipeline(commands)
+		if err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			exists, value, ttl := replies[i*3], replies[i*3+1], replies[i*3+2]
+			if exists.IsError() {
+				return fmt.Errorf("查询 %s 失败: %s", key, exists.Str)
+			}
+			snap := keySnapshot{Exists: exists.Int > 0, TTL: ttl.Int}
+			if value.IsError() {
+				snap.GetErr = value.Str
+			} else if !value.Nil {
+				snap.Value = value.Str
+			}
+			d.snapshot[key] = snap
+			d.states[key] = &keyState{Exists: snap.Exists, Value: snap.Value}
+		}
+	}
+	return nil
+}
+
+// apply 在本地模拟一条命令
+func (d *DryRunner) apply(args []string) {
+	verb := strings.ToLower(args[0])
+	switch verb {
+	case "del", "unlink":
+		for _, key := range args[1:] {
+			d.states[key] = &keyState{}
+		}
+		return
+	case "set":
+		if len(args) >= 3 {
+			d.states[args[1]] = &keyState{Exists: true, Value: args[2]}
+			return
+		}
+	}
+	d.report.Unsupported[verb]++
+}
+
+// buildDiffs 对比模拟前后的状态
+func (d *DryRunner) buildDiffs() {
+	for _, key := range d.keys {
+		old := d.snapshot[key]
+		cur := *d.states[key]
+
+		diff := KeyDiff{Key: key, Old: old, New: cur}
+		switch {
+		case !old.Exists && !cur.Exists:
+			diff.Change = changeMissing
+		case old.Exists && !cur.Exists:
+			diff.Change = changeDelete
+			diff.Bytes = len(old.Value)
+		case !old.Exists && cur.Exists:
+			diff.Change = changeCreate
+			diff.Bytes = len(cur.Value)
+		case old.GetErr == "" && old.Value == cur.Value:
+			// SET 相同的值仍会清除 TTL，这里只关心值是否变化
+			diff.Change = changeUnchanged
+		default:
+			diff.Change = changeOverwrite
+			diff.Bytes = len(old.Value) + len(cur.Value)
+		}
+
+		d.report.Counts[diff.Change]++
+		d.report.TotalBytes += diff.Bytes
+		d.report.Diffs = append(d.report.Diffs, diff)
+	}
+}
+
+// WriteCSV 将变更明细写入 CSV 文件
+func (r *DryRunReport) WriteCSV(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建报告文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"key", "change", "old_exists", "old_value", "old_ttl", "new_value", "bytes"})
+	for _, diff := range r.Diffs {
+		oldValue := diff.Old.Value
+		if diff.Old.GetErr != "" {
+			oldValue = "(error) " + diff.Old.GetErr
+		}
+		newValue := ""
+		if diff.New.Exists {
+			newValue = diff.New.Value
+		}
+		writer.Write([]string{
+			diff.Key,
+			diff.Change,
+			strconv.FormatBool(diff.Old.Exists),
+			oldValue,
+			strconv.FormatInt(diff.Old.TTL, 10),
+			newValue,
+			strconv.Itoa(diff.Bytes),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入报告文件失败: %v", err)
+	}
+	return nil
+}
+
+// PrintSummary 打印预演摘要和示例
+func (r *DryRunReport) PrintSummary(samples int) {
+	fmt.Println("================================")
+	fmt.Println("预演结果 (未修改任何数据):")
+	fmt.Printf("处理文件: %d, 命令行数: %d, 解析失败: %d\n", r.Files, r.Lines, r.ParseErrors)
+	fmt.Printf("涉及 key: %d\n", len(r.Diffs))
+	fmt.Printf("  不存在 (删除无影响): %d\n", r.Counts[changeMissing])
+	fmt.Printf("  将被删除: %d\n", r.Counts[changeDelete])
+	fmt.Printf("  将被覆盖: %d\n", r.Counts[changeOverwrite])
+	fmt.Printf("  将被新建: %d\n", r.Counts[changeCreate])
+	fmt.Printf("  值不变: %d\n", r.Counts[changeUnchanged])
+	fmt.Printf("影响字节数: %d\n", r.TotalBytes)
+
+	if len(r.Unsupported) > 0 {
+		verbs := make([]string, 0, len(r.Unsupported))
+		for verb := range r.Unsupported {
+			verbs = append(verbs, verb)
+		}
+		sort.Strings(verbs)
+		fmt.Println("⚠️  以下命令无法预演，未计入结果:")
+		for _, verb := range verbs {
+			fmt.Printf("  %s: %d\n", verb, r.Unsupported[verb])
+		}
+	}
+
+	shown := map[string]int{}
+	for _, diff := range r.Diffs {
+		if diff.Change == changeMissing || diff.Change == changeUnchanged || shown[diff.Change] >= samples {
+			continue
+		}
+		if shown[diff.Change] == 0 {
+			fmt.Printf("\n示例 (%s):\n", diff.Change)
+		}
+		shown[diff.Change]++
+		switch diff.Change {
+		case changeDelete:
+			fmt.Printf("  %s: %s (TTL %d) → (删除)\n", diff.Key, truncateValue(diff.Old.Value), diff.Old.TTL)
+		case changeCreate:
+			fmt.Printf("  %s: (nil) → %s\n", diff.Key, truncateValue(diff.New.Value))
+		case changeOverwrite:
+			fmt.Printf("  %s: %s → %s\n", diff.Key, truncateValue(diff.Old.Value), truncateValue(diff.New.Value))
+		}
+	}
+}
+
+// truncateValue 截断过长的值用于终端显示
+func truncateValue(value string) string {
+	const maxLen = 60
+	if len(value) > maxLen {
+		value = value[:maxLen] + "..."
+	}
+	return strconv.Quote(value)
+}
+
+// dryRun 预演模式入口，返回进程退出码
+func dryRun(cfg *Config, files []string) int {
+	client, err := Dial(cfg)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	startTime := time.Now()
+	report, err := NewDryRunner(client, cfg).Run(files)
+	if err != nil {
+		fmt.Printf("❌ 预演中断: %v\n", err)
+		return 1
+	}
+
+	report.PrintSummary(5)
+
+	reportPath := filepath.Join(cfg.Dir, fmt.Sprintf("redis_exec_dryrun_%s.csv", time.Now().Format("20060102_150405")))
+	if err := report.WriteCSV(reportPath); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("\n变更明细: %s\n", reportPath)
+	fmt.Printf("耗时: %v\n", time.Since(startTime).Round(time.Millisecond))
+	return 0
+}
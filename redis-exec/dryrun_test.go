@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeValue 模拟 Redis 中的一个 key，hash 为 true 时 GET 返回 WRONGTYPE
+type fakeValue struct {
+	value string
+	ttl   int64
+	hash  bool
+}
+
+// fakeRedis 只读的模拟 Redis，支持 EXISTS/GET/TTL，记录收到的命令
+type fakeRedis struct {
+	listener net.Listener
+	data     map[string]fakeValue
+
+	mu       sync.Mutex
+	commands []string
+	batches  int // 收到的 pipeline 批次数，每次读取缓冲区中的全部命令算一批
+}
+
+// startFakeRedis 启动模拟 Redis，测试结束时关闭
+func startFakeRedis(t *testing.T, data map[string]fakeValue) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, data: data}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// serve 处理一个连接上的命令
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		f.mu.Unlock()
+
+		value, ok := f.data[args[1]]
+		switch strings.ToUpper(args[0]) {
+		case "EXISTS":
+			if ok {
+				writer.WriteString(":1\r\n")
+			} else {
+				writer.WriteString(":0\r\n")
+			}
+		case "GET":
+			switch {
+			case !ok:
+				writer.WriteString("$-1\r\n")
+			case value.hash:
+				writer.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+			default:
+				fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(value.value), value.value)
+			}
+		case "TTL":
+			switch {
+			case !ok:
+				writer.WriteString(":-2\r\n")
+			case value.ttl == 0:
+				writer.WriteString(":-1\r\n")
+			default:
+				fmt.Fprintf(writer, ":%d\r\n", value.ttl)
+			}
+		default:
+			writer.WriteString("-ERR unexpected command\r\n")
+		}
+		// 缓冲区中没有后续命令时一批结束
+		if reader.Buffered() == 0 {
+			f.mu.Lock()
+			f.batches++
+			f.mu.Unlock()
+			writer.Flush()
+		}
+	}
+}
+
+// readCommand 读取一条 RESP 数组格式的命令
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+// runDryRun 连接模拟 Redis 预演命令文件，返回报告和 CSV 内容
+func runDryRun(t *testing.T, f *fakeRedis, pipelineSize int, files ...string) (*DryRunReport, [][]string) {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i, content := range files {
+		path := filepath.Join(dir, fmt.Sprintf("redis_commands_part_%04d.txt", i+1))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	cfg := defaultConfig()
+	addr := f.listener.Addr().(*net.TCPAddr)
+	cfg.Host, cfg.Port = addr.IP.String(), addr.Port
+	cfg.PipelineSize = pipelineSize
+	cfg.Timeout = 5 * time.Second
+	client, err := Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	report, err := NewDryRunner(client, cfg).Run(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(dir, "report.csv")
+	if err := report.WriteCSV(csvPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	rows, err := csv.NewReader(data).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report, rows
+}
+
+func TestDryRunDiff(t *testing.T) {
+	f := startFakeRedis(t, map[string]fakeValue{
+		"user:token:{1}": {value: "abc", ttl: 3600},
+		"user:info:{1}":  {value: "alice"},
+		"flow:{2}":       {value: "100"},
+		"same:{3}":       {value: "v"},
+		"hash:{4}":       {hash: true},
+	})
+	report, rows := runDryRun(t, f, 500, `# 注释
+del user:token:{1} user:info:{1}
+del missing:{9}
+set flow:{2} 200
+set same:{3} v
+set new:{5} "hello world"
+del hash:{4}
+hset hash:{4} f v
+set "broken
+`)
+
+	want := [][]string{
+		{"key", "change", "old_exists", "old_value", "old_ttl", "new_value", "bytes"},
+		{"user:token:{1}", "delete", "true", "abc", "3600", "", "3"},
+		{"user:info:{1}", "delete", "true", "alice", "-1", "", "5"},
+		{"missing:{9}", "missing", "false", "", "-2", "", "0"},
+		{"flow:{2}", "overwrite", "true", "100", "-1", "200", "6"},
+		{"same:{3}", "unchanged", "true", "v", "-1", "v", "0"},
+		{"new:{5}", "create", "false", "", "-2", "hello world", "11"},
+		{"hash:{4}", "delete", "true", "(error) WRONGTYPE Operation against a key holding the wrong kind of value", "-1", "", "0"},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("CSV =\n%v\nwant\n%v", rows, want)
+	}
+	if report.Lines != 8 || report.ParseErrors != 1 || report.Unsupported["hset"] != 1 || report.TotalBytes != 25 {
+		t.Errorf("report = %+v", report)
+	}
+
+	// 只发送只读命令
+	for _, cmd := range f.commands {
+		verb, _, _ := strings.Cut(cmd, " ")
+		if verb != "EXISTS" && verb != "GET" && verb != "TTL" {
+			t.Errorf("发送了非只读命令: %s", cmd)
+		}
+	}
+}
+
+// 分批流式处理时，跨批次和跨文件的同一个 key 只查询一次，按命令顺序模拟的结果与一次处理相同
+func TestDryRunStreamsBatches(t *testing.T) {
+	f := startFakeRedis(t, map[string]fakeValue{"a": {value: "1"}, "b": {value: "2"}})
+	report, rows := runDryRun(t, f, 3,
+		"set a 10\ndel b\nset c 3\nset d 4\n",
+		"set b 20\ndel a\nset c 3\ndel d\n")
+
+	changes := map[string]string{}
+	for _, row := range rows[1:] {
+		changes[row[0]] = row[1] + "=" + row[5]
+	}
+	want := map[string]string{"a": "delete=", "b": "overwrite=20", "c": "create=3", "d": "missing="}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	if report.Files != 2 || report.Lines != 8 {
+		t.Errorf("report = %+v", report)
+	}
+
+	// 每个 key 只查询一次 EXISTS/GET/TTL，按批次发送而不是一次发送全部
+	if len(f.commands) != 4*3 {
+		t.Errorf("查询命令数 = %d, want 12: %v", len(f.commands), f.commands)
+	}
+	if f.batches < 3 {
+		t.Errorf("pipeline 批次数 = %d, 应按 pipeline 大小分批查询", f.batches)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// doneSuffix 执行成功的文件会被重命名为 xxx_done.txt，再次运行时跳过
+const doneSuffix = "_done"
+
+// CommandStats 单个命令类型的统计
+type CommandStats struct {
+	Sent    int
+	Failed  int
+	Replies map[string]int // 返回值分布，例如 "(integer) 1" -> 9800
+}
+
+// Stats 执行统计
+type Stats struct {
+	Files       int
+	DoneFiles   int
+	FailedFiles int
+	Lines       int
+	Failed      int
+	Commands    map[string]*CommandStats
+}
+
+// newStats 创建统计对象
+func newStats() *Stats {
+	return &Stats{Commands: make(map[string]*CommandStats)}
+}
+
+// record 记录一条命令的执行结果
+func (s *Stats) record(verb string, reply Reply) {
+	cs, ok := s.Commands[verb]
+	if !ok {
+		cs = &CommandStats{Replies: make(map[string]int)}
+		s.Commands[verb] = cs
+	}
+	cs.Sent++
+	if reply.IsError() {
+		cs.Failed++
+		s.Failed++
+		// 错误信息只保留错误码，避免分布表被具体内容撑爆
+		code, _, _ := strings.Cut(reply.Str, " ")
+		cs.Replies["(error) "+code]++
+		return
+	}
+	cs.Replies[summarizeReply(reply)]++
+}
+
+// summarizeReply 将返回值归类，批量字符串只区分是否为空
+func summarizeReply(reply Reply) string {
+	switch reply.Type {
+	case '$':
+		if reply.Nil {
+			return "(nil)"
+		}
+		return "(bulk string)"
+	case '*':
+		return fmt.Sprintf("(array of %d)", len(reply.Array))
+	default:
+		return reply.String()
+	}
+}
+
+// pendingCommand 等待发送的命令
+type pendingCommand struct {
+	lineNum int
+	raw     string
+	args    []string
+}
+
+// FailureLog 失败命令日志
+// failed 文件只包含原样的失败命令行，可以直接作为输入重新执行；
+// errors 文件记录每条失败命令的来源位置和错误信息
+type FailureLog struct {
+	failedPath string
+	errorsPath string
+	failed     *os.File
+	errors     *os.File
+	count      int
+}
+
+// newFailureLog 创建失败日志（首次写入时才创建文件）
+func newFailureLog(dir string) *FailureLog {
+	timestamp := time.Now().Format("20060102_150405")
+	return &FailureLog{
+		failedPath: filepath.Join(dir, fmt.Sprintf("redis_exec_failed_%s.txt", timestamp)),
+		errorsPath: filepath.Join(dir, fmt.Sprintf("redis_exec_errors_%s.log", timestamp)),
+	}
+}
+
+// Write 记录一条失败命令
+func (fl *FailureLog) Write(file string, lineNum int, raw, reason string) error {
+	if fl.failed == nil {
+		var err error
+		fl.failed, err = os.Create(fl.failedPath)
+		if err != nil {
+			return fmt.Errorf("创建失败日志失败: %v", err)
+		}
+		fl.errors, err = os.Create(fl.errorsPath)
+		if err != nil {
+			return fmt.Errorf("创建错误日志失败: %v", err)
+		}
+	}
+
+	fl.count++
+	if _, err := fl.failed.WriteString(raw + "\n"); err != nil {
+		return fmt.Errorf("写入失败日志失败: %v", err)
+	}
+	_, err := fmt.Fprintf(fl.errors, "%s:%d\t%s\t%s\n", filepath.Base(file), lineNum, reason, raw)
+	if err != nil {
+		return fmt.Errorf("写入错误日志失败: %v", err)
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func (fl *FailureLog) Close() {
+	if fl.failed != nil {
+		fl.failed.Close()
+	}
+	if fl.errors != nil {
+		fl.errors.Close()
+	}
+}
+
+// rateLimiter 按每秒命令数限速
+type rateLimiter struct {
+	rate  float64
+	start time.Time
+	sent  int
+}
+
+// Wait 发送 n 条命令前调用，必要时休眠以保持平均速率
+func (l *rateLimiter) Wait(n int) {
+	if l.rate <= 0 {
+		return
+	}
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	expected := time.Duration(float64(l.sent) / l.rate * float64(time.Second))
+	if delay := expected - time.Since(l.start); delay > 0 {
+		time.Sleep(delay)
+	}
+	l.sent += n
+}
+
+// Executor 命令文件执行器
+type Executor struct {
+	client   *Client
+	cfg      *Config
+	limiter  *rateLimiter
+	stats    *Stats
+	failures *FailureLog
+}
+
+// NewExecutor 创建执行器
+func NewExecutor(client *Client, cfg *Config, failures *FailureLog) *Executor {
+	return &Executor{
+		client:   client,
+		cfg:      cfg,
+		limiter:  &rateLimiter{rate: cfg.Rate},
+		stats:    newStats(),
+		failures: failures,
+	}
+}
+
+// findCommandFiles 查找待执行的命令文件，按文件名排序并跳过已完成的文件
+func findCommandFiles(dir, pattern string) ([]string, int, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, 0, fmt.Errorf("查找命令文件失败: %v", err)
+	}
+
+	var files []string
+	skipped := 0
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		// 跳过执行器自己生成的失败日志，除非指定了重新执行失败日志
+		if strings.HasPrefix(name, "redis_exec_") && !strings.HasPrefix(pattern, "redis_exec_") {
+			continue
+		}
+		if strings.HasSuffix(name, doneSuffix) {
+			skipped++
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, skipped, nil
+}
+
+// markDone 将执行成功的文件重命名为 xxx_done.txt
+func markDone(path string) (string, error) {
+	ext := filepath.Ext(path)
+	donePath := strings.TrimSuffix(path, ext) + doneSuffix + ext
+	if err := os.Rename(path, donePath); err != nil {
+		return "", err
+	}
+	return donePath, nil
+}
+
+// RunFile 执行单个命令文件，返回该文件中失败的命令数
+// 连接级错误会直接返回 error，此时文件不会被标记为完成，可以重新执行
+func (e *Executor) RunFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// 增加缓冲区大小以处理超长的行
+	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
+	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
+
+	failedBefore := e.stats.Failed
+	batch := make([]pendingCommand, 0, e.cfg.PipelineSize)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+
+		// 跳过空行和注释
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e.stats.Lines++
+
+		args, err := splitArgs(line)
+		if err != nil {
+			e.stats.Failed++
+			if err := e.failures.Write(path, lineNum, raw, "解析失败: "+err.Error()); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		batch = append(batch, pendingCommand{lineNum: lineNum, raw: raw, args: args})
+		if len(batch) >= e.cfg.PipelineSize {
+			if err := e.flush(path, batch); err != nil {
+				return 0, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("读取文件时发生错误: %v", err)
+	}
+
+	if len(batch) > 0 {
+		if err := e.flush(path, batch); err != nil {
+			return 0, err
+		}
+	}
+
+	return e.stats.Failed - failedBefore, nil
+}
+
+// flush 以 pipeline 方式发送一批命令并记录结果
+func (e *Executor) flush(path string, batch []pendingCommand) error {
+	e.limiter.Wait(len(batch))
+
+	commands := make([][]string, len(batch))
+	for i, cmd := range batch {
+		commands[i] = cmd.args
+	}
+
+	replies, err := e.client.Pipeline(commands)
+	if err != nil {
+		return err
+	}
+
+	for i, reply := range replies {
+		verb := strings.ToLower(batch[i].args[0])
+		e.stats.record(verb, reply)
+		if reply.IsError() {
+			if err := e.failures.Write(path, batch[i].lineNum, batch[i].raw, reply.Str); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PrintReport 打印执行统计
+func (s *Stats) PrintReport() {
+	fmt.Println("================================")
+	fmt.Println("执行统计:")
+	fmt.Printf("处理文件: %d (完成 %d, 存在失败 %d)\n", s.Files, s.DoneFiles, s.FailedFiles)
+	fmt.Printf("命令行数: %d\n", s.Lines)
+	fmt.Printf("失败命令: %d\n", s.Failed)
+
+	verbs := make([]string, 0, len(s.Commands))
+	for verb := range s.Commands {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+
+	for _, verb := range verbs {
+		cs := s.Commands[verb]
+		fmt.Printf("\n  %s: 发送 %d, 失败 %d\n", verb, cs.Sent, cs.Failed)
+
+		replies := make([]string, 0, len(cs.Replies))
+		for reply := range cs.Replies {
+			replies = append(replies, reply)
+		}
+		sort.Strings(replies)
+		for _, reply := range replies {
+			fmt.Printf("    %-24s %d\n", reply, cs.Replies[reply])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindCommandFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"redis_commands_part_0001.txt",
+		"redis_commands_part_0002_done.txt",
+		"redis_commands_part_0003.txt",
+		"redis_exec_failed_20250101_120000.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("del 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		files   string
+		skipped int
+	}{
+		// 默认模式跳过已完成的文件和执行器自己生成的失败日志
+		{"*.txt", "redis_commands_part_0001.txt,redis_commands_part_0003.txt", 1},
+		// 重新执行失败日志
+		{"redis_exec_failed_*.txt", "redis_exec_failed_20250101_120000.txt", 0},
+	}
+	for _, tt := range tests {
+		files, skipped, err := findCommandFiles(dir, tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = filepath.Base(f)
+		}
+		if got := strings.Join(names, ","); got != tt.files || skipped != tt.skipped {
+			t.Errorf("findCommandFiles(%q) = %s, %d; want %s, %d", tt.pattern, got, skipped, tt.files, tt.skipped)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+module redis-exec
+
+go 1.23.3
+
+require shared v0.0.0
+
+replace shared => ../shared
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shared/pack"
+	"time"
+)
+
+func main() {
+	configFile := flag.String("config", "", "配置文件路径 (KEY=VALUE 格式，也可通过 REDIS_EXEC_CONFIG 指定)")
+	host := flag.String("host", "", "Redis 主机地址 (REDIS_HOST)")
+	port := flag.Int("port", 0, "Redis 端口 (REDIS_PORT，默认 6379)")
+	db := flag.Int("db", -1, "Redis DB (REDIS_DB，默认 0)")
+	username := flag.String("user", "", "Redis ACL 用户名 (REDIS_USERNAME)")
+	passwordFile := flag.String("password-file", "", "从文件读取 Redis 密码 (REDIS_PASSWORD_FILE)")
+	useTLS := flag.Bool("tls", false, "使用 TLS 连接 (REDIS_TLS)")
+	tlsCA := flag.String("tls-ca", "", "TLS CA 证书文件 (REDIS_TLS_CA)")
+	tlsInsecure := flag.Bool("tls-insecure", false, "跳过 TLS 证书校验 (REDIS_TLS_INSECURE)")
+	rate := flag.Float64("rate", -1, "每秒最多发送的命令数，0 表示不限速 (REDIS_EXEC_RATE)")
+	pipeline := flag.Int("pipeline", 0, "每批 pipeline 的命令数 (REDIS_EXEC_PIPELINE，默认 500)")
+	dir := flag.String("dir", "", "命令文件所在目录 (默认当前目录)")
+	pattern := flag.String("pattern", "", "命令文件匹配模式 (默认 redis_commands_part_*.txt)")
+	continueOnError := flag.Bool("continue-on-error", false, "文件存在失败命令时继续执行后续文件")
+	dryRunMode := flag.Bool("dry-run", false, "只读预演: 查询 key 的当前值并输出变更报告，不执行任何写命令")
+	noManifest := flag.Bool("no-manifest", false, "不按命令目录中的 MANIFEST.json 校验命令文件")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "使用方法: %s [选项] [redis_host]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "密码只能通过 REDIS_PASSWORD 环境变量、REDIS_PASSWORD_FILE 或配置文件提供，不接受命令行参数。\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 命令行参数优先级最高
+	if flag.NArg() > 0 {
+		cfg.Host = flag.Arg(0)
+	}
+	if *host != "" {
+		cfg.Host = *host
+	}
+	if *port > 0 {
+		cfg.Port = *port
+	}
+	if *db >= 0 {
+		cfg.DB = *db
+	}
+	if *username != "" {
+		cfg.Username = *username
+	}
+	if *passwordFile != "" {
+		password, err := readSecretFile(*passwordFile)
+		if err != nil {
+			log.Fatalf("加载配置失败: %v", err)
+		}
+		cfg.Password = password
+	}
+	if *useTLS {
+		cfg.TLS = true
+	}
+	if *tlsCA != "" {
+		cfg.TLSCAFile = *tlsCA
+	}
+	if *tlsInsecure {
+		cfg.TLSInsecure = true
+	}
+	if *rate >= 0 {
+		cfg.Rate = *rate
+	}
+	if *pipeline > 0 {
+		cfg.PipelineSize = *pipeline
+	}
+	if *dir != "" {
+		cfg.Dir = *dir
+	}
+	if *pattern != "" {
+		cfg.Pattern = *pattern
+	}
+	cfg.ContinueOnError = *continueOnError
+	cfg.DryRun = *dryRunMode
+	cfg.NoManifest = *noManifest
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	os.Exit(run(cfg))
+}
+
+// run 执行目录中的全部命令文件，返回进程退出码
+func run(cfg *Config) int {
+	files, skipped, err := findCommandFiles(cfg.Dir, cfg.Pattern)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+
+	if cfg.DryRun {
+		fmt.Println("开始预演Redis命令 (只读)...")
+	} else {
+		fmt.Println("开始执行Redis命令导入...")
+	}
+	fmt.Printf("Redis地址: %s (DB %d, TLS %v)\n", cfg.Address(), cfg.DB, cfg.TLS)
+	fmt.Printf("命令目录: %s\n", cfg.Dir)
+	if cfg.Rate > 0 {
+		fmt.Printf("限速: %.0f 条/秒, pipeline: %d\n", cfg.Rate, cfg.PipelineSize)
+	} else {
+		fmt.Printf("限速: 不限, pipeline: %d\n", cfg.PipelineSize)
+	}
+	fmt.Println("================================")
+
+	if skipped > 0 {
+		fmt.Printf("跳过 %d 个已完成的文件 (*%s)\n", skipped, doneSuffix)
+	}
+	if len(files) == 0 {
+		fmt.Printf("没有待执行的文件 (%s)\n", cfg.Pattern)
+		return 0
+	}
+	fmt.Printf("找到 %d 个文件需要处理\n", len(files))
+
+	// 执行或预演之前先校验文件，避免执行被修改或不完整的命令包
+	if cfg.NoManifest {
+		fmt.Printf("⚠️  已跳过 %s 校验\n", pack.ManifestName)
+	} else {
+		manifest, err := verifyManifest(cfg.Dir, files)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		fmt.Printf("✅ %s 校验通过: %s 生成的 %d 个文件\n", pack.ManifestName, manifest.Operation, len(manifest.Files))
+	}
+
+	if cfg.DryRun {
+		return dryRun(cfg, files)
+	}
+
+	client, err := Dial(cfg)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+	defer client.Close()
+
+	failures := newFailureLog(cfg.Dir)
+	defer failures.Close()
+
+	executor := NewExecutor(client, cfg, failures)
+	startTime := time.Now()
+	exitCode := 0
+
+	for _, path := range files {
+		filename := filepath.Base(path)
+		fmt.Printf("正在处理: %s\n", filename)
+		executor.stats.Files++
+
+		failed, err := executor.RunFile(path)
+		if err != nil {
+			// 连接异常时立即停止，文件保持原名以便恢复执行
+			fmt.Printf("  ❌ 执行中断: %v\n", err)
+			executor.stats.FailedFiles++
+			exitCode = 1
+			break
+		}
+
+		if failed > 0 {
+			fmt.Printf("  ❌ %s 有 %d 条命令失败，已记录到 %s\n", filename, failed, failures.failedPath)
+			executor.stats.FailedFiles++
+			exitCode = 1
+			if !cfg.ContinueOnError {
+				fmt.Println("停止执行剩余文件 (使用 -continue-on-error 继续执行)")
+				break
+			}
+			continue
+		}
+
+		donePath, err := markDone(path)
+		if err != nil {
+			fmt.Printf("  ⚠️  文件重命名失败: %v\n", err)
+		} else {
+			fmt.Printf("  ✅ 成功导入，已重命名为: %s\n", filepath.Base(donePath))
+		}
+		executor.stats.DoneFiles++
+	}
+
+	executor.stats.PrintReport()
+	fmt.Printf("\n耗时: %v\n", time.Since(startTime).Round(time.Millisecond))
+
+	if failures.count > 0 {
+		fmt.Printf("失败命令原文: %s\n", failures.failedPath)
+		fmt.Printf("失败原因明细: %s\n", failures.errorsPath)
+	}
+
+	if exitCode == 0 {
+		fmt.Println("🎉 所有文件都已成功导入Redis!")
+	}
+	return exitCode
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reply RESP 协议返回值
+type Reply struct {
+	Type  byte // '+' 简单字符串, '-' 错误, ':' 整数, '$' 批量字符串, '*' 数组
+	Str   string
+	Int   int64
+	Array []Reply
+	Nil   bool
+}
+
+// IsError 是否为错误返回
+func (r Reply) IsError() bool {
+	return r.Type == '-'
+}
+
+// String 以 redis-cli 风格格式化返回值
+func (r Reply) String() string {
+	switch r.Type {
+	case '+':
+		return r.Str
+	case '-':
+		return "(error) " + r.Str
+	case ':':
+		return fmt.Sprintf("(integer) %d", r.Int)
+	case '$':
+		if r.Nil {
+			return "(nil)"
+		}
+		return strconv.Quote(r.Str)
+	case '*':
+		if r.Nil {
+			return "(nil)"
+		}
+		parts := make([]string, len(r.Array))
+		for i, item := range r.Array {
+			parts[i] = item.String()
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return "(unknown)"
+	}
+}
+
+// Client 基于 RESP 协议的最小 Redis 客户端
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	timeout time.Duration
+}
+
+// Dial 连接 Redis，完成认证和选库
+func Dial(cfg *Config) (*Client, error) {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		tlsConfig, tlsErr := buildTLSConfig(cfg)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Address(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Address())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %v", err)
+	}
+
+	client := &Client{
+		conn:    conn,
+		reader:  bufio.NewReaderSize(conn, 64*1024),
+		writer:  bufio.NewWriterSize(conn, 64*1024),
+		timeout: cfg.Timeout,
+	}
+
+	if cfg.Password != "" {
+		args := []string{"AUTH", cfg.Password}
+		if cfg.Username != "" {
+			args = []string{"AUTH", cfg.Username, cfg.Password}
+		}
+		reply, err := client.Do(args...)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("认证失败: %v", err)
+		}
+		if reply.IsError() {
+			client.Close()
+			return nil, fmt.Errorf("认证失败: %s", reply.Str)
+		}
+	}
+
+	if cfg.DB != 0 {
+		reply, err := client.Do("SELECT", strconv.Itoa(cfg.DB))
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("切换 DB 失败: %v", err)
+		}
+		if reply.IsError() {
+			client.Close()
+			return nil, fmt.Errorf("切换 DB 失败: %s", reply.Str)
+		}
+	}
+
+	return client, nil
+}
+
+// buildTLSConfig 构建 TLS 配置
+func buildTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	if cfg.TLSCAFile != "" {
+		caData, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("解析 CA 证书失败: %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do 执行单条命令
+func (c *Client) Do(args ...string) (Reply, error) {
+	replies, err := c.Pipeline([][]string{args})
+	if err != nil {
+		return Reply{}, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline 批量发送命令并按顺序读取全部返回值
+func (c *Client) Pipeline(commands [][]string) ([]Reply, error) {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	for _, args := range commands {
+		if err := c.writeCommand(args); err != nil {
+			return nil, fmt.Errorf("发送命令失败: %v", err)
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, fmt.Errorf("发送命令失败: %v", err)
+	}
+
+	replies := make([]Reply, 0, len(commands))
+	for range commands {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, fmt.Errorf("读取返回值失败: %v", err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// writeCommand 按 RESP 数组格式写入命令
+func (c *Client) writeCommand(args []string) error {
+	if _, err := fmt.Fprintf(c.writer, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLine 读取一行并去掉结尾的 \r\n
+func (c *Client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("协议格式错误: %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readReply 读取一个完整的返回值
+func (c *Client) readReply() (Reply, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return Reply{}, err
+	}
+	if line == "" {
+		return Reply{}, fmt.Errorf("协议格式错误: 空行")
+	}
+
+	reply := Reply{Type: line[0]}
+	payload := line[1:]
+
+	switch reply.Type {
+	case '+', '-':
+		reply.Str = payload
+	case ':':
+		reply.Int, err = strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return Reply{}, fmt.Errorf("整数格式错误: %q", payload)
+		}
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return Reply{}, fmt.Errorf("长度格式错误: %q", payload)
+		}
+		if size < 0 {
+			reply.Nil = true
+			return reply, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return Reply{}, err
+		}
+		reply.Str = string(buf[:size])
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return Reply{}, fmt.Errorf("数组长度格式错误: %q", payload)
+		}
+		if count < 0 {
+			reply.Nil = true
+			return reply, nil
+		}
+		reply.Array = make([]Reply, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := c.readReply()
+			if err != nil {
+				return Reply{}, err
+			}
+			reply.Array = append(reply.Array, item)
+		}
+	default:
+		return Reply{}, fmt.Errorf("未知的返回类型: %q", reply.Type)
+	}
+
+	return reply, nil
+}
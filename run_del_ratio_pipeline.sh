@@ -50,9 +50,10 @@ else
     exit 1
 fi
 
-# 步骤5：压缩multi-redis-split文件夹
+# 步骤5：压缩multi-redis-split文件夹，并生成执行脚本校验用的 MANIFEST.json
 echo "步骤5：压缩multi-redis-split文件夹"
-zip -r multi-redis-split.zip multi-redis-split/
+rm -f multi-redis-split.zip
+go run main.go 6 -dir multi-redis-split -out multi-redis-split.zip
 if [ $? -eq 0 ]; then
     echo "✓ 步骤5完成：成功压缩multi-redis-split文件夹为multi-redis-split.zip"
 else
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HashFile 计算文件的 sha256
+func HashFile(path string) (Artifact, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return Artifact{Name: filepath.Base(path), SHA256: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
+
+// HashFiles 计算多个文件的 sha256
+func HashFiles(paths []string) ([]Artifact, error) {
+	artifacts := make([]Artifact, 0, len(paths))
+	for _, path := range paths {
+		artifact, err := HashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// affectedIDPatterns 从生成的脚本中识别用户ID：
+// Redis key 中的哈希标签 {uid}、SQL 中的 user_id = uid 和 b_user 表的 WHERE id = uid
+var affectedIDPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\{(\d+)\}`),
+	regexp.MustCompile(`(?i)\buser_id\s*=\s*'?(\d+)`),
+	regexp.MustCompile(`(?i)\bupdate\s+b_user\b.*\bwhere\s+id\s*=\s*'?(\d+)`),
+}
+
+// LineAffectedIDs 返回一行 SQL 或 Redis 命令中的用户ID，可能有重复
+func LineAffectedIDs(line string) []string {
+	var ids []string
+	for _, re := range affectedIDPatterns {
+		for _, m := range re.FindAllStringSubmatch(line, -1) {
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
+}
+
+// ExtractAffectedIDs 从输出的 SQL 和 Redis 命令文件（包括 zip 中的文件）中提取受影响的用户ID，去重后排序
+func ExtractAffectedIDs(paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		var err error
+		if strings.EqualFold(filepath.Ext(path), ".zip") {
+			err = extractZip(path, seen)
+		} else {
+			err = extractFile(path, seen)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// extractZip 读取 zip 中的每个脚本文件
+func extractZip(path string, seen map[string]bool) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("打开压缩包失败: %v", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isScript(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("读取压缩包文件 %s 失败: %v", f.Name, err)
+		}
+		err = extract(rc, seen)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile 读取单个脚本文件
+func extractFile(path string, seen map[string]bool) error {
+	if !isScript(path) {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	return extract(file, seen)
+}
+
+// isScript 只从 SQL 和 Redis 命令文件中提取
+func isScript(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".sql" || ext == ".txt"
+}
+
+// extract 逐行匹配用户ID
+func extract(r io.Reader, seen map[string]bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		for _, id := range LineAffectedIDs(scanner.Text()) {
+			seen[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package audit 记录生成脚本、审批等关键操作的审计日志
+//
+// 每条记录一行 JSON，只追加不修改。记录之间按 sha256 链接：每条记录的 Hash 覆盖记录内容和上一条记录的 Hash，
+// 修改或删除任意一条记录都会导致之后的校验失败，Verify 可以找出第一条被篡改的记录。
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 审计动作
+const (
+	ActionGenerate = "generate"
+	ActionSubmit   = "submit"
+	ActionApprove  = "approve"
+	ActionReject   = "reject"
+	ActionDownload = "download"
+)
+
+// Artifact 输入或输出文件
+type Artifact struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Event 审计事件
+type Event struct {
+	Seq         int64             `json:"seq"`
+	Time        time.Time         `json:"time"`
+	Source      string            `json:"source"`                 // web 或 telegram
+	Actor       string            `json:"actor"`                  // 操作人：web 用户名或 Telegram 用户ID
+	ActorName   string            `json:"actor_name,omitempty"`   // 操作人显示名称
+	Action      string            `json:"action"`                 // 动作
+	Target      string            `json:"target"`                 // 操作对象，如任务ID或审批ID
+	Command     string            `json:"command,omitempty"`      // 功能类型
+	Detail      string            `json:"detail,omitempty"`       // 备注，如拒绝原因
+	Params      map[string]string `json:"params,omitempty"`       // 处理参数
+	Input       *Artifact         `json:"input,omitempty"`        // 输入文件
+	Outputs     []Artifact        `json:"outputs,omitempty"`      // 输出文件
+	AffectedIDs []string          `json:"affected_ids,omitempty"` // 受影响的用户ID
+	PrevHash    string            `json:"prev_hash"`
+	Hash        string            `json:"hash"`
+}
+
+// computeHash 计算记录的 Hash：对清空 Hash 字段后的 JSON 取 sha256，JSON 中包含 PrevHash
+func (e Event) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("序列化审计事件失败: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log 审计日志文件
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	lastSeq  int64
+	lastHash string
+}
+
+// Open 打开（或创建）审计日志文件，读取最后一条记录以继续哈希链
+func Open(path string) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建审计日志目录失败: %v", err)
+		}
+	}
+
+	l := &Log{path: path}
+	err := scan(path, func(e *Event) error {
+		l.lastSeq = e.Seq
+		l.lastHash = e.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	l.file = file
+	return l, nil
+}
+
+// Record 追加一条审计事件并落盘，Time 为空时使用当前时间，Seq 和 Hash 由日志填充
+func (l *Log) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Seq = l.lastSeq + 1
+	event.PrevHash = l.lastHash
+	hash, err := event.computeHash()
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化审计事件失败: %v", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %v", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("写入审计日志失败: %v", err)
+	}
+	l.lastSeq = event.Seq
+	l.lastHash = event.Hash
+	return nil
+}
+
+// Filter 查询条件，零值的条件不参与过滤
+type Filter struct {
+	AffectedID string    // 受影响的用户ID
+	Date       time.Time // 记录日期（按本地时区的自然日）
+	Actor      string    // 操作人
+	Limit      int       // 最多返回的条数，返回最新的记录
+}
+
+// match 判断事件是否满足查询条件
+func (f Filter) match(e *Event) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if !f.Date.IsZero() {
+		y1, m1, d1 := f.Date.Date()
+		y2, m2, d2 := e.Time.In(f.Date.Location()).Date()
+		if y1 != y2 || m1 != m2 || d1 != d2 {
+			return false
+		}
+	}
+	if f.AffectedID != "" {
+		found := false
+		for _, id := range e.AffectedIDs {
+			if id == f.AffectedID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Query 按条件查询审计事件，按时间顺序返回
+func (l *Log) Query(filter Filter) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []Event
+	err := scan(l.path, func(e *Event) error {
+		if filter.match(e) {
+			result = append(result, *e)
+			if filter.Limit > 0 && len(result) > filter.Limit {
+				result = result[1:]
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ErrTampered 审计日志被篡改
+var ErrTampered = errors.New("审计日志校验失败")
+
+// Verify 校验整个哈希链，返回校验通过的记录数；发现篡改时返回 ErrTampered 及第一条异常记录的位置
+func (l *Log) Verify() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var count int64
+	prevHash := ""
+	err := scan(l.path, func(e *Event) error {
+		if e.Seq != count+1 {
+			return fmt.Errorf("%w: 第 %d 条记录的序号为 %d，记录可能被删除或插入", ErrTampered, count+1, e.Seq)
+		}
+		if e.PrevHash != prevHash {
+			return fmt.Errorf("%w: 第 %d 条记录与上一条记录的哈希不连续", ErrTampered, e.Seq)
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return fmt.Errorf("%w: 第 %d 条记录的内容被修改", ErrTampered, e.Seq)
+		}
+		count++
+		prevHash = e.Hash
+		return nil
+	})
+	return count, err
+}
+
+// scan 按顺序读取审计日志，文件不存在时视为空
+func scan(path string, fn func(e *Event) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	line := 0
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			var e Event
+			if jsonErr := json.Unmarshal(data, &e); jsonErr != nil {
+				return fmt.Errorf("%w: 第 %d 行无法解析: %v", ErrTampered, line, jsonErr)
+			}
+			if fnErr := fn(&e); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取审计日志失败: %v", err)
+		}
+	}
+}
+
+// Close 关闭审计日志
+func (l *Log) Close() error {
+	return l.file.Close()
+}
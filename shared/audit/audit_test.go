@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeLog 写入 n 条记录，每条记录重新打开一次日志，返回日志文件路径
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < n; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = l.Record(Event{
+			Source:      "web",
+			Actor:       "alice",
+			Action:      ActionGenerate,
+			Target:      "task_" + strconv.Itoa(i+1),
+			AffectedIDs: []string{"1001", "1002"},
+		})
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// verifyFile 校验日志文件
+func verifyFile(t *testing.T, path string) (int64, error) {
+	t.Helper()
+	l, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Verify()
+}
+
+// editLines 按行修改日志文件
+func editLines(t *testing.T, path string, edit func(lines []string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	lines = edit(lines[:len(lines)-1])
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	path := writeLog(t, 4)
+	count, err := verifyFile(t, path)
+	if err != nil || count != 4 {
+		t.Fatalf("Verify = %d, %v", count, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := map[string]struct {
+		edit func(lines []string) []string
+		want string
+	}{
+		"修改": {
+			edit: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"1002"`, `"1003"`, 1)
+				return lines
+			},
+			want: "第 2 条记录的内容被修改",
+		},
+		"删除": {
+			edit: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			want: "第 2 条记录的序号为 3",
+		},
+		"调换顺序": {
+			edit: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			want: "第 2 条记录的序号为 3",
+		},
+		"重新编号后删除": {
+			// 删除记录后修改之后记录的序号，哈希链仍然断开
+			edit: func(lines []string) []string {
+				lines = append(lines[:1], lines[2:]...)
+				for i := 1; i < len(lines); i++ {
+					lines[i] = strings.Replace(lines[i], `"seq":`+strconv.Itoa(i+2), `"seq":`+strconv.Itoa(i+1), 1)
+				}
+				return lines
+			},
+			want: "第 2 条记录与上一条记录的哈希不连续",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeLog(t, 4)
+			editLines(t, path, tt.edit)
+			count, err := verifyFile(t, path)
+			if !errors.Is(err, ErrTampered) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Verify = %d, %v; want %s", count, err, tt.want)
+			}
+			if count != 1 {
+				t.Errorf("校验通过的记录数 = %d, want 1", count)
+			}
+		})
+	}
+}
+
+func TestRecordContinuesChainAfterReopen(t *testing.T) {
+	path := writeLog(t, 2)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Record(Event{Actor: "bob", Action: ActionApprove, Target: "task_1"}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := l.Query(Filter{Actor: "bob"})
+	if err != nil || len(events) != 1 || events[0].Seq != 3 {
+		t.Fatalf("Query = %+v, %v", events, err)
+	}
+	if count, err := l.Verify(); err != nil || count != 3 {
+		t.Errorf("Verify = %d, %v", count, err)
+	}
+}
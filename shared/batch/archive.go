@@ -0,0 +1,125 @@
+package batch
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MaxFiles 一个批次最多包含的文件数
+const MaxFiles = 100
+
+// IsZip 检查文件是否为 zip 压缩包
+func IsZip(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// Extract 解压批量任务的压缩包到 dir，按包内顺序返回文件列表
+// 跳过目录、隐藏文件和 macOS 生成的 __MACOSX 目录；解压后的总大小不能超过 maxSize，防止压缩炸弹
+func Extract(zipPath, dir string, maxSize int64) ([]File, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包失败: %v", err)
+	}
+	defer zr.Close()
+
+	var entries []*zip.File
+	for _, f := range zr.File {
+		name := path.Clean(strings.ReplaceAll(f.Name, "\\", "/"))
+		base := path.Base(name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		entries = append(entries, f)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("压缩包中没有文件")
+	}
+	if len(entries) > MaxFiles {
+		return nil, fmt.Errorf("压缩包中有 %d 个文件，最多支持 %d 个", len(entries), MaxFiles)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建解压目录失败: %v", err)
+	}
+	remaining := maxSize
+	files := make([]File, 0, len(entries))
+	for i, f := range entries {
+		name := path.Clean(strings.ReplaceAll(f.Name, "\\", "/"))
+		// 包内路径只用于显示，本地文件名加序号，避免不同目录下的同名文件互相覆盖和路径穿越
+		local := filepath.Join(dir, fmt.Sprintf("%03d_%s", i+1, path.Base(name)))
+		written, err := extractFile(f, local, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= written
+		files = append(files, File{Name: name, Path: local})
+	}
+	return files, nil
+}
+
+// extractFile 解压单个文件，最多写入 limit 字节
+func extractFile(f *zip.File, local string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("读取压缩包文件 %s 失败: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(local)
+	if err != nil {
+		return 0, fmt.Errorf("创建文件 %s 失败: %v", f.Name, err)
+	}
+	defer out.Close()
+
+	written, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return 0, fmt.Errorf("解压文件 %s 失败: %v", f.Name, err)
+	}
+	if written > limit {
+		return 0, fmt.Errorf("压缩包解压后超过大小上限")
+	}
+	return written, nil
+}
+
+// Pack 将多个上传的文件打包为一个 zip，作为批量任务的输入文件保存
+func Pack(zipPath string, files []File) error {
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("创建压缩包失败: %v", err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range files {
+		if err := addFile(zw, f); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	return nil
+}
+
+// addFile 将文件写入压缩包
+func addFile(zw *zip.Writer, f File) error {
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("打开文件 %s 失败: %v", f.Name, err)
+	}
+	defer src.Close()
+
+	w, err := zw.Create(f.Name)
+	if err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("压缩文件 %s 失败: %v", f.Name, err)
+	}
+	return nil
+}
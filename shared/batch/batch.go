@@ -0,0 +1,306 @@
+// Package batch 合并一个任务中上传的多个输入文件：统一校验、跨文件按ID去重，并统计每个文件的情况
+package batch
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HeaderMode 输入文件第一行的处理方式
+type HeaderMode int
+
+const (
+	NoHeader   HeaderMode = iota // 没有表头，所有行都是数据
+	Header                       // 第一行是表头，各文件的表头必须一致（只比较写入合并文件的列）
+	AutoHeader                   // 第一行的ID不是数字时视为表头
+)
+
+// Spec 一个功能的批量合并规则
+type Spec struct {
+	Extensions     []string // 允许的文件扩展名（小写，带点）
+	Header         HeaderMode
+	KeyColumns     []int // 组成ID的列，为空时整行作为ID
+	MinColumns     int   // 数据行至少需要的列数，不足的行视为无效
+	Columns        int   // 写入合并文件的列数，多余的列丢弃、不足的补空，保证各文件合并后列数一致；为 0 时原样写入
+	KeepDuplicates bool  // 保留重复的行，由处理逻辑自行统计出现次数，只统计不去重
+}
+
+// Accepts 检查文件扩展名是否允许
+func (s Spec) Accepts(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range s.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// File 批量任务中的一个输入文件
+type File struct {
+	Name string // 显示名称，压缩包中的文件为包内路径
+	Path string // 本地路径
+}
+
+// ReadFunc 读取文件的所有行，由调用方按扩展名读取 CSV 或 Excel
+type ReadFunc func(path string) ([][]string, error)
+
+// maxConflictExamples 报告中最多列出的冲突示例数
+const maxConflictExamples = 10
+
+// FileStats 单个文件的统计
+type FileStats struct {
+	Name            string `json:"name"`
+	Rows            int    `json:"rows"`             // 数据行，不含表头和空行
+	Written         int    `json:"written"`          // 写入合并文件的行
+	Invalid         int    `json:"invalid"`          // 列数不足或ID为空的行
+	Duplicates      int    `json:"duplicates"`       // 与同一文件中之前的行ID重复
+	CrossDuplicates int    `json:"cross_duplicates"` // 与之前文件中的行ID重复
+	Conflicts       int    `json:"conflicts"`        // ID重复但其他列不同，保留最先出现的一行
+}
+
+// add 累加到合计
+func (f *FileStats) add(o FileStats) {
+	f.Rows += o.Rows
+	f.Written += o.Written
+	f.Invalid += o.Invalid
+	f.Duplicates += o.Duplicates
+	f.CrossDuplicates += o.CrossDuplicates
+	f.Conflicts += o.Conflicts
+}
+
+// Report 批量合并的结果
+type Report struct {
+	Files     []FileStats `json:"files"`
+	Total     FileStats   `json:"total"`
+	Conflicts []string    `json:"conflicts,omitempty"` // 冲突示例
+}
+
+// seenRow 已写入的行：所在文件和内容的哈希，用于判断重复的行内容是否一致
+type seenRow struct {
+	file int
+	line int
+	hash uint64
+}
+
+// Merge 按规则读取所有文件并写入一个合并的 CSV 文件，返回每个文件的统计
+// 任一文件格式不支持、无法读取或表头不一致时整个批次失败；progress 在开始读取每个文件前调用
+func Merge(ctx context.Context, spec Spec, files []File, read ReadFunc, output string, progress func(index int, name string)) (*Report, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("批量任务中没有可处理的文件")
+	}
+	// 先检查所有文件的格式，避免处理到一半才失败
+	for _, f := range files {
+		if !spec.Accepts(f.Name) {
+			return nil, fmt.Errorf("文件 %s 格式不支持，只支持 %s", f.Name, strings.Join(spec.Extensions, "/"))
+		}
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, fmt.Errorf("创建合并文件失败: %v", err)
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+
+	report := &Report{}
+	seen := make(map[string]seenRow)
+	var header []string
+	headerFrom := ""
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(i, f.Name)
+		}
+		rows, err := read(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件 %s 失败: %v", f.Name, err)
+		}
+
+		stats := FileStats{Name: f.Name}
+		first := true
+		for n, row := range rows {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			row = trimRow(row)
+			if isEmpty(row) {
+				continue
+			}
+			isFirst := first
+			first = false
+			if isFirst && spec.isHeader(row) {
+				if spec.Header == Header && header != nil && !sameRow(spec.normalize(header), spec.normalize(row)) {
+					return nil, fmt.Errorf("文件 %s 的表头与 %s 不一致", f.Name, headerFrom)
+				}
+				if header == nil {
+					header, headerFrom = row, f.Name
+					// 合并文件只保留一个表头，AutoHeader 时之前文件的数据已经写入，表头不能再放在第一行
+					if spec.Header == Header || i == 0 {
+						if err := w.Write(spec.normalize(row)); err != nil {
+							return nil, fmt.Errorf("写入合并文件失败: %v", err)
+						}
+					}
+				}
+				continue
+			}
+
+			stats.Rows++
+			key, ok := spec.key(row)
+			if !ok {
+				stats.Invalid++
+				continue
+			}
+			row = spec.normalize(row)
+			hash := hashRow(row)
+			if prev, dup := seen[key]; dup {
+				if prev.file == i {
+					stats.Duplicates++
+				} else {
+					stats.CrossDuplicates++
+				}
+				if prev.hash != hash {
+					stats.Conflicts++
+					if len(report.Conflicts) < maxConflictExamples {
+						report.Conflicts = append(report.Conflicts, fmt.Sprintf("ID %s: %s 第 %d 行与 %s 第 %d 行内容不同",
+							strings.ReplaceAll(key, "\x00", "/"), f.Name, n+1, files[prev.file].Name, prev.line))
+					}
+				}
+				if !spec.KeepDuplicates {
+					continue
+				}
+			} else {
+				seen[key] = seenRow{file: i, line: n + 1, hash: hash}
+			}
+
+			if err := w.Write(row); err != nil {
+				return nil, fmt.Errorf("写入合并文件失败: %v", err)
+			}
+			stats.Written++
+		}
+		report.Files = append(report.Files, stats)
+		report.Total.add(stats)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("写入合并文件失败: %v", err)
+	}
+	if report.Total.Written == 0 {
+		return nil, fmt.Errorf("所有文件中都没有有效数据")
+	}
+	report.Total.Name = "合计"
+	return report, nil
+}
+
+// isHeader 判断文件的第一行是否为表头
+func (s Spec) isHeader(row []string) bool {
+	switch s.Header {
+	case Header:
+		return true
+	case AutoHeader:
+		key, ok := s.key(row)
+		return ok && !isNumeric(strings.Split(key, "\x00")[0])
+	default:
+		return false
+	}
+}
+
+// key 返回行的ID，列数不足或ID为空时返回 false
+func (s Spec) key(row []string) (string, bool) {
+	if len(row) < s.MinColumns {
+		return "", false
+	}
+	if len(s.KeyColumns) == 0 {
+		return strings.Join(trimTrailing(row), ","), true
+	}
+	parts := make([]string, len(s.KeyColumns))
+	for i, col := range s.KeyColumns {
+		if col >= len(row) || row[col] == "" {
+			return "", false
+		}
+		parts[i] = row[col]
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// normalize 按 Columns 调整列数
+func (s Spec) normalize(row []string) []string {
+	if s.Columns == 0 || len(row) == s.Columns {
+		return row
+	}
+	normalized := make([]string, s.Columns)
+	copy(normalized, row)
+	return normalized
+}
+
+// trimRow 去掉每列两端的空白
+func trimRow(row []string) []string {
+	trimmed := make([]string, len(row))
+	for i, cell := range row {
+		trimmed[i] = strings.TrimSpace(cell)
+	}
+	return trimmed
+}
+
+// isEmpty 检查是否为空行
+func isEmpty(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRow 比较两个表头，忽略大小写和末尾的空列
+func sameRow(a, b []string) bool {
+	a, b = trimTrailing(a), trimTrailing(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimTrailing 去掉末尾的空列
+func trimTrailing(row []string) []string {
+	for len(row) > 0 && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+// hashRow 计算行内容的哈希，只保存哈希以减少大批次的内存占用
+func hashRow(row []string) uint64 {
+	h := fnv.New64a()
+	for _, cell := range trimTrailing(row) {
+		h.Write([]byte(cell))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// isNumeric 检查字符串是否全部为数字
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reportHeader 统计报告 CSV 的表头
+var reportHeader = []string{"文件", "数据行", "写入", "无效", "文件内重复", "跨文件重复", "内容冲突"}
+
+// Summary 返回一行总结，用于结果消息
+func (r *Report) Summary() string {
+	return fmt.Sprintf("📦 合并 %d 个文件: %d 行数据，写入 %d 行（跨文件重复 %d，文件内重复 %d，冲突 %d，无效 %d）",
+		len(r.Files), r.Total.Rows, r.Total.Written, r.Total.CrossDuplicates, r.Total.Duplicates, r.Total.Conflicts, r.Total.Invalid)
+}
+
+// Text 返回每个文件的统计和冲突示例
+func (r *Report) Text() string {
+	var sb strings.Builder
+	sb.WriteString(r.Summary() + "\n")
+	for i, f := range r.Files {
+		sb.WriteString(fmt.Sprintf("\n%d. %s: %d 行，写入 %d", i+1, f.Name, f.Rows, f.Written))
+		if f.CrossDuplicates > 0 {
+			sb.WriteString(fmt.Sprintf("，跨文件重复 %d", f.CrossDuplicates))
+		}
+		if f.Duplicates > 0 {
+			sb.WriteString(fmt.Sprintf("，文件内重复 %d", f.Duplicates))
+		}
+		if f.Conflicts > 0 {
+			sb.WriteString(fmt.Sprintf("，⚠️ 冲突 %d", f.Conflicts))
+		}
+		if f.Invalid > 0 {
+			sb.WriteString(fmt.Sprintf("，无效 %d", f.Invalid))
+		}
+	}
+	if len(r.Conflicts) > 0 {
+		sb.WriteString("\n\n⚠️ ID相同但内容不同的行，保留最先出现的一行:\n")
+		sb.WriteString(strings.Join(r.Conflicts, "\n"))
+		if r.Total.Conflicts > len(r.Conflicts) {
+			sb.WriteString(fmt.Sprintf("\n另有 %d 个冲突未列出", r.Total.Conflicts-len(r.Conflicts)))
+		}
+	}
+	return sb.String()
+}
+
+// WriteCSV 将每个文件的统计和合计写入 CSV 报告
+func (r *Report) WriteCSV(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建批量报告失败: %v", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write(reportHeader)
+	for _, f := range r.Files {
+		w.Write(statsRow(f))
+	}
+	w.Write(statsRow(r.Total))
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("写入批量报告失败: %v", err)
+	}
+	return nil
+}
+
+// statsRow 单个文件统计的 CSV 行
+func statsRow(f FileStats) []string {
+	return []string{f.Name, strconv.Itoa(f.Rows), strconv.Itoa(f.Written), strconv.Itoa(f.Invalid),
+		strconv.Itoa(f.Duplicates), strconv.Itoa(f.CrossDuplicates), strconv.Itoa(f.Conflicts)}
+}
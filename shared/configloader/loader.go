@@ -0,0 +1,463 @@
+// Package configloader 分层加载配置：默认值 → 配置文件 (YAML/TOML) → 环境变量 → 命令行参数
+//
+// 配置结构体通过字段标签声明每一层的名称：
+//
+//	type Config struct {
+//		BotToken string        `config:"bot_token" env:"BOT_TOKEN" secret:"true" required:"true" usage:"Telegram Bot Token"`
+//		Timeout  time.Duration `config:"timeout" env:"TIMEOUT" usage:"处理超时"`
+//		Log      LogConfig     `config:"log"`
+//	}
+//
+// config 为配置文件中的 key（嵌套结构体用 . 连接，如 log.level），命令行参数名为 key 中的 _ 和 . 替换为 - 后的结果，
+// 布尔字段的参数可以只写参数名（--approval），也可以写 --approval=false；
+// env 为环境变量名，secret 字段还可以通过 <env>_FILE 指定的文件读取，打印配置时会被隐藏。
+package configloader
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置来源
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Validator 配置结构体实现该接口时，加载完成后调用 Validate 校验并计算派生字段
+type Validator interface {
+	Validate() error
+}
+
+// Options 加载选项
+type Options struct {
+	Args          []string // 命令行参数，不含程序名
+	FileEnv       string   // 指定配置文件路径的环境变量，如 TGBOT_CONFIG
+	DefaultFiles  []string // 未指定配置文件时依次尝试的路径，不存在时跳过
+	ExtraFlags    func(fs *flag.FlagSet)
+	ProgramName   string
+	ErrorHandling flag.ErrorHandling
+}
+
+// Result 加载结果
+type Result struct {
+	File        string            // 使用的配置文件，未使用时为空
+	PrintConfig bool              // 是否指定了 --print-config
+	Sources     map[string]string // 每个配置项最终生效的来源
+}
+
+// field 配置结构体中的一个叶子字段
+type field struct {
+	key      string
+	env      string
+	flagName string
+	usage    string
+	secret   bool
+	required bool
+	value    reflect.Value
+}
+
+// Load 按顺序加载配置到 cfg（必须是结构体指针），cfg 中已有的值作为默认值
+// 返回错误时 Result 仍然有效，调用方可以在 --print-config 时打印已加载的配置帮助排查
+func Load(cfg interface{}, opts Options) (*Result, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("配置必须是结构体指针")
+	}
+
+	fields, err := collectFields(rv.Elem(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Sources: make(map[string]string)}
+	for _, f := range fields {
+		result.Sources[f.key] = SourceDefault
+	}
+
+	// 先解析命令行参数，得到配置文件路径，命令行的值最后再应用
+	name := opts.ProgramName
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	fs := flag.NewFlagSet(name, opts.ErrorHandling)
+	configFile := fs.String("config", "", "配置文件路径 (YAML/TOML)")
+	printConfig := fs.Bool("print-config", false, "打印最终生效的配置（隐藏密钥）后退出")
+	flagValues := make(map[string]func() string)
+	for _, f := range fields {
+		if f.value.Kind() == reflect.Bool {
+			// 布尔参数可以只写 --cookie-secure，也可以写 --cookie-secure=false
+			b := fs.Bool(f.flagName, f.value.Bool(), f.usageText())
+			flagValues[f.flagName] = func() string { return strconv.FormatBool(*b) }
+			continue
+		}
+		s := fs.String(f.flagName, "", f.usageText())
+		flagValues[f.flagName] = func() string { return *s }
+	}
+	if opts.ExtraFlags != nil {
+		opts.ExtraFlags(fs)
+	}
+	if err := fs.Parse(opts.Args); err != nil {
+		return result, err
+	}
+	result.PrintConfig = *printConfig
+
+	// 配置文件
+	path := *configFile
+	if path == "" && opts.FileEnv != "" {
+		path = os.Getenv(opts.FileEnv)
+	}
+	if path == "" {
+		for _, candidate := range opts.DefaultFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return result, err
+		}
+		result.File = path
+		for _, f := range fields {
+			raw, ok := lookup(values, f.key)
+			if !ok {
+				continue
+			}
+			if err := setValue(f.value, raw); err != nil {
+				return result, fmt.Errorf("配置文件 %s 中 %s 无效: %v", path, f.key, err)
+			}
+			result.Sources[f.key] = SourceFile
+		}
+	}
+
+	// 环境变量，密钥可以通过 <env>_FILE 从文件读取
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(f.env); ok && value != "" {
+			if err := setValue(f.value, value); err != nil {
+				return result, fmt.Errorf("环境变量 %s 无效: %v", f.env, err)
+			}
+			result.Sources[f.key] = SourceEnv + ":" + f.env
+			continue
+		}
+		if !f.secret {
+			continue
+		}
+		if secretFile := os.Getenv(f.env + "_FILE"); secretFile != "" {
+			data, err := os.ReadFile(secretFile)
+			if err != nil {
+				return result, fmt.Errorf("读取 %s_FILE 失败: %v", f.env, err)
+			}
+			f.value.SetString(strings.TrimSpace(string(data)))
+			result.Sources[f.key] = SourceEnv + ":" + f.env + "_FILE"
+		}
+	}
+
+	// 命令行参数
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, f := range fields {
+		if !set[f.flagName] {
+			continue
+		}
+		if err := setValue(f.value, flagValues[f.flagName]()); err != nil {
+			return result, fmt.Errorf("参数 --%s 无效: %v", f.flagName, err)
+		}
+		result.Sources[f.key] = SourceFlag
+	}
+
+	// 校验
+	var missing []string
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			hint := f.key
+			if f.env != "" {
+				hint += " (" + f.env
+				if f.secret {
+					hint += " 或 " + f.env + "_FILE"
+				}
+				hint += ")"
+			}
+			missing = append(missing, hint)
+		}
+	}
+	if len(missing) > 0 {
+		return result, fmt.Errorf("缺少必填配置: %s", strings.Join(missing, ", "))
+	}
+	if v, ok := cfg.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return result, fmt.Errorf("配置校验失败: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// usageText 命令行帮助中显示的说明
+func (f *field) usageText() string {
+	usage := f.usage
+	if f.env != "" {
+		usage += " (环境变量 " + f.env + ")"
+	}
+	return strings.TrimSpace(usage)
+}
+
+// collectFields 递归收集带 config 标签的字段
+func collectFields(v reflect.Value, prefix string) ([]*field, error) {
+	var fields []*field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("config")
+		if key == "" || key == "-" || !sf.IsExported() {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			nested, err := collectFields(fv, key)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+		if !supported(fv.Type()) {
+			return nil, fmt.Errorf("配置项 %s 的类型 %s 不支持", key, fv.Type())
+		}
+
+		fields = append(fields, &field{
+			key:      key,
+			env:      sf.Tag.Get("env"),
+			flagName: strings.NewReplacer("_", "-", ".", "-").Replace(key),
+			usage:    sf.Tag.Get("usage"),
+			secret:   sf.Tag.Get("secret") == "true",
+			required: sf.Tag.Get("required") == "true",
+			value:    fv,
+		})
+	}
+	return fields, nil
+}
+
+// supported 判断字段类型是否支持
+func supported(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String, reflect.Int64:
+			return true
+		}
+	}
+	return false
+}
+
+// readFile 按扩展名读取 YAML 或 TOML 配置文件
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("不支持的配置文件格式: %s，请使用 .yaml/.yml/.toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	return values, nil
+}
+
+// lookup 按 a.b.c 形式的 key 查找配置文件中的值
+func lookup(values map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	var current interface{} = values
+	for _, part := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setValue 把配置文件中的值或字符串写入字段
+func setValue(v reflect.Value, raw interface{}) error {
+	if list, ok := raw.([]interface{}); ok && v.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(v.Type(), 0, len(list))
+		for _, item := range list {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setScalar(elem, fmt.Sprint(item)); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setScalar(v, fmt.Sprint(raw))
+}
+
+// setScalar 解析字符串并写入字段，切片使用逗号分隔
+func setScalar(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("无效的时长 %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("无效的布尔值 %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := parseInt(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("无效的数字 %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setScalar(elem, item); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// parseInt 解析整数，支持 KB/MB/GB 后缀，便于配置文件大小
+func parseInt(s string) (int64, error) {
+	multiplier := int64(1)
+	upper := strings.ToUpper(s)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			multiplier = unit.size
+			s = strings.TrimSpace(s[:len(s)-len(unit.suffix)])
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的整数 %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// Print 以 key = value 的形式打印配置和来源，密钥只显示长度
+func Print(w io.Writer, cfg interface{}, result *Result) error {
+	fields, err := collectFields(reflect.ValueOf(cfg).Elem(), "")
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+
+	if result != nil && result.File != "" {
+		fmt.Fprintf(w, "# 配置文件: %s\n", result.File)
+	}
+	for _, f := range fields {
+		value := formatValue(f.value)
+		if f.secret {
+			value = Redact(f.value.String())
+		}
+		source := ""
+		if result != nil {
+			source = "  # " + result.Sources[f.key]
+		}
+		fmt.Fprintf(w, "%s = %s%s\n", f.key, value, source)
+	}
+	return nil
+}
+
+// Redact 隐藏密钥内容
+func Redact(secret string) string {
+	if secret == "" {
+		return `""`
+	}
+	return fmt.Sprintf("<已隐藏, %d 字符>", len(secret))
+}
+
+// formatValue 格式化字段值用于打印
+func formatValue(v reflect.Value) string {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// IsHelp 判断是否为请求帮助
+func IsHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
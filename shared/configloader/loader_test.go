@@ -0,0 +1,86 @@
+package configloader
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Listen  string        `config:"listen" env:"TEST_LISTEN"`
+	Secure  bool          `config:"cookie_secure" env:"TEST_COOKIE_SECURE"`
+	Verbose bool          `config:"verbose"`
+	MaxSize int64         `config:"max_file_size" env:"TEST_MAX_FILE_SIZE"`
+	Timeout time.Duration `config:"timeout"`
+	Log     struct {
+		Level string `config:"level" env:"TEST_LOG_LEVEL"`
+	} `config:"log"`
+}
+
+// load 按 args 加载配置，file 不为空时作为 TOML 配置文件
+func load(t *testing.T, file string, args ...string) (*testConfig, *Result) {
+	t.Helper()
+	cfg := &testConfig{Listen: "0.0.0.0:9088", MaxSize: 50 << 20}
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "test.toml")
+		if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"--config", path}, args...)
+	}
+	result, err := Load(cfg, Options{Args: args, ErrorHandling: flag.ContinueOnError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, result
+}
+
+func TestLoadLayers(t *testing.T) {
+	t.Setenv("TEST_LOG_LEVEL", "warn")
+	t.Setenv("TEST_MAX_FILE_SIZE", "100MB")
+	cfg, result := load(t, "listen = \"127.0.0.1:1\"\ntimeout = \"45m\"\nmax_file_size = \"10MB\"\n[log]\nlevel = \"debug\"\n",
+		"--listen", "127.0.0.1:2")
+
+	if cfg.Listen != "127.0.0.1:2" || result.Sources["listen"] != SourceFlag {
+		t.Errorf("listen = %s (%s)", cfg.Listen, result.Sources["listen"])
+	}
+	if cfg.MaxSize != 100<<20 || result.Sources["max_file_size"] != SourceEnv+":TEST_MAX_FILE_SIZE" {
+		t.Errorf("max_file_size = %d (%s)", cfg.MaxSize, result.Sources["max_file_size"])
+	}
+	if cfg.Log.Level != "warn" {
+		t.Errorf("log.level = %s", cfg.Log.Level)
+	}
+	if cfg.Timeout != 45*time.Minute || result.Sources["timeout"] != SourceFile {
+		t.Errorf("timeout = %v (%s)", cfg.Timeout, result.Sources["timeout"])
+	}
+	if cfg.Secure || result.Sources["cookie_secure"] != SourceDefault {
+		t.Errorf("cookie_secure = %v (%s)", cfg.Secure, result.Sources["cookie_secure"])
+	}
+}
+
+func TestLoadBoolFlags(t *testing.T) {
+	// 只写参数名即为 true，后面的参数照常解析
+	cfg, result := load(t, "", "--cookie-secure", "--listen", "127.0.0.1:2")
+	if !cfg.Secure || result.Sources["cookie_secure"] != SourceFlag || cfg.Listen != "127.0.0.1:2" {
+		t.Errorf("--cookie-secure: secure = %v (%s), listen = %s", cfg.Secure, result.Sources["cookie_secure"], cfg.Listen)
+	}
+
+	// 显式的 false 覆盖配置文件和环境变量中的 true
+	t.Setenv("TEST_COOKIE_SECURE", "true")
+	cfg, result = load(t, "verbose = true\n", "--cookie-secure=false", "--verbose=false")
+	if cfg.Secure || cfg.Verbose || result.Sources["cookie_secure"] != SourceFlag || result.Sources["verbose"] != SourceFlag {
+		t.Errorf("=false: secure = %v, verbose = %v", cfg.Secure, cfg.Verbose)
+	}
+
+	// 未指定参数时保留配置文件和环境变量的值
+	cfg, _ = load(t, "verbose = true\n")
+	if !cfg.Secure || !cfg.Verbose {
+		t.Errorf("未指定参数: secure = %v, verbose = %v", cfg.Secure, cfg.Verbose)
+	}
+
+	if _, err := Load(&testConfig{}, Options{Args: []string{"--cookie-secure=maybe"}, ErrorHandling: flag.ContinueOnError}); err == nil {
+		t.Error("无效的布尔值应返回错误")
+	}
+}
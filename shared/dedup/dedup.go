@@ -0,0 +1,400 @@
+// Package dedup UID名单去重和集合运算：每个UID保留一次、只保留唯一出现或重复出现的UID，以及两个名单的并集、交集和差集
+// 输入文件每行一个UID，输出按UID在输入中首次出现的顺序排列，相同输入的结果完全一致
+// 纯数字的UID压缩为 uint64 统计；名单超出内存预算时按UID哈希分区写入临时文件，逐个分区处理后归并
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode 去重方式或集合运算
+type Mode string
+
+const (
+	Distinct   Mode = "distinct"   // 每个UID保留一次
+	Singletons Mode = "singletons" // 只保留只出现一次的UID，重复出现的UID全部去掉
+	Duplicates Mode = "duplicates" // 只保留重复出现的UID，并输出出现次数
+	Union      Mode = "union"      // 名单A和名单B的并集
+	Intersect  Mode = "intersect"  // 同时在名单A和名单B中的UID
+	Minus      Mode = "minus"      // 在名单A中但不在名单B中的UID，例如封禁名单减去已封禁名单
+)
+
+// Modes 所有去重方式，按界面显示顺序排列
+var Modes = []Mode{Distinct, Singletons, Duplicates, Union, Intersect, Minus}
+
+// progressInterval 每读取多少行报告一次进度
+const progressInterval = 10000
+
+// maxExamples 报告中最多列出的重复UID示例数
+const maxExamples = 10
+
+// maxLineSize 单行UID的最大长度
+const maxLineSize = 16 * 1024 * 1024
+
+// ParseMode 解析去重方式，空值为 distinct
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return Distinct, nil
+	case Distinct, Singletons, Duplicates, Union, Intersect, Minus:
+		return m, nil
+	default:
+		return "", fmt.Errorf("不支持的去重方式 %q，可选 %s", s, modeNames())
+	}
+}
+
+// modeNames 返回所有去重方式的名称，用于错误提示
+func modeNames() string {
+	names := make([]string, len(Modes))
+	for i, m := range Modes {
+		names[i] = string(m)
+	}
+	return strings.Join(names, "/")
+}
+
+// SetOperation 是否为两个名单之间的集合运算
+func (m Mode) SetOperation() bool {
+	return m == Union || m == Intersect || m == Minus
+}
+
+// Inputs 需要的输入文件数
+func (m Mode) Inputs() int {
+	if m.SetOperation() {
+		return 2
+	}
+	return 1
+}
+
+// String 返回去重方式的说明
+func (m Mode) String() string {
+	switch m {
+	case Singletons:
+		return "只保留唯一出现的UID（重复的UID全部去掉）"
+	case Duplicates:
+		return "只保留重复出现的UID及出现次数"
+	case Union:
+		return "并集：A 和 B 中的所有UID"
+	case Intersect:
+		return "交集：同时在 A 和 B 中的UID"
+	case Minus:
+		return "差集：在 A 中但不在 B 中的UID"
+	default:
+		return "每个UID保留一次"
+	}
+}
+
+// DefaultMemoryLimit 默认的内存预算
+const DefaultMemoryLimit = 512 * 1024 * 1024
+
+// Options 去重的资源限制
+type Options struct {
+	MemoryLimit int64  // 统计表的内存预算（字节），预计超出时按UID哈希分区写入临时文件逐个处理；<=0 使用 DefaultMemoryLimit
+	TempDir     string // 分区临时文件所在的目录，为空时使用输出文件所在的目录
+}
+
+// Progress 读取进度，done/total 为当前名单已读取的字节数，list 为名单序号（从 0 开始）
+type Progress func(list int, done, total int64, lines int)
+
+// List 一个输入名单的统计
+type List struct {
+	Name  string
+	Lines int // 非空行数
+	stats
+}
+
+// Distinct 不同UID的数量
+func (l *List) Distinct() int { return l.distinct }
+
+// Duplicated 重复出现的UID数量
+func (l *List) Duplicated() int { return l.duplicated }
+
+// scan 逐行读取名单，去掉首尾空白和 UTF-8 BOM，跳过空行，每个UID调用一次 fn
+func scan(ctx context.Context, path string, progress func(done, total int64, lines int), fn func(uid []byte) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("打开输入文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var total int64
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), maxLineSize)
+	var read int64
+	lines := 0
+	for first := true; scanner.Scan(); first = false {
+		b := scanner.Bytes()
+		read += int64(len(b)) + 1
+		if first {
+			b = bytes.TrimPrefix(b, []byte("\ufeff"))
+		}
+		uid := bytes.TrimSpace(b)
+		if len(uid) == 0 {
+			continue
+		}
+		if err := fn(uid); err != nil {
+			return 0, err
+		}
+		lines++
+
+		if lines%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			if progress != nil {
+				progress(read, total, lines)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("读取文件时出错: %v", err)
+	}
+	if progress != nil {
+		progress(total, total, lines)
+	}
+	return lines, nil
+}
+
+// Result 去重或集合运算的结果
+type Result struct {
+	Mode       Mode
+	Lists      []*List
+	Written    int // 写入输出文件的UID数
+	Partitions int // 分区数，为 1 时全部在内存中处理
+	Resplit    int // 超出内存预算后再次分区的分区数，UID哈希分布不均匀或输入超出 maxPartitions 个分区的容量时出现
+}
+
+// Run 按 mode 处理输入名单，结果每行一个UID写入 output；duplicates 模式每行为 "UID,出现次数"
+// 集合运算需要两个输入文件，inputs[0] 为名单A，inputs[1] 为名单B，各名单内部先去重
+// 预计统计表超出内存预算时，先按UID哈希把所有行写入分区文件，逐个分区统计后按首次出现的顺序归并，结果与内存中处理完全相同
+func Run(ctx context.Context, mode Mode, inputs []string, output string, opts Options, progress Progress) (*Result, error) {
+	if len(inputs) != mode.Inputs() {
+		return nil, fmt.Errorf("%s 需要 %d 个名单，收到 %d 个", string(mode), mode.Inputs(), len(inputs))
+	}
+	if opts.MemoryLimit <= 0 {
+		opts.MemoryLimit = DefaultMemoryLimit
+	}
+	if opts.TempDir == "" {
+		opts.TempDir = filepath.Dir(output)
+	}
+	partitions, err := partitionCount(inputs, opts.MemoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Mode: mode, Partitions: partitions}
+	for _, input := range inputs {
+		result.Lists = append(result.Lists, &List{Name: filepath.Base(input)})
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	write := func(text string) error {
+		result.Written++
+		if _, err := w.WriteString(text); err != nil {
+			return fmt.Errorf("写入文件时出错: %v", err)
+		}
+		return w.WriteByte('\n')
+	}
+
+	if partitions == 1 {
+		err = result.runInMemory(ctx, inputs, progress, write)
+	} else {
+		err = result.runPartitioned(ctx, inputs, opts, progress, write)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("写入文件时出错: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("保存输出文件失败: %v", err)
+	}
+	return result, nil
+}
+
+// read 依次读取所有名单，行号在所有名单中连续编号
+func (r *Result) read(ctx context.Context, inputs []string, progress Progress, add func(list int, seq uint64, uid []byte) error) error {
+	var seq uint64
+	for i, input := range inputs {
+		lines, err := scan(ctx, input, func(done, total int64, lines int) {
+			if progress != nil {
+				progress(i, done, total, lines)
+			}
+		}, func(uid []byte) error {
+			seq++
+			return add(i, seq, uid)
+		})
+		if err != nil {
+			return err
+		}
+		r.Lists[i].Lines = lines
+	}
+	return nil
+}
+
+// runInMemory 所有UID在一个统计表中处理
+func (r *Result) runInMemory(ctx context.Context, inputs []string, progress Progress, write func(string) error) error {
+	t := newTable()
+	err := r.read(ctx, inputs, progress, func(list int, seq uint64, uid []byte) error {
+		t.add(list, seq, uid)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	lines, st := t.emit(r.Mode, len(inputs))
+	for i := range st {
+		r.Lists[i].stats = st[i]
+	}
+	for _, l := range lines {
+		if err := write(l.text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPartitioned 按UID哈希分区处理，同一个UID的所有行都在同一个分区，每次只有一个分区的统计表在内存中
+func (r *Result) runPartitioned(ctx context.Context, inputs []string, opts Options, progress Progress, write func(string) error) error {
+	dir, err := os.MkdirTemp(opts.TempDir, "dedup-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sp, err := newSpill(dir, "part", r.Partitions, 0)
+	if err != nil {
+		return err
+	}
+	if err := r.read(ctx, inputs, progress, sp.add); err != nil {
+		sp.close()
+		return err
+	}
+	if err := sp.flush(); err != nil {
+		return err
+	}
+
+	var results []string
+	for i, f := range sp.files {
+		if err := r.runPartition(ctx, f.Name(), sp.sizes[i], 0, opts.MemoryLimit, &results); err != nil {
+			return err
+		}
+	}
+	results, err = mergeResults(ctx, results)
+	if err != nil {
+		return err
+	}
+	return mergeLines(ctx, results, func(l line) error { return write(l.text) })
+}
+
+// runPartition 统计一个分区，结果写入临时文件并追加到 results
+// 分区超出内存预算时按下一层的哈希再次分区，超过 maxPartitionLevels 层仍超出时报错，不会超出预算继续处理
+func (r *Result) runPartition(ctx context.Context, path string, size int64, level int, limit int64, results *[]string) error {
+	if size*memoryPerByte > limit {
+		if level+1 >= maxPartitionLevels {
+			return fmt.Errorf("分区 %s 经过 %d 层分区后仍超出内存预算（约 %d MB 数据），请提高内存预算", filepath.Base(path), level+1, size>>20)
+		}
+		sub, err := splitPartition(ctx, path, size, limit, level+1)
+		if err != nil {
+			return err
+		}
+		if sub != nil {
+			r.Resplit++
+			os.Remove(path)
+			for i, f := range sub.files {
+				if err := r.runPartition(ctx, f.Name(), sub.sizes[i], level+1, limit, results); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	t, err := loadPartition(ctx, path)
+	if err != nil {
+		return err
+	}
+	lines, st := t.emit(r.Mode, len(r.Lists))
+	for j := range st {
+		r.Lists[j].merge(&st[j])
+	}
+	result := filepath.Join(filepath.Dir(path), "result-"+filepath.Base(path))
+	if err := writeLines(result, lines); err != nil {
+		return err
+	}
+	*results = append(*results, result)
+	// 处理完的分区文件不再需要，及时释放磁盘空间
+	os.Remove(path)
+	return nil
+}
+
+// Summary 返回结果说明
+func (r *Result) Summary() string {
+	if r.Mode.SetOperation() {
+		a, b := r.Lists[0], r.Lists[1]
+		return fmt.Sprintf("%s\n名单A %s: %d 行，%d 个不同UID\n名单B %s: %d 行，%d 个不同UID\n结果: %d 个UID",
+			r.Mode, a.Name, a.Lines, a.Distinct(), b.Name, b.Lines, b.Distinct(), r.Written)
+	}
+	l := r.Lists[0]
+	return fmt.Sprintf("%s\n原始数据: %d 行，%d 个不同UID，其中 %d 个重复出现\n结果: %d 个UID",
+		r.Mode, l.Lines, l.Distinct(), l.Duplicated(), r.Written)
+}
+
+// WriteReport 写入处理报告，列出每个名单的统计和重复UID示例
+func (r *Result) WriteReport(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建报告文件失败: %v", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintf(w, "UID去重处理报告\n==================\n\n")
+	fmt.Fprintf(w, "处理方式: %s (%s)\n", string(r.Mode), r.Mode)
+	fmt.Fprintf(w, "结果UID数量: %d\n", r.Written)
+	if r.Partitions > 1 {
+		fmt.Fprintf(w, "超出内存预算，按UID哈希分为 %d 个分区处理\n", r.Partitions)
+	}
+	if r.Resplit > 0 {
+		fmt.Fprintf(w, "其中 %d 个分区超出内存预算，再次分区处理\n", r.Resplit)
+	}
+	for i, l := range r.Lists {
+		fmt.Fprintf(w, "\n")
+		if r.Mode.SetOperation() {
+			fmt.Fprintf(w, "名单%c: %s\n", 'A'+i, l.Name)
+		}
+		fmt.Fprintf(w, "总共读取了 %d 行数据\n", l.Lines)
+		fmt.Fprintf(w, "发现 %d 个不同的UID\n", l.Distinct())
+		fmt.Fprintf(w, "只出现一次的UID数量: %d\n", l.Distinct()-l.Duplicated())
+		fmt.Fprintf(w, "重复出现的UID数量: %d\n", l.Duplicated())
+
+		if len(l.examples) > 0 {
+			fmt.Fprintf(w, "重复UID示例（前%d个）:\n", maxExamples)
+		}
+		for _, ex := range l.examples {
+			fmt.Fprintf(w, "UID: %s, 出现次数: %d\n", ex.uid, ex.count)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入报告失败: %v", err)
+	}
+	return file.Close()
+}
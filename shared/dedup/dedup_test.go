@@ -0,0 +1,185 @@
+package dedup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeUIDs 生成 n 行UID，约一半的UID重复出现，strs 为 true 时使用带字母前缀的UID
+func writeUIDs(t testing.TB, path string, n int, strs bool, seed int64) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		uid := rng.Int63n(int64(n)) + 100000000
+		if strs {
+			fmt.Fprintf(w, "u%d\n", uid)
+		} else {
+			fmt.Fprintf(w, "%d\n", uid)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run 处理名单并返回结果文件内容
+func run(t *testing.T, mode Mode, inputs []string, limit int64) (*Result, string) {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "out.csv")
+	result, err := Run(context.Background(), mode, inputs, output, Options{MemoryLimit: limit}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, string(data)
+}
+
+func TestRunSmall(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.csv")
+	b := filepath.Join(dir, "b.csv")
+	os.WriteFile(a, []byte("\ufeff3\n1\n u2 \n\n1\n007\n3\n"), 0644)
+	os.WriteFile(b, []byte("5\n3\n007\n"), 0644)
+
+	tests := []struct {
+		mode   Mode
+		inputs []string
+		want   string
+	}{
+		{Distinct, []string{a}, "3\n1\nu2\n007\n"},
+		{Singletons, []string{a}, "u2\n007\n"},
+		{Duplicates, []string{a}, "3,2\n1,2\n"},
+		{Union, []string{a, b}, "3\n1\nu2\n007\n5\n"},
+		{Intersect, []string{a, b}, "3\n007\n"},
+		{Minus, []string{a, b}, "1\nu2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			if _, got := run(t, tt.mode, tt.inputs, 0); got != tt.want {
+				t.Errorf("结果 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 分区处理（包括再次分区）的结果与内存中处理完全相同
+func TestRunPartitionedMatchesInMemory(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.csv")
+	b := filepath.Join(dir, "b.csv")
+	writeUIDs(t, a, 50000, false, 1)
+	writeUIDs(t, b, 10000, true, 2)
+	info, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range Modes {
+		inputs := []string{a}
+		if mode.SetOperation() {
+			inputs = append(inputs, b)
+		}
+		t.Run(string(mode), func(t *testing.T) {
+			want, wantOut := run(t, mode, inputs, 1<<40)
+			if want.Partitions != 1 {
+				t.Fatalf("内存中处理的分区数 = %d", want.Partitions)
+			}
+
+			// 预算可分为 16 个分区
+			got, out := run(t, mode, inputs, info.Size()*memoryPerByte/16)
+			if got.Partitions < 16 || got.Resplit != 0 {
+				t.Errorf("分区数 = %d, 再次分区 = %d", got.Partitions, got.Resplit)
+			}
+			if out != wantOut || got.Summary() != want.Summary() {
+				t.Errorf("分区处理的结果与内存中处理不同")
+			}
+
+			// 预算需要 1024 个分区，超出 maxPartitions 的部分再次分区
+			got, out = run(t, mode, inputs, info.Size()*memoryPerByte/1024)
+			if got.Partitions != maxPartitions || got.Resplit == 0 {
+				t.Errorf("分区数 = %d, 再次分区 = %d", got.Partitions, got.Resplit)
+			}
+			if out != wantOut || got.Summary() != want.Summary() {
+				t.Errorf("再次分区的结果与内存中处理不同")
+			}
+		})
+	}
+}
+
+// 只有少数几个不同UID的分区无法再分，直接在内存中统计
+func TestRunRepeatedUIDNotResplit(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "a.csv")
+	os.WriteFile(input, []byte(strings.Repeat("100000001\n", 50000)), 0644)
+
+	result, out := run(t, Duplicates, []string{input}, 1024)
+	if out != "100000001,50000\n" {
+		t.Errorf("结果 = %q", out)
+	}
+	if result.Resplit != 0 {
+		t.Errorf("再次分区 = %d, want 0", result.Resplit)
+	}
+}
+
+// 最后一层分区仍超出内存预算时报错
+func TestRunPartitionFailsAtMaxLevel(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpill(dir, "part", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		sp.add(0, uint64(i+1), []byte(fmt.Sprint(100000000+i)))
+	}
+	if err := sp.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Result{Mode: Distinct, Lists: []*List{{Name: "a.csv"}}}
+	var results []string
+	err = r.runPartition(context.Background(), sp.files[0].Name(), sp.sizes[0], maxPartitionLevels-1, 1024, &results)
+	if err == nil || !strings.Contains(err.Error(), "仍超出内存预算") {
+		t.Errorf("runPartition = %v", err)
+	}
+}
+
+// benchmarkRun 对 n 行数字UID去重，limit 为内存预算
+func benchmarkRun(b *testing.B, n int, limit int64) {
+	dir := b.TempDir()
+	input := filepath.Join(dir, "uid.csv")
+	writeUIDs(b, input, n, false, 1)
+	info, err := os.Stat(input)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if limit == 0 {
+		limit = info.Size() * memoryPerByte / 16
+	}
+	output := filepath.Join(dir, "out.csv")
+	b.SetBytes(info.Size())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Run(context.Background(), Distinct, []string{input}, output, Options{MemoryLimit: limit}, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunInMemory(b *testing.B) { benchmarkRun(b, 1000000, 1<<40) }
+
+// BenchmarkRunPartitioned 内存预算按 16 个分区计算
+func BenchmarkRunPartitioned(b *testing.B) { benchmarkRun(b, 1000000, 0) }
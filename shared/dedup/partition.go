@@ -0,0 +1,382 @@
+package dedup
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// memoryPerByte 估算每个输入字节在统计表和结果中占用的内存（按每行都是不同UID估算，包含垃圾回收前的余量）
+const memoryPerByte = 16
+
+// maxPartitions 最多的分区数，分区文件同时打开，避免超出文件句柄限制
+const maxPartitions = 256
+
+// partitionBuffer 每个分区文件的读写缓冲区大小
+const partitionBuffer = 64 * 1024
+
+// maxPartitionLevels 最多的分区层数，分区超出内存预算时按新的哈希再次分区，超过层数仍超出时报错
+const maxPartitionLevels = 3
+
+// partitionCount 根据输入文件大小估算需要的分区数，使每个分区的统计表不超过内存预算
+func partitionCount(inputs []string, limit int64) (int, error) {
+	var size int64
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return 0, fmt.Errorf("读取输入文件失败: %v", err)
+		}
+		size += info.Size()
+	}
+	return partitionsFor(size, limit), nil
+}
+
+// partitionHeadroom 估算分区数时按 1/partitionHeadroom 预留余量，UID哈希分布的正常波动不会使分区超出内存预算
+const partitionHeadroom = 4
+
+// partitionsFor 按数据量估算分区数，最多 maxPartitions 个
+func partitionsFor(size, limit int64) int {
+	need := size * memoryPerByte
+	need += need / partitionHeadroom
+	n := (need + limit - 1) / limit
+	switch {
+	case n < 1:
+		return 1
+	case n > maxPartitions:
+		return maxPartitions
+	}
+	return int(n)
+}
+
+// partitionOf 按UID的哈希值选择分区，同一个UID总在同一个分区
+// 每一层分区使用不同的种子，同一分区中的UID再次分区时仍能均匀分布
+func partitionOf(uid []byte, n, level int) int {
+	v, ok := parseUint(uid)
+	if !ok {
+		h := fnv.New64a()
+		h.Write(uid)
+		v = h.Sum64()
+	}
+	// splitmix64 混合，连续的数字UID也能均匀分布；FNV 的低位只取决于输入字节的低位，同样需要混合
+	v += uint64(level) * 0x9e3779b97f4a7c15
+	v ^= v >> 30
+	v *= 0xbf58476d1ce4e5b9
+	v ^= v >> 27
+	v *= 0x94d049bb133111eb
+	v ^= v >> 31
+	return int(v % uint64(n))
+}
+
+// spill 分区文件的写入端，每条记录为 行号、名单序号、UID长度、UID
+type spill struct {
+	level   int
+	files   []*os.File
+	writers []*bufio.Writer
+	sizes   []int64 // 每个分区的数据量，按输入文件中的字节数（UID和换行符）计算
+	buf     [binary.MaxVarintLen64]byte
+}
+
+// newSpill 创建 n 个分区文件 <prefix>-000.bin ...，level 为分区层数
+func newSpill(dir, prefix string, n, level int) (*spill, error) {
+	s := &spill{level: level, sizes: make([]int64, n)}
+	for i := 0; i < n; i++ {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s-%03d.bin", prefix, i)))
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("创建分区文件失败: %v", err)
+		}
+		s.files = append(s.files, f)
+		s.writers = append(s.writers, bufio.NewWriterSize(f, partitionBuffer))
+	}
+	return s, nil
+}
+
+// add 将一行UID写入所在的分区
+func (s *spill) add(list int, seq uint64, uid []byte) error {
+	i := partitionOf(uid, len(s.writers), s.level)
+	s.sizes[i] += int64(len(uid)) + 1
+	w := s.writers[i]
+	w.Write(s.buf[:binary.PutUvarint(s.buf[:], seq)])
+	w.WriteByte(byte(list))
+	w.Write(s.buf[:binary.PutUvarint(s.buf[:], uint64(len(uid)))])
+	_, err := w.Write(uid)
+	return err
+}
+
+// flush 写完所有记录后关闭分区文件
+func (s *spill) flush() error {
+	for i, w := range s.writers {
+		if err := w.Flush(); err != nil {
+			s.close()
+			return fmt.Errorf("写入分区文件失败: %v", err)
+		}
+		if err := s.files[i].Close(); err != nil {
+			s.close()
+			return fmt.Errorf("写入分区文件失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *spill) close() {
+	for _, f := range s.files {
+		f.Close()
+	}
+}
+
+// remove 删除所有分区文件
+func (s *spill) remove() {
+	for _, f := range s.files {
+		os.Remove(f.Name())
+	}
+}
+
+// readPartition 按顺序读取一个分区文件中的所有记录
+func readPartition(ctx context.Context, path string, fn func(list int, seq uint64, uid []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取分区文件失败: %v", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, partitionBuffer)
+	var uid []byte
+	for records := 1; ; records++ {
+		seq, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取分区文件失败: %v", err)
+		}
+		list, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("读取分区文件失败: %v", err)
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("读取分区文件失败: %v", err)
+		}
+		if uint64(cap(uid)) < size {
+			uid = make([]byte, size)
+		}
+		uid = uid[:size]
+		if _, err := io.ReadFull(r, uid); err != nil {
+			return fmt.Errorf("读取分区文件失败: %v", err)
+		}
+		if err := fn(int(list), seq, uid); err != nil {
+			return err
+		}
+
+		if records%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// loadPartition 读取一个分区文件，统计其中每个UID的出现次数
+func loadPartition(ctx context.Context, path string) (*table, error) {
+	t := newTable()
+	err := readPartition(ctx, path, func(list int, seq uint64, uid []byte) error {
+		t.add(list, seq, uid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitPartition 按第 level 层的哈希把超出内存预算的分区再分为多个子分区
+// 所有行都落在同一个子分区时（分区中只有很少几个不同的UID），再次分区没有意义，删除子分区并返回 nil
+func splitPartition(ctx context.Context, path string, size, limit int64, level int) (*spill, error) {
+	n := max(partitionsFor(size, limit), 2)
+	sp, err := newSpill(filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ".bin"), n, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := readPartition(ctx, path, sp.add); err != nil {
+		sp.close()
+		sp.remove()
+		return nil, err
+	}
+	if err := sp.flush(); err != nil {
+		sp.remove()
+		return nil, err
+	}
+	if slices.Max(sp.sizes) == size {
+		sp.remove()
+		return nil, nil
+	}
+	return sp, nil
+}
+
+// lineWriter 按顺序写入结果记录，每条记录为 行号、长度、内容
+type lineWriter struct {
+	file *os.File
+	w    *bufio.Writer
+	buf  [binary.MaxVarintLen64]byte
+}
+
+func createLines(path string) (*lineWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建分区结果文件失败: %v", err)
+	}
+	return &lineWriter{file: file, w: bufio.NewWriterSize(file, partitionBuffer)}, nil
+}
+
+// write 写入一行结果
+func (lw *lineWriter) write(l line) error {
+	lw.w.Write(lw.buf[:binary.PutUvarint(lw.buf[:], l.seq)])
+	lw.w.Write(lw.buf[:binary.PutUvarint(lw.buf[:], uint64(len(l.text)))])
+	_, err := lw.w.WriteString(l.text)
+	return err
+}
+
+// close 写完所有结果后关闭文件
+func (lw *lineWriter) close() error {
+	if err := lw.w.Flush(); err != nil {
+		lw.file.Close()
+		return fmt.Errorf("写入分区结果文件失败: %v", err)
+	}
+	return lw.file.Close()
+}
+
+// writeLines 将一个分区的结果按顺序写入临时文件
+func writeLines(path string, lines []line) error {
+	lw, err := createLines(path)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		lw.write(l)
+	}
+	return lw.close()
+}
+
+// mergeResults 结果文件超过 maxPartitions 个时（再次分区后），每 maxPartitions 个归并为一个文件，
+// 避免最终归并时同时打开的文件超出句柄限制
+func mergeResults(ctx context.Context, results []string) ([]string, error) {
+	for round := 0; len(results) > maxPartitions; round++ {
+		var merged []string
+		for i := 0; i < len(results); i += maxPartitions {
+			group := results[i:min(i+maxPartitions, len(results))]
+			path := filepath.Join(filepath.Dir(group[0]), fmt.Sprintf("merged-%d-%03d.bin", round, i/maxPartitions))
+			lw, err := createLines(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := mergeLines(ctx, group, lw.write); err != nil {
+				lw.close()
+				return nil, err
+			}
+			if err := lw.close(); err != nil {
+				return nil, err
+			}
+			for _, f := range group {
+				os.Remove(f)
+			}
+			merged = append(merged, path)
+		}
+		results = merged
+	}
+	return results, nil
+}
+
+// lineReader 按顺序读取一个分区的结果
+type lineReader struct {
+	file *os.File
+	r    *bufio.Reader
+	cur  line
+}
+
+// next 读取下一行，读完时返回 io.EOF
+func (lr *lineReader) next() error {
+	seq, err := binary.ReadUvarint(lr.r)
+	if err != nil {
+		return err
+	}
+	size, err := binary.ReadUvarint(lr.r)
+	if err != nil {
+		return err
+	}
+	text := make([]byte, size)
+	if _, err := io.ReadFull(lr.r, text); err != nil {
+		return err
+	}
+	lr.cur = line{seq: seq, text: string(text)}
+	return nil
+}
+
+// lineHeap 按行号取各分区结果中最小的一行
+type lineHeap []*lineReader
+
+func (h lineHeap) Len() int            { return len(h) }
+func (h lineHeap) Less(i, j int) bool  { return h[i].cur.seq < h[j].cur.seq }
+func (h lineHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *lineHeap) Push(x interface{}) { *h = append(*h, x.(*lineReader)) }
+func (h *lineHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeLines 多路归并各分区的结果文件，按行号顺序逐行写出
+func mergeLines(ctx context.Context, paths []string, write func(l line) error) error {
+	h := make(lineHeap, 0, len(paths))
+	defer func() {
+		for _, lr := range h {
+			lr.file.Close()
+		}
+	}()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("读取分区结果文件失败: %v", err)
+		}
+		lr := &lineReader{file: file, r: bufio.NewReaderSize(file, partitionBuffer)}
+		if err := lr.next(); err != nil {
+			file.Close()
+			if err == io.EOF {
+				continue
+			}
+			return fmt.Errorf("读取分区结果文件失败: %v", err)
+		}
+		h = append(h, lr)
+	}
+	heap.Init(&h)
+
+	for written := 1; h.Len() > 0; written++ {
+		lr := h[0]
+		if err := write(lr.cur); err != nil {
+			return err
+		}
+		switch err := lr.next(); err {
+		case nil:
+			heap.Fix(&h, 0)
+		case io.EOF:
+			heap.Pop(&h)
+			lr.file.Close()
+		default:
+			return fmt.Errorf("读取分区结果文件失败: %v", err)
+		}
+		if written%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package dedup
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// entry 一个UID在名单A、B中的出现次数和首次出现的行号（所有名单连续编号，从 1 开始）
+type entry struct {
+	first  [2]uint64
+	counts [2]uint32
+}
+
+// see 记录UID在名单 list 的第 seq 行出现一次
+func (e *entry) see(list int, seq uint64) {
+	if e.counts[list] == 0 {
+		e.first[list] = seq
+	}
+	e.counts[list]++
+}
+
+// table 统计UID的出现次数，纯数字的UID压缩为 uint64 保存，节省内存并加快比较
+type table struct {
+	nums map[uint64]entry
+	strs map[string]*entry
+}
+
+func newTable() *table {
+	return &table{nums: make(map[uint64]entry), strs: make(map[string]*entry)}
+}
+
+// add 记录一行UID
+func (t *table) add(list int, seq uint64, uid []byte) {
+	if n, ok := parseUint(uid); ok {
+		t.addNum(list, seq, n)
+		return
+	}
+	t.addStr(list, seq, uid)
+}
+
+func (t *table) addNum(list int, seq uint64, n uint64) {
+	e := t.nums[n]
+	e.see(list, seq)
+	t.nums[n] = e
+}
+
+func (t *table) addStr(list int, seq uint64, uid []byte) {
+	// 使用 string(uid) 查找不会分配内存，只有新的UID才复制一份
+	if e := t.strs[string(uid)]; e != nil {
+		e.see(list, seq)
+		return
+	}
+	e := &entry{}
+	e.see(list, seq)
+	t.strs[string(uid)] = e
+}
+
+// parseUint 解析纯数字且没有前导零的UID，转换回字符串后与原文完全相同
+func parseUint(b []byte) (uint64, bool) {
+	if len(b) == 0 || len(b) > 20 || (b[0] == '0' && len(b) > 1) {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (math.MaxUint64-d)/10 {
+			return 0, false
+		}
+		n = n*10 + d
+	}
+	return n, true
+}
+
+// line 一行输出及其排序位置
+type line struct {
+	seq  uint64
+	text string
+}
+
+// example 重复UID示例
+type example struct {
+	seq   uint64
+	uid   string
+	count int
+}
+
+// stats 名单的统计，分区处理时每个分区分别统计后合并
+type stats struct {
+	distinct   int
+	duplicated int
+	examples   []example // 按首次出现的位置排序，最多 maxExamples 个
+}
+
+// addExample 保留首次出现最早的 maxExamples 个重复UID
+func (s *stats) addExample(ex example) {
+	i := sort.Search(len(s.examples), func(i int) bool { return s.examples[i].seq > ex.seq })
+	if i >= maxExamples {
+		return
+	}
+	s.examples = append(s.examples, example{})
+	copy(s.examples[i+1:], s.examples[i:])
+	s.examples[i] = ex
+	if len(s.examples) > maxExamples {
+		s.examples = s.examples[:maxExamples]
+	}
+}
+
+// merge 合并另一个分区的统计
+func (s *stats) merge(o *stats) {
+	s.distinct += o.distinct
+	s.duplicated += o.duplicated
+	for _, ex := range o.examples {
+		s.addExample(ex)
+	}
+}
+
+// emit 按处理方式生成输出行（按首次出现的位置排序），并统计每个名单
+func (t *table) emit(mode Mode, lists int) ([]line, []stats) {
+	var lines []line
+	st := make([]stats, lists)
+	visit := func(uid func() string, e *entry) {
+		for i := 0; i < lists; i++ {
+			if e.counts[i] == 0 {
+				continue
+			}
+			st[i].distinct++
+			if e.counts[i] > 1 {
+				st[i].duplicated++
+				st[i].addExample(example{seq: e.first[i], uid: uid(), count: int(e.counts[i])})
+			}
+		}
+		if seq, ok := mode.keep(e); ok {
+			text := uid()
+			if mode == Duplicates {
+				text = fmt.Sprintf("%s,%d", text, e.counts[0])
+			}
+			lines = append(lines, line{seq: seq, text: text})
+		}
+	}
+	for n, e := range t.nums {
+		e := e
+		visit(func() string { return strconv.FormatUint(n, 10) }, &e)
+	}
+	for s, e := range t.strs {
+		visit(func() string { return s }, e)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].seq < lines[j].seq })
+	return lines, st
+}
+
+// keep UID是否写入结果，以及它在结果中的排序位置
+// 名单A的行号都小于名单B，按首次出现的行号排序即先按名单A的顺序，再按名单B的顺序
+func (m Mode) keep(e *entry) (uint64, bool) {
+	a, b := e.counts[0], e.counts[1]
+	switch m {
+	case Singletons:
+		return e.first[0], a == 1
+	case Duplicates:
+		return e.first[0], a > 1
+	case Union:
+		if a == 0 {
+			return e.first[1], b > 0
+		}
+		return e.first[0], true
+	case Intersect:
+		return e.first[0], a > 0 && b > 0
+	case Minus:
+		return e.first[0], a > 0 && b == 0
+	default:
+		return e.first[0], a > 0
+	}
+}
@@ -0,0 +1,387 @@
+// Package kyc 根据审核表格生成 b_kyc 的状态变更 SQL：每行一个审核结论（通过、拒绝、锁定）和可选的原因
+// 只允许从待审核、未锁定的记录变更，SQL 的 WHERE 条件同时限定原状态，重复执行不会改变已处理的记录
+package kyc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"shared/snapshot"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decision 审核结论
+type Decision string
+
+const (
+	Approve Decision = "approve" // 审核通过
+	Reject  Decision = "reject"  // 审核拒绝
+	Lock    Decision = "lock"    // 锁定可疑的提交，保持待审核状态
+)
+
+// Decisions 所有审核结论，按输出顺序排列
+var Decisions = []Decision{Approve, Reject, Lock}
+
+// b_kyc 的审核状态
+const (
+	StatusApproved = 1 // 审核通过
+	StatusPending  = 2 // 待审核
+	StatusRejected = 3 // 审核拒绝
+)
+
+const (
+	// Table KYC 表名
+	Table = "b_kyc"
+	// RemarkColumn 保存审核原因的列
+	RemarkColumn = "audit_remark"
+	// MaxReasonLength 原因的最大长度（字符数）
+	MaxReasonLength = 255
+	// maxProblems 错误信息中最多列出的问题数
+	maxProblems = 10
+)
+
+// decisionAliases 表格中审核结论的写法，不区分大小写；空值视为通过，兼容只有 user_id 和 id 两列的旧表格
+var decisionAliases = map[string]Decision{
+	"":         Approve,
+	"approve":  Approve,
+	"approved": Approve,
+	"pass":     Approve,
+	"通过":       Approve,
+	"reject":   Reject,
+	"rejected": Reject,
+	"拒绝":       Reject,
+	"驳回":       Reject,
+	"lock":     Lock,
+	"locked":   Lock,
+	"锁定":       Lock,
+}
+
+// ParseDecision 解析审核结论
+func ParseDecision(s string) (Decision, error) {
+	d, ok := decisionAliases[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", fmt.Errorf("无效的审核结论 %q，可选 approve/reject/lock", s)
+	}
+	return d, nil
+}
+
+// String 返回审核结论的中文名称
+func (d Decision) String() string {
+	switch d {
+	case Reject:
+		return "拒绝"
+	case Lock:
+		return "锁定"
+	default:
+		return "通过"
+	}
+}
+
+// Transition 审核结论允许的状态变更
+type Transition struct {
+	FromStatus int // 变更前必须是的审核状态
+	FromLock   int // 变更前必须是的锁定状态
+	ToStatus   int // 变更后的审核状态
+	ToLock     int // 变更后的锁定状态
+}
+
+// Transitions 每个审核结论允许的状态变更，都只能从待审核、未锁定的记录开始
+var Transitions = map[Decision]Transition{
+	Approve: {FromStatus: StatusPending, FromLock: 0, ToStatus: StatusApproved, ToLock: 0},
+	Reject:  {FromStatus: StatusPending, FromLock: 0, ToStatus: StatusRejected, ToLock: 0},
+	Lock:    {FromStatus: StatusPending, FromLock: 0, ToStatus: StatusPending, ToLock: 1},
+}
+
+// String 返回状态变更的说明
+func (t Transition) String() string {
+	return fmt.Sprintf("audit_status %d→%d is_lock %d→%d", t.FromStatus, t.ToStatus, t.FromLock, t.ToLock)
+}
+
+// Record 一条审核记录
+type Record struct {
+	Line     int // 表格中的行号，从 1 开始
+	UserID   string
+	ID       string
+	Decision Decision
+	Reason   string
+}
+
+// key 同一条KYC记录的标识
+func (r Record) key() string { return r.UserID + "/" + r.ID }
+
+// columns 表格中各字段所在的列，-1 表示没有该列
+type columns struct {
+	userID, id, decision, reason, status, lock int
+}
+
+// headerNames 表头中各字段的写法，不区分大小写
+var headerNames = map[string][]string{
+	"user_id":  {"user_id", "userid", "uid", "用户id"},
+	"id":       {"id", "kyc_id", "记录id"},
+	"decision": {"decision", "result", "结论", "审核结论", "审核结果"},
+	"reason":   {"reason", "remark", "原因", "备注"},
+	"status":   {"audit_status", "当前状态"},
+	"lock":     {"is_lock"},
+}
+
+// findColumns 按表头查找各字段的列；没有 user_id 和 id 表头时使用前两列，兼容旧表格
+func findColumns(header []string) columns {
+	find := func(field string) int {
+		for i, cell := range header {
+			cell = strings.ToLower(strings.TrimSpace(cell))
+			for _, name := range headerNames[field] {
+				if cell == name {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	c := columns{userID: find("user_id"), id: find("id"), decision: find("decision"), reason: find("reason"), status: find("status"), lock: find("lock")}
+	if c.userID < 0 || c.id < 0 {
+		c.userID, c.id = 0, 1
+	}
+	return c
+}
+
+// Batch 一个审核表格解析后的结果
+type Batch struct {
+	Records    []Record // 按表格顺序，已去掉重复的行
+	Rows       int      // 数据行数（不含表头和空行）
+	Duplicates int      // 同一条记录、同一结论的重复行
+	Counts     map[Decision]int
+}
+
+// Parse 解析审核表格，第一行为表头
+// 任一行的ID不是数字、结论无效、同一条记录有不同结论或当前状态不允许变更时返回错误，列出前几个问题，不生成部分结果
+func Parse(rows [][]string) (*Batch, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("文件为空")
+	}
+	cols := findColumns(rows[0])
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	b := &Batch{Counts: make(map[Decision]int)}
+	var problems []string
+	problem := func(line int, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("第 %d 行: %s", line, fmt.Sprintf(format, args...)))
+	}
+	seen := make(map[string]Record)
+	for i, row := range rows[1:] {
+		line := i + 2
+		r := Record{Line: line, UserID: cell(row, cols.userID), ID: cell(row, cols.id), Reason: cell(row, cols.reason)}
+		if r.UserID == "" && r.ID == "" && cell(row, cols.decision) == "" {
+			continue
+		}
+		b.Rows++
+
+		if !isID(r.UserID) || !isID(r.ID) {
+			problem(line, "user_id %q 或 id %q 不是正整数", r.UserID, r.ID)
+			continue
+		}
+		d, err := ParseDecision(cell(row, cols.decision))
+		if err != nil {
+			problem(line, "%v", err)
+			continue
+		}
+		r.Decision = d
+		if n := len([]rune(r.Reason)); n > MaxReasonLength {
+			problem(line, "原因长度 %d 超过 %d 个字符", n, MaxReasonLength)
+			continue
+		}
+		if err := checkCurrent(d, cell(row, cols.status), cell(row, cols.lock)); err != nil {
+			problem(line, "%v", err)
+			continue
+		}
+
+		if prev, ok := seen[r.key()]; ok {
+			if prev.Decision != r.Decision || prev.Reason != r.Reason {
+				problem(line, "记录 %s 与第 %d 行的结论不同（%s / %s）", r.key(), prev.Line, prev.Decision, r.Decision)
+			} else {
+				b.Duplicates++
+			}
+			continue
+		}
+		seen[r.key()] = r
+		b.Records = append(b.Records, r)
+		b.Counts[r.Decision]++
+	}
+
+	if len(problems) > 0 {
+		more := ""
+		if len(problems) > maxProblems {
+			more = fmt.Sprintf("\n... 共 %d 个问题", len(problems))
+			problems = problems[:maxProblems]
+		}
+		return nil, fmt.Errorf("审核表格有误，未生成SQL:\n%s%s", strings.Join(problems, "\n"), more)
+	}
+	if len(b.Records) == 0 {
+		return nil, fmt.Errorf("没有有效的审核记录")
+	}
+	return b, nil
+}
+
+// checkCurrent 表格带有当前状态（audit_status、is_lock 列）时检查是否允许变更
+func checkCurrent(d Decision, status, lock string) error {
+	t := Transitions[d]
+	if status != "" {
+		if n, err := strconv.Atoi(status); err != nil || n != t.FromStatus {
+			return fmt.Errorf("当前 audit_status 为 %s，%s只能用于 audit_status = %d 的记录", status, d, t.FromStatus)
+		}
+	}
+	if lock != "" {
+		if n, err := strconv.Atoi(lock); err != nil || n != t.FromLock {
+			return fmt.Errorf("当前 is_lock 为 %s，%s只能用于 is_lock = %d 的记录", lock, d, t.FromLock)
+		}
+	}
+	return nil
+}
+
+// isID 是否为正整数，ID直接写入SQL，必须是数字
+func isID(s string) bool {
+	if s == "" || s[0] == '0' {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// quote 转义为 SQL 字符串，换行替换为空格
+func quote(s string) string {
+	s = strings.NewReplacer("\\", "\\\\", "'", "''", "\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	return "'" + s + "'"
+}
+
+// SQL 返回记录的状态变更语句，WHERE 条件限定变更前的状态
+func (r Record) SQL(now time.Time) string {
+	t := Transitions[r.Decision]
+	var set []string
+	if r.Decision == Lock {
+		set = append(set, fmt.Sprintf("is_lock = %d", t.ToLock))
+	} else {
+		set = append(set, fmt.Sprintf("audit_status = %d", t.ToStatus), fmt.Sprintf("audit_at = '%s'", now.Format("2006-01-02 15:04:05")))
+	}
+	if r.Reason != "" {
+		set = append(set, fmt.Sprintf("%s = %s", RemarkColumn, quote(r.Reason)))
+	}
+	return fmt.Sprintf("UPDATE %s set %s where audit_status = %d and is_lock = %d and user_id = %s and id = %s;",
+		Table, strings.Join(set, ","), t.FromStatus, t.FromLock, r.UserID, r.ID)
+}
+
+// WriteSQL 按审核结论分组写出SQL，每组前有注释说明状态变更和条数，返回语句数
+func (b *Batch) WriteSQL(w io.Writer, now time.Time) (int, error) {
+	bw := bufio.NewWriter(w)
+	count := 0
+	for _, d := range Decisions {
+		if b.Counts[d] == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "-- %s (%s): %d 条，%s\n", string(d), d, b.Counts[d], Transitions[d])
+		for _, r := range b.Records {
+			if r.Decision != d {
+				continue
+			}
+			if _, err := bw.WriteString(r.SQL(now) + "\n"); err != nil {
+				return count, fmt.Errorf("写入SQL语句失败: %v", err)
+			}
+			count++
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("写入SQL语句失败: %v", err)
+	}
+	return count, nil
+}
+
+// LoadSnapshot 读取 b_kyc 快照，需要 id、user_id、audit_status 和 is_lock 列
+func LoadSnapshot(path string) (*snapshot.Snapshot, error) {
+	return snapshot.Load(path, "user_id", "audit_status", "is_lock")
+}
+
+// Check 对照 b_kyc 快照检查每条记录，只保留执行后会变更的记录
+// 快照中没有该 id 或 user_id 不同视为不存在；已是结论对应的状态视为已处理；其余不满足变更前状态的记录不会被SQL修改
+func (b *Batch) Check(s *snapshot.Snapshot) *snapshot.Report {
+	report := snapshot.NewReport(Table, s)
+	var kept []Record
+	counts := make(map[Decision]int)
+	for _, r := range b.Records {
+		row, ok := s.Get(r.ID)
+		if !ok {
+			report.Add(r.key(), snapshot.Missing, "快照中没有该记录")
+			continue
+		}
+		if row.Get("user_id") != r.UserID {
+			report.Add(r.key(), snapshot.Missing, "该记录属于 user_id "+row.Get("user_id"))
+			continue
+		}
+		t := Transitions[r.Decision]
+		status, statusErr := strconv.Atoi(row.Get("audit_status"))
+		lock, lockErr := strconv.Atoi(row.Get("is_lock"))
+		switch {
+		case statusErr != nil || lockErr != nil:
+			report.Add(r.key(), snapshot.Blocked, row.String())
+		case status == t.ToStatus && lock == t.ToLock:
+			report.Add(r.key(), snapshot.Already, row.String())
+		case status != t.FromStatus || lock != t.FromLock:
+			report.Add(r.key(), snapshot.Blocked, row.String())
+		default:
+			report.Add(r.key(), snapshot.Change, "")
+			kept = append(kept, r)
+			counts[r.Decision]++
+		}
+	}
+	b.Records, b.Counts = kept, counts
+	return report
+}
+
+// Summary 返回每种审核结论的条数
+func (b *Batch) Summary() string {
+	var lines []string
+	for _, d := range Decisions {
+		if b.Counts[d] > 0 {
+			lines = append(lines, fmt.Sprintf("%s %s: %d 条", d, string(d), b.Counts[d]))
+		}
+	}
+	if b.Duplicates > 0 {
+		lines = append(lines, fmt.Sprintf("重复行: %d 条（已跳过）", b.Duplicates))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteSummary 写出按审核结论统计的 CSV：结论、条数、状态变更和有原因的条数
+func (b *Batch) WriteSummary(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建统计文件失败: %v", err)
+	}
+	defer file.Close()
+
+	reasons := make(map[Decision]int)
+	for _, r := range b.Records {
+		if r.Reason != "" {
+			reasons[r.Decision]++
+		}
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "decision,count,with_reason,transition")
+	for _, d := range Decisions {
+		fmt.Fprintf(w, "%s,%d,%d,%s\n", string(d), b.Counts[d], reasons[d], Transitions[d])
+	}
+	fmt.Fprintf(w, "total,%d,%d,\n", len(b.Records), reasons[Approve]+reasons[Reject]+reasons[Lock])
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入统计文件失败: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,176 @@
+package kyc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    [][]string
+		want    string // 记录 user_id/id:结论:原因，空格分隔
+		dups    int
+		wantErr string
+	}{
+		{
+			name: "旧表格只有两列，默认通过",
+			rows: [][]string{{"uid", "kyc"}, {"1001", "1"}, {"1002", "2"}},
+			want: "1001/1:approve: 1002/2:approve:",
+		},
+		{
+			name: "按表头查找列，结论支持中文和别名",
+			rows: [][]string{
+				{"备注", "审核结论", "id", "user_id"},
+				{"资料不全", "拒绝", "1", "1001"},
+				{"", "LOCKED", "2", "1002"},
+				{"", "pass", "3", "1003"},
+			},
+			want: "1001/1:reject:资料不全 1002/2:lock: 1003/3:approve:",
+		},
+		{
+			name: "空行跳过，相同结论的重复行只保留一条",
+			rows: [][]string{{"user_id", "id", "decision"}, {}, {" ", ""}, {"1001", "1", "approve"}, {"1001", "1", "approved"}},
+			want: "1001/1:approve:",
+			dups: 1,
+		},
+		{
+			name: "缺少列的行按空值处理",
+			rows: [][]string{{"user_id", "id", "decision", "reason"}, {"1001", "1"}},
+			want: "1001/1:approve:",
+		},
+		{name: "空表格", rows: nil, wantErr: "文件为空"},
+		{name: "只有表头", rows: [][]string{{"user_id", "id"}}, wantErr: "没有有效的审核记录"},
+		{name: "ID不是数字", rows: [][]string{{"user_id", "id"}, {"1001", "1 or 1=1"}}, wantErr: "第 2 行: user_id \"1001\" 或 id \"1 or 1=1\" 不是正整数"},
+		{name: "ID以0开头", rows: [][]string{{"user_id", "id"}, {"01001", "1"}}, wantErr: "不是正整数"},
+		{name: "无效结论", rows: [][]string{{"user_id", "id", "decision"}, {"1001", "1", "maybe"}}, wantErr: "第 2 行: 无效的审核结论 \"maybe\""},
+		{
+			name:    "原因过长",
+			rows:    [][]string{{"user_id", "id", "reason"}, {"1001", "1", strings.Repeat("长", MaxReasonLength+1)}},
+			wantErr: "原因长度 256 超过 255 个字符",
+		},
+		{
+			name:    "同一记录结论不同",
+			rows:    [][]string{{"user_id", "id", "decision"}, {"1001", "1", "approve"}, {"1001", "1", "reject"}},
+			wantErr: "第 3 行: 记录 1001/1 与第 2 行的结论不同",
+		},
+		{
+			name:    "当前状态不允许变更",
+			rows:    [][]string{{"user_id", "id", "decision", "audit_status", "is_lock"}, {"1001", "1", "approve", "1", "0"}, {"1002", "2", "lock", "2", "1"}},
+			wantErr: "第 2 行: 当前 audit_status 为 1",
+		},
+		{
+			name:    "当前锁定状态不允许变更",
+			rows:    [][]string{{"user_id", "id", "decision", "is_lock"}, {"1002", "2", "lock", "x"}},
+			wantErr: "当前 is_lock 为 x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Parse(tt.rows)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Parse 错误 = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range b.Records {
+				got = append(got, fmt.Sprintf("%s:%s:%s", r.key(), string(r.Decision), r.Reason))
+			}
+			if strings.Join(got, " ") != tt.want || b.Duplicates != tt.dups {
+				t.Errorf("Parse = %q (重复 %d), want %q (重复 %d)", got, b.Duplicates, tt.want, tt.dups)
+			}
+		})
+	}
+}
+
+// 问题超过上限时只列出前几个
+func TestParseTruncatesProblems(t *testing.T) {
+	rows := [][]string{{"user_id", "id"}}
+	for i := 0; i < maxProblems+5; i++ {
+		rows = append(rows, []string{"x", "1"})
+	}
+	_, err := Parse(rows)
+	if err == nil {
+		t.Fatal("Parse 没有返回错误")
+	}
+	if n := strings.Count(err.Error(), "不是正整数"); n != maxProblems {
+		t.Errorf("列出了 %d 个问题, want %d", n, maxProblems)
+	}
+	if !strings.Contains(err.Error(), "共 15 个问题") {
+		t.Errorf("错误信息没有问题总数: %v", err)
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	b, err := Parse([][]string{
+		{"user_id", "id", "decision", "reason"},
+		{"1001", "1", "lock", ""},
+		{"1002", "2", "reject", "It's\nfake \\"},
+		{"1003", "3", "approve", ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 9, 25, 8, 0, 0, 0, time.UTC)
+	var sb strings.Builder
+	n, err := b.WriteSQL(&sb, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-- approve (通过): 1 条，audit_status 2→1 is_lock 0→0
+UPDATE b_kyc set audit_status = 1,audit_at = '2025-09-25 08:00:00' where audit_status = 2 and is_lock = 0 and user_id = 1003 and id = 3;
+-- reject (拒绝): 1 条，audit_status 2→3 is_lock 0→0
+UPDATE b_kyc set audit_status = 3,audit_at = '2025-09-25 08:00:00',audit_remark = 'It''s fake \\' where audit_status = 2 and is_lock = 0 and user_id = 1002 and id = 2;
+-- lock (锁定): 1 条，audit_status 2→2 is_lock 0→1
+UPDATE b_kyc set is_lock = 1 where audit_status = 2 and is_lock = 0 and user_id = 1001 and id = 1;
+`
+	if n != 3 || sb.String() != want {
+		t.Errorf("WriteSQL = %d\n%s\nwant\n%s", n, sb.String(), want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b_kyc.csv")
+	snapshot := "id,user_id,audit_status,is_lock\n1,1001,2,0\n2,1002,3,0\n3,1003,1,0\n4,9999,2,0\n5,1005,2,x\n"
+	if err := os.WriteFile(path, []byte(snapshot), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Parse([][]string{
+		{"user_id", "id", "decision"},
+		{"1001", "1", "approve"}, // 会变更
+		{"1002", "2", "reject"},  // 已拒绝
+		{"1003", "3", "lock"},    // 已通过，锁定不会变更
+		{"1004", "4", "approve"}, // 属于其他用户
+		{"1005", "5", "approve"}, // 状态无法解析
+		{"1006", "6", "approve"}, // 快照中没有
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := b.Check(s)
+	var got []string
+	for _, c := range report.Skipped {
+		got = append(got, c.ID+":"+string(c.Outcome))
+	}
+	want := "1002/2:already 1003/3:blocked 1004/4:missing 1005/5:blocked 1006/6:missing"
+	if strings.Join(got, " ") != want {
+		t.Errorf("跳过的记录 = %q, want %q", got, want)
+	}
+	if len(b.Records) != 1 || b.Records[0].ID != "1" || b.Counts[Approve] != 1 || b.Counts[Reject] != 0 {
+		t.Errorf("保留的记录 = %+v, counts = %v", b.Records, b.Counts)
+	}
+}
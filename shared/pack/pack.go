@@ -0,0 +1,199 @@
+// Package pack 将任务声明的输出文件打包为 zip，并写入 MANIFEST.json 记录每个文件的行数和 SHA-256，执行脚本据此校验文件
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestName 清单文件名
+const ManifestName = "MANIFEST.json"
+
+// File 压缩包中的一个文件
+type File struct {
+	Path   string `json:"-"`      // 本地文件路径
+	Name   string `json:"name"`   // 压缩包中的文件名，为空时使用 Path 的文件名
+	Lines  int    `json:"lines"`  // 文本文件的行数；Excel 文件无法按行统计，由调用方填写数据行数
+	Bytes  int64  `json:"bytes"`  // 文件大小
+	SHA256 string `json:"sha256"` // 文件内容的 SHA-256
+}
+
+// Paths 将文件路径转换为待打包的文件列表
+func Paths(paths ...string) []File {
+	files := make([]File, len(paths))
+	for i, p := range paths {
+		files[i] = File{Path: p}
+	}
+	return files
+}
+
+// Manifest 压缩包清单
+type Manifest struct {
+	Operation string            `json:"operation"`        // 生成压缩包的操作，例如 redisdel、lockuser、filesplit
+	Params    map[string]string `json:"params,omitempty"` // 操作参数
+	CreatedAt time.Time         `json:"created_at"`
+	Dir       string            `json:"-"` // 压缩包内的顶层目录，为空时文件直接放在压缩包根目录
+	Files     []File            `json:"files"`
+}
+
+// Zip 只将 files 打包到 zipPath，并在同一目录写入 MANIFEST.json
+// 文件名不能重复；Files 和 CreatedAt 会被填充为实际打包的内容
+func (m *Manifest) Zip(zipPath string, files []File) error {
+	names := make(map[string]bool, len(files))
+	m.Files = make([]File, 0, len(files))
+	for _, f := range files {
+		if f.Name == "" {
+			f.Name = filepath.Base(f.Path)
+		}
+		if f.Name == ManifestName || names[f.Name] {
+			return fmt.Errorf("压缩包中的文件名重复: %s", f.Name)
+		}
+		names[f.Name] = true
+		if err := summarize(&f); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, f)
+	}
+	m.CreatedAt = time.Now()
+
+	manifest, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("创建压缩包失败: %v", err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	header := &zip.FileHeader{Name: path.Join(m.Dir, ManifestName), Method: zip.Deflate, Modified: m.CreatedAt}
+	header.SetMode(0644)
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	if _, err := w.Write(manifest); err != nil {
+		return fmt.Errorf("写入清单失败: %v", err)
+	}
+	for _, f := range m.Files {
+		if err := m.add(zw, f); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("保存压缩包失败: %v", err)
+	}
+	return nil
+}
+
+// add 将文件写入压缩包，保留文件权限（执行脚本解压后仍可执行）
+func (m *Manifest) add(zw *zip.Writer, f File) error {
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("打开文件 %s 失败: %v", f.Name, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("读取文件 %s 失败: %v", f.Name, err)
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	header.Name = path.Join(m.Dir, f.Name)
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("写入压缩包失败: %v", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("压缩文件 %s 失败: %v", f.Name, err)
+	}
+	return nil
+}
+
+// summarize 计算文件的大小、SHA-256 和行数（最后一行没有换行符也计为一行）
+func summarize(f *File) error {
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("打开文件 %s 失败: %v", f.Name, err)
+	}
+	defer src.Close()
+
+	h := sha256.New()
+	buf := make([]byte, 64*1024)
+	lines, last := 0, byte('\n')
+	var size int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+			size += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取文件 %s 失败: %v", f.Name, err)
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+
+	f.Bytes = size
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(filepath.Ext(f.Name), ".xlsx") {
+		f.Lines = lines
+	}
+	return nil
+}
+
+// encode 生成清单内容，每个文件的记录占一行，执行脚本不依赖 jq 也能逐行读取
+func (m *Manifest) encode() ([]byte, error) {
+	head, err := json.MarshalIndent(struct {
+		Operation string            `json:"operation"`
+		Params    map[string]string `json:"params,omitempty"`
+		CreatedAt time.Time         `json:"created_at"`
+	}{m.Operation, m.Params, m.CreatedAt}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("生成清单失败: %v", err)
+	}
+
+	var b bytes.Buffer
+	b.Write(bytes.TrimSuffix(head, []byte("\n}")))
+	b.WriteString(",\n  \"files\": [")
+	for i, f := range m.Files {
+		line, err := json.Marshal(f)
+		if err != nil {
+			return nil, fmt.Errorf("生成清单失败: %v", err)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("\n    ")
+		b.Write(line)
+	}
+	b.WriteString("\n  ]\n}\n")
+	return b.Bytes(), nil
+}
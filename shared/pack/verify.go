@@ -0,0 +1,79 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoManifest 目录中没有 MANIFEST.json，调用方据此提示跳过校验的方式
+var ErrNoManifest = errors.New("目录中没有 " + ManifestName)
+
+// Verify 按目录中的 MANIFEST.json 校验待执行的文件，redis-exec 和 sql-exec 在连接数据库之前调用
+// 清单中的文件必须存在且 SHA-256 一致，执行成功后重命名为 xxx<doneSuffix>.ext 的文件校验重命名后的文件；
+// files 中的文件必须记录在清单中
+func Verify(dir string, files []string, doneSuffix string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoManifest
+		}
+		return nil, fmt.Errorf("读取 %s 失败: %v", ManifestName, err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", ManifestName, err)
+	}
+	if len(manifest.Files) == 0 {
+		return nil, fmt.Errorf("%s 中没有文件记录", ManifestName)
+	}
+
+	var problems []string
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		listed[f.Name] = true
+		path := filepath.Join(dir, f.Name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			ext := filepath.Ext(path)
+			path = strings.TrimSuffix(path, ext) + doneSuffix + ext
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("缺少文件 %s", f.Name))
+			continue
+		}
+		if sum != f.SHA256 {
+			problems = append(problems, fmt.Sprintf("%s 的 SHA-256 不一致", f.Name))
+		}
+	}
+	for _, path := range files {
+		if !listed[filepath.Base(path)] {
+			problems = append(problems, fmt.Sprintf("%s 不在清单中", filepath.Base(path)))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s 校验失败，文件可能被修改或不完整: %s", ManifestName, strings.Join(problems, "; "))
+	}
+	return &manifest, nil
+}
+
+// fileSHA256 计算文件的 SHA-256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
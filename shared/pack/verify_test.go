@@ -0,0 +1,124 @@
+package pack
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unzip 将压缩包解压到 dir，与执行前解压 lockuser 等输出的步骤一致
+func unzip(t *testing.T, zipPath, dir string) {
+	t.Helper()
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(f.Name)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// packScripts 打包两个 SQL 文件并解压到新目录，返回解压目录
+func packScripts(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"lock_1.sql": "UPDATE b_user SET status = -1 WHERE id = 1;\n",
+		"lock_2.sql": "UPDATE b_user SET status = -1 WHERE id = 2;\n",
+	} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Manifest{Operation: "lockuser", Dir: "lockuser-files"}
+	zipPath := filepath.Join(src, "lockuser-files.zip")
+	if err := m.Zip(zipPath, Paths(filepath.Join(src, "lock_1.sql"), filepath.Join(src, "lock_2.sql"))); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	unzip(t, zipPath, dir)
+	return dir
+}
+
+func TestVerify(t *testing.T) {
+	dir := packScripts(t)
+	files := []string{filepath.Join(dir, "lock_1.sql"), filepath.Join(dir, "lock_2.sql")}
+
+	manifest, err := Verify(dir, files, "_done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Operation != "lockuser" || len(manifest.Files) != 2 || manifest.Files[0].Lines != 1 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	// 已执行的文件重命名后仍按原内容校验
+	if err := os.Rename(files[0], filepath.Join(dir, "lock_1_done.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(dir, files[1:], "_done"); err != nil {
+		t.Errorf("重命名后校验失败: %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	tests := map[string]struct {
+		change func(dir string) error
+		files  []string
+		want   string
+	}{
+		"修改": {
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "lock_2.sql"), []byte("UPDATE b_user SET status = -1;\n"), 0644)
+			},
+			want: "lock_2.sql 的 SHA-256 不一致",
+		},
+		"缺少": {
+			change: func(dir string) error { return os.Remove(filepath.Join(dir, "lock_1.sql")) },
+			want:   "缺少文件 lock_1.sql",
+		},
+		"不在清单中": {
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "extra.sql"), []byte("DELETE FROM b_user;\n"), 0644)
+			},
+			files: []string{"extra.sql"},
+			want:  "extra.sql 不在清单中",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := packScripts(t)
+			if err := tt.change(dir); err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, f := range tt.files {
+				files = append(files, filepath.Join(dir, f))
+			}
+			_, err := Verify(dir, files, "_done")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Verify(t.TempDir(), nil, "_done"); !errors.Is(err, ErrNoManifest) {
+		t.Errorf("没有清单时 Verify = %v", err)
+	}
+}
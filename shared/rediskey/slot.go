@@ -0,0 +1,244 @@
+package rediskey
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SlotCount Redis Cluster 哈希槽总数
+const SlotCount = 16384
+
+// SlotIndexFileName 分割结果中记录每个文件槽位范围的索引文件
+const SlotIndexFileName = "redis_slots_index.txt"
+
+// crc16 Redis Cluster 使用的 CRC16 (XMODEM) 校验
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// HashSlot 计算 key 所在的哈希槽，存在非空哈希标签 {...} 时只对标签内容计算
+func HashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % SlotCount)
+}
+
+// singleKeyCommands 第一个参数为 key、且只有这一个 key 的命令
+// 不在列表中的命令（select、ping、auth 等没有 key 的命令和未知命令）不能按槽位分割
+var singleKeyCommands = map[string]bool{
+	// 字符串
+	"set": true, "setex": true, "psetex": true, "setnx": true, "get": true, "getdel": true, "getex": true, "getset": true,
+	"append": true, "strlen": true, "setrange": true, "getrange": true,
+	"incr": true, "incrby": true, "incrbyfloat": true, "decr": true, "decrby": true,
+	"setbit": true, "getbit": true, "bitcount": true, "pfadd": true,
+	// 通用
+	"expire": true, "pexpire": true, "expireat": true, "pexpireat": true, "persist": true,
+	"ttl": true, "pttl": true, "type": true, "dump": true, "restore": true,
+	// 哈希
+	"hset": true, "hsetnx": true, "hmset": true, "hget": true, "hmget": true, "hdel": true, "hgetall": true,
+	"hincrby": true, "hincrbyfloat": true, "hexists": true, "hkeys": true, "hvals": true, "hlen": true,
+	// 列表
+	"lpush": true, "rpush": true, "lpushx": true, "rpushx": true, "lpop": true, "rpop": true, "lrange": true,
+	"lrem": true, "lset": true, "ltrim": true, "llen": true, "lindex": true, "linsert": true,
+	// 集合
+	"sadd": true, "srem": true, "smembers": true, "sismember": true, "scard": true, "spop": true, "srandmember": true,
+	// 有序集合
+	"zadd": true, "zrem": true, "zincrby": true, "zscore": true, "zrange": true, "zrangebyscore": true,
+	"zrevrange": true, "zremrangebyscore": true, "zremrangebyrank": true, "zcard": true, "zcount": true,
+	// 流
+	"xadd": true, "xdel": true, "xtrim": true, "xlen": true,
+}
+
+// CommandKeys 返回命令中的 key 列表，没有 key 或不认识的命令返回 nil
+func CommandKeys(args []string) []string {
+	if len(args) < 2 {
+		return nil
+	}
+	verb := strings.ToLower(args[0])
+	switch verb {
+	case "del", "unlink", "exists", "touch", "mget":
+		return args[1:]
+	case "mset", "msetnx":
+		var keys []string
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "eval", "evalsha":
+		// eval script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 || 3+n > len(args) {
+			return nil
+		}
+		return args[3 : 3+n]
+	}
+	if singleKeyCommands[verb] {
+		return args[1:2]
+	}
+	return nil
+}
+
+// CommandSlot 计算一行命令所在的哈希槽，没有 key 或多个 key 跨槽位时返回错误
+func CommandSlot(line string) (int, error) {
+	// key 中不含空白，按空白拆分即可取到全部 key；脚本中带空白的 eval 无法取到 numkeys，返回错误
+	args := strings.Fields(line)
+	keys := CommandKeys(args)
+	if len(keys) == 0 {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("命令中没有 key")
+		}
+		return 0, fmt.Errorf("%s 命令没有 key 或不支持按槽位分割", args[0])
+	}
+
+	slot := HashSlot(keys[0])
+	for _, key := range keys[1:] {
+		if other := HashSlot(key); other != slot {
+			return 0, fmt.Errorf("多个 key 跨槽位 (%s: %d, %s: %d)", keys[0], slot, key, other)
+		}
+	}
+	return slot, nil
+}
+
+// SlotPart 按槽位分割后的单个文件
+type SlotPart struct {
+	File    string
+	MinSlot int
+	MaxSlot int
+	Slots   int
+	Lines   int
+}
+
+// SplitBySlot 按哈希槽分割 Redis 命令文件
+// 同一槽位（同一哈希标签，即同一用户）的命令保持原有顺序并写入同一个文件，
+// 每个文件按槽位升序覆盖一段连续的槽位范围，行数尽量不超过 maxLines
+func SplitBySlot(inputFile, outputDir string, maxLines int) ([]SlotPart, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// 增加缓冲区大小以处理超长的行
+	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
+	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
+
+	groups := make(map[int][]string)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		slot, err := CommandSlot(line)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行 %v: %s", lineNum, err, line)
+		}
+		groups[slot] = append(groups[slot], line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取文件时发生错误: %v", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	slots := make([]int, 0, len(groups))
+	for slot := range groups {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	var parts []SlotPart
+	var current *SlotPart
+	var writer *bufio.Writer
+	var outFile *os.File
+
+	closeCurrent := func() error {
+		if outFile == nil {
+			return nil
+		}
+		if err := writer.Flush(); err != nil {
+			outFile.Close()
+			return fmt.Errorf("写入文件失败: %v", err)
+		}
+		return outFile.Close()
+	}
+
+	for _, slot := range slots {
+		lines := groups[slot]
+		// 同一槽位的命令不拆开，单个槽位超过 maxLines 时独占一个文件
+		if current == nil || (current.Lines > 0 && current.Lines+len(lines) > maxLines) {
+			if err := closeCurrent(); err != nil {
+				return nil, err
+			}
+			parts = append(parts, SlotPart{
+				File:    filepath.Join(outputDir, fmt.Sprintf("redis_commands_part_%04d.txt", len(parts)+1)),
+				MinSlot: slot,
+			})
+			current = &parts[len(parts)-1]
+			outFile, err = os.Create(current.File)
+			if err != nil {
+				return nil, fmt.Errorf("创建输出文件失败: %v", err)
+			}
+			writer = bufio.NewWriter(outFile)
+		}
+
+		for _, line := range lines {
+			if _, err := writer.WriteString(line + "\n"); err != nil {
+				outFile.Close()
+				return nil, fmt.Errorf("写入文件失败: %v", err)
+			}
+		}
+		current.MaxSlot = slot
+		current.Slots++
+		current.Lines += len(lines)
+	}
+	if err := closeCurrent(); err != nil {
+		return nil, err
+	}
+
+	if err := writeSlotIndex(filepath.Join(outputDir, SlotIndexFileName), parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// writeSlotIndex 写入槽位索引，便于按节点的槽位范围分配文件
+func writeSlotIndex(path string, parts []SlotPart) error {
+	var sb strings.Builder
+	sb.WriteString("# file\tslot_range\tslots\tlines\n")
+	for _, part := range parts {
+		sb.WriteString(fmt.Sprintf("%s\t%d-%d\t%d\t%d\n",
+			filepath.Base(part.File), part.MinSlot, part.MaxSlot, part.Slots, part.Lines))
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("写入槽位索引失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package rediskey
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashSlot(t *testing.T) {
+	// 期望值来自 Redis Cluster 规范和 CLUSTER KEYSLOT
+	for key, want := range map[string]int{
+		"123456789":            12739,
+		"foo":                  12182,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"user1000":             3443,
+		"foo{{bar}}zap":        HashSlot("{bar"),
+		"foo{bar}{zap}":        HashSlot("bar"),
+	} {
+		if got := HashSlot(key); got != want {
+			t.Errorf("HashSlot(%q) = %d, want %d", key, got, want)
+		}
+	}
+	// 空哈希标签时对整个 key 计算
+	if HashSlot("foo{}{bar}") == HashSlot("bar") {
+		t.Error("空哈希标签不应只对后面的标签计算")
+	}
+}
+
+func TestCommandSlot(t *testing.T) {
+	if slot, err := CommandSlot("del user:token:{1001} user:info:{1001}"); err != nil || slot != HashSlot("1001") {
+		t.Errorf("同一哈希标签 = %d, %v", slot, err)
+	}
+	if slot, err := CommandSlot("mset a:{1} x b:{1} y"); err != nil || slot != HashSlot("1") {
+		t.Errorf("mset = %d, %v", slot, err)
+	}
+	if _, err := CommandSlot("del user:{1001} user:{1002}"); err == nil || !strings.Contains(err.Error(), "跨槽位") {
+		t.Errorf("跨槽位 = %v", err)
+	}
+	if slot, err := CommandSlot("evalsha 1a2b 2 a:{7} b:{7} 1001"); err != nil || slot != HashSlot("7") {
+		t.Errorf("evalsha = %d, %v", slot, err)
+	}
+	if slot, err := CommandSlot("HSET user:{1001} field value"); err != nil || slot != HashSlot("1001") {
+		t.Errorf("hset = %d, %v", slot, err)
+	}
+
+	// 没有 key 的命令和不认识的命令不能把参数当作 key 计算槽位
+	for _, line := range []string{"ping", "ping foo", "select 0", "auth secret", "flushdb async", "unknowncmd user:{1}", "evalsha 1a2b 0 x", "evalsha 1a2b 3 a:{1}", "eval \"return redis.call(KEYS[1])\" 1 a:{1}", ""} {
+		if slot, err := CommandSlot(line); err == nil {
+			t.Errorf("CommandSlot(%q) = %d, 应返回错误", line, slot)
+		}
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	for line, want := range map[string]string{
+		"del a b c":              "a,b,c",
+		"mset a 1 b 2":           "a,b",
+		"set a 1 ex 60":          "a",
+		"zadd z 1 m":             "z",
+		"evalsha abc 1 k arg":    "k",
+		"eval s 0":               "",
+		"select 0":               "",
+		"ping foo":               "",
+		"auth user secret":       "",
+		"config set maxmemory 1": "",
+	} {
+		if got := strings.Join(CommandKeys(strings.Fields(line)), ","); got != want {
+			t.Errorf("CommandKeys(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestSplitBySlot(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "commands.txt")
+	var lines []string
+	for _, uid := range []string{"1001", "1002", "1003", "1004", "1005"} {
+		lines = append(lines, "del user:token:{"+uid+"}", "del user:info:{"+uid+"}")
+	}
+	content := "# 注释\n\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(input, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := filepath.Join(dir, "out")
+	parts, err := SplitBySlot(input, outputDir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("文件数 = %d, want 3", len(parts))
+	}
+
+	total := 0
+	lastSlot := -1
+	for _, part := range parts {
+		data, err := os.ReadFile(part.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileLines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(fileLines) != part.Lines || part.Lines > 4 {
+			t.Errorf("%s: %d 行, 记录 %d 行", part.File, len(fileLines), part.Lines)
+		}
+		// 每个文件覆盖一段升序的槽位，同一用户的命令相邻且保持原有顺序
+		if part.MinSlot <= lastSlot || part.MaxSlot < part.MinSlot {
+			t.Errorf("%s: 槽位范围 %d-%d 与上一个文件重叠", part.File, part.MinSlot, part.MaxSlot)
+		}
+		lastSlot = part.MaxSlot
+		for i := 0; i < len(fileLines); i += 2 {
+			uid := fileLines[i][strings.Index(fileLines[i], "{"):]
+			if fileLines[i] != "del user:token:"+uid || fileLines[i+1] != "del user:info:"+uid {
+				t.Errorf("%s: 同一用户的命令不相邻: %q", part.File, fileLines[i:i+2])
+			}
+		}
+		total += part.Lines
+	}
+	if total != len(lines) {
+		t.Errorf("总行数 = %d, want %d", total, len(lines))
+	}
+
+	index, err := os.ReadFile(filepath.Join(outputDir, SlotIndexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(index), "\n"); got != len(parts)+1 {
+		t.Errorf("索引行数 = %d, want %d", got, len(parts)+1)
+	}
+
+	if err := os.WriteFile(input, []byte("del a:{1} b:{2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SplitBySlot(input, outputDir, 4); err == nil || !strings.Contains(err.Error(), "第 1 行") {
+		t.Errorf("跨槽位命令 = %v", err)
+	}
+	// 没有 key 的命令不会被分到某个槽位的文件中
+	if err := os.WriteFile(input, []byte("del a:{1}\nselect 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SplitBySlot(input, outputDir, 4); err == nil || !strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("没有 key 的命令 = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package rediskey Redis key模板的解析和渲染、Redis Cluster 哈希槽计算和按槽位分割命令文件，根目录命令行工具、tgbot、webbot 共用同一套规则
+package rediskey
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultLockUser 默认的锁定用户Redis key模板
+const DefaultLockUser = "0=user:token:{uid},user:info:{uid}"
+
+// Template 单个Redis DB中的key模板
+// 模板中的 {uid} 替换为 {用户ID}（保留花括号作为哈希标签），<uid> 替换为不带花括号的用户ID
+type Template struct {
+	DB        int
+	Templates []string
+}
+
+// ParseTemplates 解析key模板配置
+// 格式: "0=user:token:{uid},user:info:{uid};2=session:{uid}"，分号分隔DB，逗号分隔模板
+// 模板错误会导致删除错误的key，调用方应在启动时解析并拒绝无效配置
+func ParseTemplates(spec string) ([]Template, error) {
+	var result []Template
+	seen := make(map[int]bool)
+
+	for _, group := range strings.Split(spec, ";") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+
+		dbPart, keysPart, ok := strings.Cut(group, "=")
+		if !ok {
+			return nil, fmt.Errorf("缺少DB编号: %s", group)
+		}
+		db, err := strconv.Atoi(strings.TrimSpace(dbPart))
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("DB编号无效: %s", dbPart)
+		}
+		if seen[db] {
+			return nil, fmt.Errorf("DB %d 重复配置", db)
+		}
+		seen[db] = true
+
+		var templates []string
+		for _, tpl := range strings.Split(keysPart, ",") {
+			tpl = strings.TrimSpace(tpl)
+			if tpl == "" {
+				continue
+			}
+			if !strings.Contains(tpl, "{uid}") && !strings.Contains(tpl, "<uid>") {
+				return nil, fmt.Errorf("模板缺少 {uid} 或 <uid> 占位符: %s", tpl)
+			}
+			if strings.ContainsAny(tpl, " \t") {
+				return nil, fmt.Errorf("模板不能包含空白: %s", tpl)
+			}
+			templates = append(templates, tpl)
+		}
+		if len(templates) == 0 {
+			return nil, fmt.Errorf("DB %d 没有配置key模板", db)
+		}
+
+		result = append(result, Template{DB: db, Templates: templates})
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("没有配置任何key模板")
+	}
+	return result, nil
+}
+
+// Render 按模板生成指定用户的key
+func Render(template, uid string) string {
+	key := strings.ReplaceAll(template, "{uid}", "{"+uid+"}")
+	return strings.ReplaceAll(key, "<uid>", uid)
+}
+
+// DelCommands 按key模板生成用户的 del 命令，同一用户的命令相邻
+func DelCommands(templates, uids []string) []string {
+	commands := make([]string, 0, len(templates)*len(uids))
+	for _, uid := range uids {
+		for _, template := range templates {
+			commands = append(commands, "del "+Render(template, uid))
+		}
+	}
+	return commands
+}
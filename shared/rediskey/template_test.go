@@ -0,0 +1,68 @@
+package rediskey
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	got, err := ParseTemplates(" 0=user:token:{uid}, user:info:{uid} ; 2=session:<uid>;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Template{
+		{DB: 0, Templates: []string{"user:token:{uid}", "user:info:{uid}"}},
+		{DB: 2, Templates: []string{"session:<uid>"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTemplates = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseTemplates(DefaultLockUser); err != nil {
+		t.Errorf("默认模板无效: %v", err)
+	}
+}
+
+func TestParseTemplatesRejects(t *testing.T) {
+	for spec, want := range map[string]string{
+		"":                             "没有配置任何key模板",
+		"user:{uid}":                   "缺少DB编号",
+		"a=user:{uid}":                 "DB编号无效",
+		"-1=user:{uid}":                "DB编号无效",
+		"0=user:{uid};0=info:{uid}":    "DB 0 重复配置",
+		"0=user:token":                 "缺少 {uid} 或 <uid> 占位符",
+		"0=user:uid":                   "缺少 {uid} 或 <uid> 占位符",
+		"0=user:\t{uid}":               "不能包含空白",
+		"0=, ;1=user:{uid}":            "DB 0 没有配置key模板",
+		"0=user:{uid};1=info:{uid};1=": "DB 1 重复配置",
+	} {
+		if _, err := ParseTemplates(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseTemplates(%q) = %v, want %s", spec, err, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	for tpl, want := range map[string]string{
+		"user:token:{uid}":  "user:token:{1001}",
+		"session:<uid>":     "session:1001",
+		"a:{uid}:b:<uid>":   "a:{1001}:b:1001",
+		"plain:{uid}:{uid}": "plain:{1001}:{1001}",
+	} {
+		if got := Render(tpl, "1001"); got != want {
+			t.Errorf("Render(%q) = %q, want %q", tpl, got, want)
+		}
+	}
+}
+
+func TestDelCommands(t *testing.T) {
+	got := DelCommands([]string{"user:token:{uid}", "session:<uid>"}, []string{"1", "2"})
+	want := []string{"del user:token:{1}", "del session:1", "del user:token:{2}", "del session:2"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DelCommands = %q, want %q", got, want)
+	}
+	if got := DelCommands([]string{"a:{uid}"}, nil); len(got) != 0 {
+		t.Errorf("没有用户时 DelCommands = %q", got)
+	}
+}
@@ -0,0 +1,270 @@
+// Package review 为需要审批的输出文件生成审核摘要：行数、示例语句和检查发现的问题
+package review
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 检查结果级别
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+)
+
+// DefaultSamples 每个文件默认展示的示例语句数
+const DefaultSamples = 3
+
+// maxFindings 最多记录的问题数，超过后只计数
+const maxFindings = 50
+
+// FileSummary 单个输出文件的摘要
+type FileSummary struct {
+	Name    string   `json:"name"`
+	Lines   int      `json:"lines"`
+	Samples []string `json:"samples"`
+}
+
+// Finding 检查发现的问题
+type Finding struct {
+	Level   string `json:"level"`
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// String 返回问题的单行描述
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("[%s] %s:%d %s", f.Level, f.File, f.Line, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s %s", f.Level, f.File, f.Message)
+}
+
+// Summary 输出包的审核摘要
+type Summary struct {
+	Files         []FileSummary `json:"files"`
+	TotalLines    int           `json:"total_lines"`
+	Findings      []Finding     `json:"findings"`
+	ErrorCount    int           `json:"error_count"`
+	WarnCount     int           `json:"warn_count"`
+	TruncatedHint string        `json:"truncated_hint,omitempty"`
+}
+
+// HasErrors 是否存在错误级别的问题
+func (s *Summary) HasErrors() bool {
+	return s.ErrorCount > 0
+}
+
+// Summarize 读取输出文件生成摘要，zip 文件会逐个读取其中的文件
+func Summarize(paths []string, samples int) (*Summary, error) {
+	if samples <= 0 {
+		samples = DefaultSamples
+	}
+	s := &Summary{}
+	for _, path := range paths {
+		if strings.EqualFold(filepath.Ext(path), ".zip") {
+			if err := s.addZip(path, samples); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("打开输出文件失败: %v", err)
+		}
+		err = s.add(filepath.Base(path), file, samples)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dropped := s.ErrorCount + s.WarnCount - len(s.Findings); dropped > 0 {
+		s.TruncatedHint = fmt.Sprintf("另有 %d 个问题未列出", dropped)
+	}
+	return s, nil
+}
+
+// addZip 读取 zip 中的每个文件
+func (s *Summary) addZip(path string, samples int) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("打开压缩包失败: %v", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("读取压缩包文件 %s 失败: %v", f.Name, err)
+		}
+		err = s.add(filepath.Base(path)+"/"+f.Name, rc, samples)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add 统计单个文件并逐行检查
+func (s *Summary) add(name string, r io.Reader, samples int) error {
+	fs := FileSummary{Name: name}
+	kind := fileKind(name)
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fs.Lines++
+		if len(fs.Samples) < samples {
+			fs.Samples = append(fs.Samples, line)
+		}
+
+		if first, ok := seen[line]; ok {
+			s.addFinding(Finding{Level: LevelWarn, File: name, Line: lineNum, Message: fmt.Sprintf("与第 %d 行重复", first)})
+		} else {
+			seen[line] = lineNum
+		}
+
+		switch kind {
+		case kindSQL:
+			s.checkSQL(name, lineNum, line)
+		case kindRedis:
+			s.checkRedis(name, lineNum, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", name, err)
+	}
+	if fs.Lines == 0 {
+		s.addFinding(Finding{Level: LevelWarn, File: name, Message: "文件为空"})
+	}
+
+	s.Files = append(s.Files, fs)
+	s.TotalLines += fs.Lines
+	return nil
+}
+
+// 文件类型
+const (
+	kindOther = iota
+	kindSQL
+	kindRedis
+)
+
+// fileKind 按扩展名判断文件类型，Redis 命令文件为 .txt
+func fileKind(name string) int {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".sql":
+		return kindSQL
+	case ".txt", ".redis":
+		return kindRedis
+	default:
+		return kindOther
+	}
+}
+
+var (
+	sqlWriteRe = regexp.MustCompile(`(?i)^\s*(update|delete)\b`)
+	sqlWhereRe = regexp.MustCompile(`(?i)\bwhere\b`)
+	sqlDDLRe   = regexp.MustCompile(`(?i)^\s*(drop|truncate|alter)\b`)
+)
+
+// checkSQL 检查 SQL 语句：没有 WHERE 的更新/删除、DDL、缺少分号
+func (s *Summary) checkSQL(name string, lineNum int, line string) {
+	switch {
+	case sqlDDLRe.MatchString(line):
+		s.addFinding(Finding{Level: LevelError, File: name, Line: lineNum, Message: "包含 DDL 语句"})
+	case sqlWriteRe.MatchString(line) && !sqlWhereRe.MatchString(line):
+		s.addFinding(Finding{Level: LevelError, File: name, Line: lineNum, Message: "UPDATE/DELETE 缺少 WHERE 条件"})
+	}
+	if !strings.HasSuffix(line, ";") {
+		s.addFinding(Finding{Level: LevelWarn, File: name, Line: lineNum, Message: "语句未以分号结尾"})
+	}
+}
+
+// dangerousRedisCommands 不应出现在批量命令文件中的 Redis 命令
+var dangerousRedisCommands = map[string]bool{
+	"FLUSHALL": true,
+	"FLUSHDB":  true,
+	"KEYS":     true,
+	"CONFIG":   true,
+	"SHUTDOWN": true,
+}
+
+// checkRedis 检查 Redis 命令：危险命令、缺少 key、key 中包含通配符
+func (s *Summary) checkRedis(name string, lineNum int, line string) {
+	fields := strings.Fields(line)
+	command := strings.ToUpper(fields[0])
+	if dangerousRedisCommands[command] {
+		s.addFinding(Finding{Level: LevelError, File: name, Line: lineNum, Message: "包含危险命令 " + command})
+		return
+	}
+	if len(fields) < 2 {
+		s.addFinding(Finding{Level: LevelError, File: name, Line: lineNum, Message: "命令缺少 key"})
+		return
+	}
+	if command == "DEL" || command == "UNLINK" {
+		for _, key := range fields[1:] {
+			if strings.ContainsAny(key, "*?[") {
+				s.addFinding(Finding{Level: LevelError, File: name, Line: lineNum, Message: "删除的 key 包含通配符: " + key})
+			}
+		}
+	}
+}
+
+// addFinding 记录问题，超过上限后只计数
+func (s *Summary) addFinding(f Finding) {
+	if f.Level == LevelError {
+		s.ErrorCount++
+	} else {
+		s.WarnCount++
+	}
+	if len(s.Findings) < maxFindings {
+		s.Findings = append(s.Findings, f)
+	}
+}
+
+// Text 返回纯文本格式的摘要，用于消息通知
+func (s *Summary) Text(maxSampleLen int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📄 共 %d 个文件，%d 行\n", len(s.Files), s.TotalLines))
+	for _, f := range s.Files {
+		sb.WriteString(fmt.Sprintf("\n• %s: %d 行\n", f.Name, f.Lines))
+		for _, sample := range f.Samples {
+			if maxSampleLen > 0 && len([]rune(sample)) > maxSampleLen {
+				sample = string([]rune(sample)[:maxSampleLen]) + "…"
+			}
+			sb.WriteString("  " + sample + "\n")
+		}
+	}
+	if len(s.Findings) == 0 {
+		sb.WriteString("\n✅ 检查未发现问题\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("\n⚠️ 检查发现 %d 个错误，%d 个警告\n", s.ErrorCount, s.WarnCount))
+	for i, f := range s.Findings {
+		if i >= 10 {
+			sb.WriteString(fmt.Sprintf("… 另有 %d 个问题\n", s.ErrorCount+s.WarnCount-10))
+			break
+		}
+		sb.WriteString(f.String() + "\n")
+	}
+	return sb.String()
+}
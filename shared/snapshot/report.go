@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Outcome 目标ID对照快照的检查结果
+type Outcome string
+
+const (
+	Change  Outcome = "change"  // 满足SQL条件，执行后会变更
+	Missing Outcome = "missing" // 快照中没有该记录
+	Already Outcome = "already" // 已经是目标状态
+	Blocked Outcome = "blocked" // 当前状态不满足SQL条件，执行后不会变更
+)
+
+// Outcomes 所有检查结果，按报告顺序排列
+var Outcomes = []Outcome{Change, Missing, Already, Blocked}
+
+// String 返回检查结果的中文名称
+func (o Outcome) String() string {
+	switch o {
+	case Missing:
+		return "不存在"
+	case Already:
+		return "已是目标状态"
+	case Blocked:
+		return "不满足条件"
+	default:
+		return "会变更"
+	}
+}
+
+// Check 一个未生成SQL的目标ID
+type Check struct {
+	ID      string
+	Outcome Outcome
+	Detail  string // 快照中的当前状态或原因
+}
+
+// Report 对照快照的检查结果
+type Report struct {
+	Table    string // 目标表
+	Snapshot string // 快照文件名
+	Rows     int    // 快照数据行数
+	Counts   map[Outcome]int
+	Skipped  []Check // 按输入顺序，不含会变更的ID
+}
+
+// NewReport 创建对照快照 s 检查 table 的报告
+func NewReport(table string, s *Snapshot) *Report {
+	return &Report{Table: table, Snapshot: s.Name, Rows: s.Rows, Counts: make(map[Outcome]int)}
+}
+
+// Add 记录一个目标ID的检查结果
+func (r *Report) Add(id string, outcome Outcome, detail string) {
+	r.Counts[outcome]++
+	if outcome != Change {
+		r.Skipped = append(r.Skipped, Check{ID: id, Outcome: outcome, Detail: detail})
+	}
+}
+
+// Summary 返回各检查结果的数量
+func (r *Report) Summary() string {
+	lines := []string{fmt.Sprintf("对照快照 %s（%s %d 行）", r.Snapshot, r.Table, r.Rows)}
+	for _, o := range Outcomes {
+		if r.Counts[o] > 0 || o == Change {
+			lines = append(lines, fmt.Sprintf("%s %s: %d", o, string(o), r.Counts[o]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteCSV 写出未生成SQL的目标ID：id、检查结果和当前状态
+func (r *Report) WriteCSV(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建快照检查报告失败: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "id,outcome,detail")
+	for _, c := range r.Skipped {
+		fmt.Fprintf(w, "%s,%s,%s\n", c.ID, string(c.Outcome), strings.ReplaceAll(c.Detail, ",", " "))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入快照检查报告失败: %v", err)
+	}
+	return file.Close()
+}
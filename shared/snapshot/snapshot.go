@@ -0,0 +1,131 @@
+// Package snapshot 读取数据库当前状态的CSV导出（快照），生成变更脚本前逐个检查目标ID：
+// 不存在、已是目标状态或不满足SQL条件的ID写入检查报告，只为执行后确实会变更的ID生成SQL
+package snapshot
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IDColumn 快照中每行记录的主键列
+const IDColumn = "id"
+
+// Snapshot 按 id 列索引的快照，只保留检查需要的列
+type Snapshot struct {
+	Name    string // 快照文件名，用于报告
+	Rows    int    // 数据行数（不含表头和空行）
+	columns []string
+	rows    map[string][]string
+}
+
+// Load 读取快照CSV，第一行为列名（不区分大小写，可带反引号），必须包含 id 列和 columns 中的列
+// 同一个 id 出现多次时返回错误，快照应直接从数据库导出
+func Load(path string, columns ...string) (*Snapshot, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return nil, fmt.Errorf("快照只支持CSV格式的文件")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开快照文件失败: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("快照文件为空")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取快照表头失败: %v", err)
+	}
+
+	// 需要的列在快照中的位置，第一个为 id 列
+	names := append([]string{IDColumn}, columns...)
+	index := make([]int, len(names))
+	for i, name := range names {
+		index[i] = -1
+		for j, cell := range header {
+			cell = strings.Trim(strings.TrimSpace(strings.TrimPrefix(cell, "\ufeff")), "`\"")
+			if strings.EqualFold(cell, name) {
+				index[i] = j
+				break
+			}
+		}
+		if index[i] < 0 {
+			return nil, fmt.Errorf("快照缺少 %s 列，需要的列: %s", name, strings.Join(names, ", "))
+		}
+	}
+
+	s := &Snapshot{Name: filepath.Base(path), columns: columns, rows: make(map[string][]string)}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取快照第 %d 行失败: %v", line, err)
+		}
+		values := make([]string, len(index))
+		empty := true
+		for i, j := range index {
+			if j < len(record) {
+				values[i] = strings.TrimSpace(record[j])
+			}
+			if values[i] != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		id := values[0]
+		if id == "" {
+			return nil, fmt.Errorf("快照第 %d 行没有 id", line)
+		}
+		if _, ok := s.rows[id]; ok {
+			return nil, fmt.Errorf("快照第 %d 行的 id %s 重复", line, id)
+		}
+		s.rows[id] = values[1:]
+		s.Rows++
+	}
+	if s.Rows == 0 {
+		return nil, fmt.Errorf("快照中没有数据行")
+	}
+	return s, nil
+}
+
+// Row 快照中的一行
+type Row struct {
+	columns []string
+	values  []string
+}
+
+// Get 按 id 查找快照中的一行
+func (s *Snapshot) Get(id string) (Row, bool) {
+	values, ok := s.rows[id]
+	return Row{columns: s.columns, values: values}, ok
+}
+
+// Get 返回列的值，列不是 Load 时指定的列时返回空字符串
+func (r Row) Get(column string) string {
+	for i, name := range r.columns {
+		if name == column {
+			return r.values[i]
+		}
+	}
+	return ""
+}
+
+// String 返回当前状态的说明，例如 "audit_status=2 is_lock=0"
+func (r Row) String() string {
+	parts := make([]string, len(r.columns))
+	for i, name := range r.columns {
+		parts[i] = name + "=" + r.values[i]
+	}
+	return strings.Join(parts, " ")
+}
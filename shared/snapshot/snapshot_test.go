@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSnapshot 把快照内容写入临时目录中的 name
+func writeSnapshot(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string // 按 id 查到的行，格式 id:Row.String()，空格分隔
+		rows    int
+		wantErr string
+	}{
+		{
+			name:    "BOM、反引号和大小写不同的列名",
+			file:    "b_user.csv",
+			content: "\ufeff`ID`,name,\"Status\"\n1, alice ,0\n2,bob,-1\n",
+			want:    "1:status=0 2:status=-1",
+			rows:    2,
+		},
+		{
+			name:    "空行和列数不足的行",
+			file:    "b_user.CSV",
+			content: "id,status\n\n1,0\n,\n3\n",
+			want:    "1:status=0 3:status=",
+			rows:    2,
+		},
+		{name: "不是CSV", file: "b_user.xlsx", content: "id,status\n1,0\n", wantErr: "只支持CSV"},
+		{name: "空文件", file: "b_user.csv", content: "", wantErr: "快照文件为空"},
+		{name: "缺少列", file: "b_user.csv", content: "id,name\n1,alice\n", wantErr: "快照缺少 status 列，需要的列: id, status"},
+		{name: "只有表头", file: "b_user.csv", content: "id,status\n", wantErr: "快照中没有数据行"},
+		{name: "没有id", file: "b_user.csv", content: "id,status\n1,0\n,-1\n", wantErr: "快照第 3 行没有 id"},
+		{name: "id重复", file: "b_user.csv", content: "id,status\n1,0\n2,0\n1,-1\n", wantErr: "快照第 4 行的 id 1 重复"},
+		{name: "引号不完整", file: "b_user.csv", content: "id,status\n1,\"0\n", wantErr: "读取快照第 2 行失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadUsers(writeSnapshot(t, tt.file, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load 错误 = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, id := range strings.Fields(tt.want) {
+				id, _, _ = strings.Cut(id, ":")
+				row, ok := s.Get(id)
+				if !ok {
+					t.Fatalf("快照中没有 id %s", id)
+				}
+				got = append(got, id+":"+row.String())
+			}
+			if strings.Join(got, " ") != tt.want || s.Rows != tt.rows || s.Name != tt.file {
+				t.Errorf("Load = %q (%d 行, %s), want %q (%d 行)", got, s.Rows, s.Name, tt.want, tt.rows)
+			}
+		})
+	}
+}
+
+func TestCheckLock(t *testing.T) {
+	s, err := LoadUsers(writeSnapshot(t, "b_user.csv", "id,status\n1,0\n2,-1\n3,1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, report := CheckLock(s, []string{"3", "2", "9", "1"})
+	if strings.Join(kept, ",") != "3,1" {
+		t.Errorf("会变更的用户 = %v, want [3 1]", kept)
+	}
+	if report.Counts[Change] != 2 || report.Counts[Already] != 1 || report.Counts[Missing] != 1 {
+		t.Errorf("Counts = %v", report.Counts)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := report.WriteCSV(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,outcome,detail\n2,already,status=-1\n9,missing,快照中没有该用户\n"
+	if string(data) != want {
+		t.Errorf("报告 = %q, want %q", data, want)
+	}
+	if summary := report.Summary(); !strings.Contains(summary, "对照快照 b_user.csv（b_user 3 行）") || strings.Contains(summary, "blocked") {
+		t.Errorf("Summary = %q", summary)
+	}
+}
@@ -0,0 +1,37 @@
+package snapshot
+
+import "strings"
+
+const (
+	// UserTable 用户表名
+	UserTable = "b_user"
+	// UserStatusColumn 用户状态列
+	UserStatusColumn = "status"
+	// LockedStatus 已锁定用户的状态
+	LockedStatus = "-1"
+)
+
+// LoadUsers 读取 b_user 快照，需要 id 和 status 列
+func LoadUsers(path string) (*Snapshot, error) {
+	return Load(path, UserStatusColumn)
+}
+
+// CheckLock 对照 b_user 快照检查待锁定的用户，返回会变更的用户ID（保持输入顺序）
+// 锁定SQL的条件为 status != -1，快照中没有的用户不存在，status 已为 -1 的用户已锁定
+func CheckLock(s *Snapshot, ids []string) ([]string, *Report) {
+	report := NewReport(UserTable, s)
+	var kept []string
+	for _, id := range ids {
+		row, ok := s.Get(id)
+		switch {
+		case !ok:
+			report.Add(id, Missing, "快照中没有该用户")
+		case strings.TrimSpace(row.Get(UserStatusColumn)) == LockedStatus:
+			report.Add(id, Already, row.String())
+		default:
+			report.Add(id, Change, "")
+			kept = append(kept, id)
+		}
+	}
+	return kept, report
+}
@@ -0,0 +1,308 @@
+package split
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mode 分割方式
+type Mode string
+
+const (
+	ByLines Mode = "lines" // 每个文件固定行数
+	ByBytes Mode = "bytes" // 每个文件不超过指定大小，只在行边界切分
+	ByParts Mode = "parts" // 按行数平均分为指定份数
+	ByKey   Mode = "key"   // 同一ID的行写入同一个文件，每个文件的行数尽量不超过指定行数
+)
+
+// HeaderMode CSV/Excel 第一行的处理方式
+type HeaderMode string
+
+const (
+	HeaderAuto HeaderMode = "auto" // CSV/Excel 第一行的ID列不是数字时视为表头，文本文件没有表头
+	HeaderYes  HeaderMode = "yes"  // 第一行是表头
+	HeaderNo   HeaderMode = "no"   // 没有表头
+)
+
+const (
+	// DefaultLines 默认每个文件的行数
+	DefaultLines = 10000
+	// DefaultBytes 按大小分割时默认每个文件的大小
+	DefaultBytes = 10 * 1024 * 1024 // 10MB
+	// DefaultParts 按份数分割时默认的份数
+	DefaultParts = 10
+	// DefaultPattern 默认的分割文件命名规则
+	DefaultPattern = "{name}_part_{n}{ext}"
+	// MaxParts 一次最多生成的分割文件数，按ID分组时所有文件同时打开，不能超过进程的文件句柄上限
+	MaxParts = 500
+	// minBytes 按大小分割时每个文件的最小大小
+	minBytes = 1024
+)
+
+// Options 分割参数
+type Options struct {
+	Mode      Mode
+	Lines     int        // lines/key 模式每个文件的最大数据行数（不含表头）
+	Bytes     int64      // bytes 模式每个文件的最大字节数（含表头）
+	Parts     int        // parts 模式分割的份数
+	KeyColumn int        // key 模式 CSV/Excel 中作为ID的列，从 1 开始；文本文件使用 Redis 命令的哈希标签或 key
+	Header    HeaderMode // CSV/Excel 第一行是否为表头，表头会写入每个分割文件
+	Pattern   string     // 分割文件命名规则，{name} 原文件名、{n} 四位序号、{ext} 扩展名
+}
+
+// ParseOptions 解析网页表单、机器人命令或命令行中的分割参数，空值使用默认值
+// size 的含义取决于分割方式：lines/key 为行数，bytes 为大小（支持 KB/MB 单位），parts 为份数
+func ParseOptions(mode, size, header, column, pattern string) (Options, error) {
+	var opts Options
+	switch Mode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", ByLines:
+		opts.Mode = ByLines
+	case ByBytes, "size":
+		opts.Mode = ByBytes
+	case ByParts:
+		opts.Mode = ByParts
+	case ByKey:
+		opts.Mode = ByKey
+	default:
+		return opts, fmt.Errorf("不支持的分割方式 %q，可选 lines/bytes/parts/key", mode)
+	}
+
+	size = strings.TrimSpace(size)
+	if size != "" {
+		switch opts.Mode {
+		case ByBytes:
+			n, err := ParseSize(size)
+			if err != nil {
+				return opts, err
+			}
+			opts.Bytes = n
+		default:
+			n, err := strconv.Atoi(size)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("%s必须是正整数: %s", opts.sizeName(), size)
+			}
+			if opts.Mode == ByParts {
+				opts.Parts = n
+			} else {
+				opts.Lines = n
+			}
+		}
+	}
+
+	switch HeaderMode(strings.ToLower(strings.TrimSpace(header))) {
+	case "", HeaderAuto:
+		opts.Header = HeaderAuto
+	case HeaderYes, "true", "1":
+		opts.Header = HeaderYes
+	case HeaderNo, "false", "0":
+		opts.Header = HeaderNo
+	default:
+		return opts, fmt.Errorf("表头参数无效 %q，可选 auto/yes/no", header)
+	}
+
+	if column = strings.TrimSpace(column); column != "" {
+		n, err := strconv.Atoi(column)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("ID列必须是正整数（从 1 开始）: %s", column)
+		}
+		opts.KeyColumn = n
+	}
+	opts.Pattern = strings.TrimSpace(pattern)
+
+	return opts.normalize()
+}
+
+// ParseArgs 解析机器人命令参数，格式: [分割方式] [行数/大小/份数] [header=auto|yes|no] [col=N] [name=命名规则]
+// 例如 "bytes 5MB"、"key 20000 col=2"、"parts 4 name={name}-{n}{ext}"
+func ParseArgs(args string) (Options, error) {
+	var positional []string
+	values := make(map[string]string)
+	for _, field := range strings.Fields(args) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			positional = append(positional, field)
+			continue
+		}
+		switch k = strings.ToLower(k); k {
+		case "header", "col", "name":
+			values[k] = v
+		default:
+			return Options{}, fmt.Errorf("未知参数 %s，可选 header/col/name", k)
+		}
+	}
+	if len(positional) > 2 {
+		return Options{}, fmt.Errorf("参数过多: %s", strings.Join(positional[2:], " "))
+	}
+	positional = append(positional, "", "")
+	return ParseOptions(positional[0], positional[1], values["header"], values["col"], values["name"])
+}
+
+// ParseSize 解析文件大小，支持 B/KB/MB/GB 单位（1KB = 1024B），不带单位时为字节
+func ParseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, unit = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("文件大小无效: %s（例如 512KB、10MB）", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize 格式化文件大小
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+// normalize 填充默认值并检查参数范围
+func (o Options) normalize() (Options, error) {
+	if o.Mode == "" {
+		o.Mode = ByLines
+	}
+	if o.Header == "" {
+		o.Header = HeaderAuto
+	}
+	if o.Pattern == "" {
+		o.Pattern = DefaultPattern
+	}
+	if o.KeyColumn == 0 {
+		o.KeyColumn = 1
+	}
+
+	switch o.Mode {
+	case ByLines, ByKey:
+		if o.Lines == 0 {
+			o.Lines = DefaultLines
+		}
+		if o.Lines < 0 {
+			return o, fmt.Errorf("每个文件的行数必须大于 0")
+		}
+	case ByBytes:
+		if o.Bytes == 0 {
+			o.Bytes = DefaultBytes
+		}
+		if o.Bytes < minBytes {
+			return o, fmt.Errorf("每个文件的大小不能小于 %s", FormatSize(minBytes))
+		}
+	case ByParts:
+		if o.Parts == 0 {
+			o.Parts = DefaultParts
+		}
+		if o.Parts < 1 || o.Parts > MaxParts {
+			return o, fmt.Errorf("份数必须在 1 到 %d 之间", MaxParts)
+		}
+	default:
+		return o, fmt.Errorf("不支持的分割方式 %q", o.Mode)
+	}
+	if o.KeyColumn < 0 {
+		return o, fmt.Errorf("ID列必须是正整数（从 1 开始）")
+	}
+
+	if err := checkPattern(o.Pattern); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// checkPattern 检查命名规则：必须包含序号，以扩展名结尾保证文件类型不变，不能包含目录
+func checkPattern(pattern string) error {
+	if !strings.Contains(pattern, "{n}") {
+		return fmt.Errorf("命名规则必须包含序号 {n}: %s", pattern)
+	}
+	if !strings.HasSuffix(pattern, "{ext}") {
+		return fmt.Errorf("命名规则必须以 {ext} 结尾，保证分割后的文件类型不变: %s", pattern)
+	}
+	if strings.ContainsAny(pattern, `/\`) || strings.Contains(pattern, "..") {
+		return fmt.Errorf("命名规则不能包含目录: %s", pattern)
+	}
+	return nil
+}
+
+// partName 按命名规则生成第 n 个分割文件的文件名
+func (o Options) partName(inputFile string, n int) string {
+	base := filepath.Base(inputFile)
+	ext := filepath.Ext(base)
+	return strings.NewReplacer(
+		"{name}", strings.TrimSuffix(base, ext),
+		"{n}", fmt.Sprintf("%04d", n),
+		"{ext}", ext,
+	).Replace(o.Pattern)
+}
+
+// sizeName size 参数在当前分割方式下的含义
+func (o Options) sizeName() string {
+	switch o.Mode {
+	case ByBytes:
+		return "每个文件的大小"
+	case ByParts:
+		return "份数"
+	default:
+		return "每个文件的行数"
+	}
+}
+
+// String 返回分割方式的说明，用于处理消息
+func (o Options) String() string {
+	var desc string
+	switch o.Mode {
+	case ByBytes:
+		desc = fmt.Sprintf("每个文件不超过 %s", FormatSize(o.Bytes))
+	case ByParts:
+		desc = fmt.Sprintf("平均分为 %d 份", o.Parts)
+	case ByKey:
+		desc = fmt.Sprintf("按ID分组，每个文件约 %d 行，CSV/Excel 以第 %d 列为ID", o.Lines, o.KeyColumn)
+	default:
+		desc = fmt.Sprintf("每 %d 行一个文件", o.Lines)
+	}
+	switch o.Header {
+	case HeaderYes:
+		desc += "，第一行为表头"
+	case HeaderNo:
+		desc += "，没有表头"
+	}
+	if o.Pattern != DefaultPattern {
+		desc += "，命名 " + o.Pattern
+	}
+	return desc
+}
+
+// Values 返回参数的字符串形式，用于保存任务参数和审计记录
+func (o Options) Values() map[string]string {
+	size := strconv.Itoa(o.Lines)
+	switch o.Mode {
+	case ByBytes:
+		size = strconv.FormatInt(o.Bytes, 10)
+	case ByParts:
+		size = strconv.Itoa(o.Parts)
+	}
+	return map[string]string{
+		"split_mode":   string(o.Mode),
+		"split_size":   size,
+		"split_header": string(o.Header),
+		"split_column": strconv.Itoa(o.KeyColumn),
+		"split_name":   o.Pattern,
+	}
+}
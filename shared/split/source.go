@@ -0,0 +1,282 @@
+package split
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// format 输入文件的格式
+type format int
+
+const (
+	formatText format = iota // 按行读写，适用于 Redis 命令、日志等任意文本
+	formatCSV                // 按 CSV 记录读写
+	formatXLSX               // 读取第一个工作表，分割文件也是 Excel
+)
+
+// formatOf 按扩展名判断文件格式
+func formatOf(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV
+	case ".xlsx":
+		return formatXLSX
+	default:
+		return formatText
+	}
+}
+
+// record 输入文件中的一行
+type record struct {
+	fields []string // CSV/Excel 的各列，文本文件只有一列即整行内容
+	size   int64    // 在输入文件中占用的字节数，Excel 为 0
+}
+
+// source 按行读取输入文件
+type source interface {
+	next() (record, error) // 读完时返回 io.EOF
+	offset() int64         // 已读取的字节数（Excel 为行数），用于进度
+	close() error
+}
+
+// sink 写入一个分割文件
+type sink interface {
+	write(fields []string) error
+	close() error
+}
+
+// open 打开输入文件
+func open(f format, path string) (source, error) {
+	if f == formatXLSX {
+		return openXLSX(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if f == formatCSV {
+		reader := csv.NewReader(file)
+		// 各行的列数可以不一致，按原样写入分割文件
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		return &csvSource{file: file, reader: reader}, nil
+	}
+	// 不限制行的长度
+	return &textSource{file: file, reader: bufio.NewReaderSize(file, 1024*1024)}, nil
+}
+
+// createSink 创建分割文件
+func createSink(f format, path, sheet string) (sink, error) {
+	if f == formatXLSX {
+		return createXLSX(path, sheet)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	if f == formatCSV {
+		return &csvSink{file: file, buf: w, writer: csv.NewWriter(w)}, nil
+	}
+	return &textSink{file: file, writer: w}, nil
+}
+
+// textSource 按行读取文本文件
+type textSource struct {
+	file   *os.File
+	reader *bufio.Reader
+	read   int64
+}
+
+func (s *textSource) next() (record, error) {
+	line, err := s.reader.ReadString('\n')
+	if line == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return record{}, err
+	}
+	if err != nil && err != io.EOF {
+		return record{}, err
+	}
+	s.read += int64(len(line))
+	// 统一以 \n 结尾写入，最后一行没有换行符时补上
+	size := int64(len(strings.TrimRight(line, "\r\n"))) + 1
+	return record{fields: []string{strings.TrimRight(line, "\r\n")}, size: size}, nil
+}
+
+func (s *textSource) offset() int64 { return s.read }
+func (s *textSource) close() error  { return s.file.Close() }
+
+// textSink 按行写入文本文件
+type textSink struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func (s *textSink) write(fields []string) error {
+	_, err := s.writer.WriteString(fields[0] + "\n")
+	return err
+}
+
+func (s *textSink) close() error {
+	err := s.writer.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// csvSource 按记录读取 CSV 文件，引号内的换行属于同一条记录
+type csvSource struct {
+	file   *os.File
+	reader *csv.Reader
+	read   int64
+}
+
+func (s *csvSource) next() (record, error) {
+	fields, err := s.reader.Read()
+	if err != nil {
+		return record{}, err
+	}
+	end := s.reader.InputOffset()
+	size := end - s.read
+	s.read = end
+	return record{fields: fields, size: size}, nil
+}
+
+func (s *csvSource) offset() int64 { return s.read }
+func (s *csvSource) close() error  { return s.file.Close() }
+
+// csvSink 写入 CSV 文件
+type csvSink struct {
+	file   *os.File
+	buf    *bufio.Writer
+	writer *csv.Writer
+}
+
+func (s *csvSink) write(fields []string) error {
+	return s.writer.Write(fields)
+}
+
+func (s *csvSink) close() error {
+	s.writer.Flush()
+	err := s.writer.Error()
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// xlsxSource 流式读取 Excel 第一个工作表
+type xlsxSource struct {
+	file *excelize.File
+	rows *excelize.Rows
+	read int64
+}
+
+// openXLSX 打开 Excel 文件的第一个工作表
+func openXLSX(path string) (*xlsxSource, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := f.Rows(f.GetSheetName(0))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &xlsxSource{file: f, rows: rows}, nil
+}
+
+func (s *xlsxSource) next() (record, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Error(); err != nil {
+			return record{}, err
+		}
+		return record{}, io.EOF
+	}
+	fields, err := s.rows.Columns()
+	if err != nil {
+		return record{}, err
+	}
+	s.read++
+	return record{fields: fields}, nil
+}
+
+func (s *xlsxSource) offset() int64 { return s.read }
+
+func (s *xlsxSource) close() error {
+	s.rows.Close()
+	return s.file.Close()
+}
+
+// firstSheetName 返回 Excel 文件第一个工作表的名称
+func firstSheetName(path string) string {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return f.GetSheetName(0)
+}
+
+// xlsxSink 流式写入 Excel 文件
+type xlsxSink struct {
+	path   string
+	file   *excelize.File
+	writer *excelize.StreamWriter
+	row    int
+}
+
+// createXLSX 创建 Excel 分割文件，工作表名称与原文件一致
+func createXLSX(path, sheet string) (*xlsxSink, error) {
+	f := excelize.NewFile()
+	if sheet != "" && sheet != "Sheet1" {
+		if err := f.SetSheetName("Sheet1", sheet); err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else {
+		sheet = "Sheet1"
+	}
+	w, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &xlsxSink{path: path, file: f, writer: w}, nil
+}
+
+func (s *xlsxSink) write(fields []string) error {
+	s.row++
+	cell, err := excelize.CoordinatesToCellName(1, s.row)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(fields))
+	for i, v := range fields {
+		values[i] = v
+	}
+	return s.writer.SetRow(cell, values)
+}
+
+func (s *xlsxSink) close() error {
+	err := s.writer.Flush()
+	if err == nil {
+		err = s.file.SaveAs(s.path)
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,396 @@
+// Package split 按行数、大小、份数或ID分组分割文件，CSV/Excel 文件的每个分割文件都保留表头
+package split
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Progress 分割进度，done/total 为已读取的输入字节数（Excel 为行数），total 未知时为 0
+type Progress func(done, total int64, rows, parts int)
+
+// progressInterval 每处理多少行报告一次进度
+const progressInterval = 1000
+
+// maxSummaryHeader 结果说明中表头最多显示的字符数
+const maxSummaryHeader = 100
+
+// Part 一个分割文件
+type Part struct {
+	File  string `json:"file"`
+	Rows  int    `json:"rows"`  // 数据行数，不含表头
+	Bytes int64  `json:"bytes"` // 按输入文件估算的大小，含表头
+	Keys  int    `json:"keys,omitempty"`
+}
+
+// Result 分割结果
+type Result struct {
+	Options Options
+	Parts   []Part
+	Rows    int      // 数据行总数，不含表头
+	Header  []string // 写入每个分割文件的表头，没有表头时为空
+}
+
+// Files 返回所有分割文件的路径
+func (r *Result) Files() []string {
+	files := make([]string, len(r.Parts))
+	for i, p := range r.Parts {
+		files[i] = p.File
+	}
+	return files
+}
+
+// Summary 返回分割结果的说明
+func (r *Result) Summary() string {
+	s := fmt.Sprintf("📄 总计 %d 行数据，分割为 %d 个文件（%s）", r.Rows, len(r.Parts), r.Options)
+	if r.Header != nil {
+		header := []rune(strings.Join(r.Header, ","))
+		if len(header) > maxSummaryHeader {
+			header = append(header[:maxSummaryHeader], '…')
+		}
+		s += "\n📋 每个文件都保留表头: " + string(header)
+	}
+	return s
+}
+
+// Run 按参数分割 inputFile，分割文件写入 outputDir
+// .csv 按记录分割（字段中的换行不会被切断），.xlsx 读取第一个工作表并生成 Excel 文件，其他文件按行分割
+// 按份数分割和按ID分组需要先读一遍文件统计行数
+func Run(ctx context.Context, inputFile, outputDir string, opts Options, progress Progress) (*Result, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	format := formatOf(inputFile)
+	if format == formatXLSX && opts.Mode == ByBytes {
+		return nil, fmt.Errorf("Excel文件不支持按大小分割，请按行数或份数分割")
+	}
+	if progress == nil {
+		progress = func(done, total int64, rows, parts int) {}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	s := &splitter{
+		opts:      opts,
+		format:    format,
+		inputFile: inputFile,
+		outputDir: outputDir,
+		limit:     opts.Lines,
+	}
+	switch opts.Mode {
+	case ByParts:
+		rows, err := s.count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// 向上取整，保证不超过指定份数
+		s.limit = max((rows+opts.Parts-1)/opts.Parts, 1)
+	case ByKey:
+		if err := s.planKeys(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := s.write(ctx, progress)
+	if err != nil {
+		s.closeAll()
+		return nil, err
+	}
+	return result, nil
+}
+
+// splitter 一次分割的状态
+type splitter struct {
+	opts      Options
+	format    format
+	inputFile string
+	outputDir string
+	limit     int            // 每个文件的最大数据行数
+	assign    map[string]int // key 模式每个ID所在的分割文件序号（从 0 开始）
+	parts     []Part
+	sinks     []sink
+	header    *record
+}
+
+// scan 读取输入文件的每个数据行，表头只在第一行按参数判断
+func (s *splitter) scan(ctx context.Context, fn func(rec record, src source) error) error {
+	src, err := open(s.format, s.inputFile)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	first := true
+	for n := 0; ; n++ {
+		if n%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		rec, err := src.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取文件第 %d 行失败: %v", n+1, err)
+		}
+		if first {
+			first = false
+			if s.isHeader(rec) {
+				s.header = &rec
+				continue
+			}
+		}
+		if err := fn(rec, src); err != nil {
+			return err
+		}
+	}
+}
+
+// count 统计数据行数
+func (s *splitter) count(ctx context.Context) (int, error) {
+	rows := 0
+	err := s.scan(ctx, func(record, source) error {
+		rows++
+		return nil
+	})
+	return rows, err
+}
+
+// planKeys 统计每个ID的行数，按ID首次出现的顺序依次装入分割文件
+// 同一ID的行全部写入同一个文件；单个ID的行数超过上限时独占一个文件
+func (s *splitter) planKeys(ctx context.Context) error {
+	counts := make(map[string]int)
+	var order []string
+	err := s.scan(ctx, func(rec record, _ source) error {
+		key := s.key(rec)
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.assign = make(map[string]int, len(order))
+	part, used := 0, 0
+	for _, key := range order {
+		if used > 0 && used+counts[key] > s.limit {
+			part++
+			used = 0
+		}
+		if part >= MaxParts {
+			return fmt.Errorf("分割文件超过 %d 个，请增大每个文件的行数", MaxParts)
+		}
+		s.assign[key] = part
+		used += counts[key]
+	}
+	return nil
+}
+
+// write 写入所有分割文件
+func (s *splitter) write(ctx context.Context, progress Progress) (*Result, error) {
+	total := int64(0)
+	if s.format != formatXLSX {
+		if info, err := os.Stat(s.inputFile); err == nil {
+			total = info.Size()
+		}
+	}
+
+	rows := 0
+	current := -1
+	err := s.scan(ctx, func(rec record, src source) error {
+		part := current
+		switch {
+		case s.assign != nil:
+			part = s.assign[s.key(rec)]
+		case current < 0 || s.full(current, rec):
+			part = current + 1
+			if current >= 0 {
+				// 按顺序分割时写满的文件不会再写入，及时关闭
+				if err := s.close(current); err != nil {
+					return err
+				}
+			}
+			current = part
+		}
+		if err := s.writeRow(part, rec); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%progressInterval == 0 {
+			progress(src.offset(), total, rows, len(s.parts))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("文件中没有数据")
+	}
+	if err := s.closeAll(); err != nil {
+		return nil, err
+	}
+	progress(total, total, rows, len(s.parts))
+
+	result := &Result{Options: s.opts, Parts: s.parts, Rows: rows}
+	if s.header != nil {
+		result.Header = s.header.fields
+	}
+	if s.assign != nil {
+		for _, p := range s.assign {
+			s.parts[p].Keys++
+		}
+	}
+	return result, nil
+}
+
+// full 当前分割文件是否已写满，写满后下一行写入新文件
+func (s *splitter) full(part int, rec record) bool {
+	p := s.parts[part]
+	if s.opts.Mode == ByBytes {
+		// 每个文件至少一行，单行超过上限时独占一个文件
+		return p.Rows > 0 && p.Bytes+rec.size > s.opts.Bytes
+	}
+	return p.Rows >= s.limit
+}
+
+// writeRow 写入一行，分割文件不存在时创建并写入表头
+func (s *splitter) writeRow(part int, rec record) error {
+	for len(s.parts) <= part {
+		if len(s.parts) >= MaxParts {
+			return fmt.Errorf("分割文件超过 %d 个，请增大每个文件的行数或大小", MaxParts)
+		}
+		if err := s.create(len(s.parts)); err != nil {
+			return err
+		}
+	}
+	if err := s.sinks[part].write(rec.fields); err != nil {
+		return fmt.Errorf("写入文件 %s 失败: %v", filepath.Base(s.parts[part].File), err)
+	}
+	s.parts[part].Rows++
+	s.parts[part].Bytes += rec.size
+	return nil
+}
+
+// create 创建第 index 个分割文件（从 0 开始）
+func (s *splitter) create(index int) error {
+	path := filepath.Join(s.outputDir, s.opts.partName(s.inputFile, index+1))
+	out, err := createSink(s.format, path, s.sheetName())
+	if err != nil {
+		return fmt.Errorf("创建分割文件失败: %v", err)
+	}
+	part := Part{File: path}
+	if s.header != nil {
+		if err := out.write(s.header.fields); err != nil {
+			out.close()
+			return fmt.Errorf("写入表头失败: %v", err)
+		}
+		part.Bytes = s.header.size
+	}
+	s.parts = append(s.parts, part)
+	s.sinks = append(s.sinks, out)
+	return nil
+}
+
+// close 关闭一个分割文件
+func (s *splitter) close(part int) error {
+	if s.sinks[part] == nil {
+		return nil
+	}
+	err := s.sinks[part].close()
+	s.sinks[part] = nil
+	if err != nil {
+		return fmt.Errorf("保存文件 %s 失败: %v", filepath.Base(s.parts[part].File), err)
+	}
+	return nil
+}
+
+// closeAll 关闭所有分割文件，返回第一个错误
+func (s *splitter) closeAll() error {
+	var first error
+	for i := range s.sinks {
+		if err := s.close(i); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// sheetName Excel 分割文件使用原文件第一个工作表的名称
+func (s *splitter) sheetName() string {
+	if s.format != formatXLSX {
+		return ""
+	}
+	return firstSheetName(s.inputFile)
+}
+
+// isHeader 判断第一行是否为表头
+func (s *splitter) isHeader(rec record) bool {
+	switch s.opts.Header {
+	case HeaderYes:
+		return true
+	case HeaderNo:
+		return false
+	}
+	// 文本文件默认没有表头
+	if s.format == formatText {
+		return false
+	}
+	key := s.key(rec)
+	return key != "" && !isNumeric(key)
+}
+
+// key 返回行的ID：CSV/Excel 为指定列，文本文件为 Redis 命令的哈希标签或 key
+func (s *splitter) key(rec record) string {
+	if s.format == formatText {
+		return lineKey(rec.fields[0])
+	}
+	col := s.opts.KeyColumn - 1
+	if col >= len(rec.fields) {
+		return ""
+	}
+	return strings.TrimSpace(rec.fields[col])
+}
+
+// lineKey 返回文本行的分组ID
+// Redis 命令优先使用第一个哈希标签 {...}（同一用户的命令使用相同的标签），没有标签时使用第二个字段即命令的 key
+func lineKey(line string) string {
+	if start := strings.IndexByte(line, '{'); start >= 0 {
+		if end := strings.IndexByte(line[start+1:], '}'); end > 0 {
+			return line[start+1 : start+1+end]
+		}
+	}
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 0:
+		return ""
+	case 1:
+		return fields[0]
+	default:
+		return fields[1]
+	}
+}
+
+// isNumeric 检查字符串是否全部为数字
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
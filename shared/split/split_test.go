@@ -0,0 +1,187 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    string // Options.String()，为空时期望出错
+		wantErr string
+	}{
+		{args: "", want: "每 10000 行一个文件"},
+		{args: "bytes 5MB", want: "每个文件不超过 5MB"},
+		{args: "size 1.5m", want: "每个文件不超过 1.5MB"},
+		{args: "parts 4 header=no", want: "平均分为 4 份，没有表头"},
+		{args: "key 200 col=2 name={name}-{n}{ext}", want: "按ID分组，每个文件约 200 行，CSV/Excel 以第 2 列为ID，命名 {name}-{n}{ext}"},
+		{args: "words 10", wantErr: "不支持的分割方式"},
+		{args: "lines 0", wantErr: "每个文件的行数必须是正整数"},
+		{args: "lines abc", wantErr: "每个文件的行数必须是正整数"},
+		{args: "bytes 100", wantErr: "不能小于 1KB"},
+		{args: "bytes -1MB", wantErr: "文件大小无效"},
+		{args: "parts 501", wantErr: "份数必须在 1 到 500 之间"},
+		{args: "key 10 col=0", wantErr: "ID列必须是正整数"},
+		{args: "lines 10 header=maybe", wantErr: "表头参数无效"},
+		{args: "lines 10 sheet=1", wantErr: "未知参数 sheet"},
+		{args: "lines 10 20", wantErr: "参数过多: 20"},
+		{args: "lines 10 name={name}.txt", wantErr: "必须包含序号"},
+		{args: "lines 10 name={n}.csv", wantErr: "必须以 {ext} 结尾"},
+		{args: "lines 10 name=../{n}{ext}", wantErr: "不能包含目录"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			opts, err := ParseArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseArgs(%q) 错误 = %v, want %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := opts.String(); got != tt.want {
+				t.Errorf("ParseArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	long := strings.Repeat("x", 2000)
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    string
+		want    map[string]string // 分割文件名到内容
+		wantErr string
+	}{
+		{
+			name:    "按行数分割",
+			file:    "cmds.txt",
+			content: "a\nb\r\nc",
+			args:    "lines 2",
+			want:    map[string]string{"cmds_part_0001.txt": "a\nb\n", "cmds_part_0002.txt": "c\n"},
+		},
+		{
+			name:    "CSV保留表头",
+			file:    "users.csv",
+			content: "id,name\n1,a\n2,b\n3,c\n",
+			args:    "lines 2",
+			want:    map[string]string{"users_part_0001.csv": "id,name\n1,a\n2,b\n", "users_part_0002.csv": "id,name\n3,c\n"},
+		},
+		{
+			name:    "CSV字段中的换行不被切断",
+			file:    "users.csv",
+			content: "1,\"x\ny\"\n2,z\n",
+			args:    "lines 1",
+			want:    map[string]string{"users_part_0001.csv": "1,\"x\ny\"\n", "users_part_0002.csv": "2,z\n"},
+		},
+		{
+			name:    "CSV列数不一致的行保留，不规范的引号宽松解析",
+			file:    "users.csv",
+			content: "1,a\n2\n3,b\"c,d\n",
+			args:    "lines 10",
+			want:    map[string]string{"users_part_0001.csv": "1,a\n2\n3,\"b\"\"c\",d\n"},
+		},
+		{
+			name:    "单行超过大小上限时独占一个文件",
+			file:    "cmds.txt",
+			content: "short\n" + long + "\nshort\n",
+			args:    "bytes 1KB",
+			want: map[string]string{
+				"cmds_part_0001.txt": "short\n",
+				"cmds_part_0002.txt": long + "\n",
+				"cmds_part_0003.txt": "short\n",
+			},
+		},
+		{
+			name:    "按份数平均分割",
+			file:    "cmds.txt",
+			content: "1\n2\n3\n4\n5\n",
+			args:    "parts 2",
+			want:    map[string]string{"cmds_part_0001.txt": "1\n2\n3\n", "cmds_part_0002.txt": "4\n5\n"},
+		},
+		{
+			name:    "同一哈希标签的命令写入同一个文件",
+			file:    "cmds.txt",
+			content: "del a:{1}\ndel b:{2}\ndel c:{1}\nset plain 1\n",
+			args:    "key 2",
+			want:    map[string]string{"cmds_part_0001.txt": "del a:{1}\ndel c:{1}\n", "cmds_part_0002.txt": "del b:{2}\nset plain 1\n"},
+		},
+		{
+			name:    "CSV按指定列分组",
+			file:    "users.csv",
+			content: "name,uid\na,1\nb,2\nc,1\n",
+			args:    "key 2 col=2",
+			want:    map[string]string{"users_part_0001.csv": "name,uid\na,1\nc,1\n", "users_part_0002.csv": "name,uid\nb,2\n"},
+		},
+		{name: "空文件", file: "empty.txt", content: "", args: "lines 10", wantErr: "文件中没有数据"},
+		{name: "只有表头", file: "users.csv", content: "id,name\n", args: "lines 10", wantErr: "文件中没有数据"},
+		{name: "分割文件过多", file: "cmds.txt", content: strings.Repeat("1\n", MaxParts+1), args: "lines 1", wantErr: "分割文件超过 500 个"},
+		{name: "按ID分组文件过多", file: "cmds.txt", content: manyKeys(MaxParts + 1), args: "key 1", wantErr: "分割文件超过 500 个"},
+		{name: "Excel不支持按大小分割", file: "users.xlsx", content: "", args: "bytes 1MB", wantErr: "不支持按大小分割"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(input, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			opts, err := ParseArgs(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputDir := filepath.Join(dir, "out")
+			result, err := Run(context.Background(), input, outputDir, opts, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Run 错误 = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			rows := 0
+			for _, part := range result.Parts {
+				data, err := os.ReadFile(part.File)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[filepath.Base(part.File)] = string(data)
+				rows += part.Rows
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("分割文件 = %q, want %q", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %q, want %q", name, got[name], want)
+				}
+			}
+			if rows != result.Rows {
+				t.Errorf("各文件行数之和 %d != 总行数 %d", rows, result.Rows)
+			}
+		})
+	}
+}
+
+// manyKeys 生成 n 条key各不相同的删除命令
+func manyKeys(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "del user:{%d}\n", i)
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Config 执行器配置
+type Config struct {
+	DSN string // MySQL DSN，例如 user:password@tcp(10.0.0.12:3306)/db_user
+
+	BatchSize       int           // 每个事务包含的语句数
+	Timeout         time.Duration // 连接与单条语句的超时
+	Dir             string        // SQL 文件所在目录
+	Pattern         string        // SQL 文件匹配模式
+	ContinueOnError bool          // 语句失败后是否继续执行：继续时失败语句跳过，事务照常提交
+	DryRun          bool          // 在一个事务中执行全部语句后回滚，只统计影响行数
+	NoManifest      bool          // 不按 MANIFEST.json 校验 SQL 文件
+}
+
+// defaultConfig 默认配置
+func defaultConfig() *Config {
+	return &Config{
+		BatchSize: 500,
+		Timeout:   30 * time.Second,
+		Dir:       ".",
+		Pattern:   "*.sql",
+	}
+}
+
+// loadConfigFile 读取 KEY=VALUE 格式的配置文件（与 .env 文件格式一致）
+func loadConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开配置文件失败: %v", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("配置文件第 %d 行格式错误: %s", lineNum, line)
+		}
+		// 去掉行尾注释和引号
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = value[:idx]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		values[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	return values, nil
+}
+
+// applyValues 将配置项应用到配置结构体，后应用的来源覆盖先应用的来源
+func (c *Config) applyValues(lookup func(key string) (string, bool)) error {
+	if v, ok := lookup("MYSQL_DSN"); ok && v != "" {
+		c.DSN = v
+	}
+	if v, ok := lookup("MYSQL_DSN_FILE"); ok && v != "" {
+		dsn, err := readSecretFile(v)
+		if err != nil {
+			return err
+		}
+		c.DSN = dsn
+	}
+	if v, ok := lookup("SQL_EXEC_BATCH"); ok && v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("SQL_EXEC_BATCH 格式错误: %s", v)
+		}
+		c.BatchSize = size
+	}
+	if v, ok := lookup("SQL_EXEC_TIMEOUT"); ok && v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("SQL_EXEC_TIMEOUT 格式错误: %s", v)
+		}
+		c.Timeout = timeout
+	}
+	return nil
+}
+
+// readSecretFile 从文件读取密钥，去掉首尾空白
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LoadConfig 按 默认值 → 配置文件 → 环境变量 的顺序加载配置
+func LoadConfig(configFile string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if configFile == "" {
+		configFile = os.Getenv("SQL_EXEC_CONFIG")
+	}
+	if configFile != "" {
+		values, err := loadConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.applyValues(func(key string) (string, bool) {
+			v, ok := values[key]
+			return v, ok
+		})
+		if err != nil {
+			return nil, fmt.Errorf("配置文件 %s: %v", configFile, err)
+		}
+	}
+
+	if err := cfg.applyValues(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("环境变量: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.DSN == "" {
+		return fmt.Errorf("未指定 MySQL DSN")
+	}
+	if _, err := mysql.ParseDSN(c.DSN); err != nil {
+		return fmt.Errorf("MySQL DSN 格式错误: %v", err)
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("事务大小必须大于 0")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("超时时间必须大于 0")
+	}
+	return nil
+}
+
+// mysqlConfig 解析 DSN，设置连接超时；多语句执行关闭，每次只发送一条语句
+func (c *Config) mysqlConfig() (*mysql.Config, error) {
+	mc, err := mysql.ParseDSN(c.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("MySQL DSN 格式错误: %v", err)
+	}
+	mc.Timeout = c.Timeout
+	mc.MultiStatements = false
+	return mc, nil
+}
+
+// Target 返回不含密码的连接目标，用于输出
+func (c *Config) Target() string {
+	mc, err := mysql.ParseDSN(c.DSN)
+	if err != nil {
+		return "(DSN 格式错误)"
+	}
+	return fmt.Sprintf("%s@%s(%s)/%s", mc.User, mc.Net, mc.Addr, mc.DBName)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// dryRun 预演模式入口：在一个事务中按顺序执行全部文件的语句，统计每条语句的影响行数后回滚，返回进程退出码
+// 预演期间被更新的行会加锁直到回滚，文件不会被重命名
+func dryRun(ctx context.Context, db *sql.DB, cfg *Config, files []string, scripts [][]Statement) int {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("❌ 开始事务失败: %v\n", err)
+		return 1
+	}
+
+	executor := NewExecutor(db, cfg, nil)
+	executor.tx = tx
+	startTime := time.Now()
+	exitCode := 0
+
+	for i, path := range files {
+		filename := filepath.Base(path)
+		fmt.Printf("正在预演: %s (%d 条语句)\n", filename, len(scripts[i]))
+		executor.report.Files++
+
+		failed, err := executor.RunFile(ctx, scripts[i])
+		if err != nil {
+			fmt.Printf("  ❌ 预演中断: %v\n", err)
+			executor.report.FailedFiles++
+			exitCode = 1
+			executor.skipFiles(scripts[i+1:])
+			break
+		}
+		if failed > 0 {
+			fmt.Printf("  ❌ %s 有 %d 条语句失败\n", filename, failed)
+			executor.report.FailedFiles++
+			exitCode = 1
+			if !cfg.ContinueOnError {
+				fmt.Println("停止预演剩余文件 (使用 -continue-on-error 继续执行)")
+				executor.skipFiles(scripts[i+1:])
+				break
+			}
+			continue
+		}
+		executor.report.DoneFiles++
+	}
+
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		fmt.Printf("❌ 回滚预演事务失败: %v\n", err)
+		exitCode = 1
+	}
+
+	executor.report.PrintSummary(5)
+
+	reportPath := filepath.Join(cfg.Dir, fmt.Sprintf("sql_exec_dryrun_%s.csv", time.Now().Format("20060102_150405")))
+	if err := executor.report.WriteCSV(reportPath); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("\n执行明细: %s\n", reportPath)
+	fmt.Printf("耗时: %v\n", time.Since(startTime).Round(time.Millisecond))
+	return exitCode
+}
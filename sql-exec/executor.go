@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// doneSuffix 全部语句执行成功的文件会被重命名为 xxx_done.sql，再次运行时跳过
+const doneSuffix = "_done"
+
+// 语句的执行结果
+const (
+	statusCommitted  = "committed"   // 已执行，所在事务已提交
+	statusRolledBack = "rolled_back" // 已执行，所在事务被回滚（同一事务中有语句失败，或预演）
+	statusFailed     = "failed"      // 执行失败
+	statusNotRun     = "not_run"     // 停止执行后没有执行
+)
+
+// errDeadlock MySQL 检测到死锁时会回滚整个事务，不能继续在该事务中执行
+const errDeadlock = 1213
+
+// Result 一条语句的执行结果
+type Result struct {
+	Statement
+	Batch    int    // 所在事务的序号，从 1 开始
+	Status   string // 为空表示已执行、等待事务结束
+	Affected int64
+	Error    string
+}
+
+// FailureLog 失败语句日志
+// failed 文件只包含失败语句的原文，修复后可以直接作为输入重新执行；
+// errors 文件记录每条失败语句的来源位置和错误信息
+type FailureLog struct {
+	failedPath string
+	errorsPath string
+	failed     *os.File
+	errors     *os.File
+	count      int
+}
+
+// newFailureLog 创建失败日志（首次写入时才创建文件）
+func newFailureLog(dir string) *FailureLog {
+	timestamp := time.Now().Format("20060102_150405")
+	return &FailureLog{
+		failedPath: filepath.Join(dir, fmt.Sprintf("sql_exec_failed_%s.sql", timestamp)),
+		errorsPath: filepath.Join(dir, fmt.Sprintf("sql_exec_errors_%s.log", timestamp)),
+	}
+}
+
+// Write 记录一条失败语句
+func (fl *FailureLog) Write(s Statement, reason string) error {
+	if fl.failed == nil {
+		var err error
+		fl.failed, err = os.Create(fl.failedPath)
+		if err != nil {
+			return fmt.Errorf("创建失败日志失败: %v", err)
+		}
+		fl.errors, err = os.Create(fl.errorsPath)
+		if err != nil {
+			return fmt.Errorf("创建错误日志失败: %v", err)
+		}
+	}
+
+	fl.count++
+	if _, err := fl.failed.WriteString(s.SQL + ";\n"); err != nil {
+		return fmt.Errorf("写入失败日志失败: %v", err)
+	}
+	_, err := fmt.Fprintf(fl.errors, "%s:%d\t%s\t%s\n", s.File, s.Line, reason, strings.ReplaceAll(s.SQL, "\n", " "))
+	if err != nil {
+		return fmt.Errorf("写入错误日志失败: %v", err)
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func (fl *FailureLog) Close() {
+	if fl.failed != nil {
+		fl.failed.Close()
+	}
+	if fl.errors != nil {
+		fl.errors.Close()
+	}
+}
+
+// Executor SQL 文件执行器，按事务分批执行语句并记录每条语句的影响行数
+type Executor struct {
+	db       *sql.DB
+	cfg      *Config
+	tx       *sql.Tx // 预演时所有语句共用的事务，全部执行后由调用方回滚
+	report   *Report
+	failures *FailureLog // 预演时为 nil，失败语句只记录在报告中
+	batches  int
+}
+
+// NewExecutor 创建执行器
+func NewExecutor(db *sql.DB, cfg *Config, failures *FailureLog) *Executor {
+	return &Executor{
+		db:       db,
+		cfg:      cfg,
+		report:   &Report{DryRun: cfg.DryRun},
+		failures: failures,
+	}
+}
+
+// openDB 连接数据库并检查连接，事务内的语句总在同一个连接上执行
+func openDB(ctx context.Context, cfg *Config) (*sql.DB, error) {
+	mc, err := cfg.mysqlConfig()
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(mc)
+	if err != nil {
+		return nil, fmt.Errorf("MySQL DSN 格式错误: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接 MySQL 失败: %v", err)
+	}
+	return db, nil
+}
+
+// findSQLFiles 查找待执行的 SQL 文件，按文件名排序并跳过已完成的文件
+func findSQLFiles(dir, pattern string) ([]string, int, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, 0, fmt.Errorf("查找 SQL 文件失败: %v", err)
+	}
+
+	var files []string
+	skipped := 0
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		// 跳过执行器自己生成的失败日志，除非指定了重新执行失败日志
+		if strings.HasPrefix(name, "sql_exec_") && !strings.HasPrefix(pattern, "sql_exec_") {
+			continue
+		}
+		if strings.HasSuffix(name, doneSuffix) {
+			skipped++
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, skipped, nil
+}
+
+// markDone 将执行成功的文件重命名为 xxx_done.sql
+func markDone(path string) (string, error) {
+	ext := filepath.Ext(path)
+	donePath := strings.TrimSuffix(path, ext) + doneSuffix + ext
+	if err := os.Rename(path, donePath); err != nil {
+		return "", err
+	}
+	return donePath, nil
+}
+
+// RunFile 按事务分批执行一个文件的语句，返回失败的语句数
+// 默认遇到失败语句时回滚当前事务，文件中剩余的语句不再执行，之前已提交的事务保留；
+// ContinueOnError 时跳过失败语句，事务照常提交。连接级错误直接返回 error，当前事务回滚
+func (e *Executor) RunFile(ctx context.Context, statements []Statement) (int, error) {
+	failed := 0
+	for start := 0; start < len(statements); start += e.cfg.BatchSize {
+		end := start + e.cfg.BatchSize
+		if end > len(statements) {
+			end = len(statements)
+		}
+		n, err := e.runBatch(ctx, statements[start:end])
+		failed += n
+		if err != nil || (n > 0 && !e.cfg.ContinueOnError) {
+			e.skip(statements[end:])
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// runBatch 在一个事务中执行一批语句
+func (e *Executor) runBatch(ctx context.Context, batch []Statement) (int, error) {
+	e.batches++
+	tx := e.tx
+	if tx == nil {
+		var err error
+		tx, err = e.db.BeginTx(ctx, nil)
+		if err != nil {
+			e.skip(batch)
+			return 0, fmt.Errorf("开始事务失败: %v", err)
+		}
+	}
+	rollback := func() {
+		if e.tx == nil {
+			tx.Rollback()
+		}
+	}
+
+	results := make([]Result, 0, len(batch))
+	failed := 0
+	for i, s := range batch {
+		r, err := e.exec(ctx, tx, s)
+		results = append(results, r)
+		if r.Status != statusFailed {
+			continue
+		}
+		failed++
+		if err != nil {
+			// 连接中断、超时或死锁，事务已不可用
+			rollback()
+			e.finish(results, statusRolledBack)
+			e.skip(batch[i+1:])
+			return failed, fmt.Errorf("%s:%d %v", s.File, s.Line, err)
+		}
+		if e.failures != nil {
+			if err := e.failures.Write(s, r.Error); err != nil {
+				rollback()
+				e.finish(results, statusRolledBack)
+				e.skip(batch[i+1:])
+				return failed, err
+			}
+		}
+		if !e.cfg.ContinueOnError {
+			rollback()
+			e.finish(results, statusRolledBack)
+			e.skip(batch[i+1:])
+			return failed, nil
+		}
+	}
+
+	if e.tx != nil {
+		// 预演的事务在全部语句执行后统一回滚
+		e.finish(results, statusRolledBack)
+		return failed, nil
+	}
+	if err := tx.Commit(); err != nil {
+		e.finish(results, statusRolledBack)
+		return failed, fmt.Errorf("提交事务失败: %v", err)
+	}
+	e.finish(results, statusCommitted)
+	return failed, nil
+}
+
+// exec 执行一条语句；语句本身的错误（MySQL 返回的错误码）记录在结果中，
+// 连接级错误和会回滚整个事务的死锁同时作为 error 返回
+func (e *Executor) exec(ctx context.Context, tx *sql.Tx, s Statement) (Result, error) {
+	r := Result{Statement: s, Batch: e.batches}
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, s.SQL)
+	if err == nil {
+		r.Affected, err = res.RowsAffected()
+	}
+	if err == nil {
+		return r, nil
+	}
+	r.Status = statusFailed
+	r.Error = err.Error()
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number != errDeadlock {
+		return r, nil
+	}
+	return r, err
+}
+
+// finish 事务结束后确定已执行语句的状态并加入报告
+func (e *Executor) finish(results []Result, status string) {
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = status
+		}
+	}
+	e.report.Results = append(e.report.Results, results...)
+}
+
+// skip 记录停止执行后没有执行的语句
+func (e *Executor) skip(statements []Statement) {
+	for _, s := range statements {
+		e.report.Results = append(e.report.Results, Result{Statement: s, Status: statusNotRun})
+	}
+}
+
+// skipFiles 记录停止执行后没有处理的文件中的语句
+func (e *Executor) skipFiles(scripts [][]Statement) {
+	for _, statements := range scripts {
+		e.skip(statements)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/sirupsen/logrus"
+)
+
+// startMySQL 在本地启动内存中的 MySQL 兼容服务器（go-mysql-server），
+// 创建 db_user.b_user 表并写入 id 为 1-5、status 为 0 的用户
+func startMySQL(t *testing.T) (*sql.DB, *Config) {
+	t.Helper()
+	// 测试中执行失败的语句会在服务端输出警告日志
+	logrus.SetLevel(logrus.ErrorLevel)
+	database := memory.NewDatabase("db_user")
+	database.BaseDatabase.EnablePrimaryKeyIndexes()
+	provider := memory.NewDBProvider(database)
+	engine := sqle.NewDefault(provider)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.NewServer(server.Config{Protocol: "tcp", Listener: listener}, engine, gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(func() { srv.Close() })
+
+	cfg := defaultConfig()
+	cfg.DSN = fmt.Sprintf("root@tcp(%s)/db_user", listener.Addr())
+	cfg.Dir = t.TempDir()
+	cfg.Timeout = 10 * time.Second
+	cfg.BatchSize = 2
+
+	db, err := openDB(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mustExec(t, db, "CREATE TABLE b_user (id BIGINT PRIMARY KEY, status INT NOT NULL)")
+	mustExec(t, db, "INSERT INTO b_user VALUES (1, 0), (2, 0), (3, 0), (4, 0), (5, 0)")
+	return db, cfg
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string) {
+	t.Helper()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// lockStatements 锁定指定用户的语句，id 为 0 时生成一条执行失败的语句
+func lockStatements(ids ...int) []Statement {
+	statements := make([]Statement, len(ids))
+	for i, id := range ids {
+		sql := fmt.Sprintf("UPDATE b_user SET status = -1 WHERE id = %d AND status != -1", id)
+		if id == 0 {
+			sql = "UPDATE b_user SET no_such_column = -1 WHERE id = 4"
+		}
+		statements[i] = Statement{File: "lock.sql", Line: i + 1, SQL: sql}
+	}
+	return statements
+}
+
+// lockedUsers 返回 status 为 -1 的用户ID
+func lockedUsers(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query("SELECT id FROM b_user WHERE status = -1 ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// statuses 返回每条语句的执行结果
+func statuses(report *Report) []string {
+	result := make([]string, len(report.Results))
+	for i, r := range report.Results {
+		result[i] = r.Status
+	}
+	return result
+}
+
+func TestRunFileCommitsBatches(t *testing.T) {
+	db, cfg := startMySQL(t)
+	executor := NewExecutor(db, cfg, newFailureLog(cfg.Dir))
+
+	failed, err := executor.RunFile(context.Background(), lockStatements(1, 2, 3, 1, 5))
+	if err != nil || failed != 0 {
+		t.Fatalf("RunFile = %d, %v", failed, err)
+	}
+	if got := fmt.Sprint(lockedUsers(t, db)); got != "[1 2 3 5]" {
+		t.Errorf("锁定的用户 = %s", got)
+	}
+	for i, r := range executor.report.Results {
+		if r.Status != statusCommitted || r.Batch != i/2+1 {
+			t.Errorf("语句 %d: status=%s batch=%d", i+1, r.Status, r.Batch)
+		}
+	}
+	// 重复的语句影响 0 行
+	if got := executor.report.Results[3].Affected; got != 0 {
+		t.Errorf("重复语句影响 %d 行", got)
+	}
+	if got := executor.report.AffectedRows(); got != 4 {
+		t.Errorf("影响行数 = %d, want 4", got)
+	}
+}
+
+func TestRunFileRollsBackFailedBatch(t *testing.T) {
+	db, cfg := startMySQL(t)
+	failures := newFailureLog(cfg.Dir)
+	executor := NewExecutor(db, cfg, failures)
+
+	failed, err := executor.RunFile(context.Background(), lockStatements(1, 2, 3, 0, 5))
+	failures.Close()
+	if err != nil || failed != 1 {
+		t.Fatalf("RunFile = %d, %v", failed, err)
+	}
+	// 第一个事务已提交；第二个事务中的失败语句使整个事务回滚，之后的语句不再执行
+	if got := fmt.Sprint(lockedUsers(t, db)); got != "[1 2]" {
+		t.Errorf("锁定的用户 = %s", got)
+	}
+	want := []string{statusCommitted, statusCommitted, statusRolledBack, statusFailed, statusNotRun}
+	if got := statuses(executor.report); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("执行结果 = %v, want %v", got, want)
+	}
+
+	data, err := os.ReadFile(failures.failedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "UPDATE b_user SET no_such_column = -1 WHERE id = 4;\n" {
+		t.Errorf("失败日志 = %q", data)
+	}
+}
+
+func TestRunFileContinueOnError(t *testing.T) {
+	db, cfg := startMySQL(t)
+	cfg.ContinueOnError = true
+	executor := NewExecutor(db, cfg, newFailureLog(cfg.Dir))
+
+	failed, err := executor.RunFile(context.Background(), lockStatements(1, 2, 3, 0, 5))
+	executor.failures.Close()
+	if err != nil || failed != 1 {
+		t.Fatalf("RunFile = %d, %v", failed, err)
+	}
+	// 失败语句跳过，所在事务照常提交
+	if got := fmt.Sprint(lockedUsers(t, db)); got != "[1 2 3 5]" {
+		t.Errorf("锁定的用户 = %s", got)
+	}
+	want := []string{statusCommitted, statusCommitted, statusCommitted, statusFailed, statusCommitted}
+	if got := statuses(executor.report); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("执行结果 = %v, want %v", got, want)
+	}
+}
+
+func TestDryRunLeavesRowsUnchanged(t *testing.T) {
+	db, cfg := startMySQL(t)
+	cfg.DryRun = true
+	cfg.ContinueOnError = true
+	files := []string{filepath.Join(cfg.Dir, "lock_1.sql"), filepath.Join(cfg.Dir, "lock_2.sql")}
+	scripts := [][]Statement{lockStatements(1, 2, 3), lockStatements(0, 5)}
+
+	if code := dryRun(context.Background(), db, cfg, files, scripts); code != 1 {
+		t.Errorf("有失败语句时退出码 = %d, want 1", code)
+	}
+	if got := lockedUsers(t, db); len(got) != 0 {
+		t.Errorf("预演后锁定的用户 = %v，应全部回滚", got)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(cfg.Dir, "sql_exec_dryrun_*.csv"))
+	if len(reports) != 1 {
+		t.Fatalf("预演报告 = %v", reports)
+	}
+	data, err := os.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), statusRolledBack); n != 4 {
+		t.Errorf("报告中回滚的语句数 = %d, want 4\n%s", n, data)
+	}
+	// 预演不生成失败日志，文件不重命名
+	if logs, _ := filepath.Glob(filepath.Join(cfg.Dir, "sql_exec_failed_*")); len(logs) != 0 {
+		t.Errorf("预演生成了失败日志: %v", logs)
+	}
+}
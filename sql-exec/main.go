@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"shared/pack"
+	"syscall"
+	"time"
+)
+
+func main() {
+	configFile := flag.String("config", "", "配置文件路径 (KEY=VALUE 格式，也可通过 SQL_EXEC_CONFIG 指定)")
+	dsnFile := flag.String("dsn-file", "", "从文件读取 MySQL DSN (MYSQL_DSN_FILE)")
+	batchSize := flag.Int("batch", 0, "每个事务包含的语句数 (SQL_EXEC_BATCH，默认 500)")
+	timeout := flag.Duration("timeout", 0, "连接与单条语句的超时 (SQL_EXEC_TIMEOUT，默认 30s)")
+	dir := flag.String("dir", "", "SQL 文件所在目录 (默认当前目录)")
+	pattern := flag.String("pattern", "", "SQL 文件匹配模式 (默认 *.sql)")
+	continueOnError := flag.Bool("continue-on-error", false, "语句失败时跳过该语句继续执行，所在事务照常提交")
+	dryRunMode := flag.Bool("dry-run", false, "预演: 在一个事务中执行全部语句并统计影响行数，然后回滚")
+	noManifest := flag.Bool("no-manifest", false, "不按 SQL 目录中的 MANIFEST.json 校验 SQL 文件")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "使用方法: %s [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "DSN 含密码，只能通过 MYSQL_DSN 环境变量、MYSQL_DSN_FILE 或配置文件提供，不接受命令行参数。\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 命令行参数优先级最高
+	if *dsnFile != "" {
+		dsn, err := readSecretFile(*dsnFile)
+		if err != nil {
+			log.Fatalf("加载配置失败: %v", err)
+		}
+		cfg.DSN = dsn
+	}
+	if *batchSize > 0 {
+		cfg.BatchSize = *batchSize
+	}
+	if *timeout > 0 {
+		cfg.Timeout = *timeout
+	}
+	if *dir != "" {
+		cfg.Dir = *dir
+	}
+	if *pattern != "" {
+		cfg.Pattern = *pattern
+	}
+	cfg.ContinueOnError = *continueOnError
+	cfg.DryRun = *dryRunMode
+	cfg.NoManifest = *noManifest
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	os.Exit(run(cfg))
+}
+
+// run 执行目录中的全部 SQL 文件，返回进程退出码
+func run(cfg *Config) int {
+	files, skipped, err := findSQLFiles(cfg.Dir, cfg.Pattern)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+
+	if cfg.DryRun {
+		fmt.Println("开始预演SQL (执行后回滚)...")
+	} else {
+		fmt.Println("开始执行SQL...")
+	}
+	fmt.Printf("MySQL地址: %s\n", cfg.Target())
+	fmt.Printf("SQL目录: %s\n", cfg.Dir)
+	fmt.Printf("每个事务: %d 条语句, 单条超时: %v\n", cfg.BatchSize, cfg.Timeout)
+	fmt.Println("================================")
+
+	if skipped > 0 {
+		fmt.Printf("跳过 %d 个已完成的文件 (*%s)\n", skipped, doneSuffix)
+	}
+	if len(files) == 0 {
+		fmt.Printf("没有待执行的文件 (%s)\n", cfg.Pattern)
+		return 0
+	}
+	fmt.Printf("找到 %d 个文件需要处理\n", len(files))
+
+	// 连接数据库之前先校验文件并检查全部语句，避免执行被修改、不完整或不符合预期的脚本
+	if cfg.NoManifest {
+		fmt.Printf("⚠️  已跳过 %s 校验\n", pack.ManifestName)
+	} else {
+		manifest, err := verifyManifest(cfg.Dir, files)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return 1
+		}
+		fmt.Printf("✅ %s 校验通过: %s 生成的 %d 个文件\n", pack.ManifestName, manifest.Operation, len(manifest.Files))
+	}
+
+	scripts := make([][]Statement, len(files))
+	var all []Statement
+	for i, path := range files {
+		statements, err := readScript(path)
+		if err != nil {
+			log.Printf("❌ %s: %v", filepath.Base(path), err)
+			return 1
+		}
+		scripts[i] = statements
+		all = append(all, statements...)
+	}
+	if err := checkStatements(all); err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+	fmt.Printf("✅ 语句检查通过: 共 %d 条\n", len(all))
+
+	// Ctrl+C 时取消正在执行的语句，当前事务回滚
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	if cfg.DryRun {
+		return dryRun(ctx, db, cfg, files, scripts)
+	}
+
+	failures := newFailureLog(cfg.Dir)
+	defer failures.Close()
+
+	executor := NewExecutor(db, cfg, failures)
+	startTime := time.Now()
+	exitCode := 0
+
+	for i, path := range files {
+		filename := filepath.Base(path)
+		fmt.Printf("正在处理: %s (%d 条语句)\n", filename, len(scripts[i]))
+		executor.report.Files++
+
+		failed, err := executor.RunFile(ctx, scripts[i])
+		if err != nil {
+			// 连接异常时立即停止，文件保持原名；已提交的事务不会重复生效，重新执行时这些语句影响 0 行
+			fmt.Printf("  ❌ 执行中断: %v\n", err)
+			executor.report.FailedFiles++
+			exitCode = 1
+			executor.skipFiles(scripts[i+1:])
+			break
+		}
+
+		if failed > 0 {
+			fmt.Printf("  ❌ %s 有 %d 条语句失败，已记录到 %s\n", filename, failed, failures.failedPath)
+			executor.report.FailedFiles++
+			exitCode = 1
+			if !cfg.ContinueOnError {
+				fmt.Println("停止执行剩余文件 (使用 -continue-on-error 继续执行)")
+				executor.skipFiles(scripts[i+1:])
+				break
+			}
+			continue
+		}
+
+		donePath, err := markDone(path)
+		if err != nil {
+			fmt.Printf("  ⚠️  文件重命名失败: %v\n", err)
+		} else {
+			fmt.Printf("  ✅ 执行完成，已重命名为: %s\n", filepath.Base(donePath))
+		}
+		executor.report.DoneFiles++
+	}
+
+	executor.report.PrintSummary(5)
+
+	reportPath := filepath.Join(cfg.Dir, fmt.Sprintf("sql_exec_report_%s.csv", time.Now().Format("20060102_150405")))
+	if err := executor.report.WriteCSV(reportPath); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		exitCode = 1
+	} else {
+		fmt.Printf("\n执行明细: %s\n", reportPath)
+	}
+	fmt.Printf("耗时: %v\n", time.Since(startTime).Round(time.Millisecond))
+
+	if failures.count > 0 {
+		fmt.Printf("失败语句原文: %s\n", failures.failedPath)
+		fmt.Printf("失败原因明细: %s\n", failures.errorsPath)
+	}
+
+	if exitCode == 0 {
+		fmt.Println("🎉 所有文件都已成功执行!")
+	}
+	return exitCode
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"shared/pack"
+)
+
+// verifyManifest 按 SQL 目录中的 MANIFEST.json 校验待执行的 SQL 文件，清单格式和校验规则与生成端共用 shared/pack
+func verifyManifest(dir string, files []string) (*pack.Manifest, error) {
+	manifest, err := pack.Verify(dir, files, doneSuffix)
+	if errors.Is(err, pack.ErrNoManifest) {
+		return nil, fmt.Errorf("SQL 目录中没有 %s，无法校验 SQL 文件（确认文件来源可靠时使用 -no-manifest 跳过校验）", pack.ManifestName)
+	}
+	return manifest, err
+}
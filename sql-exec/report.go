@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 影响行数分布
+const (
+	affectedNone = "影响 0 行"
+	affectedOne  = "影响 1 行"
+	affectedMany = "影响多行"
+)
+
+// Report 执行报告，按执行顺序记录每条语句的结果
+type Report struct {
+	DryRun      bool
+	Files       int
+	DoneFiles   int
+	FailedFiles int
+	Results     []Result
+}
+
+// verbStats 一类语句的统计
+type verbStats struct {
+	Executed int
+	Failed   int
+	Rows     int64
+	Affected map[string]int
+}
+
+// sectionStats 一组语句（同一行注释之后的语句）的统计
+type sectionStats struct {
+	Statements int
+	Executed   int
+	Rows       int64
+}
+
+// affectedBucket 返回影响行数所属的分布区间
+func affectedBucket(n int64) string {
+	switch {
+	case n == 0:
+		return affectedNone
+	case n == 1:
+		return affectedOne
+	}
+	return affectedMany
+}
+
+// executed 语句是否已在数据库中执行（提交或回滚）
+func (r Result) executed() bool {
+	return r.Status == statusCommitted || r.Status == statusRolledBack
+}
+
+// Counts 按执行结果统计语句数
+func (r *Report) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, res := range r.Results {
+		counts[res.Status]++
+	}
+	return counts
+}
+
+// AffectedRows 已执行语句的影响行数合计
+func (r *Report) AffectedRows() int64 {
+	var total int64
+	for _, res := range r.Results {
+		if res.executed() {
+			total += res.Affected
+		}
+	}
+	return total
+}
+
+// PrintSummary 打印执行统计和核对结果：每类语句的影响行数分布、每组语句的影响行数，
+// 以及影响 0 行和影响多行的语句示例。生成的脚本每条语句按主键更新一行，这两类需要人工核对
+func (r *Report) PrintSummary(samples int) {
+	counts := r.Counts()
+	fmt.Println("================================")
+	if r.DryRun {
+		fmt.Println("预演结果 (事务已回滚，未修改任何数据):")
+	} else {
+		fmt.Println("执行统计:")
+	}
+	fmt.Printf("处理文件: %d (完成 %d, 存在失败 %d)\n", r.Files, r.DoneFiles, r.FailedFiles)
+	fmt.Printf("语句: %d (已提交 %d, 已回滚 %d, 失败 %d, 未执行 %d)\n", len(r.Results),
+		counts[statusCommitted], counts[statusRolledBack], counts[statusFailed], counts[statusNotRun])
+	fmt.Printf("影响行数: %d\n", r.AffectedRows())
+
+	verbs := make(map[string]*verbStats)
+	sections := make(map[string]*sectionStats)
+	var sectionOrder []string
+	var none, many, failed []Result
+	for _, res := range r.Results {
+		verb := res.Verb()
+		vs, ok := verbs[verb]
+		if !ok {
+			vs = &verbStats{Affected: make(map[string]int)}
+			verbs[verb] = vs
+		}
+		if res.Section != "" {
+			ss, ok := sections[res.Section]
+			if !ok {
+				ss = &sectionStats{}
+				sections[res.Section] = ss
+				sectionOrder = append(sectionOrder, res.Section)
+			}
+			ss.Statements++
+			if res.executed() {
+				ss.Executed++
+				ss.Rows += res.Affected
+			}
+		}
+
+		switch {
+		case res.Status == statusFailed:
+			vs.Failed++
+			failed = append(failed, res)
+		case res.executed():
+			vs.Executed++
+			vs.Rows += res.Affected
+			bucket := affectedBucket(res.Affected)
+			vs.Affected[bucket]++
+			if bucket == affectedNone {
+				none = append(none, res)
+			} else if bucket == affectedMany {
+				many = append(many, res)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(verbs))
+	for verb := range verbs {
+		names = append(names, verb)
+	}
+	sort.Strings(names)
+	for _, verb := range names {
+		vs := verbs[verb]
+		fmt.Printf("\n  %s: 执行 %d, 失败 %d, 影响 %d 行\n", verb, vs.Executed, vs.Failed, vs.Rows)
+		for _, bucket := range []string{affectedNone, affectedOne, affectedMany} {
+			if vs.Affected[bucket] > 0 {
+				fmt.Printf("    %-12s %d\n", bucket, vs.Affected[bucket])
+			}
+		}
+	}
+
+	if len(sectionOrder) > 0 {
+		fmt.Println("\n按注释分组核对:")
+		for _, section := range sectionOrder {
+			ss := sections[section]
+			fmt.Printf("  %s\n    语句 %d, 已执行 %d, 影响 %d 行\n", section, ss.Statements, ss.Executed, ss.Rows)
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("\n❌ 失败的语句: %d 条\n", len(failed))
+		for i, res := range failed {
+			if i >= samples {
+				fmt.Printf("  ... 完整列表见报告文件\n")
+				break
+			}
+			fmt.Printf("  %s:%d %s\n    %s\n", res.File, res.Line, res.Error, truncateSQL(res.SQL))
+		}
+	}
+	printSamples("⚠️  影响 0 行的语句 (条件不满足，可能已执行过或数据已变化)", none, samples)
+	printSamples("⚠️  影响多行的语句 (WHERE 条件可能不够精确)", many, samples)
+}
+
+// printSamples 打印需要核对的语句示例
+func printSamples(title string, results []Result, samples int) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("\n%s: %d 条\n", title, len(results))
+	for i, res := range results {
+		if i >= samples {
+			fmt.Printf("  ... 完整列表见报告文件\n")
+			break
+		}
+		fmt.Printf("  %s:%d 影响 %d 行: %s\n", res.File, res.Line, res.Affected, truncateSQL(res.SQL))
+	}
+}
+
+// truncateSQL 截断过长的语句用于终端显示
+func truncateSQL(sql string) string {
+	const maxLen = 100
+	sql = strings.Join(strings.Fields(sql), " ")
+	if runes := []rune(sql); len(runes) > maxLen {
+		sql = string(runes[:maxLen]) + "..."
+	}
+	return sql
+}
+
+// WriteCSV 将每条语句的执行结果写入 CSV 文件
+func (r *Report) WriteCSV(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建报告文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"file", "line", "section", "batch", "status", "affected", "error", "statement"})
+	for _, res := range r.Results {
+		affected := ""
+		if res.executed() {
+			affected = strconv.FormatInt(res.Affected, 10)
+		}
+		batch := ""
+		if res.Batch > 0 {
+			batch = strconv.Itoa(res.Batch)
+		}
+		writer.Write([]string{
+			res.File,
+			strconv.Itoa(res.Line),
+			res.Section,
+			batch,
+			res.Status,
+			affected,
+			res.Error,
+			res.SQL,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入报告文件失败: %v", err)
+	}
+	return nil
+}
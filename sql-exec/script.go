@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Statement SQL 文件中的一条语句
+type Statement struct {
+	File    string // 文件名
+	Line    int    // 语句开始的行号
+	Section string // 语句前最近的一行注释，例如 kyc 脚本中的 "approve (通过): 3 条，..."
+	SQL     string // 语句原文，不含结尾的分号
+}
+
+// Verb 返回语句的类型，例如 update
+func (s Statement) Verb() string {
+	fields := strings.Fields(s.SQL)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// allowedVerbs 允许执行的语句类型，生成的脚本只包含数据变更语句
+// DDL 会隐式提交事务，预演无法回滚，一律拒绝
+var allowedVerbs = map[string]bool{
+	"update":  true,
+	"insert":  true,
+	"delete":  true,
+	"replace": true,
+}
+
+// whereClause 语句中是否有 WHERE 条件（注释已去掉，字符串常量和反引号内容已替换为空格）
+var whereClause = regexp.MustCompile(`(?i)\bwhere\b`)
+
+// readScript 读取 SQL 文件，按语句结尾的分号拆分（忽略引号和注释内的分号）
+// --、# 和 /* */ 注释在拆分前去掉，语句中不保留注释，WHERE 检查和执行的都是去掉注释后的内容
+func readScript(path string) ([]Statement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// 增加缓冲区大小以处理超长的行
+	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
+	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
+
+	name := filepath.Base(path)
+	var statements []Statement
+	var current strings.Builder
+	var quote byte // 当前所在的引号，0 表示不在引号内
+	escaped := false
+	inComment := false // 是否在 /* */ 注释内
+	started := false   // 当前语句是否已有非空白内容
+	commentLine := 0
+	section := ""
+	start := 0
+	lineNum := 0
+
+	// emit 结束当前语句
+	emit := func() {
+		if sql := strings.TrimSpace(current.String()); sql != "" {
+			statements = append(statements, Statement{File: name, Line: start, Section: section, SQL: sql})
+		}
+		current.Reset()
+		started = false
+	}
+	// write 写入语句内容，第一个非空白字符所在的行为语句开始的行
+	write := func(c byte) {
+		if !started && c != ' ' && c != '\t' {
+			started = true
+			start = lineNum
+		}
+		current.WriteByte(c)
+	}
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// 语句之间的空行和注释行
+		if !started && !inComment {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "--") || strings.HasPrefix(trimmed, "#") {
+				section = strings.TrimSpace(strings.TrimLeft(trimmed, "-# "))
+				continue
+			}
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+
+	scan:
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case inComment:
+				if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+					inComment = false
+					i++
+				}
+			case escaped:
+				escaped = false
+				write(c)
+			case quote != 0 && quote != '`' && c == '\\':
+				escaped = true
+				write(c)
+			case quote != 0 && c == quote:
+				quote = 0
+				write(c)
+			case quote != 0:
+				write(c)
+			case c == '\'' || c == '"' || c == '`':
+				quote = c
+				write(c)
+			case c == '#' || isDashComment(line, i):
+				// 行尾注释，MySQL 的 -- 注释要求后面跟空白字符
+				break scan
+			case c == '/' && i+1 < len(line) && line[i+1] == '*':
+				// 注释替换为空格，避免前后的内容连在一起
+				inComment = true
+				commentLine = lineNum
+				current.WriteByte(' ')
+				i++
+			case c == ';':
+				emit()
+			default:
+				write(c)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取文件时发生错误: %v", err)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("%s 第 %d 行开始的语句引号不完整", name, start)
+	}
+	if inComment {
+		return nil, fmt.Errorf("%s 第 %d 行开始的注释没有结束", name, commentLine)
+	}
+	// 最后一条语句可以没有分号
+	emit()
+	return statements, nil
+}
+
+// isDashComment 判断 line[i] 开始的是否为 -- 注释，与 MySQL 一致，-- 后面必须是空白字符或行尾
+func isDashComment(line string, i int) bool {
+	if !strings.HasPrefix(line[i:], "--") {
+		return false
+	}
+	return i+2 == len(line) || line[i+2] == ' ' || line[i+2] == '\t'
+}
+
+// checkStatements 执行前检查全部语句：只允许数据变更语句，UPDATE/DELETE 必须带 WHERE 条件
+// 返回前几个问题，有问题时不连接数据库
+func checkStatements(statements []Statement) error {
+	var problems []string
+	for _, s := range statements {
+		verb := s.Verb()
+		switch {
+		case !allowedVerbs[verb]:
+			problems = append(problems, fmt.Sprintf("%s:%d 不支持的语句类型 %s", s.File, s.Line, strings.ToUpper(verb)))
+		case (verb == "update" || verb == "delete") && !whereClause.MatchString(stripLiterals(s.SQL)):
+			problems = append(problems, fmt.Sprintf("%s:%d %s 没有 WHERE 条件", s.File, s.Line, strings.ToUpper(verb)))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	more := ""
+	if len(problems) > 10 {
+		more = fmt.Sprintf("; ... 共 %d 个问题", len(problems))
+		problems = problems[:10]
+	}
+	return fmt.Errorf("SQL 检查未通过，只执行带 WHERE 条件的 UPDATE/DELETE 和 INSERT/REPLACE: %s%s", strings.Join(problems, "; "), more)
+}
+
+// stripLiterals 将引号内的内容替换为空格，避免字符串常量和反引号中的字段名（例如 `where`）影响检查
+func stripLiterals(sql string) string {
+	out := []byte(sql)
+	var quote byte
+	escaped := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case escaped:
+			escaped = false
+			out[i] = ' '
+		case quote != 0 && quote != '`' && c == '\\':
+			escaped = true
+			out[i] = ' '
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			out[i] = ' '
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript 在临时目录中写入 SQL 文件
+func writeScript(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.sql")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadScriptStripsComments(t *testing.T) {
+	path := writeScript(t, `-- approve (通过): 3 条
+UPDATE b_user SET status = -1 -- where id = 5
+;
+UPDATE b_user SET status = -1 /* where */ ;
+UPDATE b_user SET remark = 'a;b -- c /* d */' WHERE id = 1; -- 行尾注释; 中的分号
+/* 跨行注释
+   ; 中的分号 */ DELETE FROM b_user WHERE id = 2 # 行尾注释;
+;
+UPDATE b_user SET `+"`where`"+` = 1;
+UPDATE b_user SET x = 5--3
+ WHERE id = 3;
+INSERT INTO b_log VALUES ('it''s; "quoted"', "a\"; b")
+`)
+	statements, err := readScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		line int
+		sql  string
+	}{
+		{2, "UPDATE b_user SET status = -1"},
+		{4, "UPDATE b_user SET status = -1"},
+		{5, "UPDATE b_user SET remark = 'a;b -- c /* d */' WHERE id = 1"},
+		{7, "DELETE FROM b_user WHERE id = 2"},
+		{9, "UPDATE b_user SET `where` = 1"},
+		{10, "UPDATE b_user SET x = 5--3\n WHERE id = 3"},
+		{12, `INSERT INTO b_log VALUES ('it''s; "quoted"', "a\"; b")`},
+	}
+	if len(statements) != len(want) {
+		for _, s := range statements {
+			t.Logf("%d: %q", s.Line, s.SQL)
+		}
+		t.Fatalf("语句数 = %d, want %d", len(statements), len(want))
+	}
+	for i, w := range want {
+		s := statements[i]
+		if s.Line != w.line || s.SQL != w.sql {
+			t.Errorf("语句 %d = %d %q, want %d %q", i, s.Line, s.SQL, w.line, w.sql)
+		}
+		if s.Section != "approve (通过): 3 条" {
+			t.Errorf("语句 %d 的 Section = %q", i, s.Section)
+		}
+	}
+
+	err = checkStatements(statements)
+	if err == nil {
+		t.Fatal("注释中的 WHERE 不应通过检查")
+	}
+	for _, line := range []string{"test.sql:2 ", "test.sql:4 ", "test.sql:9 "} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("检查结果缺少 %s: %v", line, err)
+		}
+	}
+	for _, line := range []string{"test.sql:5 ", "test.sql:7 ", "test.sql:10 ", "test.sql:12 "} {
+		if strings.Contains(err.Error(), line) {
+			t.Errorf("%s 不应报错: %v", line, err)
+		}
+	}
+}
+
+func TestReadScriptUnterminated(t *testing.T) {
+	for name, content := range map[string]string{
+		"引号": "UPDATE b_user SET remark = 'abc WHERE id = 1;\n",
+		"注释": "UPDATE b_user SET status = 1 WHERE id = 1; /* 没有结束\n",
+	} {
+		if _, err := readScript(writeScript(t, content)); err == nil {
+			t.Errorf("%s不完整时应返回错误", name)
+		}
+	}
+}
+
+func TestCheckStatements(t *testing.T) {
+	tests := []struct {
+		sql string
+		ok  bool
+	}{
+		{"UPDATE b_user SET status = -1 WHERE id = 1", true},
+		{"update b_user set status = -1 where id in (1, 2)", true},
+		{"DELETE FROM b_user WHERE id = 1", true},
+		{"INSERT INTO b_log (id) VALUES (1)", true},
+		{"REPLACE INTO b_log (id) VALUES (1)", true},
+		{"UPDATE b_user SET status = -1", false},
+		{"DELETE FROM b_user", false},
+		{"UPDATE b_user SET remark = 'where'", false},
+		{`UPDATE b_user SET remark = "x \" where"`, false},
+		{"UPDATE b_user SET `where` = 1", false},
+		{"UPDATE b_user SET somewhere = 1", false},
+		{"SELECT * FROM b_user WHERE id = 1", false},
+		{"DROP TABLE b_user", false},
+		{"TRUNCATE b_user", false},
+	}
+	for _, tt := range tests {
+		err := checkStatements([]Statement{{File: "test.sql", Line: 1, SQL: tt.sql}})
+		if (err == nil) != tt.ok {
+			t.Errorf("checkStatements(%q) = %v, want ok=%v", tt.sql, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckStatementsLimitsProblems(t *testing.T) {
+	var statements []Statement
+	for i := 1; i <= 12; i++ {
+		statements = append(statements, Statement{File: "test.sql", Line: i, SQL: "DELETE FROM b_user"})
+	}
+	err := checkStatements(statements)
+	if err == nil || !strings.Contains(err.Error(), "共 12 个问题") || strings.Contains(err.Error(), "test.sql:11 ") {
+		t.Errorf("checkStatements = %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RoleAdmin 管理员角色，可以使用全部功能并管理用户
+const RoleAdmin = "admin"
+
+// AllCommands 角色权限中表示全部功能的通配符
+const AllCommands = "*"
+
+// PublicCommands 白名单用户都可以使用的命令
+var PublicCommands = map[string]bool{
+	"start":  true,
+	"help":   true,
+	"menu":   true,
+	"status": true,
+	"cancel": true,
+
+	// 审批命令，能否审批具体的任务取决于是否有该功能的权限
+	"approvals": true,
+	"approve":   true,
+	"reject":    true,
+
+	// 历史任务，只能查看和重新下载自己的任务，重新执行还需要该功能的权限
+	"history":    true,
+	"redownload": true,
+	"rerun":      true,
+}
+
+// DefaultRoles 访问控制文件未配置角色时使用的默认权限
+// ops 可以使用全部功能，analyst 不能执行锁定用户和删除Redis流水等高风险操作
+var DefaultRoles = map[string][]string{
+	"ops":     {AllCommands},
+	"analyst": {"logparse", "sqlparse", "filesplit", "kycreview", "redisadd", "uiddedup"},
+}
+
+// AccessUser 白名单中的用户
+type AccessUser struct {
+	ID    int64    `json:"-"`
+	Name  string   `json:"name,omitempty"`
+	Roles []string `json:"roles"`
+}
+
+// accessFile 访问控制文件格式，users 的 key 为 Telegram 用户ID
+type accessFile struct {
+	Roles map[string][]string   `json:"roles"`
+	Users map[string]AccessUser `json:"users"`
+}
+
+// AccessControl 用户白名单和角色权限，通过管理员命令修改后写回访问控制文件
+type AccessControl struct {
+	mu     sync.RWMutex
+	path   string
+	admins map[int64]bool
+	roles  map[string][]string
+	users  map[int64]AccessUser
+}
+
+// LoadAccessControl 加载访问控制文件
+// admins 为配置中的管理员；seed 为环境变量中的初始白名单，格式: "123456:ops,234567:analyst"，
+// 只在访问控制文件不存在时使用并写入文件，之后以文件为准，避免运行时移除的用户在重启后恢复
+func LoadAccessControl(path string, admins []int64, seed string) (*AccessControl, error) {
+	ac := &AccessControl{
+		path:   path,
+		admins: make(map[int64]bool),
+		roles:  DefaultRoles,
+		users:  make(map[int64]AccessUser),
+	}
+	for _, id := range admins {
+		ac.admins[id] = true
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取访问控制文件失败: %v", err)
+	}
+	if err != nil {
+		if err := ac.seed(seed); err != nil {
+			return nil, err
+		}
+		return ac, nil
+	}
+
+	var file accessFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析访问控制文件失败: %v", err)
+	}
+	if len(file.Roles) > 0 {
+		ac.roles = file.Roles
+	}
+	for key, user := range file.Users {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的用户ID: %s", key)
+		}
+		if err := ac.validateRoles(user.Roles); err != nil {
+			return nil, fmt.Errorf("用户 %d: %v", id, err)
+		}
+		user.ID = id
+		ac.users[id] = user
+	}
+	return ac, nil
+}
+
+// seed 使用初始白名单创建访问控制文件
+func (ac *AccessControl) seed(spec string) error {
+	users, err := ParseAllowedUsers(spec)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	for _, user := range users {
+		if err := ac.validateRoles(user.Roles); err != nil {
+			return fmt.Errorf("用户 %d: %v", user.ID, err)
+		}
+		ac.users[user.ID] = user
+	}
+	return ac.save()
+}
+
+// ParseAllowedUsers 解析白名单配置，格式: "123456:ops,234567:analyst+ops"，未写角色时默认为 analyst
+func ParseAllowedUsers(spec string) ([]AccessUser, error) {
+	var users []AccessUser
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idPart, rolePart, _ := strings.Cut(item, ":")
+		id, err := strconv.ParseInt(strings.TrimSpace(idPart), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的用户ID: %s", item)
+		}
+		roles := []string{"analyst"}
+		if rolePart = strings.TrimSpace(rolePart); rolePart != "" {
+			roles = strings.Split(rolePart, "+")
+		}
+		users = append(users, AccessUser{ID: id, Roles: roles})
+	}
+	return users, nil
+}
+
+// validateRoles 检查角色是否已定义
+func (ac *AccessControl) validateRoles(roles []string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("至少需要一个角色")
+	}
+	for _, role := range roles {
+		if _, ok := ac.roles[role]; !ok && role != RoleAdmin {
+			return fmt.Errorf("角色 %s 未定义", role)
+		}
+	}
+	return nil
+}
+
+// IsAdmin 检查用户是否为管理员（配置中的管理员或拥有 admin 角色）
+func (ac *AccessControl) IsAdmin(userID int64) bool {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.isAdmin(userID)
+}
+
+// isAdmin 调用方需持有锁
+func (ac *AccessControl) isAdmin(userID int64) bool {
+	if ac.admins[userID] {
+		return true
+	}
+	for _, role := range ac.users[userID].Roles {
+		if role == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowed 检查用户是否在白名单中
+func (ac *AccessControl) IsAllowed(userID int64) bool {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	_, ok := ac.users[userID]
+	return ok || ac.isAdmin(userID)
+}
+
+// CanUse 检查用户能否使用命令
+func (ac *AccessControl) CanUse(userID int64, command string) bool {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	if ac.isAdmin(userID) {
+		return true
+	}
+	user, ok := ac.users[userID]
+	if !ok {
+		return false
+	}
+	if PublicCommands[command] {
+		return true
+	}
+	for _, role := range user.Roles {
+		for _, allowed := range ac.roles[role] {
+			if allowed == AllCommands || allowed == command {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddUser 添加或更新白名单用户并保存
+func (ac *AccessControl) AddUser(userID int64, name string, roles []string) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if err := ac.validateRoles(roles); err != nil {
+		return err
+	}
+	previous, existed := ac.users[userID]
+	ac.users[userID] = AccessUser{ID: userID, Name: name, Roles: roles}
+	if err := ac.save(); err != nil {
+		// 保存失败时恢复原来的记录，内存中的白名单与文件保持一致
+		if existed {
+			ac.users[userID] = previous
+		} else {
+			delete(ac.users, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveUser 从白名单移除用户并保存，用户不存在时返回 false
+func (ac *AccessControl) RemoveUser(userID int64) (bool, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	previous, ok := ac.users[userID]
+	if !ok {
+		return false, nil
+	}
+	delete(ac.users, userID)
+	if err := ac.save(); err != nil {
+		ac.users[userID] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// Users 返回按用户ID排序的白名单
+func (ac *AccessControl) Users() []AccessUser {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	users := make([]AccessUser, 0, len(ac.users))
+	for _, user := range ac.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// Roles 返回角色名称列表
+func (ac *AccessControl) Roles() []string {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	roles := make([]string, 0, len(ac.roles)+1)
+	for role := range ac.roles {
+		roles = append(roles, role)
+	}
+	roles = append(roles, RoleAdmin)
+	sort.Strings(roles)
+	return roles
+}
+
+// AdminIDs 返回配置中的管理员和拥有 admin 角色的用户
+func (ac *AccessControl) AdminIDs() []int64 {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	var ids []int64
+	for id := range ac.admins {
+		ids = append(ids, id)
+	}
+	for id := range ac.users {
+		if !ac.admins[id] && ac.isAdmin(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// save 写入访问控制文件，先写临时文件再重命名，避免写入中断导致文件损坏，调用方需持有锁
+func (ac *AccessControl) save() error {
+	file := accessFile{
+		Roles: ac.roles,
+		Users: make(map[string]AccessUser, len(ac.users)),
+	}
+	for id, user := range ac.users {
+		file.Users[strconv.FormatInt(id, 10)] = user
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化访问控制失败: %v", err)
+	}
+	if dir := filepath.Dir(ac.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+	}
+	tmp := ac.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入访问控制文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, ac.path); err != nil {
+		return fmt.Errorf("保存访问控制文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 保存失败时 AddUser/RemoveUser 恢复内存中的白名单，与文件保持一致
+func TestAccessControlSaveFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	ac, err := LoadAccessControl(path, nil, "1001:analyst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 访问控制文件路径变成非空目录后，保存时 rename 失败
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"新增用户", func() error { return ac.AddUser(2002, "bob", []string{"ops"}) }},
+		{"更新用户", func() error { return ac.AddUser(1001, "alice", []string{"ops"}) }},
+		{"移除用户", func() error {
+			removed, err := ac.RemoveUser(1001)
+			if removed {
+				t.Error("保存失败时 RemoveUser 返回 removed = true")
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err == nil {
+				t.Fatal("保存失败没有返回错误")
+			}
+			users := ac.Users()
+			if len(users) != 1 || users[0].ID != 1001 || users[0].Name != "" || len(users[0].Roles) != 1 || users[0].Roles[0] != "analyst" {
+				t.Errorf("保存失败后白名单 = %+v, want 只有 1001:analyst", users)
+			}
+			if ac.IsAllowed(2002) {
+				t.Error("保存失败后新增的用户仍然可用")
+			}
+		})
+	}
+}
@@ -1,79 +1,181 @@
 package config
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"shared/configloader"
+	"shared/dedup"
+	"shared/rediskey"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	BotToken    string
-	TempDir     string
-	MaxFileSize int64   // 最大文件大小 (字节)
-	AdminUsers  []int64 // 管理员用户ID列表
-	Log         LogConfig
+	BotToken    string    `config:"bot_token" env:"BOT_TOKEN" secret:"true" required:"true" usage:"Telegram Bot Token"`
+	TempDir     string    `config:"temp_dir" env:"TEMP_DIR" usage:"临时文件目录"`
+	MaxFileSize int64     `config:"max_file_size" env:"MAX_FILE_SIZE" usage:"上传文件大小上限，如 50MB"`
+	AdminUsers  []int64   `config:"admin_users" env:"ADMIN_USERS" usage:"管理员用户ID，逗号分隔"`
+	Log         LogConfig `config:"log"`
+
+	AccessFile   string `config:"access_file" env:"ACCESS_FILE" usage:"白名单和角色权限文件，管理员命令修改后写回该文件"`
+	AllowedUsers string `config:"allowed_users" env:"ALLOWED_USERS" usage:"初始白名单，格式: 123456:ops,234567:analyst"`
+
+	Approval         bool     `config:"approval" env:"APPROVAL" usage:"是否启用双人审批"`
+	ApprovalCommands []string `config:"approval_commands" env:"APPROVAL_COMMANDS" usage:"需要审批的功能，逗号分隔"`
+	ApprovalDir      string   `config:"approval_dir" env:"APPROVAL_DIR" usage:"等待审批的输出文件和审批记录目录"`
+	AuditFile        string   `config:"audit_file" env:"AUDIT_FILE" usage:"审计日志文件"`
+
+	HistoryDir   string        `config:"history_dir" env:"HISTORY_DIR" usage:"历史任务的输入和输出文件目录"`
+	HistoryTTL   time.Duration `config:"history_ttl" env:"HISTORY_TTL" usage:"历史任务保留时间"`
+	HistoryQuota int64         `config:"history_quota" env:"HISTORY_QUOTA" usage:"每个用户的历史文件空间上限，如 200MB"`
+
+	LockUserRedisKeysSpec string              `config:"lock_user_redis_keys" env:"LOCK_USER_REDIS_KEYS" usage:"锁定用户时删除的Redis key模板"`
+	LockUserRedisKeys     []rediskey.Template // 锁定用户时需要删除的Redis key，按DB分组，由 LockUserRedisKeysSpec 解析
+
+	DedupMemory int64 `config:"dedup_memory" env:"DEDUP_MEMORY" usage:"UID去重的内存预算，如 512MB，超出时按UID哈希分区写入临时文件处理"`
+
+	TaskTimeout      time.Duration            `config:"task_timeout" env:"TASK_TIMEOUT" usage:"单个任务默认最长处理时间"`
+	TaskTimeoutsSpec string                   `config:"task_timeouts" env:"TASK_TIMEOUTS" usage:"按功能覆盖处理时间上限，如 logparse=1h"`
+	TaskTimeouts     map[string]time.Duration // 按功能覆盖的处理时间上限，由 TaskTimeoutsSpec 解析
 }
 
+// DefaultTaskTimeout 默认任务超时时间
+const DefaultTaskTimeout = 30 * time.Minute
+
 type LogConfig struct {
-	Level       string // DEBUG, INFO, WARN, ERROR
-	LogDir      string // 日志目录
-	MaxFileSize int64  // 日志文件最大大小
-	EnableJSON  bool   // 是否启用JSON格式
-	KeepDays    int    // 保留日志天数
+	Level       string `config:"level" env:"LOG_LEVEL" usage:"日志级别: DEBUG, INFO, WARN, ERROR"`
+	LogDir      string `config:"dir" env:"LOG_DIR" usage:"日志目录"`
+	MaxFileSize int64  `config:"max_file_size" env:"LOG_MAX_SIZE" usage:"日志文件最大大小"`
+	EnableJSON  bool   `config:"json" env:"LOG_JSON" usage:"是否启用JSON格式"`
+	KeepDays    int    `config:"keep_days" env:"LOG_KEEP_DAYS" usage:"保留日志天数"`
 }
 
-func LoadConfig() *Config {
-	botToken := os.Getenv("BOT_TOKEN")
-	if botToken == "" {
-		botToken = "8485165772:AAH4XePh1c2vL8VwBh_oqhs0ywFY3-cToqE"
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	wd, _ := os.Getwd()
+	return &Config{
+		TempDir:     "/tmp/tgbot",
+		MaxFileSize: 50 * 1024 * 1024, // 50MB
+		AdminUsers:  []int64{},
+		Log: LogConfig{
+			Level:       "INFO",
+			LogDir:      filepath.Join(wd, "logs"),
+			MaxFileSize: 100 * 1024 * 1024, // 100MB
+			EnableJSON:  true,
+			KeepDays:    30,
+		},
+		AccessFile:            filepath.Join(wd, "access.json"),
+		Approval:              true, // 这些功能的输出会修改生产数据，默认需要另一位用户审批
+		ApprovalCommands:      []string{"lockuser", "kycreview", "redisdel", "redisadd"},
+		ApprovalDir:           filepath.Join(wd, "approvals"),
+		AuditFile:             filepath.Join(wd, "audit.log"),
+		HistoryDir:            filepath.Join(wd, "history"),
+		HistoryTTL:            7 * 24 * time.Hour,
+		HistoryQuota:          200 * 1024 * 1024, // 200MB
+		LockUserRedisKeysSpec: rediskey.DefaultLockUser,
+		DedupMemory:           dedup.DefaultMemoryLimit,
+		TaskTimeout:           DefaultTaskTimeout,
 	}
+}
 
-	tempDir := os.Getenv("TEMP_DIR")
-	if tempDir == "" {
-		tempDir = "/tmp/tgbot"
-	}
+// LoadConfig 按 默认值 → 配置文件 → 环境变量 → 命令行参数 的顺序加载配置并校验
+// 配置文件通过 --config 或 TGBOT_CONFIG 指定，未指定时依次尝试当前目录的 tgbot.yaml、tgbot.toml
+func LoadConfig(args []string) (*Config, *configloader.Result, error) {
+	cfg := DefaultConfig()
+	result, err := configloader.Load(cfg, configloader.Options{
+		Args:          args,
+		FileEnv:       "TGBOT_CONFIG",
+		DefaultFiles:  []string{"tgbot.yaml", "tgbot.yml", "tgbot.toml"},
+		ErrorHandling: flag.ContinueOnError,
+	})
+	return cfg, result, err
+}
 
-	// 日志配置
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel == "" {
-		logLevel = "INFO"
+// Validate 校验配置并解析派生字段，配置错误时拒绝启动
+func (c *Config) Validate() error {
+	if c.MaxFileSize <= 0 {
+		return fmt.Errorf("max_file_size 必须大于 0")
+	}
+	if c.TaskTimeout <= 0 {
+		return fmt.Errorf("task_timeout 必须大于 0")
+	}
+	if c.DedupMemory <= 0 {
+		return fmt.Errorf("dedup_memory 必须大于 0")
+	}
+	if c.HistoryTTL <= 0 || c.HistoryQuota <= 0 {
+		return fmt.Errorf("history_ttl 和 history_quota 必须大于 0")
+	}
+	if c.Log.KeepDays <= 0 || c.Log.MaxFileSize <= 0 {
+		return fmt.Errorf("log.keep_days 和 log.max_file_size 必须大于 0")
+	}
+	c.Log.Level = strings.ToUpper(c.Log.Level)
+	switch c.Log.Level {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		return fmt.Errorf("无效的日志级别: %s", c.Log.Level)
 	}
 
-	logDir := os.Getenv("LOG_DIR")
-	if logDir == "" {
-		wd, _ := os.Getwd()
-		logDir = filepath.Join(wd, "logs")
+	// key模板错误会导致删除错误的key，直接拒绝启动
+	lockUserRedisKeys, err := rediskey.ParseTemplates(c.LockUserRedisKeysSpec)
+	if err != nil {
+		return fmt.Errorf("lock_user_redis_keys 配置错误: %v", err)
 	}
+	c.LockUserRedisKeys = lockUserRedisKeys
 
-	logMaxSize, _ := strconv.ParseInt(os.Getenv("LOG_MAX_SIZE"), 10, 64)
-	if logMaxSize == 0 {
-		logMaxSize = 100 * 1024 * 1024 // 100MB
+	taskTimeouts, err := ParseTaskTimeouts(c.TaskTimeoutsSpec)
+	if err != nil {
+		return fmt.Errorf("task_timeouts 配置错误: %v", err)
 	}
+	c.TaskTimeouts = taskTimeouts
+	return nil
+}
 
-	enableJSON, _ := strconv.ParseBool(os.Getenv("LOG_JSON"))
-	if os.Getenv("LOG_JSON") == "" {
-		enableJSON = true // 默认启用JSON
+// RequiresApproval 检查功能的输出是否需要审批
+func (c *Config) RequiresApproval(command string) bool {
+	if !c.Approval {
+		return false
 	}
+	for _, cmd := range c.ApprovalCommands {
+		if cmd == command {
+			return true
+		}
+	}
+	return false
+}
 
-	keepDays, _ := strconv.Atoi(os.Getenv("LOG_KEEP_DAYS"))
-	if keepDays == 0 {
-		keepDays = 30 // 默认保留30天
+// TaskTimeoutFor 返回指定功能的任务超时时间，未单独配置时使用默认值
+func (c *Config) TaskTimeoutFor(command string) time.Duration {
+	if timeout, ok := c.TaskTimeouts[command]; ok {
+		return timeout
+	}
+	if c.TaskTimeout > 0 {
+		return c.TaskTimeout
 	}
+	return DefaultTaskTimeout
+}
 
-	return &Config{
-		BotToken:    botToken,
-		TempDir:     tempDir,
-		MaxFileSize: 50 * 1024 * 1024, // 50MB
-		AdminUsers:  []int64{},        // 可以通过环境变量扩展
-		Log: LogConfig{
-			Level:       strings.ToUpper(logLevel),
-			LogDir:      logDir,
-			MaxFileSize: logMaxSize,
-			EnableJSON:  enableJSON,
-			KeepDays:    keepDays,
-		},
+// ParseTaskTimeouts 解析按功能配置的超时时间
+// 格式: "logparse=1h,sqlparse=45m"
+func ParseTaskTimeouts(spec string) (map[string]time.Duration, error) {
+	result := make(map[string]time.Duration)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		command, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("超时配置格式错误: %s", item)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("超时时间无效: %s", item)
+		}
+		result[strings.TrimSpace(command)] = timeout
 	}
+	return result, nil
 }
 
 // IsAdmin 检查用户是否是管理员
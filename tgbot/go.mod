@@ -7,6 +7,11 @@ require (
 	github.com/xuri/excelize/v2 v2.9.1
 )
 
+require (
+	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
 require (
 	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.4 // indirect
@@ -16,4 +21,7 @@ require (
 	golang.org/x/crypto v0.38.0 // indirect
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
+	shared v0.0.0
 )
+
+replace shared => ../shared
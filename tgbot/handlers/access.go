@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// functionCommands 需要按角色授权的功能命令
+var functionCommands = map[string]bool{
+	"logparse":  true,
+	"lockuser":  true,
+	"sqlparse":  true,
+	"filesplit": true,
+	"kycreview": true,
+	"redisdel":  true,
+	"redisadd":  true,
+	"uiddedup":  true,
+}
+
+// adminCommands 只有管理员可以使用的命令
+var adminCommands = map[string]bool{
+	"adduser": true,
+	"deluser": true,
+	"users":   true,
+	"audit":   true,
+}
+
+// deniedNotifyInterval 同一用户的越权尝试通知管理员的最小间隔，避免刷屏
+const deniedNotifyInterval = 10 * time.Minute
+
+// authorize 检查用户能否使用命令，没有权限时回复用户、记录日志并通知管理员
+func (hm *HandlerManager) authorize(chatID, userID int64, command string) bool {
+	switch {
+	case !hm.access.IsAllowed(userID):
+	case adminCommands[command] && !hm.access.IsAdmin(userID):
+	case functionCommands[command] && !hm.access.CanUse(userID, command):
+	default:
+		return true
+	}
+
+	hm.denyAccess(chatID, userID, command)
+	return false
+}
+
+// denyAccess 拒绝未授权的操作
+func (hm *HandlerManager) denyAccess(chatID, userID int64, command string) {
+	allowed := hm.access.IsAllowed(userID)
+	hm.logger.Warn("未授权的操作",
+		slog.Int64("user_id", userID),
+		slog.Int64("chat_id", chatID),
+		slog.String("command", command),
+		slog.Bool("in_allow_list", allowed),
+		slog.String("timestamp", time.Now().Format(time.RFC3339)),
+	)
+
+	text := fmt.Sprintf("⛔ 你没有使用 /%s 的权限，请联系管理员", command)
+	if !allowed {
+		text = fmt.Sprintf("⛔ 你没有使用本Bot的权限，请联系管理员开通\n你的用户ID: `%d`", userID)
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	hm.bot.Send(msg)
+
+	now := time.Now()
+	if last, ok := hm.deniedAt.Load(userID); ok && now.Sub(last.(time.Time)) < deniedNotifyInterval {
+		return
+	}
+	hm.deniedAt.Store(userID, now)
+	hm.notifyAdmins(fmt.Sprintf("⚠️ 未授权的操作\n用户: [%d](tg://user?id=%d)\n命令: /%s\n白名单用户: %v\n\n开通权限: `/adduser %d analyst`",
+		userID, userID, tgbotapi.EscapeText(tgbotapi.ModeMarkdown, command), allowed, userID))
+}
+
+// notifyAdmins 给所有管理员发送消息
+func (hm *HandlerManager) notifyAdmins(text string) {
+	for _, adminID := range hm.access.AdminIDs() {
+		msg := tgbotapi.NewMessage(adminID, text)
+		msg.ParseMode = "Markdown"
+		if _, err := hm.bot.Send(msg); err != nil {
+			hm.logger.Error("通知管理员失败",
+				slog.Int64("admin_id", adminID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// handleAddUser 添加白名单用户，格式: /adduser <用户ID> <角色[,角色]> [备注名]
+func (hm *HandlerManager) handleAddUser(chatID, userID int64, args string) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("用法: /adduser <用户ID> <角色[,角色]> [备注名]\n可用角色: %s",
+			strings.Join(hm.access.Roles(), ", "))))
+		return
+	}
+
+	targetID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 无效的用户ID: "+fields[0]))
+		return
+	}
+	roles := strings.Split(fields[1], ",")
+	name := strings.Join(fields[2:], " ")
+
+	if err := hm.access.AddUser(targetID, name, roles); err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 添加失败: "+err.Error()))
+		return
+	}
+
+	hm.logger.Info("管理员添加用户",
+		slog.Int64("admin_id", userID),
+		slog.Int64("target_id", targetID),
+		slog.String("roles", strings.Join(roles, ",")),
+	)
+	hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已添加用户 %d，角色: %s", targetID, strings.Join(roles, ", "))))
+}
+
+// handleDelUser 移除白名单用户，格式: /deluser <用户ID>
+func (hm *HandlerManager) handleDelUser(chatID, userID int64, args string) {
+	targetID, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "用法: /deluser <用户ID>"))
+		return
+	}
+
+	removed, err := hm.access.RemoveUser(targetID)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 移除失败: "+err.Error()))
+		return
+	}
+	if !removed {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("用户 %d 不在白名单中", targetID)))
+		return
+	}
+
+	hm.logger.Info("管理员移除用户",
+		slog.Int64("admin_id", userID),
+		slog.Int64("target_id", targetID),
+	)
+	hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已移除用户 %d", targetID)))
+}
+
+// sendUserList 发送白名单用户列表
+func (hm *HandlerManager) sendUserList(chatID int64) {
+	var sb strings.Builder
+	sb.WriteString("👥 白名单用户\n\n")
+
+	users := hm.access.Users()
+	if len(users) == 0 {
+		sb.WriteString("（空）\n")
+	}
+	for _, user := range users {
+		sb.WriteString(fmt.Sprintf("• %d", user.ID))
+		if user.Name != "" {
+			sb.WriteString(" " + user.Name)
+		}
+		sb.WriteString(" - " + strings.Join(user.Roles, ", ") + "\n")
+	}
+
+	adminIDs := hm.access.AdminIDs()
+	ids := make([]string, len(adminIDs))
+	for i, id := range adminIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	sb.WriteString("\n🔑 管理员: " + strings.Join(ids, ", "))
+	sb.WriteString("\n📋 可用角色: " + strings.Join(hm.access.Roles(), ", "))
+
+	hm.bot.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
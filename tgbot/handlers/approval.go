@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"shared/audit"
+	"shared/review"
+	"strconv"
+	"strings"
+	"tgbot/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// heldResultsKey UserState 中保存等待审批的输出文件的 key
+const heldResultsKey = "held_results"
+
+// outputsKey UserState 中保存本次处理生成的所有输出文件的 key
+const outputsKey = "outputs"
+
+// approvalIDKey UserState 中保存本次处理提交的审批编号的 key
+const approvalIDKey = "approval_id"
+
+// deliverResult 发送结果文件，需要审批的功能先保留文件，处理结束后统一提交审批
+// 所有输出文件都记录到 state，处理结束后写入审计日志
+func (hm *HandlerManager) deliverResult(chatID int64, state *UserState, filePath, caption string) {
+	outputs, _ := state.Get(outputsKey).([]utils.HistoryFile)
+	state.Set(outputsKey, append(outputs, utils.HistoryFile{Name: filepath.Base(filePath), Path: filePath, Caption: caption}))
+
+	if !hm.config.RequiresApproval(state.CurrentCommand) {
+		hm.sendResultFile(chatID, filePath, caption)
+		return
+	}
+	held, _ := state.Get(heldResultsKey).([]utils.ApprovalFile)
+	state.Set(heldResultsKey, append(held, utils.ApprovalFile{Path: filePath, Caption: caption}))
+}
+
+// submitApproval 将保留的输出文件提交审批，并通知有权限的其他用户
+func (hm *HandlerManager) submitApproval(chatID, userID int64, state *UserState) error {
+	held, _ := state.Get(heldResultsKey).([]utils.ApprovalFile)
+	if len(held) == 0 {
+		return nil
+	}
+
+	paths := make([]string, len(held))
+	for i, f := range held {
+		paths[i] = f.Path
+	}
+	summary, err := review.Summarize(paths, review.DefaultSamples)
+	if err != nil {
+		return fmt.Errorf("生成审核摘要失败: %v", err)
+	}
+
+	approval := &utils.Approval{
+		Command:     state.CurrentCommand,
+		SubmittedBy: userID,
+		Submitter:   hm.displayName(userID),
+		ChatID:      chatID,
+		Files:       held,
+		Summary:     summary,
+	}
+	if err := hm.approvals.Create(approval); err != nil {
+		return fmt.Errorf("提交审批失败: %v", err)
+	}
+	state.Set(approvalIDKey, approval.ID)
+	hm.recordAudit(userID, audit.ActionSubmit, approval, fmt.Sprintf("files=%d lines=%d errors=%d warnings=%d",
+		len(summary.Files), summary.TotalLines, summary.ErrorCount, summary.WarnCount))
+
+	text := fmt.Sprintf("⏳ 结果已提交审批，审批编号 #%d\n需要另一位有 /%s 权限的用户批准后才会发送文件\n\n%s",
+		approval.ID, approval.Command, summary.Text(120))
+	reviewers := hm.reviewersFor(approval)
+	if len(reviewers) == 0 {
+		text += "\n⚠️ 当前没有可以审批的用户，请联系管理员"
+	}
+	hm.bot.Send(tgbotapi.NewMessage(chatID, text))
+
+	for _, reviewerID := range reviewers {
+		msg := tgbotapi.NewMessage(reviewerID, hm.approvalText(approval))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ 批准", fmt.Sprintf("approve:%d", approval.ID)),
+				tgbotapi.NewInlineKeyboardButtonData("❌ 拒绝", fmt.Sprintf("reject:%d", approval.ID)),
+			),
+		)
+		if _, err := hm.bot.Send(msg); err != nil {
+			hm.logger.Error("发送审批通知失败",
+				slog.Int64("reviewer_id", reviewerID),
+				slog.Int64("approval_id", approval.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return nil
+}
+
+// reviewersFor 返回可以审批的用户：有该功能权限，且不是提交人
+func (hm *HandlerManager) reviewersFor(approval *utils.Approval) []int64 {
+	seen := make(map[int64]bool)
+	var reviewers []int64
+	candidates := hm.access.AdminIDs()
+	for _, user := range hm.access.Users() {
+		candidates = append(candidates, user.ID)
+	}
+	for _, id := range candidates {
+		if seen[id] || id == approval.SubmittedBy || !hm.access.CanUse(id, approval.Command) {
+			continue
+		}
+		seen[id] = true
+		reviewers = append(reviewers, id)
+	}
+	return reviewers
+}
+
+// approvalText 审批通知内容
+func (hm *HandlerManager) approvalText(approval *utils.Approval) string {
+	return fmt.Sprintf("🔔 待审批 #%d\n功能: /%s\n提交人: %s (%d)\n时间: %s\n\n%s\n批准: /approve %d [备注]\n拒绝: /reject %d <原因>",
+		approval.ID, approval.Command, approval.Submitter, approval.SubmittedBy,
+		approval.CreatedAt.Format("2006-01-02 15:04:05"), approval.Summary.Text(120), approval.ID, approval.ID)
+}
+
+// sendApprovalList 发送当前用户可以审批的和自己提交的待审批列表
+func (hm *HandlerManager) sendApprovalList(chatID, userID int64) {
+	var sb strings.Builder
+	sb.WriteString("📝 待审批列表\n")
+	count := 0
+	for _, approval := range hm.approvals.Pending() {
+		mine := approval.SubmittedBy == userID
+		if !mine && !hm.access.CanUse(userID, approval.Command) {
+			continue
+		}
+		count++
+		sb.WriteString(fmt.Sprintf("\n#%d /%s 提交人 %s，%d 行", approval.ID, approval.Command, approval.Submitter, approval.Summary.TotalLines))
+		if approval.Summary.ErrorCount > 0 {
+			sb.WriteString(fmt.Sprintf("，⚠️ %d 个错误", approval.Summary.ErrorCount))
+		}
+		if mine {
+			sb.WriteString("（我提交的）")
+		}
+	}
+	if count == 0 {
+		sb.WriteString("\n（空）")
+	} else {
+		sb.WriteString("\n\n查看详情: /approvals <编号>")
+	}
+	hm.bot.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
+
+// handleApprovals 处理 /approvals [编号]，带编号时显示审批详情
+func (hm *HandlerManager) handleApprovals(chatID, userID int64, args string) {
+	if strings.TrimSpace(args) == "" {
+		hm.sendApprovalList(chatID, userID)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(args), "#"), 10, 64)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "用法: /approvals [审批编号]"))
+		return
+	}
+	approval, err := hm.approvals.Get(id)
+	if err != nil || (approval.SubmittedBy != userID && !hm.access.CanUse(userID, approval.Command)) {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("审批 #%d 不存在", id)))
+		return
+	}
+	text := hm.approvalText(approval)
+	if approval.Status != utils.ApprovalPending {
+		text += fmt.Sprintf("\n\n状态: %s，审批人 %s", approval.Status, approval.Reviewer)
+		if approval.Comment != "" {
+			text += "，备注: " + approval.Comment
+		}
+	}
+	hm.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// handleReview 处理 /approve <编号> [备注] 和 /reject <编号> <原因>
+func (hm *HandlerManager) handleReview(chatID, userID int64, args string, approve bool) {
+	username := hm.displayName(userID)
+	usage := "用法: /approve <审批编号> [备注]"
+	if !approve {
+		usage = "用法: /reject <审批编号> <原因>"
+	}
+	idPart, comment, _ := strings.Cut(strings.TrimSpace(args), " ")
+	comment = strings.TrimSpace(comment)
+	id, err := strconv.ParseInt(strings.TrimPrefix(idPart, "#"), 10, 64)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+	if !approve && comment == "" {
+		// 通知中的拒绝按钮不带原因，已处理的审批直接提示结果
+		if approval, err := hm.approvals.Get(id); err == nil && approval.Status != utils.ApprovalPending {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("审批 #%d 已处理（%s）", id, approval.Status)))
+			return
+		}
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("请填写拒绝原因: /reject %d <原因>", id)))
+		return
+	}
+
+	status, action := utils.ApprovalApproved, audit.ActionApprove
+	if !approve {
+		status, action = utils.ApprovalRejected, audit.ActionReject
+	}
+	approval, err := hm.approvals.Decide(id, status, userID, username, comment, func(a *utils.Approval) error {
+		if a.SubmittedBy == userID {
+			return fmt.Errorf("不能审批自己提交的任务")
+		}
+		if !hm.access.CanUse(userID, a.Command) {
+			return fmt.Errorf("没有审批 /%s 的权限", a.Command)
+		}
+		return nil
+	})
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()))
+		return
+	}
+	hm.recordAudit(userID, action, approval, comment)
+
+	if !approve {
+		if err := hm.approvals.RemoveFiles(approval.ID); err != nil {
+			hm.logger.Error("删除被拒绝的审批文件失败", slog.Int64("approval_id", approval.ID), slog.String("error", err.Error()))
+		}
+		hm.bot.Send(tgbotapi.NewMessage(approval.ChatID, fmt.Sprintf("❌ 审批 #%d (/%s) 被 %s 拒绝\n原因: %s\n输出文件已删除",
+			approval.ID, approval.Command, username, comment)))
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已拒绝审批 #%d", approval.ID)))
+		return
+	}
+
+	// 审批通过后把文件发给提交人
+	hm.bot.Send(tgbotapi.NewMessage(approval.ChatID, fmt.Sprintf("✅ 审批 #%d (/%s) 已由 %s 批准", approval.ID, approval.Command, username)))
+	for _, f := range approval.Files {
+		doc := tgbotapi.NewDocument(approval.ChatID, tgbotapi.FilePath(f.Path))
+		doc.Caption = f.Caption
+		if _, err := hm.bot.Send(doc); err != nil {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 文件发送失败: %v", err)))
+			continue
+		}
+		hm.recordAudit(approval.SubmittedBy, audit.ActionDownload, approval, f.Path)
+	}
+	hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 已批准审批 #%d，文件已发送给提交人", approval.ID)))
+}
+
+// displayName 返回白名单中的备注名，没有备注名时返回用户ID
+func (hm *HandlerManager) displayName(userID int64) string {
+	for _, user := range hm.access.Users() {
+		if user.ID == userID && user.Name != "" {
+			return user.Name
+		}
+	}
+	return strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"shared/audit"
+	"strconv"
+	"strings"
+	"tgbot/utils"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// auditQueryLimit /audit 每次最多显示的记录数
+const auditQueryLimit = 20
+
+// recordAudit 记录审批相关的审计事件，写入失败只记录日志
+func (hm *HandlerManager) recordAudit(actor int64, action string, approval *utils.Approval, detail string) {
+	hm.logger.Info("审计",
+		slog.Int64("actor", actor),
+		slog.String("action", action),
+		slog.Int64("approval_id", approval.ID),
+		slog.String("command", approval.Command),
+		slog.String("detail", detail),
+	)
+	hm.writeAudit(audit.Event{
+		Source:    "telegram",
+		Actor:     strconv.FormatInt(actor, 10),
+		ActorName: hm.displayName(actor),
+		Action:    action,
+		Target:    fmt.Sprintf("approval#%d", approval.ID),
+		Command:   approval.Command,
+		Detail:    detail,
+	})
+}
+
+// recordGenerate 记录生成的输出：操作人、输入和输出文件的 sha256、参数和受影响的用户ID
+func (hm *HandlerManager) recordGenerate(userID int64, state *UserState, inputFile string) {
+	files, _ := state.Get(outputsKey).([]utils.HistoryFile)
+	outputs := make([]string, len(files))
+	for i, f := range files {
+		outputs[i] = f.Path
+	}
+	event := audit.Event{
+		Source:    "telegram",
+		Actor:     strconv.FormatInt(userID, 10),
+		ActorName: hm.displayName(userID),
+		Action:    audit.ActionGenerate,
+		Target:    state.CurrentCommand,
+		Command:   state.CurrentCommand,
+		Params:    hm.auditParams(state),
+	}
+	if jobID, ok := state.Get(rerunOfKey).(int64); ok {
+		event.Detail = fmt.Sprintf("重新执行历史任务 #%d", jobID)
+	}
+	if input, err := audit.HashFile(inputFile); err == nil {
+		event.Input = &input
+	} else {
+		event.Detail = "计算输入文件哈希失败: " + err.Error()
+	}
+	artifacts, err := audit.HashFiles(outputs)
+	if err != nil {
+		event.Detail = "计算输出文件哈希失败: " + err.Error()
+	}
+	event.Outputs = artifacts
+	ids, err := audit.ExtractAffectedIDs(outputs)
+	if err != nil {
+		event.Detail = "提取受影响用户失败: " + err.Error()
+	}
+	event.AffectedIDs = ids
+
+	hm.logger.Info("审计",
+		slog.Int64("actor", userID),
+		slog.String("action", audit.ActionGenerate),
+		slog.String("command", state.CurrentCommand),
+		slog.Int("outputs", len(artifacts)),
+		slog.Int("affected_ids", len(ids)),
+	)
+	hm.writeAudit(event)
+}
+
+// auditParams 返回影响功能输出的配置参数和命令参数
+func (hm *HandlerManager) auditParams(state *UserState) map[string]string {
+	var params map[string]string
+	switch state.CurrentCommand {
+	case "lockuser":
+		params = map[string]string{"lock_user_redis_keys": hm.config.LockUserRedisKeysSpec}
+		if useSnapshot(state) {
+			params["snapshot"] = "true"
+		}
+	case "kycreview":
+		if useSnapshot(state) {
+			params = map[string]string{"snapshot": "true"}
+		}
+	case "filesplit":
+		if opts, err := splitOptions(state); err == nil {
+			params = opts.Values()
+		}
+	case "uiddedup":
+		params = map[string]string{"dedup_mode": string(dedupMode(state))}
+	}
+	return params
+}
+
+// writeAudit 写入审计日志，失败只记录日志
+func (hm *HandlerManager) writeAudit(event audit.Event) {
+	if err := hm.auditLog.Record(event); err != nil {
+		hm.logger.Error("写入审计日志失败", slog.String("error", err.Error()))
+	}
+}
+
+// handleAudit 处理 /audit 命令：/audit <用户ID|YYYY-MM-DD>... 查询，/audit verify 校验哈希链
+func (hm *HandlerManager) handleAudit(chatID int64, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "用法:\n/audit <用户ID> - 查询影响该用户的操作\n/audit <YYYY-MM-DD> - 查询某天的操作\n/audit <用户ID> <YYYY-MM-DD> - 组合查询\n/audit verify - 校验审计日志是否被篡改"))
+		return
+	}
+
+	if fields[0] == "verify" {
+		count, err := hm.auditLog.Verify()
+		if err != nil {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🚨 审计日志校验失败: %v\n已校验通过 %d 条记录", err, count)))
+			return
+		}
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 审计日志校验通过，共 %d 条记录", count)))
+		return
+	}
+
+	filter := audit.Filter{Limit: auditQueryLimit}
+	for _, field := range fields {
+		if day, err := time.ParseInLocation("2006-01-02", field, time.Local); err == nil {
+			filter.Date = day
+			continue
+		}
+		if _, err := strconv.ParseInt(field, 10, 64); err == nil {
+			filter.AffectedID = field
+			continue
+		}
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 无法识别的参数: %s，应为用户ID或 YYYY-MM-DD", field)))
+		return
+	}
+
+	events, err := hm.auditLog.Query(filter)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 查询审计日志失败: "+err.Error()))
+		return
+	}
+	if len(events) == 0 {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "📭 没有符合条件的审计记录"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧾 审计记录（最近 %d 条）\n", len(events)))
+	for _, e := range events {
+		entry := formatAuditEvent(e)
+		// Telegram 单条消息最长 4096 个字符，超出时分多条发送
+		if len([]rune(sb.String()))+len([]rune(entry)) > 4000 {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, sb.String()))
+			sb.Reset()
+		}
+		sb.WriteString(entry)
+	}
+	hm.bot.Send(tgbotapi.NewMessage(chatID, sb.String()))
+}
+
+// formatAuditEvent 格式化一条审计记录
+func formatAuditEvent(e audit.Event) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n#%d %s [%s] %s", e.Seq, e.Time.Local().Format("2006-01-02 15:04:05"), e.Source, e.Actor))
+	if e.ActorName != "" && e.ActorName != e.Actor {
+		sb.WriteString("(" + e.ActorName + ")")
+	}
+	sb.WriteString(fmt.Sprintf(" %s %s", e.Action, e.Target))
+	if e.Command != "" && e.Command != e.Target {
+		sb.WriteString(" /" + e.Command)
+	}
+	if e.Input != nil {
+		sb.WriteString(fmt.Sprintf("\n  输入: %s sha256:%.12s", e.Input.Name, e.Input.SHA256))
+	}
+	for _, out := range e.Outputs {
+		sb.WriteString(fmt.Sprintf("\n  输出: %s sha256:%.12s", out.Name, out.SHA256))
+	}
+	if len(e.AffectedIDs) > 0 {
+		sb.WriteString(fmt.Sprintf("\n  影响用户: %d 个", len(e.AffectedIDs)))
+	}
+	if detail := []rune(e.Detail); len(detail) > 100 {
+		sb.WriteString("\n  备注: " + string(detail[:100]) + "...")
+	} else if len(detail) > 0 {
+		sb.WriteString("\n  备注: " + e.Detail)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"shared/batch"
+	"shared/dedup"
+	"strings"
+	"sync"
+	"tgbot/utils"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// batchUploadKey UserState 中保存批量模式已上传文件的 key
+const batchUploadKey = "batch_upload"
+
+// maxBatchExtractSize 批量任务压缩包解压后的大小上限，也是批量模式下上传文件的总大小上限
+const maxBatchExtractSize = 500 * 1024 * 1024 // 500MB
+
+// maxCaptionLength Telegram 文件说明的最大长度
+const maxCaptionLength = 1024
+
+// batchSpecs 支持批量处理的功能及合并规则，与各功能读取输入文件的方式保持一致
+var batchSpecs = map[string]batch.Spec{
+	// 第一列为用户ID，没有表头
+	"lockuser": {Extensions: []string{".csv"}, Header: batch.NoHeader, KeyColumns: []int{0}, MinColumns: 1, Columns: 1},
+	// 第一行为表头，user_id 和 id 共同确定一条审核记录；保留审核结论和原因等所有列，各文件的表头必须一致
+	// 合并时保留重复行，同一条记录的结论不同时由审核逻辑报错，而不是只保留第一个结论
+	"kycreview": {Extensions: []string{".csv", ".xlsx"}, Header: batch.Header, KeyColumns: []int{0, 1}, MinColumns: 2, KeepDuplicates: true},
+	// 第一列为用户ID，第一行不是数字时视为表头
+	"redisdel": {Extensions: []string{".csv", ".xlsx"}, Header: batch.AutoHeader, KeyColumns: []int{0}, MinColumns: 1, Columns: 1},
+	// 第一行为表头，每个用户只保留一行流水数据，第5列为投注金额
+	"redisadd": {Extensions: []string{".csv"}, Header: batch.Header, KeyColumns: []int{0}, MinColumns: 5, Columns: 5},
+	// 去重逻辑需要统计每个UID在所有文件中的出现次数，合并时保留重复行
+	"uiddedup": {Extensions: []string{".csv"}, Header: batch.NoHeader, KeepDuplicates: true},
+}
+
+// batchUpload 批量模式下已上传的文件，同一用户的多个文件可能同时到达，需要加锁
+type batchUpload struct {
+	mu      sync.Mutex
+	files   []batch.File
+	size    int64
+	started bool     // 已开始处理，之后上传的文件不再加入
+	labels  []string // 固定文件数的上传依次需要的文件（UID集合运算的名单A和名单B、数据文件和快照），全部下载完成后自动开始处理；为空表示普通批量模式
+	ready   int      // 已下载完成的文件数
+}
+
+// isBatchInput 输入文件是否为需要合并的批量任务压缩包，UID集合运算的两个名单、对照快照时的数据文件和快照分别处理，不合并
+func isBatchInput(state *UserState, inputFile string) bool {
+	_, ok := batchSpecs[state.CurrentCommand]
+	if state.CurrentCommand == "uiddedup" && dedupMode(state).SetOperation() {
+		return false
+	}
+	if useSnapshot(state) {
+		return false
+	}
+	return ok && batch.IsZip(inputFile)
+}
+
+// handleBatch 处理 /batch <功能>，进入批量模式：逐个上传文件后发送 /done 统一处理
+func (hm *HandlerManager) handleBatch(chatID, userID int64, args string) {
+	command, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	command = strings.TrimPrefix(command, "/")
+	if command == "" {
+		hm.sendBatchMenu(chatID, userID)
+		return
+	}
+	spec, ok := batchSpecs[command]
+	if !ok {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("/%s 不支持批量处理，输入 /batch 查看支持的功能", command)))
+		return
+	}
+	if !hm.access.CanUse(userID, command) {
+		hm.denyAccess(chatID, userID, command)
+		return
+	}
+	// UID去重可以指定去重方式，合并所有文件后按该方式处理
+	data := map[string]interface{}{batchUploadKey: &batchUpload{}}
+	if command == "uiddedup" {
+		mode, err := dedup.ParseMode(rest)
+		if err == nil && mode.SetOperation() {
+			err = fmt.Errorf("集合运算请使用 /uiddedup %s 依次上传两个名单", string(mode))
+		}
+		if err != nil {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 参数错误: "+err.Error()))
+			return
+		}
+		data[argsKey] = string(mode)
+	}
+	// 替换状态期间占用任务位置，避免清理正在开始的任务的文件
+	task, ok := hm.reserveTask(userID, command)
+	if !ok {
+		hm.sendTaskRunning(chatID, "开始批量处理")
+		return
+	}
+	defer hm.releaseTask(userID, task)
+
+	// 放弃等待上传的流程
+	if previous := hm.getUserState(userID); previous.UserDir != "" {
+		hm.fileManager.CleanupUserDir(previous.UserDir)
+	}
+	state := &UserState{
+		CurrentCommand: command,
+		UserDir:        hm.fileManager.CreateUserDir(userID),
+		data:           data,
+	}
+	hm.setUserState(userID, state)
+
+	hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(`📦 /%s 批量模式
+
+请逐个上传 %s 格式的文件，全部上传后发送 /done 开始处理，最多 %d 个文件。
+也可以不进入批量模式，直接在 /%s 中上传包含这些文件的zip压缩包。
+
+⚙️ 处理说明：
+• 所有文件先统一校验，有文件格式不对或表头不一致时整个批次不处理
+• 按ID跨文件去重，ID相同但内容不同时保留最先上传的一行
+• 生成一份合并的结果，并附带每个文件的统计报告
+
+输入 /cancel 退出批量模式`, command, strings.Join(spec.Extensions, "/"), batch.MaxFiles, command)))
+}
+
+// sendBatchMenu 列出当前用户可以批量处理的功能
+func (hm *HandlerManager) sendBatchMenu(chatID, userID int64) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, command := range []string{"lockuser", "kycreview", "redisdel", "redisadd", "uiddedup"} {
+		if hm.access.CanUse(userID, command) {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📦 /"+command, "batch:"+command),
+			))
+		}
+	}
+	if len(rows) == 0 {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "你没有可以批量处理的功能"))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, "📦 批量处理：一次上传多个文件，合并去重后生成一份结果\n\n用法: /batch <功能>，请选择功能：")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	hm.bot.Send(msg)
+}
+
+// addBatchFile 批量模式下保存上传的文件，等待 /done 后统一处理
+func (hm *HandlerManager) addBatchFile(chatID, userID int64, document *tgbotapi.Document, state *UserState, upload *batchUpload) {
+	spec := batchSpecs[state.CurrentCommand]
+	if !spec.Accepts(document.FileName) {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %s 格式不支持，/%s 批量模式只支持 %s 文件",
+			document.FileName, state.CurrentCommand, strings.Join(spec.Extensions, "/"))))
+		return
+	}
+
+	// 先占位再下载，避免同时到达的文件超出数量和大小限制
+	upload.mu.Lock()
+	switch {
+	case upload.started:
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ 批量任务已开始处理，%s 未加入本次批次", document.FileName)))
+		return
+	case len(upload.labels) > 0 && len(upload.files) >= len(upload.labels):
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ 已上传%s，%s 未加入", strings.Join(upload.labels, "和"), document.FileName)))
+		return
+	case len(upload.files) >= batch.MaxFiles:
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 一个批次最多 %d 个文件", batch.MaxFiles)))
+		return
+	case upload.size+int64(document.FileSize) > maxBatchExtractSize:
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 批次文件总大小不能超过 %s", utils.FormatFileSize(maxBatchExtractSize))))
+		return
+	}
+	index := len(upload.files)
+	f := batch.File{
+		Name: document.FileName,
+		Path: filepath.Join(state.UserDir, "batch", fmt.Sprintf("%03d_%s", index+1, filepath.Base(document.FileName))),
+	}
+	upload.files = append(upload.files, f)
+	upload.size += int64(document.FileSize)
+	upload.mu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(f.Path), 0755)
+	if err == nil {
+		var file tgbotapi.File
+		file, err = hm.bot.GetFile(tgbotapi.FileConfig{FileID: document.FileID})
+		if err == nil {
+			err = hm.downloadFile(file.Link(hm.bot.Token), f.Path)
+		}
+	}
+	if err != nil {
+		upload.mu.Lock()
+		for i := range upload.files {
+			if upload.files[i].Path == f.Path {
+				upload.files = append(upload.files[:i], upload.files[i+1:]...)
+				break
+			}
+		}
+		upload.size -= int64(document.FileSize)
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 保存 %s 失败: %v", document.FileName, err)))
+		return
+	}
+
+	upload.mu.Lock()
+	upload.ready++
+	count, size, ready := len(upload.files), upload.size, upload.ready
+	upload.mu.Unlock()
+
+	if len(upload.labels) > 0 {
+		// 文件按上传顺序确定，例如第一个为名单A
+		if ready < len(upload.labels) {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("📎 已添加%s: %s\n请继续上传%s，输入 /cancel 取消", upload.labels[index], document.FileName, upload.labels[ready])))
+			return
+		}
+		hm.handleDone(chatID, userID)
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📎 已添加 %s\n当前批次 %d 个文件，共 %s\n继续上传或发送 /done 开始处理",
+		document.FileName, count, utils.FormatFileSize(size)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ 开始处理", "cmd_done"),
+			tgbotapi.NewInlineKeyboardButtonData("🛑 取消", "cmd_cancel"),
+		),
+	)
+	hm.bot.Send(msg)
+}
+
+// handleDone 处理 /done，将批量模式下上传的文件打包后开始处理
+func (hm *HandlerManager) handleDone(chatID, userID int64) {
+	state := hm.getUserState(userID)
+	upload, ok := state.Get(batchUploadKey).(*batchUpload)
+	if !ok {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "当前不在批量模式，输入 /batch 开始批量处理"))
+		return
+	}
+	if !hm.access.CanUse(userID, state.CurrentCommand) {
+		hm.fileManager.CleanupUserDir(state.UserDir)
+		hm.clearUserState(userID)
+		hm.denyAccess(chatID, userID, state.CurrentCommand)
+		return
+	}
+
+	upload.mu.Lock()
+	if upload.started {
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "批量任务已开始处理，输入 /status 查看进度"))
+		return
+	}
+	if len(upload.files) == 0 {
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "请先上传文件，全部上传后再发送 /done"))
+		return
+	}
+	if len(upload.labels) > 0 && upload.ready < len(upload.labels) {
+		upload.mu.Unlock()
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("请依次上传%s，当前已上传 %d 个文件", strings.Join(upload.labels, "和"), upload.ready)))
+		return
+	}
+	task, ok := hm.reserveTask(userID, state.CurrentCommand)
+	if !ok {
+		upload.mu.Unlock()
+		hm.sendTaskRunning(chatID, "开始批量处理")
+		return
+	}
+	upload.started = true
+	files := append([]batch.File(nil), upload.files...)
+	upload.mu.Unlock()
+
+	// 多个文件打包为一个输入文件，审计和历史记录都以压缩包为输入，重新执行时也按批量任务处理
+	zipPath := filepath.Join(state.UserDir, fmt.Sprintf("%s-batch-%d.zip", state.CurrentCommand, len(files)))
+	if err := batch.Pack(zipPath, files); err != nil {
+		hm.releaseTask(userID, task)
+		hm.fileManager.CleanupUserDir(state.UserDir)
+		hm.clearUserState(userID)
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 打包批量文件失败: "+err.Error()))
+		return
+	}
+	os.RemoveAll(filepath.Join(state.UserDir, "batch"))
+
+	hm.logger.Info("开始批量任务",
+		slog.Int64("user_id", userID),
+		slog.String("command", state.CurrentCommand),
+		slog.Int("files", len(files)),
+		slog.String("timestamp", time.Now().Format(time.RFC3339)),
+	)
+	sentMsg, _ := hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("📦 已收到 %d 个文件，开始处理...", len(files))))
+	hm.runTask(chatID, userID, sentMsg.MessageID, zipPath, state, task)
+}
+
+// prepareBatch 解压批量任务的压缩包，校验所有文件后按ID去重合并为一个输入文件，返回合并文件路径
+// 每个文件的统计写入 batch_report.csv，处理成功后和结果文件一起发送
+func (hm *HandlerManager) prepareBatch(ctx context.Context, state *UserState, inputFile string) (string, *batch.Report, string, error) {
+	state.Progress.Update("📦 正在解压批量文件...")
+	files, err := batch.Extract(inputFile, filepath.Join(state.UserDir, "batch-files"), maxBatchExtractSize)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	mergedFile := filepath.Join(state.UserDir, "batch_merged.csv")
+	report, err := batch.Merge(ctx, batchSpecs[state.CurrentCommand], files, readBatchRows, mergedFile, func(index int, name string) {
+		state.Progress.Report(int64(index), int64(len(files)), fmt.Sprintf("📦 正在合并第 %d/%d 个文件: %s", index+1, len(files), name))
+	})
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	reportFile := filepath.Join(state.UserDir, "batch_report.csv")
+	if err := report.WriteCSV(reportFile); err != nil {
+		return "", nil, "", err
+	}
+	state.Progress.Report(int64(len(files)), int64(len(files)), report.Summary())
+	return mergedFile, report, reportFile, nil
+}
+
+// batchCaption 批量报告的文件说明，超出 Telegram 长度限制时只保留总结
+func batchCaption(report *batch.Report) string {
+	text := "📋 批量处理报告\n" + report.Text()
+	if len([]rune(text)) > maxCaptionLength {
+		return "📋 批量处理报告\n" + report.Summary() + "\n每个文件的统计见报告文件"
+	}
+	return text
+}
+
+// readBatchRows 读取批量任务中的 CSV 或 Excel 文件（第一个工作表）的所有行
+func readBatchRows(path string) ([][]string, error) {
+	if utils.GetFileExt(path) == ".xlsx" {
+		return utils.NewExcelHelper().ReadExcelFile(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	// 不同文件、不同行的列数可以不一致，由合并规则统一
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
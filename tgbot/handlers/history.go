@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"shared/audit"
+	"strconv"
+	"strings"
+	"tgbot/utils"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// historyListLimit /history 显示的最近任务数
+const historyListLimit = 10
+
+// rerunOfKey UserState 中保存重新执行的历史任务编号的 key
+const rerunOfKey = "rerun_of"
+
+// argsKey UserState 中保存命令参数的 key，参数随历史任务保存，重新执行时使用相同的参数
+const argsKey = "args"
+
+// recordHistory 将本次处理的输入和输出文件保存到历史目录
+func (hm *HandlerManager) recordHistory(chatID, userID int64, state *UserState, inputFile string) {
+	outputs, _ := state.Get(outputsKey).([]utils.HistoryFile)
+	if len(outputs) == 0 {
+		return
+	}
+
+	job := &utils.HistoryJob{
+		UserID:  userID,
+		Command: state.CurrentCommand,
+		Input:   utils.HistoryFile{Name: filepath.Base(inputFile), Path: inputFile},
+	}
+	if info, err := os.Stat(inputFile); err == nil {
+		job.Input.Size = info.Size()
+	}
+	for _, f := range outputs {
+		if info, err := os.Stat(f.Path); err == nil {
+			f.Size = info.Size()
+		}
+		job.Outputs = append(job.Outputs, f)
+	}
+	if approvalID, ok := state.Get(approvalIDKey).(int64); ok {
+		job.ApprovalID = approvalID
+	}
+	job.Args, _ = state.Get(argsKey).(string)
+
+	evicted, err := hm.history.Add(job)
+	if err != nil {
+		hm.logger.Warn("保存历史任务失败",
+			slog.Int64("user_id", userID),
+			slog.String("command", state.CurrentCommand),
+			slog.String("error", err.Error()),
+		)
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "⚠️ 本次结果未保存到历史记录: "+err.Error()))
+		return
+	}
+	if len(evicted) > 0 {
+		ids := make([]string, len(evicted))
+		for i, j := range evicted {
+			ids[i] = fmt.Sprintf("#%d", j.ID)
+		}
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🧹 历史空间已满（上限 %s），已删除最早的任务 %s",
+			utils.FormatFileSize(hm.history.Quota()), strings.Join(ids, " "))))
+	}
+}
+
+// sendHistory 发送用户最近的任务列表，每个任务带重新下载和重新执行按钮
+func (hm *HandlerManager) sendHistory(chatID, userID int64) {
+	jobs := hm.history.List(userID, historyListLimit)
+	if len(jobs) == 0 {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("📭 没有历史任务\n处理结果保留 %s", formatRetention(hm.history.TTL()))))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🕘 最近的任务（保留 %s，已用空间 %s / %s）\n",
+		formatRetention(hm.history.TTL()), utils.FormatFileSize(hm.history.Usage(userID)), utils.FormatFileSize(hm.history.Quota())))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, job := range jobs {
+		command := job.Command
+		if job.Args != "" {
+			command += " " + job.Args
+		}
+		sb.WriteString(fmt.Sprintf("\n#%d /%s %s\n  📎 %s，%d 个结果文件，%s",
+			job.ID, command, job.CreatedAt.Format("01-02 15:04"), job.Input.Name, len(job.Outputs), utils.FormatFileSize(job.Size)))
+		if job.ApprovalID != 0 {
+			sb.WriteString(fmt.Sprintf("\n  📝 审批 #%d: %s", job.ApprovalID, hm.approvalStatus(job.ApprovalID)))
+		}
+		sb.WriteString("\n")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⬇️ 下载 #%d", job.ID), fmt.Sprintf("redownload:%d", job.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔁 重新执行 #%d", job.ID), fmt.Sprintf("rerun:%d", job.ID)),
+		))
+	}
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	hm.bot.Send(msg)
+}
+
+// formatRetention 格式化保留时间，整天数显示为天
+func formatRetention(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d 天", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// approvalStatus 返回审批状态的描述
+func (hm *HandlerManager) approvalStatus(id int64) string {
+	approval, err := hm.approvals.Get(id)
+	if err != nil {
+		return "不存在"
+	}
+	switch approval.Status {
+	case utils.ApprovalApproved:
+		return "已批准"
+	case utils.ApprovalRejected:
+		return "已拒绝"
+	default:
+		return "等待审批"
+	}
+}
+
+// historyJob 解析任务编号并检查任务属于该用户，失败时回复用户
+func (hm *HandlerManager) historyJob(chatID, userID int64, args, usage string) (*utils.HistoryJob, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(args), "#"), 10, 64)
+	if err != nil {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return nil, false
+	}
+	job, err := hm.history.Get(id)
+	if err != nil || job.UserID != userID {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 历史任务 #%d 不存在或已过期，输入 /history 查看", id)))
+		return nil, false
+	}
+	if !hm.access.CanUse(userID, job.Command) {
+		hm.denyAccess(chatID, userID, job.Command)
+		return nil, false
+	}
+	return job, true
+}
+
+// handleRedownload 处理 /redownload <任务编号>，重新发送历史任务的结果文件
+func (hm *HandlerManager) handleRedownload(chatID, userID int64, args string) {
+	job, ok := hm.historyJob(chatID, userID, args, "用法: /redownload <任务编号>")
+	if !ok {
+		return
+	}
+	// 需要审批的任务只有审批通过后才能下载
+	if job.ApprovalID != 0 {
+		if approval, err := hm.approvals.Get(job.ApprovalID); err != nil || approval.Status != utils.ApprovalApproved {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⛔ 任务 #%d 的审批 #%d %s，不能下载结果",
+				job.ID, job.ApprovalID, hm.approvalStatus(job.ApprovalID))))
+			return
+		}
+	}
+
+	for _, f := range job.Outputs {
+		doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(f.Path))
+		doc.Caption = fmt.Sprintf("🔁 历史任务 #%d\n%s", job.ID, f.Caption)
+		if _, err := hm.bot.Send(doc); err != nil {
+			hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ 文件 %s 发送失败: %v", f.Name, err)))
+			continue
+		}
+		hm.writeAudit(audit.Event{
+			Source:    "telegram",
+			Actor:     strconv.FormatInt(userID, 10),
+			ActorName: hm.displayName(userID),
+			Action:    audit.ActionDownload,
+			Target:    fmt.Sprintf("history#%d", job.ID),
+			Command:   job.Command,
+			Detail:    f.Name,
+		})
+	}
+}
+
+// handleRerun 处理 /rerun <任务编号>，用历史任务保存的输入文件重新执行同一功能
+func (hm *HandlerManager) handleRerun(chatID, userID int64, args string) {
+	job, ok := hm.historyJob(chatID, userID, args, "用法: /rerun <任务编号>")
+	if !ok {
+		return
+	}
+	task, ok := hm.reserveTask(userID, job.Command)
+	if !ok {
+		hm.sendTaskRunning(chatID, "重新执行")
+		return
+	}
+
+	// 放弃等待上传的流程
+	if previous := hm.getUserState(userID); previous.UserDir != "" {
+		hm.fileManager.CleanupUserDir(previous.UserDir)
+	}
+	state := &UserState{
+		CurrentCommand: job.Command,
+		UserDir:        hm.fileManager.CreateUserDir(userID),
+		data:           map[string]interface{}{rerunOfKey: job.ID, argsKey: job.Args},
+	}
+	inputFile := filepath.Join(state.UserDir, job.Input.Name)
+	if err := hm.copyFile(job.Input.Path, inputFile); err != nil {
+		hm.releaseTask(userID, task)
+		hm.fileManager.CleanupUserDir(state.UserDir)
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "❌ 读取历史输入文件失败: "+err.Error()))
+		return
+	}
+	hm.setUserState(userID, state)
+
+	hm.logger.Info("重新执行历史任务",
+		slog.Int64("user_id", userID),
+		slog.Int64("history_id", job.ID),
+		slog.String("command", job.Command),
+		slog.String("timestamp", time.Now().Format(time.RFC3339)),
+	)
+	sentMsg, _ := hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🔁 重新执行历史任务 #%d (/%s)", job.ID, job.Command)))
+	hm.runTask(chatID, userID, sentMsg.MessageID, inputFile, state, task)
+}
@@ -1,31 +1,70 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
-	"strings"
+	"shared/batch"
+	"shared/kyc"
+	"shared/snapshot"
 	"time"
 	"tgbot/utils"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// processKYCReviewHandler 处理KYC审核处理功能
-func (hm *HandlerManager) processKYCReviewHandler(chatID, userID int64, inputFile string, state *UserState) error {
+// processKYCReviewHandler 处理KYC审核处理功能，对照快照时只为会变更的记录生成SQL
+func (hm *HandlerManager) processKYCReviewHandler(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	var current *snapshot.Snapshot
+	if useSnapshot(state) {
+		var snapshotFile batch.File
+		var err error
+		inputFile, snapshotFile, err = snapshotInputs(state, inputFile)
+		if err != nil {
+			return err
+		}
+		if current, err = kyc.LoadSnapshot(snapshotFile.Path); err != nil {
+			return err
+		}
+		current.Name = snapshotFile.Name
+	}
+
 	// 检查文件格式
 	if !utils.IsValidFileType(inputFile, []string{".xlsx", ".csv"}) {
 		return fmt.Errorf("只支持Excel (.xlsx) 或CSV格式的文件")
 	}
 
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在处理KYC审核数据...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Update("🔄 正在处理KYC审核数据...")
 
 	// 获取当前日期用于文件名
 	currentTime := time.Now()
 	filename := fmt.Sprintf("kyc-%s.sql", currentTime.Format("2006-01-02"))
 	outputFile := filepath.Join(state.UserDir, filename)
 
+	// 读取审核表格并检查审核结论，任一行有误时不生成SQL
+	var batch *kyc.Batch
+	excelHelper := utils.NewExcelHelper()
+	err := excelHelper.ProcessFileByType(inputFile, func(rows [][]string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		batch, err = kyc.Parse(rows)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("处理文件失败: %v", err)
+	}
+
+	// 对照快照，去掉不会变更的记录
+	var report *snapshot.Report
+	if current != nil {
+		report = batch.Check(current)
+		if len(batch.Records) == 0 {
+			return fmt.Errorf("对照快照后没有会变更的记录，未生成SQL\n%s", report.Summary())
+		}
+	}
+
+	state.Progress.Update(fmt.Sprintf("🔄 正在生成 %d 条KYC状态变更SQL...", len(batch.Records)))
+
 	// 创建输出文件
 	file, err := hm.fileManager.CreateOutputFile(outputFile)
 	if err != nil {
@@ -33,53 +72,24 @@ func (hm *HandlerManager) processKYCReviewHandler(chatID, userID int64, inputFil
 	}
 	defer hm.fileManager.CloseFile(outputFile)
 
-	var sqlCount int
-
-	// 使用Excel辅助工具处理文件
-	excelHelper := utils.NewExcelHelper()
-
-	err = excelHelper.ProcessFileByType(inputFile, func(rows [][]string) error {
-		// 跳过标题行，处理数据行
-		for i, row := range rows {
-			// 跳过标题行（假设第一行是标题）
-			if i == 0 {
-				continue
-			}
-
-			// 确保行有足够的列数据
-			if len(row) >= 2 {
-				// 假设第1列是 user_id，第2列是 id（根据实际Excel结构调整）
-				userId := strings.TrimSpace(row[0])
-				recordId := strings.TrimSpace(row[1])
-
-				// 生成 SQL 语句
-				if userId != "" && recordId != "" {
-					sql := fmt.Sprintf("UPDATE b_kyc set audit_status = 1,audit_at = '%s' where audit_status = 2 and is_lock = 0 and user_id = %s and id = %s;\n",
-						time.Now().Format("2006-01-02 15:04:05"), userId, recordId)
+	sqlCount, err := batch.WriteSQL(file, currentTime)
+	if err != nil {
+		return err
+	}
 
-					_, err := file.WriteString(sql)
-					if err != nil {
-						return fmt.Errorf("写入SQL语句失败: %v", err)
-					}
-					sqlCount++
-				}
-			}
+	summaryFile := filepath.Join(state.UserDir, fmt.Sprintf("kyc-summary-%s.csv", currentTime.Format("2006-01-02")))
+	if err := batch.WriteSummary(summaryFile); err != nil {
+		return err
+	}
 
-			// 每处理1000行发送进度
-			if i%1000 == 0 && i > 0 {
-				progressMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🔄 已处理 %d 行KYC数据，生成 %d 条SQL...", i, sqlCount))
-				hm.bot.Send(progressMsg)
-			}
+	// 发送结果文件和按结论的统计
+	hm.deliverResult(chatID, state, outputFile, fmt.Sprintf("✅ KYC审核处理完成！\n📋 共生成 %d 条SQL语句\n%s\n📅 文件名: %s", sqlCount, batch.Summary(), filename))
+	hm.deliverResult(chatID, state, summaryFile, "📊 KYC审核结论统计")
+	if report != nil {
+		if err := hm.deliverSnapshotReport(chatID, state, report); err != nil {
+			return err
 		}
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("处理文件失败: %v", err)
 	}
 
-	// 发送结果文件
-	hm.sendResultFile(chatID, outputFile, fmt.Sprintf("✅ KYC审核处理完成！\n📋 共生成 %d 条SQL语句\n📅 文件名: %s", sqlCount, filename))
-
 	return nil
-}
\ No newline at end of file
+}
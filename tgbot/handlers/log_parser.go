@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"path/filepath"
@@ -12,7 +13,7 @@ import (
 )
 
 // processLogParse 处理日志解析
-func (hm *HandlerManager) processLogParse(chatID, userID int64, inputFile string, state *UserState) error {
+func (hm *HandlerManager) processLogParse(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
 	// 检查输入文件是否是TXT格式
 	if !utils.IsValidFileType(inputFile, []string{".txt"}) {
 		return fmt.Errorf("只支持TXT格式的日志文件")
@@ -47,9 +48,7 @@ func (hm *HandlerManager) processLogParse(chatID, userID int64, inputFile string
 	}
 	defer hm.fileManager.CloseFile(inputFile)
 
-	// 发送处理进度更新 - 我们现在不跟踪具体的消息ID，而是发送新消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在解析日志文件...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Update("🔄 正在解析日志文件...")
 
 	scanner := bufio.NewScanner(inputFileHandle)
 	// 增加缓冲区大小以处理超长的行
@@ -58,10 +57,16 @@ func (hm *HandlerManager) processLogParse(chatID, userID int64, inputFile string
 
 	lineNum := 0
 	processedLines := 0
+	totalBytes, readBytes := fileSize(inputFile), int64(0)
 
 	for scanner.Scan() {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		lineNum++
 		logStr := scanner.Text()
+		readBytes += int64(len(logStr)) + 1
 
 		// 解析日志行
 		row := hm.parseLogLine(logStr)
@@ -74,11 +79,9 @@ func (hm *HandlerManager) processLogParse(chatID, userID int64, inputFile string
 			processedLines++
 		}
 
-		// 每处理1000行发送一次进度消息
+		// 每处理1000行更新一次进度，进度消息自身会限制编辑频率
 		if lineNum%1000 == 0 {
-			progress := fmt.Sprintf("🔄 已处理 %d 行，有效数据 %d 条...", lineNum, processedLines)
-			progressMsg := tgbotapi.NewMessage(chatID, progress)
-			hm.bot.Send(progressMsg)
+			state.Progress.Report(readBytes, totalBytes, fmt.Sprintf("🔄 已处理 %d 行，有效数据 %d 条...", lineNum, processedLines))
 		}
 	}
 
@@ -86,8 +89,10 @@ func (hm *HandlerManager) processLogParse(chatID, userID int64, inputFile string
 		return fmt.Errorf("读取文件时发生错误: %v", err)
 	}
 
+	state.Progress.Report(totalBytes, totalBytes, fmt.Sprintf("📊 共处理 %d 行，有效数据 %d 条", lineNum, processedLines))
+
 	// 完成处理，发送结果文件
-	hm.sendResultFile(chatID, outputFile, fmt.Sprintf("✅ 日志解析完成！\n📊 总计处理 %d 行，提取有效数据 %d 条", lineNum, processedLines))
+	hm.deliverResult(chatID, state, outputFile, fmt.Sprintf("✅ 日志解析完成！\n📊 总计处理 %d 行，提取有效数据 %d 条", lineNum, processedLines))
 
 	return nil
 }
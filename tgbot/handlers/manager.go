@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"shared/audit"
 	"strings"
 	"sync"
 	"tgbot/config"
@@ -19,22 +21,86 @@ type HandlerManager struct {
 	fileManager *utils.FileManager
 	logger      *utils.Logger
 	userStates  sync.Map // 用户状态管理
+	access      *config.AccessControl
+	approvals   *utils.ApprovalStore
+	auditLog    *audit.Log
+	history     *utils.HistoryStore
+
+	runningTasks sync.Map // 正在处理的任务，userID -> *runningTask
+	deniedAt     sync.Map // 最近一次通知管理员越权尝试的时间，userID -> time.Time
+}
+
+// runningTask 正在处理的任务，用于 /cancel 取消
+// 下载输入文件前就占用位置，同一用户同时上传的多个文件只有一个能开始处理
+type runningTask struct {
+	command   string
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	startTime time.Time
+}
+
+// reserveTask 为用户占用任务位置，已有任务在处理时返回 false
+// 占用后的每个提前返回路径都要调用 releaseTask，开始处理后由 runTask 释放
+func (hm *HandlerManager) reserveTask(userID int64, command string) (*runningTask, bool) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	task := &runningTask{
+		command:   command,
+		ctx:       ctx,
+		cancel:    cancel,
+		startTime: time.Now(),
+	}
+	if _, loaded := hm.runningTasks.LoadOrStore(userID, task); loaded {
+		cancel(nil)
+		return nil, false
+	}
+	return task, true
+}
+
+// releaseTask 释放 reserveTask 占用的任务位置
+func (hm *HandlerManager) releaseTask(userID int64, task *runningTask) {
+	task.cancel(nil)
+	hm.runningTasks.CompareAndDelete(userID, task)
 }
 
 // UserState 用户状态
+// 处理协程写入输出文件等数据时，消息处理协程可能同时读取，data 只能通过 Get/Set 访问
 type UserState struct {
 	CurrentCommand string
 	UserDir        string
-	Data           map[string]interface{}
+	Progress       *progressMessage // 处理中任务的进度消息
+
+	mu   sync.Mutex
+	data map[string]interface{}
+}
+
+// Get 读取状态数据，不存在时返回 nil
+func (s *UserState) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+// Set 写入状态数据
+func (s *UserState) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string]interface{})
+	}
+	s.data[key] = value
 }
 
 // NewHandlerManager 创建处理器管理器
-func NewHandlerManager(bot *tgbotapi.BotAPI, cfg *config.Config, fm *utils.FileManager, logger *utils.Logger) *HandlerManager {
+func NewHandlerManager(bot *tgbotapi.BotAPI, cfg *config.Config, fm *utils.FileManager, logger *utils.Logger, access *config.AccessControl, approvals *utils.ApprovalStore, auditLog *audit.Log, history *utils.HistoryStore) *HandlerManager {
 	return &HandlerManager{
 		bot:         bot,
 		config:      cfg,
 		fileManager: fm,
 		logger:      logger,
+		access:      access,
+		approvals:   approvals,
+		auditLog:    auditLog,
+		history:     history,
 	}
 }
 
@@ -108,6 +174,12 @@ func (hm *HandlerManager) handleCommand(chatID, userID int64, command, args stri
 
 	startTime := time.Now()
 
+	if !hm.authorize(chatID, userID, command) {
+		hm.logger.LogResponse(userID, chatID, command, false,
+			time.Since(startTime), fmt.Sprintf("命令 %s 未授权", command))
+		return
+	}
+
 	switch command {
 	case "start":
 		hm.sendStartMessage(chatID)
@@ -118,21 +190,47 @@ func (hm *HandlerManager) handleCommand(chatID, userID int64, command, args stri
 	case "logparse":
 		hm.startLogParseProcess(chatID, userID)
 	case "lockuser":
-		hm.startLockUserProcess(chatID, userID)
+		hm.startLockUserProcess(chatID, userID, args)
 	case "sqlparse":
 		hm.startSQLParseProcess(chatID, userID)
 	case "filesplit":
-		hm.startFileSplitProcess(chatID, userID)
+		hm.startFileSplitProcess(chatID, userID, args)
 	case "kycreview":
-		hm.startKYCReviewProcess(chatID, userID)
+		hm.startKYCReviewProcess(chatID, userID, args)
 	case "redisdel":
 		hm.startRedisDelProcess(chatID, userID)
 	case "redisadd":
 		hm.startRedisAddProcess(chatID, userID)
 	case "uiddedup":
-		hm.startUIDDedupProcess(chatID, userID)
+		hm.startUIDDedupProcess(chatID, userID, args)
 	case "status":
 		hm.sendStatusMessage(chatID, userID)
+	case "cancel":
+		hm.cancelTask(chatID, userID)
+	case "adduser":
+		hm.handleAddUser(chatID, userID, args)
+	case "deluser":
+		hm.handleDelUser(chatID, userID, args)
+	case "users":
+		hm.sendUserList(chatID)
+	case "audit":
+		hm.handleAudit(chatID, args)
+	case "approvals":
+		hm.handleApprovals(chatID, userID, args)
+	case "approve":
+		hm.handleReview(chatID, userID, args, true)
+	case "reject":
+		hm.handleReview(chatID, userID, args, false)
+	case "history":
+		hm.sendHistory(chatID, userID)
+	case "redownload":
+		hm.handleRedownload(chatID, userID, args)
+	case "rerun":
+		hm.handleRerun(chatID, userID, args)
+	case "batch":
+		hm.handleBatch(chatID, userID, args)
+	case "done":
+		hm.handleDone(chatID, userID)
 	default:
 		hm.logger.Warn("未知命令",
 			slog.Int64("user_id", userID),
@@ -156,13 +254,17 @@ func (hm *HandlerManager) sendStartMessage(chatID int64) {
 
 📋 *可用功能：*
 • /logparse - 日志追踪解析
-• /lockuser - 用户锁定操作
+• /lockuser [snapshot] - 用户锁定操作
 • /sqlparse - SQL日志解析
 • /filesplit - 文件分割
-• /kycreview - KYC审核处理
+• /kycreview [snapshot] - KYC审核处理
 • /redisdel - Redis流水清零命令生成
 • /redisadd - Redis流水增加命令生成
-• /uiddedup - UID去重处理
+• /uiddedup [方式] - UID去重和名单集合运算
+• /cancel - 取消当前任务
+• /approvals - 查看待审批的任务
+• /history - 最近的任务，重新下载或重新执行
+• /batch - 批量处理，一次上传多个文件
 
 💡 *使用方法：*
 1. 选择您需要的功能命令
@@ -213,10 +315,11 @@ func (hm *HandlerManager) sendHelpMessage(chatID int64) {
 • 输出：CSV格式的结构化数据
 • 功能：提取关键信息如用户ID、追踪ID等
 
-*2. 🔒 用户锁定 (/lockuser)*
+*2. 🔒 用户锁定 (/lockuser [snapshot])*
 • 输入：包含用户ID的CSV文件
 • 输出：SQL更新语句 + Redis删除命令
 • 功能：批量生成用户锁定操作命令
+• 对照快照：` + "`/lockuser snapshot`" + ` 再上传 b_user 的当前状态导出，只为未锁定的用户生成SQL
 
 *3. 🗄️ SQL解析 (/sqlparse)*
 • 输入：包含SQL信息的TXT日志文件
@@ -225,13 +328,15 @@ func (hm *HandlerManager) sendHelpMessage(chatID int64) {
 
 *4. ✂️ 文件分割 (/filesplit)*
 • 输入：大文件（任意格式）
-• 输出：按10,000行分割的小文件
-• 功能：将大文件拆分成易处理的小文件
+• 输出：按行数、大小、份数或ID分组分割的小文件
+• 功能：CSV/Excel 每个文件保留表头，按ID分组时同一用户的命令不会被拆开
+• 示例：` + "`/filesplit bytes 5MB`、`/filesplit key 10000`" + `
 
 *5. 📋 KYC审核 (/kycreview)*
-• 输入：Excel或CSV格式的KYC数据
-• 输出：KYC审核通过的SQL更新语句
-• 功能：批量处理KYC审核结果
+• 输入：Excel或CSV格式的KYC数据，包含审核结论（approve/reject/lock）和可选的原因
+• 输出：按结论分组的状态变更SQL和结论统计
+• 功能：批量处理KYC审核通过、拒绝和锁定
+• 对照快照：` + "`/kycreview snapshot`" + ` 再上传 b_kyc 的当前状态导出，只为会变更的记录生成SQL
 
 *6. 🗑️ Redis流水清零命令 (/redisdel)*
 • 输入：Excel或CSV格式的用户数据
@@ -243,22 +348,29 @@ func (hm *HandlerManager) sendHelpMessage(chatID int64) {
 • 输出：Redis设置命令文件
 • 功能：生成用户流水要求设置命令
 
-*8. 🔄 UID去重 (/uiddedup)*
-• 输入：包含用户ID的CSV文件
-• 输出：去重后的唯一用户ID文件
-• 功能：移除重复的用户ID
+*8. 🔄 UID去重 (/uiddedup [方式])*
+• 输入：包含用户ID的CSV文件，集合运算依次上传名单A和名单B
+• 输出：按首次出现顺序排列的UID文件和去重报告
+• 方式：distinct 每个UID保留一次（默认）、singletons 只保留唯一的、duplicates 只保留重复的及次数、union/intersect/minus 两个名单的并集/交集/差集
 
 *📝 使用提示：*
-• 文件大小限制：50MB
+• 文件大小限制：%s
 • 支持的格式：TXT, CSV, XLSX
 • 处理过程中请耐心等待
 • 大文件处理可能需要几分钟时间
+• 输入 /cancel 可取消正在处理的任务
+• 用户锁定、KYC审核、Redis删除/增加的结果需要另一位有权限的用户批准后才会发送
+• 审批命令：/approvals、/approve <编号> [备注]、/reject <编号> <原因>
+• 输入 /history 查看最近的任务，可以重新下载结果或用原文件重新执行
+• 用户锁定、KYC审核、Redis删除/增加、UID去重支持批量处理：输入 /batch <功能> 后逐个上传文件再发送 /done，或直接上传zip压缩包；所有文件按ID去重合并为一份结果，并附带每个文件的统计
+• 管理员可以用 /audit <用户ID|日期> 查询审计记录，/audit verify 校验审计日志
 
 *🚀 快速访问：*
 • 输入 /menu 随时显示功能菜单
 • 处理完成后会自动返回菜单
 
 有问题请联系管理员。`
+	helpText = fmt.Sprintf(helpText, utils.FormatFileSize(hm.config.MaxFileSize))
 
 	msg := tgbotapi.NewMessage(chatID, helpText)
 	msg.ParseMode = "Markdown"
@@ -280,6 +392,21 @@ func (hm *HandlerManager) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQu
 		command := strings.TrimPrefix(data, "cmd_")
 		hm.handleCommand(chatID, userID, command, "")
 	}
+
+	// 审批通知中的按钮，格式: approve:<审批编号>、reject:<审批编号>
+	if command, id, ok := strings.Cut(data, ":"); ok && (command == "approve" || command == "reject") {
+		hm.handleCommand(chatID, userID, command, id)
+	}
+
+	// 历史任务中的按钮，格式: redownload:<任务编号>、rerun:<任务编号>
+	if command, id, ok := strings.Cut(data, ":"); ok && (command == "redownload" || command == "rerun") {
+		hm.handleCommand(chatID, userID, command, id)
+	}
+
+	// 批量处理的功能选择按钮，格式: batch:<功能>
+	if command, function, ok := strings.Cut(data, ":"); ok && command == "batch" {
+		hm.handleCommand(chatID, userID, command, function)
+	}
 }
 
 // 获取用户状态
@@ -288,7 +415,7 @@ func (hm *HandlerManager) getUserState(userID int64) *UserState {
 		return state.(*UserState)
 	}
 	return &UserState{
-		Data: make(map[string]interface{}),
+		data: make(map[string]interface{}),
 	}
 }
 
@@ -304,6 +431,11 @@ func (hm *HandlerManager) clearUserState(userID int64) {
 
 // handleTextMessage 处理文本消息
 func (hm *HandlerManager) handleTextMessage(chatID, userID int64, text string) {
+	if !hm.access.IsAllowed(userID) {
+		hm.denyAccess(chatID, userID, "text")
+		return
+	}
+
 	state := hm.getUserState(userID)
 
 	if state.CurrentCommand == "" {
@@ -326,6 +458,11 @@ func (hm *HandlerManager) handleTextMessage(chatID, userID int64, text string) {
 
 // handleDocument 处理文档
 func (hm *HandlerManager) handleDocument(chatID, userID int64, document *tgbotapi.Document) {
+	if !hm.access.IsAllowed(userID) {
+		hm.denyAccess(chatID, userID, "upload")
+		return
+	}
+
 	state := hm.getUserState(userID)
 
 	if state.CurrentCommand == "" {
@@ -341,6 +478,13 @@ func (hm *HandlerManager) handleDocument(chatID, userID int64, document *tgbotap
 		return
 	}
 
+	// 选择功能后权限可能已被管理员收回
+	if !hm.access.CanUse(userID, state.CurrentCommand) {
+		hm.clearUserState(userID)
+		hm.denyAccess(chatID, userID, state.CurrentCommand)
+		return
+	}
+
 	// 检查文件大小
 	if int64(document.FileSize) > hm.config.MaxFileSize {
 		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("文件过大！最大支持 %s\n\n请重新选择功能或上传较小的文件：", utils.FormatFileSize(hm.config.MaxFileSize)))
@@ -354,8 +498,36 @@ func (hm *HandlerManager) handleDocument(chatID, userID int64, document *tgbotap
 		return
 	}
 
+	// 批量模式下先保存文件，发送 /done 后统一处理
+	if upload, ok := state.Get(batchUploadKey).(*batchUpload); ok {
+		if _, running := hm.runningTasks.Load(userID); running {
+			hm.sendTaskRunning(chatID, "上传文件")
+			return
+		}
+		hm.addBatchFile(chatID, userID, document, state, upload)
+		return
+	}
+
+	// 处理中的任务仍在使用当前状态，结束前不接收新文件
+	task, ok := hm.reserveTask(userID, state.CurrentCommand)
+	if !ok {
+		hm.sendTaskRunning(chatID, "上传文件")
+		return
+	}
+	// 检查和占用之间上一个任务可能已结束并清除了状态
+	if hm.getUserState(userID) != state {
+		hm.releaseTask(userID, task)
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "⚠️ 上一个任务已结束，请重新选择功能后再上传文件"))
+		return
+	}
+
 	// 根据当前命令处理文件
-	hm.processUploadedFile(chatID, userID, document, state)
+	hm.processUploadedFile(chatID, userID, document, state, task)
+}
+
+// sendTaskRunning 提示用户当前有任务正在处理，action 为被拒绝的操作
+func (hm *HandlerManager) sendTaskRunning(chatID int64, action string) {
+	hm.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ 当前有任务正在处理，请等待完成或输入 /cancel 取消后再%s", action)))
 }
 
 // sendStatusMessage 发送状态信息
@@ -366,6 +538,21 @@ func (hm *HandlerManager) sendStatusMessage(chatID, userID int64) {
 	if state.CurrentCommand == "" {
 		statusText += "• 当前没有进行中的任务\n"
 		statusText += "• 输入 /start 开始使用功能"
+	} else if task, ok := hm.runningTasks.Load(userID); ok {
+		statusText += fmt.Sprintf("• 当前功能: %s\n", state.CurrentCommand)
+		statusText += fmt.Sprintf("• 处理中，已用时 %v\n", time.Since(task.(*runningTask).startTime).Round(time.Second))
+		statusText += "• 输入 /cancel 可取消任务"
+	} else if upload, ok := state.Get(batchUploadKey).(*batchUpload); ok {
+		upload.mu.Lock()
+		count, labels := len(upload.files), upload.labels
+		upload.mu.Unlock()
+		if len(labels) > 0 {
+			statusText += fmt.Sprintf("• 当前功能: %s（依次上传%s）\n", state.CurrentCommand, strings.Join(labels, "和"))
+			statusText += fmt.Sprintf("• 已上传 %d/%d 个文件，全部上传后自动开始处理", count, len(labels))
+		} else {
+			statusText += fmt.Sprintf("• 当前功能: %s（批量模式）\n", state.CurrentCommand)
+			statusText += fmt.Sprintf("• 已上传 %d 个文件，发送 /done 开始处理", count)
+		}
 	} else {
 		statusText += fmt.Sprintf("• 当前功能: %s\n", state.CurrentCommand)
 		statusText += "• 等待文件上传或处理中..."
@@ -376,6 +563,31 @@ func (hm *HandlerManager) sendStatusMessage(chatID, userID int64) {
 	hm.bot.Send(msg)
 }
 
+// cancelTask 取消用户正在处理的任务，未开始处理时清除等待上传的状态
+func (hm *HandlerManager) cancelTask(chatID, userID int64) {
+	if task, ok := hm.runningTasks.Load(userID); ok {
+		// 处理协程检测到取消后会更新进度消息并清理中间文件
+		task.(*runningTask).cancel(fmt.Errorf("任务已取消"))
+		hm.logger.Info("用户取消任务",
+			slog.Int64("user_id", userID),
+			slog.String("command", task.(*runningTask).command),
+		)
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "🛑 正在取消任务..."))
+		return
+	}
+
+	state := hm.getUserState(userID)
+	if state.CurrentCommand == "" {
+		hm.bot.Send(tgbotapi.NewMessage(chatID, "当前没有进行中的任务"))
+		return
+	}
+	if state.UserDir != "" {
+		hm.fileManager.CleanupUserDir(state.UserDir)
+	}
+	hm.clearUserState(userID)
+	hm.bot.Send(tgbotapi.NewMessage(chatID, "✅ 已取消，输入 /menu 选择其他功能"))
+}
+
 // sendMenuMessage 发送功能菜单
 func (hm *HandlerManager) sendMenuMessage(chatID int64) {
 	menuText := `📋 *功能菜单*
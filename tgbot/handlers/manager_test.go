@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tgbot/config"
+	"tgbot/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 处理协程记录输出文件时，消息处理协程同时读取批量上传状态
+func TestUserStateConcurrentAccess(t *testing.T) {
+	state := &UserState{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			outputs, _ := state.Get(outputsKey).([]utils.HistoryFile)
+			state.Set(outputsKey, append(outputs, utils.HistoryFile{Name: "out.csv"}))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if _, ok := state.Get(batchUploadKey).(*batchUpload); ok {
+				t.Error("没有批量上传状态")
+			}
+		}
+	}()
+	wg.Wait()
+
+	if outputs, _ := state.Get(outputsKey).([]utils.HistoryFile); len(outputs) != 1000 {
+		t.Errorf("输出文件数 = %d, want 1000", len(outputs))
+	}
+}
+
+// uploadAPI 模拟 Telegram API：getFile 阻塞到 release 关闭后返回错误，记录发送的消息
+type uploadAPI struct {
+	getFiles atomic.Int32
+	entered  chan struct{}
+	release  chan struct{}
+	messages chan string
+}
+
+func (a *uploadAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/getMe"):
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`))
+	case strings.HasSuffix(req.URL.Path, "/getFile"):
+		if a.getFiles.Add(1) == 1 {
+			close(a.entered)
+		}
+		<-a.release
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"file is too big"}`))
+	case strings.HasSuffix(req.URL.Path, "/sendMessage"):
+		a.messages <- req.FormValue("text")
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	default:
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}
+}
+
+// 同时上传的两个文件只有一个开始下载，另一个提示已有任务在处理，下载失败后释放任务位置
+func TestConcurrentUploadsReserveTask(t *testing.T) {
+	const userID = 1001
+	api := &uploadAPI{
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+		messages: make(chan string, 16),
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	bot, err := tgbotapi.NewBotAPIWithClient("token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := config.LoadAccessControl(filepath.Join(t.TempDir(), "access.json"), []int64{userID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm := &HandlerManager{
+		bot:         bot,
+		config:      &config.Config{MaxFileSize: 1 << 20},
+		fileManager: utils.NewFileManager(t.TempDir()),
+		access:      access,
+	}
+	hm.setUserState(userID, &UserState{
+		CurrentCommand: "lockuser",
+		UserDir:        hm.fileManager.CreateUserDir(userID),
+		data:           make(map[string]interface{}),
+	})
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a.xlsx", "b.xlsx"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			hm.handleDocument(userID, userID, &tgbotapi.Document{FileID: name, FileName: name, FileSize: 100})
+		}(name)
+	}
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case <-api.entered:
+	case <-timeout:
+		t.Fatal("没有开始下载")
+	}
+	for running := false; !running; {
+		select {
+		case text := <-api.messages:
+			running = strings.Contains(text, "当前有任务正在处理")
+		case <-timeout:
+			t.Fatal("第二个文件没有被拒绝")
+		}
+	}
+	if got := api.getFiles.Load(); got != 1 {
+		t.Errorf("getFile 调用次数 = %d, want 1", got)
+	}
+
+	close(api.release)
+	wg.Wait()
+	if _, running := hm.runningTasks.Load(userID); running {
+		t.Error("下载失败后没有释放任务位置")
+	}
+	if _, ok := hm.reserveTask(userID, "lockuser"); !ok {
+		t.Error("释放后无法再次占用任务位置")
+	}
+}
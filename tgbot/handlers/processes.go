@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"shared/batch"
+	"shared/dedup"
+	"shared/kyc"
+	"shared/snapshot"
+	"shared/split"
+	"strings"
+	"tgbot/utils"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -14,7 +23,7 @@ func (hm *HandlerManager) startLogParseProcess(chatID, userID int64) {
 	state := &UserState{
 		CurrentCommand: "logparse",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
 	}
 	hm.setUserState(userID, state)
 
@@ -32,12 +41,28 @@ func (hm *HandlerManager) startLogParseProcess(chatID, userID int64) {
 	hm.bot.Send(msg)
 }
 
-// startLockUserProcess 开始用户锁定流程
-func (hm *HandlerManager) startLockUserProcess(chatID, userID int64) {
+// startLockUserProcess 开始用户锁定流程，参数为 snapshot 时依次上传用户ID文件和 b_user 快照后自动开始处理
+func (hm *HandlerManager) startLockUserProcess(chatID, userID int64, args string) {
+	withSnapshot, err := parseSnapshotArg(args)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "❌ 参数错误: "+err.Error()+"\n\n"+fmt.Sprintf(snapshotUsage, "lockuser", "`"+snapshot.UserTable+"`"))
+		msg.ParseMode = "Markdown"
+		hm.bot.Send(msg)
+		return
+	}
+
 	state := &UserState{
 		CurrentCommand: "lockuser",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
+	}
+	upload := "💡 多个文件可以打包为zip上传，或使用 /batch 逐个上传\n\n📎 请上传您的CSV文件..."
+	if withSnapshot {
+		state.Set(argsKey, snapshotArg)
+		state.Set(batchUploadKey, &batchUpload{labels: snapshotLabels("lockuser")})
+		upload = "🔍 *对照快照：*\n• 快照为 `b_user` 的CSV导出，带表头，需要 `id` 和 `status` 列\n" +
+			"• 快照中没有的用户和已锁定（status = -1）的用户不生成SQL，列在检查报告中\n• Redis删除命令仍为所有用户生成\n\n" +
+			"📎 请先上传用户ID文件，再上传快照，两个文件都上传后自动开始处理..."
 	}
 	hm.setUserState(userID, state)
 
@@ -49,8 +74,9 @@ func (hm *HandlerManager) startLockUserProcess(chatID, userID int64) {
 • 读取CSV文件第一列的用户ID
 • 生成用户锁定的SQL更新语句
 • 生成对应的Redis删除命令
+• 发送 `+"`/lockuser snapshot`"+` 可对照 b_user 的当前状态，只为未锁定的用户生成SQL
 
-📎 请上传您的CSV文件...`)
+`+upload)
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
 }
@@ -60,7 +86,7 @@ func (hm *HandlerManager) startSQLParseProcess(chatID, userID int64) {
 	state := &UserState{
 		CurrentCommand: "sqlparse",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
 	}
 	hm.setUserState(userID, state)
 
@@ -78,35 +104,65 @@ func (hm *HandlerManager) startSQLParseProcess(chatID, userID int64) {
 	hm.bot.Send(msg)
 }
 
-// startFileSplitProcess 开始文件分割流程
-func (hm *HandlerManager) startFileSplitProcess(chatID, userID int64) {
+// startFileSplitProcess 开始文件分割流程，args 为分割参数，例如 "bytes 5MB"
+func (hm *HandlerManager) startFileSplitProcess(chatID, userID int64, args string) {
+	opts, err := split.ParseArgs(args)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "❌ 参数错误: `"+err.Error()+"`\n\n"+splitUsage)
+		msg.ParseMode = "Markdown"
+		hm.bot.Send(msg)
+		return
+	}
+
 	state := &UserState{
 		CurrentCommand: "filesplit",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           map[string]interface{}{argsKey: strings.TrimSpace(args)},
 	}
 	hm.setUserState(userID, state)
 
-	msg := tgbotapi.NewMessage(chatID, `✂️ *文件分割功能*
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(`✂️ *文件分割功能*
 
 请上传需要分割的大文件（支持任意格式）。
 
-📏 *处理说明：*
-• 按照每10,000行分割文件
+📏 *本次分割方式：*
+%s
+
+📋 *处理说明：*
+• CSV/Excel 文件每个分割文件都保留表头
+• 按ID分组时同一用户的 del 和 set 命令在同一个文件中
 • 保持原文件格式和扩展名
-• 生成多个小文件便于处理
 
-📎 请上传您的文件...`)
+⚙️ *调整分割方式：*
+%s
+
+📎 请上传您的文件...`, "`"+opts.String()+"`", splitUsage))
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
 }
 
-// startKYCReviewProcess 开始KYC审核流程
-func (hm *HandlerManager) startKYCReviewProcess(chatID, userID int64) {
+// startKYCReviewProcess 开始KYC审核流程，参数为 snapshot 时依次上传审核表格和 b_kyc 快照后自动开始处理
+func (hm *HandlerManager) startKYCReviewProcess(chatID, userID int64, args string) {
+	withSnapshot, err := parseSnapshotArg(args)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "❌ 参数错误: "+err.Error()+"\n\n"+fmt.Sprintf(snapshotUsage, "kycreview", "`"+kyc.Table+"`"))
+		msg.ParseMode = "Markdown"
+		hm.bot.Send(msg)
+		return
+	}
+
 	state := &UserState{
 		CurrentCommand: "kycreview",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
+	}
+	upload := "💡 多个文件可以打包为zip上传，或使用 /batch 逐个上传\n\n📎 请上传您的KYC文件..."
+	if withSnapshot {
+		state.Set(argsKey, snapshotArg)
+		state.Set(batchUploadKey, &batchUpload{labels: snapshotLabels("kycreview")})
+		upload = "🔍 *对照快照：*\n• 快照为 `b_kyc` 的CSV导出，带表头，需要 `id`、`user_id`、`audit_status` 和 `is_lock` 列\n" +
+			"• 快照中不存在、已是目标状态或不是待审核未锁定的记录不生成SQL，列在检查报告中\n\n" +
+			"📎 请先上传审核表格，再上传快照，两个文件都上传后自动开始处理..."
 	}
 	hm.setUserState(userID, state)
 
@@ -115,11 +171,14 @@ func (hm *HandlerManager) startKYCReviewProcess(chatID, userID int64) {
 请上传Excel或CSV格式的KYC数据文件。
 
 ✅ *处理说明：*
-• 处理KYC审核通过数据
-• 生成审核状态更新的SQL语句
-• 按当前日期命名输出文件
-
-📎 请上传您的KYC文件...`)
+• 第一行为表头，列为 `+"`user_id`、`id`、`decision`、`reason`"+`
+• 审核结论 `+"`decision`"+` 为 approve（通过）、reject（拒绝）或 lock（锁定），为空时视为通过；原因可选
+• 只能变更待审核、未锁定的记录，表格带 `+"`audit_status`/`is_lock`"+` 列时会提前检查
+• 任一行有误时不生成SQL，同一条记录的结论不同也视为错误
+• 生成按结论分组的SQL和结论统计，按当前日期命名输出文件
+• 发送 `+"`/kycreview snapshot`"+` 可对照 b_kyc 的当前状态，只为会变更的记录生成SQL
+
+`+upload)
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
 }
@@ -129,7 +188,7 @@ func (hm *HandlerManager) startRedisDelProcess(chatID, userID int64) {
 	state := &UserState{
 		CurrentCommand: "redisdel",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
 	}
 	hm.setUserState(userID, state)
 
@@ -142,6 +201,8 @@ func (hm *HandlerManager) startRedisDelProcess(chatID, userID int64) {
 • 为每个用户生成两条Redis删除命令
 • 删除流水要求和投注流水数据
 
+💡 多个文件可以打包为zip上传，或使用 /batch 逐个上传
+
 📎 请上传您的数据文件...`)
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
@@ -152,7 +213,7 @@ func (hm *HandlerManager) startRedisAddProcess(chatID, userID int64) {
 	state := &UserState{
 		CurrentCommand: "redisadd",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           make(map[string]interface{}),
 	}
 	hm.setUserState(userID, state)
 
@@ -166,36 +227,61 @@ func (hm *HandlerManager) startRedisAddProcess(chatID, userID int64) {
 • 第3列：流水比例
 • 第5列：投注金额
 
+💡 多个文件可以打包为zip上传，或使用 /batch 逐个上传
+
 📎 请上传您的CSV文件...`)
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
 }
 
-// startUIDDedupProcess 开始UID去重流程
-func (hm *HandlerManager) startUIDDedupProcess(chatID, userID int64) {
+// startUIDDedupProcess 开始UID去重流程，集合运算进入两个文件的上传模式：依次上传名单A和名单B后自动开始处理
+func (hm *HandlerManager) startUIDDedupProcess(chatID, userID int64, args string) {
+	mode, err := dedup.ParseMode(args)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "❌ 参数错误: `"+err.Error()+"`\n\n"+dedupUsage)
+		msg.ParseMode = "Markdown"
+		hm.bot.Send(msg)
+		return
+	}
+
 	state := &UserState{
 		CurrentCommand: "uiddedup",
 		UserDir:        hm.fileManager.CreateUserDir(userID),
-		Data:           make(map[string]interface{}),
+		data:           map[string]interface{}{argsKey: string(mode)},
+	}
+	if mode.SetOperation() {
+		state.Set(batchUploadKey, &batchUpload{labels: []string{"名单A", "名单B"}})
 	}
 	hm.setUserState(userID, state)
 
-	msg := tgbotapi.NewMessage(chatID, `🔄 *UID去重功能*
+	upload := "📎 请上传您的UID文件..."
+	notes := "• 输出按UID首次出现的顺序排列\n💡 多个文件可以打包为zip上传，或使用 /batch 逐个上传"
+	if mode.SetOperation() {
+		upload = "📎 请先上传名单A，再上传名单B，两个文件都上传后自动开始处理..."
+		notes = "• 每个名单内部先去重\n• 输出按名单A中的顺序排列，并集中只在B中的UID排在最后"
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(`🔄 *UID去重功能*
+
+请上传包含用户ID的CSV文件，每行一个UID。
 
-请上传包含用户ID的CSV文件。
+🎯 *本次处理方式：*
+%s
+
+📋 *处理说明：*
+%s
+• 生成结果文件和去重报告
 
-🎯 *处理说明：*
-• 统计每个UID的出现次数
-• 只保留唯一出现的UID
-• 生成去重报告和清理后的文件
+⚙️ *调整处理方式：*
+%s
 
-📎 请上传您的UID文件...`)
+%s`, "`"+string(mode)+"` "+mode.String(), notes, dedupUsage, upload))
 	msg.ParseMode = "Markdown"
 	hm.bot.Send(msg)
 }
 
 // processUploadedFile 处理上传的文件
-func (hm *HandlerManager) processUploadedFile(chatID, userID int64, document *tgbotapi.Document, state *UserState) {
+// task 为 handleDocument 占用的任务位置，下载失败时释放
+func (hm *HandlerManager) processUploadedFile(chatID, userID int64, document *tgbotapi.Document, state *UserState, task *runningTask) {
 	// 发送处理开始消息
 	processingMsg := tgbotapi.NewMessage(chatID, "📥 正在下载文件...")
 	sentMsg, _ := hm.bot.Send(processingMsg)
@@ -205,6 +291,7 @@ func (hm *HandlerManager) processUploadedFile(chatID, userID int64, document *tg
 	file, err := hm.bot.GetFile(fileConfig)
 	if err != nil {
 		hm.updateMessage(chatID, sentMsg.MessageID, "❌ 下载文件失败: "+err.Error())
+		hm.releaseTask(userID, task)
 		hm.clearUserState(userID)
 		return
 	}
@@ -217,52 +304,124 @@ func (hm *HandlerManager) processUploadedFile(chatID, userID int64, document *tg
 	err = hm.downloadFile(fileURL, localFilePath)
 	if err != nil {
 		hm.updateMessage(chatID, sentMsg.MessageID, "❌ 保存文件失败: "+err.Error())
+		hm.releaseTask(userID, task)
 		hm.clearUserState(userID)
 		return
 	}
 
-	// 更新消息为处理中
-	hm.updateMessage(chatID, sentMsg.MessageID, "⚙️ 正在处理文件，请稍等...")
+	hm.runTask(chatID, userID, sentMsg.MessageID, localFilePath, state, task)
+}
+
+// runTask 在后台处理已保存到用户目录的输入文件，messageID 为用于显示处理结果的消息
+// task 为调用方通过 reserveTask 占用的任务位置，处理结束后释放
+func (hm *HandlerManager) runTask(chatID, userID int64, messageID int, localFilePath string, state *UserState, task *runningTask) {
+	// 在占用位置时创建的可取消上下文上加超时，/cancel 命令通过 runningTasks 取消
+	timeout := hm.config.TaskTimeoutFor(state.CurrentCommand)
+	ctx, cancelTimeout := context.WithTimeoutCause(task.ctx, timeout, fmt.Errorf("处理超时（超过 %v）", timeout))
+
+	// 处理过程中原地编辑同一条消息显示进度，带取消按钮
+	state.Progress = hm.newProgressMessage(chatID, messageID, state.CurrentCommand)
+	if jobID, ok := state.Get(rerunOfKey).(int64); ok {
+		state.Progress.Start(fmt.Sprintf("🔁 重新执行历史任务 #%d", jobID))
+	} else {
+		state.Progress.Start("📥 文件已接收，开始处理...")
+	}
 
 	// 根据命令类型处理文件
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				hm.updateMessage(chatID, sentMsg.MessageID, fmt.Sprintf("❌ 处理过程中发生错误: %v", r))
+				state.Progress.Finish(fmt.Sprintf("❌ 处理过程中发生错误: %v", r))
 			}
-			// 清理用户目录
+			cancelTimeout()
+			hm.releaseTask(userID, task)
+			// 清理用户目录（包括被取消任务的中间文件）
 			hm.fileManager.CleanupUserDir(state.UserDir)
 			hm.clearUserState(userID)
 		}()
 
+		// 批量任务先解压并合并所有文件，之后按单个文件处理合并结果
 		var err error
-		switch state.CurrentCommand {
-		case "logparse":
-			err = hm.processLogParse(chatID, userID, localFilePath, state)
-		case "lockuser":
-			err = hm.processLockUser(chatID, userID, localFilePath, state)
-		case "sqlparse":
-			err = hm.processSQLParse(chatID, userID, localFilePath, state)
-		case "filesplit":
-			err = hm.processFileSplit(chatID, userID, localFilePath, state)
-		case "kycreview":
-			err = hm.processKYCReview(chatID, userID, localFilePath, state)
-		case "redisdel":
-			err = hm.processRedisDel(chatID, userID, localFilePath, state)
-		case "redisadd":
-			err = hm.processRedisAdd(chatID, userID, localFilePath, state)
-		case "uiddedup":
-			err = hm.processUIDDedup(chatID, userID, localFilePath, state)
-		default:
-			err = fmt.Errorf("未知的命令类型: %s", state.CurrentCommand)
+		inputFile := localFilePath
+		var batchReport *batch.Report
+		var batchReportFile string
+		if isBatchInput(state, localFilePath) {
+			inputFile, batchReport, batchReportFile, err = hm.prepareBatch(ctx, state, localFilePath)
+		}
+
+		if err == nil {
+			switch state.CurrentCommand {
+			case "logparse":
+				err = hm.processLogParse(ctx, chatID, userID, inputFile, state)
+			case "lockuser":
+				err = hm.processLockUser(ctx, chatID, userID, inputFile, state)
+			case "sqlparse":
+				err = hm.processSQLParse(ctx, chatID, userID, inputFile, state)
+			case "filesplit":
+				err = hm.processFileSplit(ctx, chatID, userID, inputFile, state)
+			case "kycreview":
+				err = hm.processKYCReview(ctx, chatID, userID, inputFile, state)
+			case "redisdel":
+				err = hm.processRedisDel(ctx, chatID, userID, inputFile, state)
+			case "redisadd":
+				err = hm.processRedisAdd(ctx, chatID, userID, inputFile, state)
+			case "uiddedup":
+				err = hm.processUIDDedup(ctx, chatID, userID, inputFile, state)
+			default:
+				err = fmt.Errorf("未知的命令类型: %s", state.CurrentCommand)
+			}
+		}
+		if err == nil && batchReport != nil {
+			hm.deliverResult(chatID, state, batchReportFile, batchCaption(batchReport))
+		}
+
+		if err == nil {
+			// 记录输入输出文件的哈希和受影响的用户，需要审批的功能在这里提交审批，审批通过后才发送文件
+			hm.recordGenerate(userID, state, localFilePath)
+			err = hm.submitApproval(chatID, userID, state)
+		}
+		if err == nil {
+			// 保存输入和输出文件，之后可以通过 /history 重新下载或重新执行
+			hm.recordHistory(chatID, userID, state, localFilePath)
 		}
 
 		if err != nil {
-			hm.updateMessage(chatID, sentMsg.MessageID, "❌ 处理失败: "+err.Error())
+			if ctx.Err() != nil {
+				// 取消或超时时显示具体原因
+				cause := context.Cause(ctx)
+				hm.logger.Info("任务已中断",
+					slog.Int64("user_id", userID),
+					slog.String("command", state.CurrentCommand),
+					slog.String("reason", cause.Error()),
+				)
+				state.Progress.Finish("🛑 " + cause.Error() + "，已清理中间文件")
+				return
+			}
+			state.Progress.Finish("❌ 处理失败: " + err.Error())
+			return
 		}
+		state.Progress.Finish(hm.taskSummary(state))
 	}()
 }
 
+// taskSummary 生成任务完成后的总结：结果文件和审批状态
+func (hm *HandlerManager) taskSummary(state *UserState) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ /%s 处理完成", state.CurrentCommand))
+	outputs, _ := state.Get(outputsKey).([]utils.HistoryFile)
+	if len(outputs) > 0 {
+		names := make([]string, len(outputs))
+		for i, f := range outputs {
+			names[i] = f.Name
+		}
+		sb.WriteString("\n📎 结果文件: " + strings.Join(names, ", "))
+	}
+	if approvalID, ok := state.Get(approvalIDKey).(int64); ok {
+		sb.WriteString(fmt.Sprintf("\n⏳ 已提交审批 #%d，批准后发送文件", approvalID))
+	}
+	return sb.String()
+}
+
 // updateMessage 更新消息内容
 func (hm *HandlerManager) updateMessage(chatID int64, messageID int, text string) {
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
@@ -302,36 +461,36 @@ func (hm *HandlerManager) downloadFile(url, localPath string) error {
 // 以下是各个处理功能的占位符实现，将逐步完善
 
 // processLockUser 处理用户锁定
-func (hm *HandlerManager) processLockUser(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processUserLock(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processLockUser(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processUserLock(ctx, chatID, userID, inputFile, state)
 }
 
 // processSQLParse 处理SQL解析
-func (hm *HandlerManager) processSQLParse(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processSQLLogParse(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processSQLParse(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processSQLLogParse(ctx, chatID, userID, inputFile, state)
 }
 
 // processFileSplit 处理文件分割
-func (hm *HandlerManager) processFileSplit(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processMultiFileSplit(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processFileSplit(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processMultiFileSplit(ctx, chatID, userID, inputFile, state)
 }
 
 // processKYCReview 处理KYC审核
-func (hm *HandlerManager) processKYCReview(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processKYCReviewHandler(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processKYCReview(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processKYCReviewHandler(ctx, chatID, userID, inputFile, state)
 }
 
 // processRedisDel 处理Redis删除命令生成
-func (hm *HandlerManager) processRedisDel(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processRedisDeleteCmds(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processRedisDel(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processRedisDeleteCmds(ctx, chatID, userID, inputFile, state)
 }
 
 // processRedisAdd 处理Redis增加命令生成
-func (hm *HandlerManager) processRedisAdd(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processRedisAddCmds(chatID, userID, inputFile, state)
+func (hm *HandlerManager) processRedisAdd(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processRedisAddCmds(ctx, chatID, userID, inputFile, state)
 }
 
 // processUIDDedup 处理UID去重
-func (hm *HandlerManager) processUIDDedup(chatID, userID int64, inputFile string, state *UserState) error {
-	return hm.processUIDDeduplicate(chatID, userID, inputFile, state)
-}
\ No newline at end of file
+func (hm *HandlerManager) processUIDDedup(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	return hm.processUIDDeduplicate(ctx, chatID, userID, inputFile, state)
+}
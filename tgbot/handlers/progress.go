@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"tgbot/utils"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// progressEditInterval 两次编辑进度消息的最小间隔
+// Telegram 对同一聊天的消息编辑有频率限制，过于频繁会返回 429
+const progressEditInterval = 3 * time.Second
+
+// progressBarWidth 进度条宽度
+const progressBarWidth = 20
+
+// progressMessage 任务的实时进度消息，处理过程中原地编辑同一条消息，并带有取消按钮
+// 编辑间隔内的更新只保留最新的一次，间隔结束后再显示；所有方法在 nil 上调用时不做任何事
+type progressMessage struct {
+	bot       *tgbotapi.BotAPI
+	chatID    int64
+	messageID int
+	command   string
+	startTime time.Time
+	interval  time.Duration // 两次编辑的最小间隔，默认为 progressEditInterval
+
+	mu       sync.Mutex
+	done     int64
+	total    int64  // 总量未知时为 0，不显示进度条
+	detail   string // 最近一次的进度说明，结束时显示在总结中
+	lastEdit time.Time
+	lastText string
+	timer    *time.Timer // 等待编辑间隔结束后显示最新进度
+	finished bool
+}
+
+// fileSize 返回文件大小，用于按已读取的字节数计算进度，获取失败时返回 0
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// newProgressMessage 创建进度消息，messageID 为已发送的处理中消息
+func (hm *HandlerManager) newProgressMessage(chatID int64, messageID int, command string) *progressMessage {
+	return &progressMessage{
+		bot:       hm.bot,
+		chatID:    chatID,
+		messageID: messageID,
+		command:   command,
+		startTime: time.Now(),
+		interval:  progressEditInterval,
+	}
+}
+
+// Start 显示初始进度和取消按钮
+func (p *progressMessage) Start(detail string) {
+	p.Report(0, 0, detail)
+}
+
+// Update 更新进度说明，保留之前的进度条
+func (p *progressMessage) Update(detail string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	done, total := p.done, p.total
+	p.mu.Unlock()
+	p.Report(done, total, detail)
+}
+
+// Report 更新进度，done/total 用于生成进度条，total 未知时传 0
+func (p *progressMessage) Report(done, total int64, detail string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return
+	}
+	p.done, p.total, p.detail = done, total, detail
+
+	wait := p.interval - time.Since(p.lastEdit)
+	if wait <= 0 {
+		p.edit()
+		return
+	}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(wait, p.flush)
+	}
+}
+
+// flush 编辑间隔结束后显示最新进度
+func (p *progressMessage) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timer = nil
+	if !p.finished {
+		p.edit()
+	}
+}
+
+// edit 渲染并编辑进度消息，调用方需持有锁
+func (p *progressMessage) edit() {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⚙️ /%s 处理中\n", p.command))
+	if p.total > 0 {
+		done := min(p.done, p.total)
+		// 按千分比渲染，避免大文件的字节数超出 int 范围
+		sb.WriteString(utils.GenerateProgressBar(int(done*1000/p.total), 1000, progressBarWidth) + "\n")
+	}
+	if p.detail != "" {
+		sb.WriteString(p.detail + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("⏱️ 已用时 %v", time.Since(p.startTime).Round(time.Second)))
+
+	text := sb.String()
+	if text == p.lastText {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(p.chatID, p.messageID, text)
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🛑 取消任务", "cmd_cancel"),
+		),
+	)
+	edit.ReplyMarkup = &markup
+	if _, err := p.bot.Send(edit); err == nil {
+		p.lastText = text
+	}
+	p.lastEdit = time.Now()
+}
+
+// Finish 结束进度消息：编辑为最终总结并移除取消按钮，之后的更新都会被忽略
+func (p *progressMessage) Finish(summary string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return
+	}
+	p.finished = true
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(summary + "\n")
+	if p.detail != "" {
+		sb.WriteString(p.detail + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("⏱️ 用时 %v", time.Since(p.startTime).Round(time.Millisecond)))
+	p.bot.Send(tgbotapi.NewEditMessageText(p.chatID, p.messageID, sb.String()))
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// editRecorder 模拟 Telegram API，记录每次编辑后的消息内容
+type editRecorder struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (r *editRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(req.URL.Path, "/getMe") {
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`))
+		return
+	}
+	if strings.HasSuffix(req.URL.Path, "/editMessageText") {
+		r.mu.Lock()
+		r.texts = append(r.texts, req.FormValue("text"))
+		r.mu.Unlock()
+	}
+	w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+}
+
+// edits 返回目前为止的编辑记录
+func (r *editRecorder) edits() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.texts...)
+}
+
+// newTestProgress 创建连接到模拟 API 的进度消息
+func newTestProgress(t *testing.T, interval time.Duration) (*progressMessage, *editRecorder) {
+	t.Helper()
+	rec := &editRecorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	bot, err := tgbotapi.NewBotAPIWithClient("token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm := &HandlerManager{bot: bot}
+	p := hm.newProgressMessage(1, 1, "lockuser")
+	p.interval = interval
+	return p, rec
+}
+
+func TestProgressThrottlesEdits(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	p, rec := newTestProgress(t, interval)
+
+	// 第一次更新立即显示
+	p.Start("📄 读取文件")
+	if got := len(rec.edits()); got != 1 {
+		t.Fatalf("Start 后编辑次数 = %d, want 1", got)
+	}
+
+	// 间隔内的多次更新只在间隔结束后显示最新的一次
+	for i := int64(1); i <= 5; i++ {
+		p.Report(i*10, 100, fmt.Sprintf("📄 已处理 %d 行", i))
+	}
+	if got := len(rec.edits()); got != 1 {
+		t.Fatalf("间隔内编辑次数 = %d, want 1", got)
+	}
+	time.Sleep(2 * interval)
+	edits := rec.edits()
+	if len(edits) != 2 {
+		t.Fatalf("间隔结束后编辑次数 = %d, want 2", len(edits))
+	}
+	if !strings.Contains(edits[1], "已处理 5 行") {
+		t.Errorf("间隔结束后显示 %q, want 最新进度", edits[1])
+	}
+
+	// 内容没有变化时不重复编辑
+	p.Update("📄 已处理 5 行")
+	time.Sleep(2 * interval)
+	if got := len(rec.edits()); got != 2 {
+		t.Errorf("内容不变时编辑次数 = %d, want 2", got)
+	}
+}
+
+func TestProgressFinishCancelsPendingEdit(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	p, rec := newTestProgress(t, interval)
+
+	p.Start("📄 读取文件")
+	p.Report(50, 100, "📄 已处理 50 行")
+	p.Finish("✅ 处理完成")
+	// 等待原本的编辑间隔结束，挂起的进度不应覆盖总结
+	time.Sleep(2 * interval)
+	p.Report(100, 100, "📄 已处理 100 行")
+
+	edits := rec.edits()
+	if len(edits) != 2 {
+		t.Fatalf("编辑次数 = %d, want 2: %q", len(edits), edits)
+	}
+	if !strings.HasPrefix(edits[1], "✅ 处理完成\n📄 已处理 50 行") {
+		t.Errorf("总结 = %q", edits[1])
+	}
+}
+
+func TestProgressNilIsNoop(t *testing.T) {
+	var p *progressMessage
+	p.Start("📄 读取文件")
+	p.Update("📄 已处理 1 行")
+	p.Report(1, 2, "")
+	p.Finish("✅ 处理完成")
+}
@@ -1,26 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 	"tgbot/utils"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"time"
 )
 
 // processRedisAddCmds 处理Redis流水增加命令生成功能
-func (hm *HandlerManager) processRedisAddCmds(chatID, userID int64, inputFile string, state *UserState) error {
+func (hm *HandlerManager) processRedisAddCmds(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
 	// 检查文件格式 - 只支持CSV
 	if !utils.IsValidFileType(inputFile, []string{".csv"}) {
 		return fmt.Errorf("只支持CSV格式的文件")
 	}
 
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在生成Redis流水设置命令...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Update("🔄 正在生成Redis流水设置命令...")
 
 	// 创建输出文件
 	outputFile := filepath.Join(state.UserDir, "redis_add_commands.txt")
@@ -40,6 +37,10 @@ func (hm *HandlerManager) processRedisAddCmds(chatID, userID int64, inputFile st
 	err = excelHelper.ProcessFileByType(inputFile, func(rows [][]string) error {
 		// 跳过标题行，处理数据行
 		for i, row := range rows {
+			// 每行检查一次任务是否被取消或超时
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if i == 0 {
 				continue // 跳过标题行
 			}
@@ -103,10 +104,9 @@ func (hm *HandlerManager) processRedisAddCmds(chatID, userID int64, inputFile st
 
 			totalCount++
 
-			// 每处理100条记录显示进度
+			// 每处理100条记录更新一次进度
 			if totalCount%100 == 0 {
-				progressMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🔄 已处理 %d 个用户，生成 %d 条命令...", totalCount, totalCount*3))
-				hm.bot.Send(progressMsg)
+				state.Progress.Report(int64(i), int64(len(rows)), fmt.Sprintf("🔄 已处理 %d 个用户，生成 %d 条命令...", totalCount, totalCount*3))
 			}
 		}
 		return nil
@@ -120,7 +120,7 @@ func (hm *HandlerManager) processRedisAddCmds(chatID, userID int64, inputFile st
 	duration := time.Since(startTime)
 
 	// 发送结果文件
-	hm.sendResultFile(chatID, outputFile, fmt.Sprintf("✅ Redis流水命令生成完成！\n👤 处理了 %d 个用户\n⚙️ 生成了 %d 条Redis命令\n⏱️ 处理时间: %v", totalCount, totalCount*3, duration))
+	hm.deliverResult(chatID, state, outputFile, fmt.Sprintf("✅ Redis流水命令生成完成！\n👤 处理了 %d 个用户\n⚙️ 生成了 %d 条Redis命令\n⏱️ 处理时间: %v", totalCount, totalCount*3, duration))
 
 	return nil
-}
\ No newline at end of file
+}
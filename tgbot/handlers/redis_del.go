@@ -1,20 +1,24 @@
 package handlers
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"shared/pack"
+	"shared/rediskey"
+	"strconv"
 	"strings"
 	"tgbot/utils"
 	"time"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// redisSplitLines Redis命令分割后每个文件的行数
+const redisSplitLines = 10000
+
 // processRedisDeleteCmds 处理Redis删除命令生成功能 - 完整流水删除操作流程
-func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile string, state *UserState) error {
+func (hm *HandlerManager) processRedisDeleteCmds(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
 	startTime := time.Now()
 
 	hm.logger.Info("开始Redis删除操作流程",
@@ -33,9 +37,9 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		return fmt.Errorf("只支持Excel (.xlsx) 或CSV格式的文件")
 	}
 
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🚀 开始执行Redis流水删除操作流程...")
-	hm.bot.Send(progressMsg)
+	// 5个步骤共用一条进度消息
+	const totalSteps = 5
+	state.Progress.Report(0, totalSteps, "🚀 开始执行Redis流水删除操作流程...")
 
 	// 步骤1：生成Redis删除命令
 	step1Start := time.Now()
@@ -45,11 +49,10 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("timestamp", step1Start.Format(time.RFC3339)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "📝 步骤1：生成Redis删除命令...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(0, totalSteps, "📝 步骤1：生成Redis删除命令...")
 
 	redisCommandsFile := filepath.Join(state.UserDir, "redis_delete_commands.txt")
-	totalCount, err := hm.generateRedisDeleteCommands(inputFile, redisCommandsFile)
+	totalCount, err := hm.generateRedisDeleteCommands(ctx, inputFile, redisCommandsFile)
 	if err != nil {
 		hm.logger.LogError(userID, "generate_redis_commands", err, map[string]interface{}{
 			"input_file":  utils.SanitizePath(inputFile),
@@ -68,8 +71,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("output_file", utils.SanitizePath(redisCommandsFile)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 步骤1完成：成功生成 %d 条Redis命令", totalCount*2))
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(1, totalSteps, fmt.Sprintf("✅ 步骤1完成：成功生成 %d 条Redis命令", totalCount*2))
 
 	// 步骤2：创建multi-redis目录并移动文件
 	step2Start := time.Now()
@@ -78,8 +80,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("timestamp", step2Start.Format(time.RFC3339)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "📁 步骤2：创建工作目录...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(1, totalSteps, "📁 步骤2：创建工作目录...")
 
 	multiRedisDir := filepath.Join(state.UserDir, "multi-redis")
 	err = os.MkdirAll(multiRedisDir, 0755)
@@ -109,8 +110,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("duration", step2Duration.String()),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "✅ 步骤2完成：文件移动成功")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(2, totalSteps, "✅ 步骤2完成：文件移动成功")
 
 	// 步骤3：执行文件分割（调用现有的文件分割功能）
 	step3Start := time.Now()
@@ -120,11 +120,10 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("timestamp", step3Start.Format(time.RFC3339)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "✂️ 步骤3：分割Redis命令文件（每10,000行一个文件）...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(2, totalSteps, "✂️ 步骤3：按哈希槽分割Redis命令文件（每个文件约10,000行）...")
 
 	splitDir := filepath.Join(state.UserDir, "multi-redis-split")
-	err = hm.splitRedisCommandFile(multiRedisFile, splitDir)
+	parts, err := hm.splitRedisCommandFile(multiRedisFile, splitDir)
 	if err != nil {
 		hm.logger.LogError(userID, "split_redis_commands", err, map[string]interface{}{
 			"source_file": utils.SanitizePath(multiRedisFile),
@@ -137,11 +136,11 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 	hm.logger.Info("步骤3完成：文件分割",
 		slog.Int64("user_id", userID),
 		slog.String("split_dir", utils.SanitizePath(splitDir)),
+		slog.Int("split_files", len(parts)),
 		slog.String("duration", step3Duration.String()),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "✅ 步骤3完成：文件分割成功")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(3, totalSteps, fmt.Sprintf("✅ 步骤3完成：文件分割成功，共 %d 个文件", len(parts)))
 
 	// 步骤4：创建执行脚本
 	step4Start := time.Now()
@@ -151,8 +150,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("timestamp", step4Start.Format(time.RFC3339)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "📜 步骤4：创建Redis执行脚本...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(3, totalSteps, "📜 步骤4：创建Redis执行脚本...")
 
 	executeScriptPath := filepath.Join(splitDir, "execute_redis_commands.sh")
 	err = hm.createExecuteScript(executeScriptPath)
@@ -170,8 +168,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("duration", step4Duration.String()),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "✅ 步骤4完成：执行脚本创建成功")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(4, totalSteps, "✅ 步骤4完成：执行脚本创建成功")
 
 	// 步骤5：压缩整个分割目录
 	step5Start := time.Now()
@@ -181,12 +178,21 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("timestamp", step5Start.Format(time.RFC3339)),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "🗜️ 步骤5：压缩文件包...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(4, totalSteps, "🗜️ 步骤5：压缩文件包...")
+
+	// 只打包分割文件、槽位索引和执行脚本，执行脚本运行前按 MANIFEST.json 校验
+	files := make([]string, 0, len(parts)+2)
+	for _, part := range parts {
+		files = append(files, part.File)
+	}
+	files = append(files, filepath.Join(splitDir, rediskey.SlotIndexFileName), executeScriptPath)
 
 	zipFilePath := filepath.Join(state.UserDir, "redis-delete-commands.zip")
-	zipHelper := utils.NewZipHelper()
-	err = zipHelper.CreateZipFromDirectory(splitDir, zipFilePath)
+	manifest := &pack.Manifest{
+		Operation: "redisdel",
+		Params:    map[string]string{"split_mode": "slot", "split_size": strconv.Itoa(redisSplitLines)},
+	}
+	err = manifest.Zip(zipFilePath, pack.Paths(files...))
 	if err != nil {
 		hm.logger.LogError(userID, "create_zip_package", err, map[string]interface{}{
 			"split_dir":     utils.SanitizePath(splitDir),
@@ -202,8 +208,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 		slog.String("duration", step5Duration.String()),
 	)
 
-	progressMsg = tgbotapi.NewMessage(chatID, "✅ 步骤5完成：文件压缩成功")
-	hm.bot.Send(progressMsg)
+	state.Progress.Report(5, totalSteps, "✅ 步骤5完成：文件压缩成功")
 
 	// 发送最终结果
 	caption := fmt.Sprintf(`🎉 Redis流水删除操作流程完成！
@@ -211,19 +216,22 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 📊 处理统计：
 • 处理用户数: %d
 • 生成Redis命令: %d 条
-• 分割文件数: 自动分割
+• 分割文件数: %d (按哈希槽分组)
 • 包含执行脚本: execute_redis_commands.sh
 
 📦 压缩包内容：
 • redis_commands_part_*.txt (分割后的命令文件)
+• redis_slots_index.txt (每个文件的槽位范围)
 • execute_redis_commands.sh (批量执行脚本)
+• MANIFEST.json (每个文件的行数和 SHA-256，脚本执行前自动校验)
 
 🚀 使用方法：
 1. 解压ZIP文件
 2. 上传到Redis服务器
-3. 运行 ./execute_redis_commands.sh`, totalCount, totalCount*2)
+3. 运行 ./execute_redis_commands.sh
+   (或使用 redis-exec: REDIS_PASSWORD=xxx redis-exec -db 2 <host>)`, totalCount, totalCount*2, len(parts))
 
-	hm.sendResultFile(chatID, zipFilePath, caption)
+	hm.deliverResult(chatID, state, zipFilePath, caption)
 
 	// 记录操作完成日志
 	hm.logger.LogPerformance("redis_delete_pipeline", time.Since(startTime), totalCount, userID)
@@ -242,7 +250,7 @@ func (hm *HandlerManager) processRedisDeleteCmds(chatID, userID int64, inputFile
 }
 
 // generateRedisDeleteCommands 生成Redis删除命令
-func (hm *HandlerManager) generateRedisDeleteCommands(inputFile, outputFile string) (int, error) {
+func (hm *HandlerManager) generateRedisDeleteCommands(ctx context.Context, inputFile, outputFile string) (int, error) {
 	// 创建输出文件
 	file, err := hm.fileManager.CreateOutputFile(outputFile)
 	if err != nil {
@@ -257,6 +265,10 @@ func (hm *HandlerManager) generateRedisDeleteCommands(inputFile, outputFile stri
 
 	err = excelHelper.ProcessFileByType(inputFile, func(rows [][]string) error {
 		for i, row := range rows {
+			// 每行检查一次任务是否被取消或超时
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if len(row) == 0 {
 				continue
 			}
@@ -290,96 +302,33 @@ func (hm *HandlerManager) generateRedisDeleteCommands(inputFile, outputFile stri
 	return totalCount, err
 }
 
-// splitRedisCommandFile 分割Redis命令文件（专用版本，不创建ZIP）
-func (hm *HandlerManager) splitRedisCommandFile(inputFile, outputDir string) error {
-	// 创建输出目录
-	err := os.MkdirAll(outputDir, 0755)
-	if err != nil {
-		return err
-	}
-
+// splitRedisCommandFile 按哈希槽分割Redis命令文件（专用版本，不创建ZIP）
+// 同一用户的命令使用相同的哈希标签，会被写入同一个分割文件
+func (hm *HandlerManager) splitRedisCommandFile(inputFile, outputDir string) ([]rediskey.SlotPart, error) {
 	// 记录分割开始
 	hm.logger.Info("开始分割Redis命令文件",
 		slog.String("input_file", utils.SanitizePath(inputFile)),
 		slog.String("output_dir", utils.SanitizePath(outputDir)),
 	)
 
-	// 打开输入文件
-	file, err := hm.fileManager.OpenFile(inputFile)
+	parts, err := rediskey.SplitBySlot(inputFile, outputDir, redisSplitLines)
 	if err != nil {
-		return fmt.Errorf("打开文件失败: %v", err)
-	}
-	defer hm.fileManager.CloseFile(inputFile)
-
-	scanner := bufio.NewScanner(file)
-	// 增加缓冲区大小以处理超长的行
-	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
-	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
-
-	var currentFileIndex int = 1
-	var currentLineCount int = 0
-	var currentOutputFile *os.File
-
-	// 获取原文件名（不含路径）
-	baseFileName := filepath.Base(inputFile)
-	// 获取原文件扩展名
-	fileExt := filepath.Ext(baseFileName)
-	// 去掉原文件扩展名
-	nameWithoutExt := strings.TrimSuffix(baseFileName, fileExt)
-
-	// 创建第一个输出文件
-	outputFileName := fmt.Sprintf("%s/%s_part_%04d%s", outputDir, nameWithoutExt, currentFileIndex, fileExt)
-	currentOutputFile, err = hm.fileManager.CreateOutputFile(outputFileName)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %v", err)
+		return nil, err
 	}
 
 	totalLines := 0
-
-	// 逐行读取并写入（不插入额外换行符）
-	for scanner.Scan() {
-		line := scanner.Text()
-		totalLines++
-		currentLineCount++
-
-		// 写入当前输出文件
-		_, err := currentOutputFile.WriteString(line + "\n")
-		if err != nil {
-			return fmt.Errorf("写入文件失败: %v", err)
-		}
-
-		// 如果当前文件已达到1万行，创建新文件
-		if currentLineCount >= 10000 {
-			hm.fileManager.CloseFile(outputFileName)
-			currentFileIndex++
-			currentLineCount = 0
-
-			// 创建新的输出文件
-			outputFileName = fmt.Sprintf("%s/%s_part_%04d%s", outputDir, nameWithoutExt, currentFileIndex, fileExt)
-			currentOutputFile, err = hm.fileManager.CreateOutputFile(outputFileName)
-			if err != nil {
-				return fmt.Errorf("创建输出文件失败: %v", err)
-			}
-		}
-	}
-
-	// 关闭最后一个输出文件
-	if currentOutputFile != nil {
-		hm.fileManager.CloseFile(outputFileName)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取文件时发生错误: %v", err)
+	for _, part := range parts {
+		totalLines += part.Lines
 	}
 
 	// 记录分割完成（不创建额外的ZIP文件）
 	hm.logger.Info("Redis命令文件分割完成",
 		slog.Int("total_lines", totalLines),
-		slog.Int("split_files", currentFileIndex),
+		slog.Int("split_files", len(parts)),
 		slog.String("output_dir", utils.SanitizePath(outputDir)),
 	)
 
-	return nil
+	return parts, nil
 }
 
 // createExecuteScript 创建Redis命令执行脚本
@@ -389,6 +338,7 @@ func (hm *HandlerManager) createExecuteScript(scriptPath string) error {
 # Redis批量导入脚本
 # 使用方法: ./execute_redis_commands.sh <redis_host>
 # 例如: ./execute_redis_commands.sh 127.0.0.1
+# 执行前按同目录的 MANIFEST.json 校验所有文件，校验不通过时不会执行任何命令
 
 # 检查参数
 if [ $# -eq 0 ]; then
@@ -409,6 +359,79 @@ echo "Redis端口: $REDIS_PORT"
 echo "当前目录: $CURRENT_DIR"
 echo "================================"
 
+# 校验 MANIFEST.json：压缩包中的每个文件都必须存在且 SHA-256 一致，校验不通过时不执行任何命令
+verify_manifest() {
+    manifest="${CURRENT_DIR}/MANIFEST.json"
+    if [ ! -f "$manifest" ]; then
+        echo "错误: 没有找到 MANIFEST.json，无法校验命令文件，请使用完整的压缩包"
+        exit 1
+    fi
+
+    if command -v sha256sum >/dev/null 2>&1; then
+        checksum="sha256sum"
+    elif command -v shasum >/dev/null 2>&1; then
+        checksum="shasum -a 256"
+    else
+        echo "错误: 没有找到 sha256sum 或 shasum，无法校验命令文件"
+        exit 1
+    fi
+
+    # 清单中每个文件的记录占一行: {"name":"...","lines":N,"bytes":N,"sha256":"..."}
+    entries=$(sed -n 's/.*"name":"\([^"]*\)".*"sha256":"\([0-9a-f]\{64\}\)".*/\2 \1/p' "$manifest")
+    if [ -z "$entries" ]; then
+        echo "错误: MANIFEST.json 中没有文件记录"
+        exit 1
+    fi
+
+    echo "正在校验 MANIFEST.json..."
+    checked=0
+    bad=0
+    while read -r expected name; do
+        path="${CURRENT_DIR}/${name}"
+        # 已执行的文件会被重命名为 xxx_done 或 xxx_done.txt，校验重命名后的文件
+        if [ ! -f "$path" ] && [ -f "${path}_done" ]; then
+            path="${path}_done"
+        elif [ ! -f "$path" ] && [ -f "${path%.txt}_done.txt" ]; then
+            path="${path%.txt}_done.txt"
+        fi
+        if [ ! -f "$path" ]; then
+            echo "  ❌ 缺少文件: $name"
+            bad=$((bad + 1))
+            continue
+        fi
+        actual=$($checksum "$path" | cut -d' ' -f1)
+        if [ "$actual" != "$expected" ]; then
+            echo "  ❌ 校验失败: $name"
+            bad=$((bad + 1))
+            continue
+        fi
+        checked=$((checked + 1))
+    done <<< "$entries"
+
+    # 不在清单中的命令文件不能执行
+    for file in "${CURRENT_DIR}"/redis_commands_part_*; do
+        [ -f "$file" ] || continue
+        name=$(basename "$file")
+        case "$name" in
+            *_done) name="${name%_done}" ;;
+            *_done.txt) name="${name%_done.txt}.txt" ;;
+        esac
+        if ! grep -q "\"name\":\"${name}\"" "$manifest"; then
+            echo "  ❌ 文件不在清单中: $(basename "$file")"
+            bad=$((bad + 1))
+        fi
+    done
+
+    if [ $bad -gt 0 ]; then
+        echo "错误: 有 $bad 个文件校验失败，文件可能被修改或不完整，已停止执行"
+        exit 1
+    fi
+    echo "✅ MANIFEST.json 校验通过，共 $checked 个文件"
+    echo "================================"
+}
+
+verify_manifest
+
 # 统计变量
 total_files=0
 success_files=0
@@ -481,8 +504,11 @@ fi
 	}
 	defer hm.fileManager.CloseFile(scriptPath)
 
-	_, err = file.WriteString(script)
-	return err
+	if _, err := file.WriteString(script); err != nil {
+		return err
+	}
+	// 解压后可以直接运行
+	return os.Chmod(scriptPath, 0755)
 }
 
 // copyFile 复制文件
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"shared/batch"
+	"shared/kyc"
+	"shared/snapshot"
+	"strings"
+)
+
+// snapshotArg 对照快照的命令参数：/lockuser snapshot、/kycreview snapshot
+const snapshotArg = "snapshot"
+
+// snapshotTables 支持对照快照的功能及快照对应的表
+var snapshotTables = map[string]string{
+	"lockuser":  snapshot.UserTable,
+	"kycreview": kyc.Table,
+}
+
+// snapshotUsage 对照快照的参数说明
+const snapshotUsage = "用法: `/%s [snapshot]`\n" +
+	"• 不带参数：直接生成SQL\n" +
+	"• `snapshot` 先上传数据文件，再上传 %s 的当前状态导出（CSV，带表头），只为执行后确实会变更的ID生成SQL"
+
+// parseSnapshotArg 检查命令参数，返回是否对照快照
+func parseSnapshotArg(args string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "":
+		return false, nil
+	case snapshotArg:
+		return true, nil
+	}
+	return false, fmt.Errorf("无效的参数 %q", strings.TrimSpace(args))
+}
+
+// useSnapshot 本次任务是否对照快照，参数在开始流程时已经检查过
+func useSnapshot(state *UserState) bool {
+	args, _ := state.Get(argsKey).(string)
+	_, ok := snapshotTables[state.CurrentCommand]
+	return ok && args == snapshotArg
+}
+
+// snapshotLabels 对照快照时依次上传的文件
+func snapshotLabels(command string) []string {
+	return []string{"数据文件", snapshotTables[command] + " 快照"}
+}
+
+// snapshotInputs 解压依次上传的数据文件和快照，返回数据文件的路径和快照文件
+// 输入是两个文件打包成的压缩包，重新执行历史任务时也使用这个压缩包
+func snapshotInputs(state *UserState, inputFile string) (string, batch.File, error) {
+	if !batch.IsZip(inputFile) {
+		return "", batch.File{}, fmt.Errorf("对照快照需要依次上传数据文件和 %s 快照", snapshotTables[state.CurrentCommand])
+	}
+	files, err := batch.Extract(inputFile, filepath.Join(state.UserDir, "snapshot-inputs"), maxBatchExtractSize)
+	if err != nil {
+		return "", batch.File{}, err
+	}
+	if len(files) != 2 {
+		return "", batch.File{}, fmt.Errorf("对照快照需要 2 个文件，压缩包中有 %d 个文件", len(files))
+	}
+	return files[0].Path, files[1], nil
+}
+
+// deliverSnapshotReport 写出并发送未生成SQL的ID及原因
+func (hm *HandlerManager) deliverSnapshotReport(chatID int64, state *UserState, report *snapshot.Report) error {
+	reportFile := filepath.Join(state.UserDir, fmt.Sprintf("%s-snapshot-check.csv", state.CurrentCommand))
+	if err := report.WriteCSV(reportFile); err != nil {
+		return err
+	}
+	hm.deliverResult(chatID, state, reportFile, fmt.Sprintf("🔍 快照检查报告\n%s\n📎 文件中列出未生成SQL的ID及原因", report.Summary()))
+	return nil
+}
@@ -2,25 +2,22 @@ package handlers
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
 	"tgbot/utils"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // processSQLLogParse 处理SQL日志解析功能
-func (hm *HandlerManager) processSQLLogParse(chatID, userID int64, inputFile string, state *UserState) error {
+func (hm *HandlerManager) processSQLLogParse(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
 	// 检查输入文件是否是TXT格式
 	if !utils.IsValidFileType(inputFile, []string{".txt"}) {
 		return fmt.Errorf("只支持TXT格式的日志文件")
 	}
 
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在解析SQL日志文件...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Update("🔄 正在解析SQL日志文件...")
 
 	// 创建输出文件
 	outputFile := filepath.Join(state.UserDir, "sql.log")
@@ -45,10 +42,16 @@ func (hm *HandlerManager) processSQLLogParse(chatID, userID int64, inputFile str
 	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
 	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
 	lineNum := 0
+	totalBytes, readBytes := fileSize(inputFile), int64(0)
 
 	for scanner.Scan() {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		lineNum++
 		line := scanner.Text()
+		readBytes += int64(len(line)) + 1
 
 		// 查找包含 SQL 信息的行
 		if strings.Contains(line, `"sql_INFO":"`) {
@@ -83,11 +86,9 @@ func (hm *HandlerManager) processSQLLogParse(chatID, userID int64, inputFile str
 			}
 		}
 
-		// 每处理5000行发送一次进度消息
+		// 每处理5000行更新一次进度，进度消息自身会限制编辑频率
 		if lineNum%5000 == 0 {
-			progress := fmt.Sprintf("🔄 已处理 %d 行，提取 %d 条唯一SQL...", lineNum, sqlCount)
-			progressMsg := tgbotapi.NewMessage(chatID, progress)
-			hm.bot.Send(progressMsg)
+			state.Progress.Report(readBytes, totalBytes, fmt.Sprintf("🔄 已处理 %d 行，提取 %d 条唯一SQL...", lineNum, sqlCount))
 		}
 	}
 
@@ -97,9 +98,10 @@ func (hm *HandlerManager) processSQLLogParse(chatID, userID int64, inputFile str
 
 	// 清理内存
 	uniqueSQLs = nil
+	state.Progress.Report(totalBytes, totalBytes, fmt.Sprintf("📊 共处理 %d 行，提取 %d 条唯一SQL", lineNum, sqlCount))
 
 	// 发送结果文件
-	hm.sendResultFile(chatID, outputFile, fmt.Sprintf("✅ SQL解析完成！\n📊 总计处理 %d 行日志，提取 %d 条唯一SQL语句", lineNum, sqlCount))
+	hm.deliverResult(chatID, state, outputFile, fmt.Sprintf("✅ SQL解析完成！\n📊 总计处理 %d 行日志，提取 %d 条唯一SQL语句", lineNum, sqlCount))
 
 	return nil
 }
@@ -260,4 +262,4 @@ func (hm *HandlerManager) extractFieldName(condition string) string {
 	}
 
 	return ""
-}
\ No newline at end of file
+}
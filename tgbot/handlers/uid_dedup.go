@@ -1,127 +1,87 @@
 package handlers
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"path/filepath"
-	"strings"
+	"shared/batch"
+	"shared/dedup"
 	"tgbot/utils"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// processUIDDeduplicate 处理UID去重功能
-func (hm *HandlerManager) processUIDDeduplicate(chatID, userID int64, inputFile string, state *UserState) error {
-	// 检查文件格式 - 只支持CSV
-	if !utils.IsValidFileType(inputFile, []string{".csv"}) {
-		return fmt.Errorf("只支持CSV格式的文件")
+// dedupUsage UID去重命令的参数说明
+const dedupUsage = "用法: `/uiddedup [方式]`\n" +
+	"• `distinct` 每个UID保留一次（默认）\n" +
+	"• `singletons` 只保留唯一出现的UID，重复的UID全部去掉\n" +
+	"• `duplicates` 只保留重复出现的UID，并输出出现次数\n" +
+	"• `union` / `intersect` / `minus` 两个名单的并集、交集、差集（A 减 B），依次上传名单A和名单B"
+
+// dedupMode 返回本次UID去重的方式，参数在开始流程时已经检查过，开始流程时总会保存去重方式
+// 旧版本的历史任务没有保存参数，重新执行时按当时的逻辑只保留唯一出现的UID
+func dedupMode(state *UserState) dedup.Mode {
+	args, _ := state.Get(argsKey).(string)
+	if args == "" {
+		return dedup.Singletons
 	}
-
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在读取和统计UID...")
-	hm.bot.Send(progressMsg)
-
-	// 打开输入文件
-	file, err := hm.fileManager.OpenFile(inputFile)
+	mode, err := dedup.ParseMode(args)
 	if err != nil {
-		return fmt.Errorf("打开文件失败: %v", err)
+		return dedup.Distinct
 	}
-	defer hm.fileManager.CloseFile(inputFile)
-
-	// 统计每个uid的出现次数
-	uidCounts := make(map[string]int)
-
-	scanner := bufio.NewScanner(file)
-	totalLines := 0
+	return mode
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			uidCounts[line]++
-			totalLines++
-
-			// 每处理10000行显示一次进度
-			if totalLines%10000 == 0 {
-				progressMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🔄 已读取 %d 行数据...", totalLines))
-				hm.bot.Send(progressMsg)
-			}
+// processUIDDeduplicate 处理UID去重功能
+// 集合运算的输入是依次上传的名单A和名单B打包成的压缩包，重新执行历史任务时也使用这个压缩包
+func (hm *HandlerManager) processUIDDeduplicate(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	mode := dedupMode(state)
+	inputs := []string{inputFile}
+	var names []string
+	if mode.SetOperation() {
+		if !batch.IsZip(inputFile) {
+			return fmt.Errorf("%s 需要依次上传名单A和名单B", string(mode))
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取文件时出错: %v", err)
-	}
-
-	// 统计重复情况
-	uniqueCount := 0
-	duplicateCount := 0
-	duplicateExamples := make(map[string]int)
-	exampleCount := 0
-
-	for uid, count := range uidCounts {
-		if count == 1 {
-			uniqueCount++
-		} else {
-			duplicateCount++
-			// 收集前10个重复uid作为示例
-			if exampleCount < 10 {
-				duplicateExamples[uid] = count
-				exampleCount++
-			}
+		files, err := batch.Extract(inputFile, filepath.Join(state.UserDir, "dedup-lists"), maxBatchExtractSize)
+		if err != nil {
+			return err
+		}
+		if len(files) != 2 {
+			return fmt.Errorf("%s 需要 2 个名单，压缩包中有 %d 个文件", string(mode), len(files))
 		}
+		inputs, names = []string{files[0].Path, files[1].Path}, []string{files[0].Name, files[1].Name}
+	} else if !utils.IsValidFileType(inputFile, []string{".csv"}) {
+		// 检查文件格式 - 只支持CSV
+		return fmt.Errorf("只支持CSV格式的文件")
 	}
 
-	progressMsg = tgbotapi.NewMessage(chatID, fmt.Sprintf("📊 分析完成！\n📈 总行数: %d\n🔢 不同UID: %d\n✅ 唯一UID: %d\n🔄 重复UID: %d", totalLines, len(uidCounts), uniqueCount, duplicateCount))
-	hm.bot.Send(progressMsg)
+	state.Progress.Update(fmt.Sprintf("🔄 正在读取和统计UID：%s", mode))
 
-	// 创建去重后的输出文件
 	outputFile := filepath.Join(state.UserDir, "unique_uids.csv")
-	outFile, err := hm.fileManager.CreateOutputFile(outputFile)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %v", err)
+	if mode == dedup.Duplicates {
+		outputFile = filepath.Join(state.UserDir, "duplicate_uids.csv")
 	}
-	defer hm.fileManager.CloseFile(outputFile)
-
-	// 写入唯一的uid
-	writtenCount := 0
-	for uid, count := range uidCounts {
-		if count == 1 {
-			_, err := outFile.WriteString(uid + "\n")
-			if err != nil {
-				return fmt.Errorf("写入文件时出错: %v", err)
-			}
-			writtenCount++
+	result, err := dedup.Run(ctx, mode, inputs, outputFile, dedup.Options{MemoryLimit: hm.config.DedupMemory}, func(list int, done, total int64, lines int) {
+		prefix := ""
+		if mode.SetOperation() {
+			prefix = fmt.Sprintf("名单%c ", 'A'+list)
 		}
+		state.Progress.Report(done, total, fmt.Sprintf("🔄 %s已读取 %d 行数据...", prefix, lines))
+	})
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		result.Lists[i].Name = name
 	}
 
 	// 创建去重报告文件
 	reportFile := filepath.Join(state.UserDir, "dedup_report.txt")
-	report, err := hm.fileManager.CreateOutputFile(reportFile)
-	if err != nil {
-		return fmt.Errorf("创建报告文件失败: %v", err)
-	}
-	defer hm.fileManager.CloseFile(reportFile)
-
-	// 写入详细报告
-	report.WriteString("UID去重处理报告\n")
-	report.WriteString("==================\n\n")
-	report.WriteString(fmt.Sprintf("总共读取了 %d 行数据\n", totalLines))
-	report.WriteString(fmt.Sprintf("发现 %d 个不同的UID\n", len(uidCounts)))
-	report.WriteString(fmt.Sprintf("唯一UID数量: %d\n", uniqueCount))
-	report.WriteString(fmt.Sprintf("重复UID数量: %d\n\n", duplicateCount))
-
-	if len(duplicateExamples) > 0 {
-		report.WriteString("重复UID示例（前10个）:\n")
-		for uid, count := range duplicateExamples {
-			report.WriteString(fmt.Sprintf("UID: %s, 出现次数: %d\n", uid, count))
-		}
+	if err := result.WriteReport(reportFile); err != nil {
+		return err
 	}
 
-	// 发送去重后的文件
-	hm.sendResultFile(chatID, outputFile, fmt.Sprintf("✅ UID去重完成！\n📄 成功写入 %d 个唯一UID", writtenCount))
-
-	// 发送详细报告
-	hm.sendResultFile(chatID, reportFile, fmt.Sprintf("📋 去重报告\n📊 原始数据: %d 行\n🎯 去重后: %d 个唯一UID\n🔄 重复数据: %d 个", totalLines, uniqueCount, duplicateCount))
+	// 发送结果文件和详细报告
+	hm.deliverResult(chatID, state, outputFile, "✅ UID去重完成！\n"+result.Summary())
+	hm.deliverResult(chatID, state, reportFile, fmt.Sprintf("📋 去重报告\n📊 处理方式: %s\n🎯 结果: %d 个UID", string(mode), result.Written))
 
 	return nil
-}
\ No newline at end of file
+}
@@ -1,26 +1,41 @@
 package handlers
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
 	"path/filepath"
+	"shared/batch"
+	"shared/rediskey"
+	"shared/snapshot"
 	"strings"
 	"tgbot/utils"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // processUserLock 处理用户锁定功能
-func (hm *HandlerManager) processUserLock(chatID, userID int64, inputFile string, state *UserState) error {
+// 对照快照时只为快照中存在且未锁定的用户生成SQL，Redis删除命令仍为所有用户生成
+func (hm *HandlerManager) processUserLock(ctx context.Context, chatID, userID int64, inputFile string, state *UserState) error {
+	var users *snapshot.Snapshot
+	if useSnapshot(state) {
+		var snapshotFile batch.File
+		var err error
+		inputFile, snapshotFile, err = snapshotInputs(state, inputFile)
+		if err != nil {
+			return err
+		}
+		if users, err = snapshot.LoadUsers(snapshotFile.Path); err != nil {
+			return err
+		}
+		users.Name = snapshotFile.Name
+	}
+
 	// 检查输入文件是否是CSV格式
 	if !utils.IsValidFileType(inputFile, []string{".csv"}) {
 		return fmt.Errorf("只支持CSV格式的文件")
 	}
 
-	// 发送处理开始消息
-	progressMsg := tgbotapi.NewMessage(chatID, "🔄 正在读取用户ID...")
-	hm.bot.Send(progressMsg)
+	state.Progress.Update("🔄 正在读取用户ID...")
 
 	// 打开CSV文件
 	file, err := hm.fileManager.OpenFile(inputFile)
@@ -35,6 +50,10 @@ func (hm *HandlerManager) processUserLock(chatID, userID int64, inputFile string
 
 	// 读取CSV文件，获取第一列的用户ID
 	for {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
@@ -53,30 +72,52 @@ func (hm *HandlerManager) processUserLock(chatID, userID int64, inputFile string
 	}
 
 	// 更新进度
-	progressMsg = tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ 找到 %d 个用户ID，正在生成命令...", len(userIds)))
-	hm.bot.Send(progressMsg)
+	state.Progress.Update(fmt.Sprintf("✅ 找到 %d 个用户ID，正在生成命令...", len(userIds)))
+
+	// 对照快照，只为会被锁定的用户生成SQL
+	lockIds := userIds
+	var report *snapshot.Report
+	if users != nil {
+		lockIds, report = snapshot.CheckLock(users, userIds)
+		state.Progress.Update(fmt.Sprintf("🔍 对照快照：%d 个用户会被锁定，%d 个跳过", len(lockIds), len(report.Skipped)))
+	}
 
 	// 生成SQL文件
-	sqlContent := hm.generateLockUserSQL(userIds)
+	sqlContent := hm.generateLockUserSQL(lockIds)
 	sqlFile := filepath.Join(state.UserDir, "lockUser-db_user库.sql")
 	err = hm.writeStringToFile(sqlFile, sqlContent)
 	if err != nil {
 		return fmt.Errorf("写入SQL文件失败: %v", err)
 	}
 
-	// 生成Redis命令文件
-	redisContent := hm.generateLockUserRedis(userIds)
-	redisFile := filepath.Join(state.UserDir, "lockUser-redis_db0.txt")
-	err = hm.writeStringToFile(redisFile, redisContent)
-	if err != nil {
-		return fmt.Errorf("写入Redis命令文件失败: %v", err)
+	// 按DB生成Redis命令文件
+	var redisFiles []string
+	commandCounts := make(map[string]int)
+	for _, target := range hm.config.LockUserRedisKeys {
+		redisContent, count := hm.generateLockUserRedis(userIds, target.Templates)
+		redisFile := filepath.Join(state.UserDir, fmt.Sprintf("lockUser-redis_db%d.txt", target.DB))
+		err = hm.writeStringToFile(redisFile, redisContent)
+		if err != nil {
+			return fmt.Errorf("写入Redis命令文件失败: %v", err)
+		}
+		redisFiles = append(redisFiles, redisFile)
+		commandCounts[redisFile] = count
 	}
 
 	// 发送SQL文件
-	hm.sendResultFile(chatID, sqlFile, fmt.Sprintf("✅ 用户锁定SQL文件生成完成！\n👤 处理了 %d 个用户", len(userIds)))
+	hm.deliverResult(chatID, state, sqlFile, fmt.Sprintf("✅ 用户锁定SQL文件生成完成！\n👤 处理了 %d 个用户", len(lockIds)))
+	if report != nil {
+		if err := hm.deliverSnapshotReport(chatID, state, report); err != nil {
+			return err
+		}
+	}
 
-	// 发送Redis文件
-	hm.sendResultFile(chatID, redisFile, fmt.Sprintf("✅ Redis删除命令文件生成完成！\n🗑️ 包含 %d 条删除命令", len(userIds)))
+	// 按DB发送Redis文件
+	for i, redisFile := range redisFiles {
+		target := hm.config.LockUserRedisKeys[i]
+		hm.deliverResult(chatID, state, redisFile, fmt.Sprintf("✅ Redis删除命令文件生成完成！\n🗄️ DB %d\n🔑 Key模板: %s\n🗑️ 包含 %d 条删除命令",
+			target.DB, strings.Join(target.Templates, ", "), commandCounts[redisFile]))
+	}
 
 	return nil
 }
@@ -93,16 +134,10 @@ func (hm *HandlerManager) generateLockUserSQL(userIds []string) string {
 	return strings.Join(sqlStatements, "\n")
 }
 
-// generateLockUserRedis 生成用户Redis删除命令
-func (hm *HandlerManager) generateLockUserRedis(userIds []string) string {
-	var redisCommands []string
-
-	for _, userId := range userIds {
-		command := fmt.Sprintf("del %s", userId)
-		redisCommands = append(redisCommands, command)
-	}
-
-	return strings.Join(redisCommands, "\n")
+// generateLockUserRedis 按key模板生成用户Redis删除命令，同一用户的命令相邻，返回命令内容和条数
+func (hm *HandlerManager) generateLockUserRedis(userIds []string, templates []string) (string, int) {
+	redisCommands := rediskey.DelCommands(templates, userIds)
+	return strings.Join(redisCommands, "\n"), len(redisCommands)
 }
 
 // writeStringToFile 将字符串写入文件
@@ -115,4 +150,4 @@ func (hm *HandlerManager) writeStringToFile(filePath, content string) error {
 
 	_, err = file.WriteString(content)
 	return err
-}
\ No newline at end of file
+}
@@ -5,6 +5,9 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"shared/audit"
+	"shared/configloader"
+	"strings"
 	"syscall"
 	"tgbot/config"
 	"tgbot/handlers"
@@ -15,8 +18,21 @@ import (
 )
 
 func main() {
-	// 加载配置
-	cfg := config.LoadConfig()
+	// 加载配置：默认值 → 配置文件 → 环境变量 → 命令行参数，配置错误或缺少 Token 时拒绝启动
+	cfg, result, err := config.LoadConfig(os.Args[1:])
+	if configloader.IsHelp(err) {
+		return
+	}
+	if result != nil && result.PrintConfig {
+		configloader.Print(os.Stdout, cfg, result)
+		if err != nil {
+			log.Fatalf("配置无效: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
 
 	// 初始化日志系统
 	logConfig := utils.LogConfig{
@@ -71,8 +87,59 @@ func main() {
 		logger.Info("系统关闭：文件清理完成", slog.String("timestamp", time.Now().Format(time.RFC3339)))
 	}()
 
+	// 加载用户白名单和角色权限
+	access, err := config.LoadAccessControl(cfg.AccessFile, cfg.AdminUsers, cfg.AllowedUsers)
+	if err != nil {
+		logger.Error("加载访问控制失败", slog.String("error", err.Error()))
+		log.Fatalf("加载访问控制失败: %v", err)
+	}
+	if len(access.AdminIDs()) == 0 {
+		logger.Warn("未配置管理员，无法在运行时添加用户，请设置 ADMIN_USERS")
+	}
+	logger.Info("访问控制已加载",
+		slog.String("access_file", cfg.AccessFile),
+		slog.Int("users", len(access.Users())),
+		slog.Int("admins", len(access.AdminIDs())),
+	)
+
+	// 审批记录和审计日志
+	approvals, err := utils.NewApprovalStore(cfg.ApprovalDir)
+	if err != nil {
+		logger.Error("加载审批记录失败", slog.String("error", err.Error()))
+		log.Fatalf("加载审批记录失败: %v", err)
+	}
+	auditLog, err := audit.Open(cfg.AuditFile)
+	if err != nil {
+		logger.Error("打开审计日志失败", slog.String("error", err.Error()))
+		log.Fatalf("打开审计日志失败: %v", err)
+	}
+	defer auditLog.Close()
+	if count, err := auditLog.Verify(); err != nil {
+		logger.Warn("审计日志校验失败", slog.Int64("verified", count), slog.String("error", err.Error()))
+	}
+	if cfg.Approval {
+		logger.Info("双人审批已启用", slog.String("commands", strings.Join(cfg.ApprovalCommands, ",")))
+	}
+
+	// 历史任务，定期清理过期的文件
+	history, err := utils.NewHistoryStore(cfg.HistoryDir, cfg.HistoryTTL, cfg.HistoryQuota)
+	if err != nil {
+		logger.Error("加载历史任务失败", slog.String("error", err.Error()))
+		log.Fatalf("加载历史任务失败: %v", err)
+	}
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			removed, err := history.Cleanup()
+			if err != nil {
+				logger.Error("清理历史任务失败", slog.String("error", err.Error()))
+			} else if removed > 0 {
+				logger.Info("已清理过期的历史任务", slog.Int("count", removed))
+			}
+		}
+	}()
+
 	// 创建处理器管理器
-	handlerManager := handlers.NewHandlerManager(bot, cfg, fileManager, logger)
+	handlerManager := handlers.NewHandlerManager(bot, cfg, fileManager, logger, access, approvals, auditLog, history)
 
 	// 设置更新配置
 	u := tgbotapi.NewUpdate(0)
@@ -121,4 +188,4 @@ func main() {
 			handlerManager.HandleUpdate(update)
 		}(update)
 	}
-}
\ No newline at end of file
+}
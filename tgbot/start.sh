@@ -2,10 +2,10 @@
 
 # Telegram Bot 启动脚本
 
-# 检查BOT_TOKEN环境变量
-if [ -z "$BOT_TOKEN" ]; then
-    echo "❌ 错误: BOT_TOKEN 环境变量未设置"
-    echo "请运行: export BOT_TOKEN='你的Bot Token'"
+# 检查Bot Token，可以通过环境变量、Token文件或配置文件提供
+if [ -z "$BOT_TOKEN" ] && [ -z "$BOT_TOKEN_FILE" ] && [ -z "$TGBOT_CONFIG" ] && [ ! -f tgbot.yaml ] && [ ! -f tgbot.toml ]; then
+    echo "❌ 错误: 未配置 Bot Token"
+    echo "请运行: export BOT_TOKEN='你的Bot Token'，或设置 BOT_TOKEN_FILE / 创建 tgbot.yaml"
     exit 1
 fi
 
@@ -16,10 +16,9 @@ fi
 
 echo "🤖 启动Telegram数据处理Bot..."
 echo "📂 临时目录: $TEMP_DIR"
-echo "🔑 Bot Token: ${BOT_TOKEN:0:10}..."
 
 # 创建临时目录
 mkdir -p "$TEMP_DIR"
 
 # 启动Bot
-go run main.go
\ No newline at end of file
+go run . "$@"
\ No newline at end of file
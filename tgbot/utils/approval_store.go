@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shared/review"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 审批状态
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ErrApprovalNotFound 审批不存在
+var ErrApprovalNotFound = errors.New("审批不存在")
+
+// ApprovalFile 等待审批的输出文件
+type ApprovalFile struct {
+	Path    string `json:"path"`
+	Caption string `json:"caption"`
+}
+
+// Approval 等待审批的输出包
+type Approval struct {
+	ID          int64           `json:"id"`
+	Command     string          `json:"command"`
+	SubmittedBy int64           `json:"submitted_by"`
+	Submitter   string          `json:"submitter"`
+	ChatID      int64           `json:"chat_id"`
+	Files       []ApprovalFile  `json:"files"`
+	Summary     *review.Summary `json:"summary"`
+	Status      string          `json:"status"`
+	ReviewedBy  int64           `json:"reviewed_by,omitempty"`
+	Reviewer    string          `json:"reviewer,omitempty"`
+	ReviewedAt  *time.Time      `json:"reviewed_at,omitempty"`
+	Comment     string          `json:"comment,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// approvalFile 审批记录文件格式
+type approvalFile struct {
+	NextID    int64       `json:"next_id"`
+	Approvals []*Approval `json:"approvals"`
+}
+
+// ApprovalStore 审批记录，保存在 dir/approvals.json，输出文件保存在 dir/<审批ID>/ 下
+type ApprovalStore struct {
+	mu        sync.Mutex
+	dir       string
+	nextID    int64
+	approvals map[int64]*Approval
+}
+
+// NewApprovalStore 打开审批目录并加载已有记录
+func NewApprovalStore(dir string) (*ApprovalStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建审批目录失败: %v", err)
+	}
+	s := &ApprovalStore{dir: dir, nextID: 1, approvals: make(map[int64]*Approval)}
+
+	data, err := os.ReadFile(s.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取审批记录失败: %v", err)
+	}
+	var file approvalFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析审批记录失败: %v", err)
+	}
+	for _, a := range file.Approvals {
+		s.approvals[a.ID] = a
+	}
+	if file.NextID > s.nextID {
+		s.nextID = file.NextID
+	}
+	return s, nil
+}
+
+// indexPath 审批记录文件路径
+func (s *ApprovalStore) indexPath() string {
+	return filepath.Join(s.dir, "approvals.json")
+}
+
+// Create 保存新的审批，将输出文件复制到审批目录（原文件所在的用户目录会在处理结束后清理）
+func (s *ApprovalStore) Create(a *Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a.ID = s.nextID
+	a.Status = ApprovalPending
+	a.CreatedAt = time.Now()
+
+	dir := filepath.Join(s.dir, fmt.Sprint(a.ID))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建审批目录失败: %v", err)
+	}
+	files := make([]ApprovalFile, len(a.Files))
+	for i, f := range a.Files {
+		dest := filepath.Join(dir, filepath.Base(f.Path))
+		if err := copyFile(f.Path, dest); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		files[i] = ApprovalFile{Path: dest, Caption: f.Caption}
+	}
+	a.Files = files
+
+	s.nextID++
+	s.approvals[a.ID] = a
+	if err := s.save(); err != nil {
+		delete(s.approvals, a.ID)
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// Get 获取审批副本
+func (s *ApprovalStore) Get(id int64) (*Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.approvals[id]
+	if !ok {
+		return nil, ErrApprovalNotFound
+	}
+	clone := *a
+	return &clone, nil
+}
+
+// Decide 记录审批结果，只有待审批的记录可以修改，返回修改后的副本
+// check 在锁内执行，返回错误时不修改记录，用于校验审批人
+func (s *ApprovalStore) Decide(id int64, status string, reviewer int64, reviewerName, comment string, check func(a *Approval) error) (*Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.approvals[id]
+	if !ok {
+		return nil, ErrApprovalNotFound
+	}
+	if a.Status != ApprovalPending {
+		return nil, fmt.Errorf("审批 #%d 已处理（%s）", id, a.Status)
+	}
+	if err := check(a); err != nil {
+		return nil, err
+	}
+
+	updated := *a
+	now := time.Now()
+	updated.Status = status
+	updated.ReviewedBy = reviewer
+	updated.Reviewer = reviewerName
+	updated.ReviewedAt = &now
+	updated.Comment = comment
+	s.approvals[id] = &updated
+	if err := s.save(); err != nil {
+		s.approvals[id] = a
+		return nil, err
+	}
+	clone := updated
+	return &clone, nil
+}
+
+// Pending 返回按编号排序的待审批记录
+func (s *ApprovalStore) Pending() []*Approval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*Approval
+	for _, a := range s.approvals {
+		if a.Status == ApprovalPending {
+			clone := *a
+			result = append(result, &clone)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// RemoveFiles 删除审批的输出文件，审批被拒绝后调用
+func (s *ApprovalStore) RemoveFiles(id int64) error {
+	return os.RemoveAll(filepath.Join(s.dir, fmt.Sprint(id)))
+}
+
+// save 写入审批记录，先写临时文件再重命名，调用方需持有锁
+func (s *ApprovalStore) save() error {
+	file := approvalFile{NextID: s.nextID}
+	for _, a := range s.approvals {
+		file.Approvals = append(file.Approvals, a)
+	}
+	sort.Slice(file.Approvals, func(i, j int) bool { return file.Approvals[i].ID < file.Approvals[j].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化审批记录失败: %v", err)
+	}
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入审批记录失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.indexPath()); err != nil {
+		return fmt.Errorf("保存审批记录失败: %v", err)
+	}
+	return nil
+}
+
+// copyFile 复制文件
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("打开源文件失败: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("创建目标文件失败: %v", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("复制文件失败: %v", err)
+	}
+	return out.Close()
+}
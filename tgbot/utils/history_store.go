@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrHistoryNotFound 历史任务不存在或已过期
+var ErrHistoryNotFound = errors.New("历史任务不存在或已过期")
+
+// HistoryFile 历史任务保存的文件
+type HistoryFile struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Caption string `json:"caption,omitempty"`
+	Size    int64  `json:"size"`
+}
+
+// HistoryJob 用户的一次处理记录，保存输入文件和输出文件，用于重新下载和重新执行
+type HistoryJob struct {
+	ID         int64         `json:"id"`
+	UserID     int64         `json:"user_id"`
+	Command    string        `json:"command"`
+	Args       string        `json:"args,omitempty"` // 命令参数，重新执行时使用相同的参数
+	Input      HistoryFile   `json:"input"`
+	Outputs    []HistoryFile `json:"outputs"`
+	ApprovalID int64         `json:"approval_id,omitempty"` // 需要审批的任务，审批通过后才能重新下载
+	Size       int64         `json:"size"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// ExpiresAt 返回历史任务的过期时间
+func (j *HistoryJob) ExpiresAt(ttl time.Duration) time.Time {
+	return j.CreatedAt.Add(ttl)
+}
+
+// historyFile 历史记录文件格式
+type historyFile struct {
+	NextID int64         `json:"next_id"`
+	Jobs   []*HistoryJob `json:"jobs"`
+}
+
+// HistoryStore 用户历史任务，记录保存在 dir/history.json，文件保存在 dir/<用户ID>/<任务ID>/ 下
+// 超过 ttl 的任务会被清理；每个用户占用的空间不超过 quota，超出时删除该用户最早的任务
+type HistoryStore struct {
+	mu     sync.Mutex
+	dir    string
+	ttl    time.Duration
+	quota  int64
+	nextID int64
+	jobs   map[int64]*HistoryJob
+}
+
+// NewHistoryStore 打开历史目录并加载已有记录
+func NewHistoryStore(dir string, ttl time.Duration, quota int64) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建历史目录失败: %v", err)
+	}
+	s := &HistoryStore{dir: dir, ttl: ttl, quota: quota, nextID: 1, jobs: make(map[int64]*HistoryJob)}
+
+	data, err := os.ReadFile(s.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %v", err)
+	}
+	var file historyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析历史记录失败: %v", err)
+	}
+	for _, j := range file.Jobs {
+		s.jobs[j.ID] = j
+	}
+	if file.NextID > s.nextID {
+		s.nextID = file.NextID
+	}
+	return s, nil
+}
+
+// TTL 返回历史任务的保留时间
+func (s *HistoryStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Quota 返回每个用户的空间上限
+func (s *HistoryStore) Quota() int64 {
+	return s.quota
+}
+
+// indexPath 历史记录文件路径
+func (s *HistoryStore) indexPath() string {
+	return filepath.Join(s.dir, "history.json")
+}
+
+// jobDir 历史任务的文件目录
+func (s *HistoryStore) jobDir(j *HistoryJob) string {
+	return filepath.Join(s.dir, fmt.Sprint(j.UserID), fmt.Sprint(j.ID))
+}
+
+// Add 保存新的历史任务，将输入和输出文件复制到历史目录（原文件所在的用户目录会在处理结束后清理）
+// 用户空间不足时按时间顺序删除该用户最早的任务，返回被删除的任务；单个任务超过上限时不保存
+func (s *HistoryStore) Add(j *HistoryJob) ([]*HistoryJob, error) {
+	size := j.Input.Size
+	for _, f := range j.Outputs {
+		size += f.Size
+	}
+	if size > s.quota {
+		return nil, fmt.Errorf("文件总大小 %s 超过历史空间上限 %s", FormatFileSize(size), FormatFileSize(s.quota))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j.ID = s.nextID
+	j.Size = size
+	j.CreatedAt = time.Now()
+
+	dir := s.jobDir(j)
+	if err := os.MkdirAll(filepath.Join(dir, "input"), 0700); err != nil {
+		return nil, fmt.Errorf("创建历史目录失败: %v", err)
+	}
+	// 输入文件单独放在 input 子目录，避免和同名的输出文件冲突
+	input := j.Input
+	input.Path = filepath.Join(dir, "input", input.Name)
+	if err := copyFile(j.Input.Path, input.Path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	j.Input = input
+	outputs := make([]HistoryFile, len(j.Outputs))
+	for i, f := range j.Outputs {
+		f.Path = filepath.Join(dir, f.Name)
+		if err := copyFile(j.Outputs[i].Path, f.Path); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		outputs[i] = f
+	}
+	j.Outputs = outputs
+
+	evicted := s.evict(j.UserID, s.quota-size)
+	s.nextID++
+	s.jobs[j.ID] = j
+	if err := s.save(); err != nil {
+		delete(s.jobs, j.ID)
+		os.RemoveAll(dir)
+		return evicted, err
+	}
+	return evicted, nil
+}
+
+// evict 删除用户最早的任务，直到占用空间不超过 limit，调用方需持有锁
+func (s *HistoryStore) evict(userID int64, limit int64) []*HistoryJob {
+	jobs := s.userJobs(userID)
+	var used int64
+	for _, j := range jobs {
+		used += j.Size
+	}
+
+	var evicted []*HistoryJob
+	// jobs 按时间倒序，从最早的开始删除
+	for i := len(jobs) - 1; i >= 0 && used > limit; i-- {
+		used -= jobs[i].Size
+		s.remove(jobs[i])
+		evicted = append(evicted, jobs[i])
+	}
+	return evicted
+}
+
+// remove 删除任务记录和文件，调用方需持有锁
+func (s *HistoryStore) remove(j *HistoryJob) {
+	delete(s.jobs, j.ID)
+	os.RemoveAll(s.jobDir(j))
+}
+
+// userJobs 返回用户未过期的任务，按时间倒序，调用方需持有锁
+func (s *HistoryStore) userJobs(userID int64) []*HistoryJob {
+	now := time.Now()
+	var result []*HistoryJob
+	for _, j := range s.jobs {
+		if j.UserID == userID && now.Before(j.ExpiresAt(s.ttl)) {
+			result = append(result, j)
+		}
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].ID > result[b].ID })
+	return result
+}
+
+// List 返回用户最近的任务副本，按时间倒序，limit <= 0 时返回全部
+func (s *HistoryStore) List(userID int64, limit int) []*HistoryJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := s.userJobs(userID)
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	result := make([]*HistoryJob, len(jobs))
+	for i, j := range jobs {
+		clone := *j
+		result[i] = &clone
+	}
+	return result
+}
+
+// Usage 返回用户当前占用的空间
+func (s *HistoryStore) Usage(userID int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var used int64
+	for _, j := range s.userJobs(userID) {
+		used += j.Size
+	}
+	return used
+}
+
+// Get 获取未过期的任务副本
+func (s *HistoryStore) Get(id int64) (*HistoryJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || !time.Now().Before(j.ExpiresAt(s.ttl)) {
+		return nil, ErrHistoryNotFound
+	}
+	clone := *j
+	return &clone, nil
+}
+
+// Cleanup 删除过期的任务，返回删除的数量
+func (s *HistoryStore) Cleanup() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	removed := 0
+	for _, j := range s.jobs {
+		if !now.Before(j.ExpiresAt(s.ttl)) {
+			s.remove(j)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save()
+}
+
+// save 写入历史记录，先写临时文件再重命名，调用方需持有锁
+func (s *HistoryStore) save() error {
+	file := historyFile{NextID: s.nextID}
+	for _, j := range s.jobs {
+		file.Jobs = append(file.Jobs, j)
+	}
+	sort.Slice(file.Jobs, func(a, b int) bool { return file.Jobs[a].ID < file.Jobs[b].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化历史记录失败: %v", err)
+	}
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入历史记录失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.indexPath()); err != nil {
+		return fmt.Errorf("保存历史记录失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addJob 保存一个输入 10 字节、输出 size-10 字节的任务
+func addJob(t *testing.T, s *HistoryStore, userID int64, size int) ([]*HistoryJob, error) {
+	t.Helper()
+	src := t.TempDir()
+	input := filepath.Join(src, "uids.csv")
+	output := filepath.Join(src, "result.sql")
+	if err := os.WriteFile(input, []byte(strings.Repeat("1", 10)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte(strings.Repeat("2", size-10)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return s.Add(&HistoryJob{
+		UserID:  userID,
+		Command: "lockuser",
+		Input:   HistoryFile{Name: "uids.csv", Path: input, Size: 10},
+		Outputs: []HistoryFile{{Name: "result.sql", Path: output, Size: int64(size - 10)}},
+	})
+}
+
+// jobIDs 返回任务编号
+func jobIDs(jobs []*HistoryJob) []int64 {
+	ids := make([]int64, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return ids
+}
+
+func TestHistoryQuotaEviction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewHistoryStore(dir, time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, userID := range []int64{1, 1, 2} {
+		if evicted, err := addJob(t, s, userID, 40); err != nil || len(evicted) != 0 {
+			t.Fatalf("Add = %v, %v", jobIDs(evicted), err)
+		}
+	}
+	// 用户 1 已占用 80 字节，再保存 40 字节时删除最早的任务 #1，其他用户的任务不受影响
+	evicted, err := addJob(t, s, 1, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(evicted); len(got) != 1 || got[0] != 1 {
+		t.Errorf("删除的任务 = %v, want [1]", got)
+	}
+	if got := jobIDs(s.List(1, 0)); len(got) != 2 || got[0] != 4 || got[1] != 2 {
+		t.Errorf("用户 1 的任务 = %v, want [4 2]", got)
+	}
+	if got := s.Usage(1); got != 80 {
+		t.Errorf("用户 1 占用 = %d, want 80", got)
+	}
+	if got := s.Usage(2); got != 40 {
+		t.Errorf("用户 2 占用 = %d, want 40", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1", "1")); !os.IsNotExist(err) {
+		t.Errorf("被删除任务的文件仍然存在: %v", err)
+	}
+
+	// 单个任务超过上限时不保存，也不删除已有任务
+	if _, err := addJob(t, s, 1, 101); err == nil {
+		t.Error("超过上限的任务应返回错误")
+	}
+	if got := s.Usage(1); got != 80 {
+		t.Errorf("保存失败后用户 1 占用 = %d, want 80", got)
+	}
+
+	// 重新打开后保留记录和编号
+	reopened, err := NewHistoryStore(dir, time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(reopened.List(1, 1)); len(got) != 1 || got[0] != 4 {
+		t.Errorf("重新打开后用户 1 最近的任务 = %v, want [4]", got)
+	}
+	if _, err := addJob(t, reopened, 2, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(reopened.List(2, 1)); got[0] != 5 {
+		t.Errorf("重新打开后的新任务编号 = %v, want 5", got)
+	}
+}
+
+func TestHistoryTTL(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewHistoryStore(dir, time.Hour, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := addJob(t, s, 1, 40); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 任务 #1 已超过保留时间
+	s.mu.Lock()
+	s.jobs[1].CreatedAt = time.Now().Add(-2 * time.Hour)
+	s.mu.Unlock()
+
+	if _, err := s.Get(1); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("过期任务 Get = %v", err)
+	}
+	if _, err := s.Get(2); err != nil {
+		t.Errorf("未过期任务 Get = %v", err)
+	}
+	if got := jobIDs(s.List(1, 0)); len(got) != 1 || got[0] != 2 {
+		t.Errorf("List = %v, want [2]", got)
+	}
+	// 过期任务不计入占用空间
+	if got := s.Usage(1); got != 40 {
+		t.Errorf("Usage = %d, want 40", got)
+	}
+
+	removed, err := s.Cleanup()
+	if err != nil || removed != 1 {
+		t.Fatalf("Cleanup = %d, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1", "1")); !os.IsNotExist(err) {
+		t.Errorf("过期任务的文件仍然存在: %v", err)
+	}
+	reopened, err := NewHistoryStore(dir, time.Hour, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.jobs) != 1 {
+		t.Errorf("清理后重新打开的任务数 = %d, want 1", len(reopened.jobs))
+	}
+}
@@ -0,0 +1,76 @@
+// Package api WebBot /api/v1 接口的请求和响应结构，服务端和 Go 客户端共用
+package api
+
+import "time"
+
+// 任务状态
+const (
+	StatusPending    = "pending"
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// 审批状态
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Job 任务
+type Job struct {
+	ID            string            `json:"id"`
+	Function      string            `json:"function"`
+	Status        string            `json:"status"` // pending, queued, processing, completed, failed
+	Progress      int               `json:"progress"`
+	Message       string            `json:"message"`
+	Params        map[string]string `json:"params,omitempty"`
+	Snapshot      bool              `json:"snapshot,omitempty"` // 是否附带了数据库当前状态快照
+	SubmittedBy   string            `json:"submitted_by"`
+	QueuePosition int               `json:"queue_position,omitempty"` // 仅 queued 状态返回
+	Approval      string            `json:"approval,omitempty"`       // 需要审批的功能才有: pending, approved, rejected
+	Downloadable  bool              `json:"downloadable"`             // 结果是否可以下载：已完成且不需要审批或已审批通过
+	CreatedAt     time.Time         `json:"created_at"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	FinishedAt    *time.Time        `json:"finished_at,omitempty"`
+}
+
+// Finished 任务是否已结束（完成或失败），需要审批的任务完成后还要等待审批才能下载
+func (j *Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// Artifact 任务的输出文件
+type Artifact struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"` // 下载地址，相对于服务根地址
+}
+
+// ArtifactList 输出文件列表
+type ArtifactList struct {
+	JobID     string     `json:"job_id"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// File JSON 请求体中的文件，content 为 base64 编码的文件内容
+type File struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+}
+
+// CreateJobRequest 以 JSON 请求体创建任务
+// 参数与网页表单相同，例如 filesplit 的 split_mode，完整列表见 /api/v1/openapi.json
+type CreateJobRequest struct {
+	Function string            `json:"function"`
+	Params   map[string]string `json:"params,omitempty"`
+	Files    []File            `json:"files"`
+	Snapshot *File             `json:"snapshot,omitempty"` // lockuser/kycreview 对照的数据库当前状态快照（CSV）
+}
+
+// Error 错误响应
+type Error struct {
+	Error string `json:"error"`
+}
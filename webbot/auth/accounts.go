@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RoleAdmin 管理员角色，可以查看所有用户的任务
+const RoleAdmin = "admin"
+
+// AllFunctions 角色配置中表示全部功能的通配符
+const AllFunctions = "*"
+
+// ErrInvalidCredentials 用户名或密码错误
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+// User 已登录的用户
+type User struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles"`
+}
+
+// DisplayName 返回用于页面显示的名称
+func (u *User) DisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Username
+}
+
+// HasRole 判断用户是否拥有指定角色
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin 判断用户是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.HasRole(RoleAdmin)
+}
+
+// account 账户文件中的单个用户，password_hash 为空的用户只能通过 OIDC 登录
+// oidc_subject 为身份提供方 ID token 中的 sub，OIDC 登录只按 sub 关联本地账户；
+// api_tokens 用于脚本调用 /api/v1 接口，与密码登录互相独立
+type account struct {
+	Username     string     `json:"username"`
+	Name         string     `json:"name"`
+	PasswordHash string     `json:"password_hash"`
+	OIDCSubject  string     `json:"oidc_subject"`
+	Roles        []string   `json:"roles"`
+	APITokens    []apiToken `json:"api_tokens"`
+}
+
+// accountsFile 账户文件格式
+type accountsFile struct {
+	Roles map[string][]string `json:"roles"`
+	Users []account           `json:"users"`
+}
+
+// Accounts 本地账户和角色权限
+type Accounts struct {
+	roles    map[string][]string // 角色 -> 可使用的功能ID
+	users    map[string]account
+	subjects map[string]string     // OIDC sub -> 用户名
+	tokens   map[string]tokenOwner // API token 哈希 -> 所属用户
+}
+
+// LoadAccounts 从 JSON 文件加载账户和角色配置
+func LoadAccounts(path string) (*Accounts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取账户文件失败: %v", err)
+	}
+
+	var file accountsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析账户文件失败: %v", err)
+	}
+
+	accounts := &Accounts{
+		roles:    file.Roles,
+		users:    make(map[string]account),
+		subjects: make(map[string]string),
+		tokens:   make(map[string]tokenOwner),
+	}
+	if accounts.roles == nil {
+		accounts.roles = make(map[string][]string)
+	}
+
+	for _, a := range file.Users {
+		a.Username = strings.TrimSpace(a.Username)
+		if a.Username == "" {
+			return nil, fmt.Errorf("账户文件中存在空用户名")
+		}
+		if _, ok := accounts.users[a.Username]; ok {
+			return nil, fmt.Errorf("用户名重复: %s", a.Username)
+		}
+		if strings.HasPrefix(a.Username, OIDCUserPrefix) {
+			return nil, fmt.Errorf("用户名不能以 %s 开头: %s", OIDCUserPrefix, a.Username)
+		}
+		for _, role := range a.Roles {
+			if _, ok := accounts.roles[role]; !ok && role != RoleAdmin {
+				return nil, fmt.Errorf("用户 %s 的角色 %s 未定义", a.Username, role)
+			}
+		}
+		if a.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(a.PasswordHash)); err != nil {
+				return nil, fmt.Errorf("用户 %s 的密码哈希无效: %v", a.Username, err)
+			}
+		}
+		if a.OIDCSubject = strings.TrimSpace(a.OIDCSubject); a.OIDCSubject != "" {
+			if other, ok := accounts.subjects[a.OIDCSubject]; ok {
+				return nil, fmt.Errorf("用户 %s 和 %s 的 oidc_subject 重复", other, a.Username)
+			}
+			accounts.subjects[a.OIDCSubject] = a.Username
+		}
+		if err := accounts.addTokens(a); err != nil {
+			return nil, err
+		}
+		accounts.users[a.Username] = a
+	}
+	return accounts, nil
+}
+
+// Authenticate 校验本地账户的用户名和密码
+func (a *Accounts) Authenticate(username, password string) (*User, error) {
+	acc, ok := a.users[username]
+	if !ok || acc.PasswordHash == "" {
+		// 用户不存在时也做一次比较，避免通过响应时间判断用户名是否存在
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(acc.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &User{Username: acc.Username, Name: acc.Name, Roles: acc.Roles}, nil
+}
+
+// dummyHash 用于不存在的用户的密码比较
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("webbot-dummy-password"), bcrypt.DefaultCost)
+
+// OIDCUserPrefix 未关联本地账户的 OIDC 用户名前缀，后接 ID token 中的 sub
+const OIDCUserPrefix = "oidc:"
+
+// ExternalUser 根据 OIDC 登录信息生成用户，角色取身份提供方返回的组中已定义的角色
+// sub 与账户文件中 oidc_subject 一致时使用该本地账户的用户名并合并其角色；
+// 没有关联时用户名为 "oidc:" + sub，preferred_username 等 claim 可以由用户自行修改，只作为显示名称，
+// 不用于关联本地账户或区分任务归属，避免两个身份设置相同的名称后共享任务和文件
+func (a *Accounts) ExternalUser(subject, username, name string, groups []string) *User {
+	user := &User{Username: OIDCUserPrefix + subject, Name: name}
+	seen := make(map[string]bool)
+	addRole := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			user.Roles = append(user.Roles, role)
+		}
+	}
+
+	for _, group := range groups {
+		if _, ok := a.roles[group]; ok || group == RoleAdmin {
+			addRole(group)
+		}
+	}
+
+	local, linked := a.subjects[subject]
+	if !linked {
+		if user.Name == "" {
+			user.Name = username
+		}
+		return user
+	}
+	acc := a.users[local]
+	user.Username = acc.Username
+	for _, role := range acc.Roles {
+		addRole(role)
+	}
+	if user.Name == "" {
+		user.Name = acc.Name
+	}
+	return user
+}
+
+// CanRun 判断用户是否可以使用指定功能
+func (a *Accounts) CanRun(user *User, functionID string) bool {
+	if user == nil {
+		return false
+	}
+	for _, role := range user.Roles {
+		for _, f := range a.roles[role] {
+			if f == AllFunctions || f == functionID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HashPassword 生成 bcrypt 密码哈希，用于填写账户文件
+func HashPassword(password string) (string, error) {
+	if len(password) < 8 {
+		return "", fmt.Errorf("密码长度至少 8 位")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
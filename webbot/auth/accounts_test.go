@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestAccounts 加载测试用的账户文件
+func loadTestAccounts(t *testing.T, content string) (*Accounts, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadAccounts(path)
+}
+
+func TestExternalUser(t *testing.T) {
+	accounts, err := loadTestAccounts(t, `{
+		"roles": {"ops": ["*"], "analyst": ["logparse"]},
+		"users": [
+			{"username": "admin", "roles": ["admin", "ops"]},
+			{"username": "bob", "name": "Bob", "oidc_subject": "sub-bob", "roles": ["ops"]}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// preferred_username 与本地管理员同名但 sub 没有关联，不能继承管理员的用户名和角色
+	user := accounts.ExternalUser("sub-mallory", "admin", "", []string{"analyst"})
+	if user.Username != "oidc:sub-mallory" || user.Name != "admin" || user.IsAdmin() {
+		t.Errorf("同名未关联用户 = %+v", user)
+	}
+
+	// 按 sub 关联本地账户，使用本地用户名并合并角色
+	user = accounts.ExternalUser("sub-bob", "bob.renamed", "", []string{"analyst", "unknown"})
+	if user.Username != "bob" || user.Name != "Bob" || len(user.Roles) != 2 || user.Roles[0] != "analyst" || user.Roles[1] != "ops" {
+		t.Errorf("关联用户 = %+v", user)
+	}
+
+	// 没有关联的用户只有用户组中已定义的角色
+	user = accounts.ExternalUser("sub-carol", "carol", "Carol", []string{"analyst", "unknown"})
+	if user.Username != "oidc:sub-carol" || user.Name != "Carol" || len(user.Roles) != 1 || user.Roles[0] != "analyst" || user.IsAdmin() {
+		t.Errorf("未关联用户 = %+v", user)
+	}
+}
+
+// 两个未关联的身份设置相同的 preferred_username 时仍是不同的用户
+func TestExternalUserSameUsername(t *testing.T) {
+	accounts, err := loadTestAccounts(t, `{"roles": {"analyst": ["logparse"]}, "users": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := accounts.ExternalUser("sub-1", "carol", "", []string{"analyst"})
+	second := accounts.ExternalUser("sub-2", "carol", "", []string{"analyst"})
+	if first.Username == second.Username {
+		t.Errorf("不同 sub 的用户名相同: %s", first.Username)
+	}
+	if first.DisplayName() != "carol" || second.DisplayName() != "carol" {
+		t.Errorf("显示名称 = %s, %s", first.DisplayName(), second.DisplayName())
+	}
+}
+
+func TestLoadAccountsRejectsOIDCPrefix(t *testing.T) {
+	_, err := loadTestAccounts(t, `{"roles": {"ops": ["*"]}, "users": [{"username": "oidc:sub-1", "roles": ["ops"]}]}`)
+	if err == nil || !strings.Contains(err.Error(), "oidc:") {
+		t.Errorf("oidc: 前缀的本地用户名 err = %v", err)
+	}
+}
+
+func TestLoadAccountsDuplicateSubject(t *testing.T) {
+	_, err := loadTestAccounts(t, `{
+		"roles": {"ops": ["*"]},
+		"users": [
+			{"username": "a", "oidc_subject": "same", "roles": ["ops"]},
+			{"username": "b", "oidc_subject": "same", "roles": ["ops"]}
+		]
+	}`)
+	if err == nil {
+		t.Error("oidc_subject 重复时应返回错误")
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig OIDC 身份提供方配置
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	RolesClaim   string // 包含用户组的 claim，默认 groups
+}
+
+// OIDCProvider OIDC 登录
+type OIDCProvider struct {
+	oauth      oauth2.Config
+	verifier   *oidc.IDTokenVerifier
+	rolesClaim string
+}
+
+// OIDCIdentity 从 ID token 中解析出的用户信息
+type OIDCIdentity struct {
+	Subject  string // sub，身份提供方中不可修改的用户标识
+	Username string
+	Name     string
+	Groups   []string
+}
+
+// NewOIDCProvider 通过 issuer 的发现文档初始化 OIDC 登录
+func NewOIDCProvider(ctx context.Context, cfg OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("获取 OIDC 配置失败: %v", err)
+	}
+
+	rolesClaim := cfg.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "groups"
+	}
+
+	return &OIDCProvider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier:   provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		rolesClaim: rolesClaim,
+	}, nil
+}
+
+// AuthCodeURL 返回跳转到身份提供方的登录地址
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange 用授权码换取 ID token 并校验签名和 nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*OIDCIdentity, error) {
+	token, err := p.oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("获取 token 失败: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("响应中缺少 id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("校验 id_token 失败: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("id_token nonce 不匹配")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析 id_token 失败: %v", err)
+	}
+
+	identity := &OIDCIdentity{
+		Subject:  idToken.Subject,
+		Username: claimString(claims, "preferred_username"),
+		Name:     claimString(claims, "name"),
+	}
+	if identity.Username == "" {
+		identity.Username = claimString(claims, "email")
+	}
+	if identity.Username == "" {
+		identity.Username = idToken.Subject
+	}
+	if groups, ok := claims[p.rolesClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// claimString 读取字符串类型的 claim
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
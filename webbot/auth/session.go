@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// Session 登录会话
+type Session struct {
+	ID        string
+	CSRFToken string
+	User      *User
+	ExpiresAt time.Time
+}
+
+// ValidCSRF 校验请求携带的 CSRF token
+func (s *Session) ValidCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.CSRFToken)) == 1
+}
+
+// SessionStore 内存会话存储，服务重启后需要重新登录
+type SessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*Session
+}
+
+// NewSessionStore 创建会话存储，ttl 为会话有效期
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		ttl:      ttl,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// TTL 返回会话有效期
+func (s *SessionStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create 为用户创建新会话
+func (s *SessionStore) Create(user *User) *Session {
+	session := &Session{
+		ID:        RandomToken(),
+		CSRFToken: RandomToken(),
+		User:      user,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired()
+	s.sessions[session.ID] = session
+	return session
+}
+
+// Get 返回有效的会话，不存在或已过期时返回 nil
+func (s *SessionStore) Get(id string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil
+	}
+	return session
+}
+
+// Delete 删除会话
+func (s *SessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// removeExpired 清理过期会话，调用方需持有锁
+func (s *SessionStore) removeExpired() {
+	now := time.Now()
+	for id, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// RandomToken 生成 32 字节的随机 token
+func RandomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("生成随机数失败: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidToken API token 不存在或已被移除
+var ErrInvalidToken = errors.New("API token 无效")
+
+const (
+	// tokenPrefix API token 的前缀，便于在日志和代码仓库扫描中识别
+	tokenPrefix = "wbt_"
+	// tokenHashPrefix 账户文件中 token 哈希的前缀
+	tokenHashPrefix = "sha256:"
+)
+
+// apiToken 账户文件中的 API token，只保存哈希，token 本身只在生成时显示一次
+type apiToken struct {
+	Name string `json:"name"` // 用途说明，例如 nightly-dedup，记录在日志中
+	Hash string `json:"hash"` // sha256:<hex>
+}
+
+// tokenOwner token 所属的用户
+type tokenOwner struct {
+	username string
+	name     string
+}
+
+// NewAPIToken 生成新的 API token，返回 token 和写入账户文件的哈希
+func NewAPIToken() (token, hash string) {
+	token = tokenPrefix + RandomToken()
+	return token, HashAPIToken(token)
+}
+
+// HashAPIToken 计算 token 的哈希
+// token 是 32 字节随机数，不需要 bcrypt 这类慢哈希，每个请求校验时也不会有明显开销
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// addTokens 登记账户的 API token，哈希格式错误或重复时返回错误
+func (a *Accounts) addTokens(acc account) error {
+	for _, t := range acc.APITokens {
+		hash := strings.ToLower(strings.TrimSpace(t.Hash))
+		digest, ok := strings.CutPrefix(hash, tokenHashPrefix)
+		if !ok || len(digest) != sha256.Size*2 {
+			return fmt.Errorf("用户 %s 的 API token %q 哈希格式错误，应为 %s<64位十六进制>", acc.Username, t.Name, tokenHashPrefix)
+		}
+		if _, err := hex.DecodeString(digest); err != nil {
+			return fmt.Errorf("用户 %s 的 API token %q 哈希格式错误: %v", acc.Username, t.Name, err)
+		}
+		if _, ok := a.tokens[hash]; ok {
+			return fmt.Errorf("API token 哈希重复: 用户 %s 的 %q", acc.Username, t.Name)
+		}
+		a.tokens[hash] = tokenOwner{username: acc.Username, name: t.Name}
+	}
+	return nil
+}
+
+// AuthenticateToken 校验 API token，返回 token 所属的用户和 token 的名称
+// 用户的角色取账户文件中的配置
+func (a *Accounts) AuthenticateToken(token string) (*User, string, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, "", ErrInvalidToken
+	}
+	owner, ok := a.tokens[HashAPIToken(token)]
+	if !ok {
+		return nil, "", ErrInvalidToken
+	}
+	acc := a.users[owner.username]
+	return &User{Username: acc.Username, Name: acc.Name, Roles: acc.Roles}, owner.name, nil
+}
@@ -0,0 +1,235 @@
+// Package client WebBot /api/v1 接口的 Go 客户端
+//
+// 用法：
+//
+//	c := client.New("http://localhost:8080", os.Getenv("WEBBOT_TOKEN"))
+//	job, err := c.CreateJob(ctx, client.JobRequest{
+//		Function: "uiddedup",
+//		Params:   map[string]string{"dedup_mode": "distinct"},
+//		Files:    []string{"uids.csv"},
+//	})
+//	job, err = c.Wait(ctx, job.ID, 2*time.Second)
+//	list, err := c.Artifacts(ctx, job.ID)
+//	err = c.Download(ctx, list.Artifacts[0], w)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"webbot/api"
+)
+
+// Client WebBot 接口客户端
+type Client struct {
+	BaseURL    string       // 服务根地址，例如 http://localhost:8080
+	Token      string       // API token
+	HTTPClient *http.Client // 为空时使用 http.DefaultClient
+}
+
+// New 创建客户端
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+	}
+}
+
+// Error 接口返回的错误
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("WebBot 接口返回 %d: %s", e.StatusCode, e.Message)
+}
+
+// JobRequest 创建任务的参数
+type JobRequest struct {
+	Function string            // 功能ID
+	Params   map[string]string // 功能参数，例如 filesplit 的 split_mode
+	Files    []string          // 输入文件路径，集合运算依次为名单A和名单B
+	Snapshot string            // 可选，数据库当前状态快照的文件路径
+}
+
+// CreateJob 上传文件创建任务，文件以 multipart 流式上传，不会整体读入内存
+func (c *Client) CreateJob(ctx context.Context, req JobRequest) (*api.Job, error) {
+	if len(req.Files) == 0 {
+		return nil, fmt.Errorf("没有指定输入文件")
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeJobForm(form, req))
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/v1/jobs", body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+
+	var job api.Job
+	if err := c.do(httpReq, &job); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &job, nil
+}
+
+// writeJobForm 写入创建任务的表单
+func writeJobForm(form *multipart.Writer, req JobRequest) error {
+	if err := form.WriteField("function", req.Function); err != nil {
+		return err
+	}
+	for name, value := range req.Params {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for _, path := range req.Files {
+		if err := writeFormFile(form, "file", path); err != nil {
+			return err
+		}
+	}
+	if req.Snapshot != "" {
+		if err := writeFormFile(form, "snapshot", req.Snapshot); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+// writeFormFile 写入一个文件字段
+func writeFormFile(form *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	part, err := form.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("上传文件失败: %v", err)
+	}
+	return nil
+}
+
+// Job 查询任务状态
+func (c *Client) Job(ctx context.Context, id string) (*api.Job, error) {
+	var job api.Job
+	if err := c.get(ctx, "/api/v1/jobs/"+url.PathEscape(id), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Wait 每隔 interval 查询一次任务状态，直到任务完成或失败
+// 需要审批的任务完成后 Downloadable 为 false，审批通过前下载会返回 403
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration) (*api.Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Finished() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Artifacts 列出任务的输出文件
+func (c *Client) Artifacts(ctx context.Context, id string) (*api.ArtifactList, error) {
+	var list api.ArtifactList
+	if err := c.get(ctx, "/api/v1/jobs/"+url.PathEscape(id)+"/artifacts", &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Download 下载输出文件写入 w
+func (c *Client) Download(ctx context.Context, artifact api.Artifact, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+artifact.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("下载 %s 失败: %v", artifact.Name, err)
+	}
+	return nil
+}
+
+// get 发送 GET 请求并解析 JSON 响应
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// do 发送请求并解析 JSON 响应
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("解析响应失败: %v", err)
+	}
+	return nil
+}
+
+// send 附加 token 发送请求，非 2xx 响应转换为 *Error
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body api.Error
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return nil, apiErr
+}
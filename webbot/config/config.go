@@ -0,0 +1,141 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"shared/configloader"
+	"shared/dedup"
+	"shared/rediskey"
+	"time"
+	"webbot/handlers"
+	"webbot/queue"
+)
+
+// Config WebBot 配置
+type Config struct {
+	Listen string `config:"listen" env:"WEBBOT_LISTEN" usage:"HTTP 监听地址"`
+
+	TaskDBPath         string        `config:"task_db_path" env:"TASK_DB_PATH" usage:"任务数据库路径"`
+	Workers            int           `config:"workers" env:"WEBBOT_WORKERS" usage:"同时处理的任务数"`
+	MaxQueued          int           `config:"max_queued" env:"WEBBOT_MAX_QUEUED" usage:"排队等待的任务数上限，超出时拒绝提交，0 为不限制"`
+	FunctionLimitsSpec string        `config:"function_limits" env:"WEBBOT_FUNCTION_LIMITS" usage:"按功能限制并发数，如 logparse=1,sqlparse=1"`
+	TaskTimeout        time.Duration `config:"task_timeout" env:"WEBBOT_TASK_TIMEOUT" usage:"单个任务默认最长处理时间"`
+	TaskTimeoutsSpec   string        `config:"task_timeouts" env:"WEBBOT_TASK_TIMEOUTS" usage:"按功能覆盖处理时间上限，如 logparse=1h"`
+
+	UsersFile    string        `config:"users_file" env:"WEBBOT_USERS_FILE" usage:"账户文件路径"`
+	SessionTTL   time.Duration `config:"session_ttl" env:"WEBBOT_SESSION_TTL" usage:"登录会话有效期"`
+	CookieSecure bool          `config:"cookie_secure" env:"WEBBOT_COOKIE_SECURE" usage:"Cookie 是否只通过 HTTPS 发送"`
+	OIDC         OIDCConfig    `config:"oidc"`
+
+	Approval          bool     `config:"approval" env:"WEBBOT_APPROVAL" usage:"是否启用双人审批"`
+	ApprovalFunctions []string `config:"approval_functions" env:"WEBBOT_APPROVAL_FUNCTIONS" usage:"需要审批的功能，逗号分隔"`
+	AuditFile         string   `config:"audit_file" env:"WEBBOT_AUDIT_FILE" usage:"审计日志文件"`
+
+	MaxFileSize int64 `config:"max_file_size" env:"WEBBOT_MAX_FILE_SIZE" usage:"上传文件总大小上限，如 50MB，API 的 JSON 请求体上限按此推算"`
+	DedupMemory int64 `config:"dedup_memory" env:"WEBBOT_DEDUP_MEMORY" usage:"UID去重的内存预算，如 512MB，超出时按UID哈希分区写入临时文件处理"`
+
+	LockUserRedisKeysSpec string `config:"lock_user_redis_keys" env:"LOCK_USER_REDIS_KEYS" usage:"锁定用户时删除的Redis key模板，如 0=user:token:{uid};2=session:<uid>"`
+
+	FunctionLimits    map[string]int           // 由 FunctionLimitsSpec 解析
+	TaskTimeouts      map[string]time.Duration // 由 TaskTimeoutsSpec 解析
+	LockUserRedisKeys []rediskey.Template      // 由 LockUserRedisKeysSpec 解析
+}
+
+// OIDCConfig OIDC 登录配置，Issuer 为空时不启用
+type OIDCConfig struct {
+	Issuer       string `config:"issuer" env:"WEBBOT_OIDC_ISSUER" usage:"OIDC Issuer 地址"`
+	ClientID     string `config:"client_id" env:"WEBBOT_OIDC_CLIENT_ID" usage:"OIDC Client ID"`
+	ClientSecret string `config:"client_secret" env:"WEBBOT_OIDC_CLIENT_SECRET" secret:"true" usage:"OIDC Client Secret"`
+	RedirectURL  string `config:"redirect_url" env:"WEBBOT_OIDC_REDIRECT_URL" usage:"OIDC 回调地址"`
+	RolesClaim   string `config:"roles_claim" env:"WEBBOT_OIDC_ROLES_CLAIM" usage:"ID Token 中表示角色的 claim"`
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Listen:     "0.0.0.0:9088",
+		TaskDBPath: "webbot.db",
+		Workers:    2,
+		MaxQueued:  100,
+		// 日志和SQL解析需要完整扫描大文件，默认同时只运行一个
+		FunctionLimitsSpec: "logparse=1,sqlparse=1",
+		TaskTimeout:        handlers.DefaultTaskTimeout,
+		UsersFile:          "users.json",
+		SessionTTL:         12 * time.Hour,
+		// 这些功能的输出会修改生产数据，默认需要另一位用户审批
+		Approval:              true,
+		ApprovalFunctions:     []string{"lockuser", "kycreview", "redisdel", "redisadd"},
+		AuditFile:             "audit.log",
+		MaxFileSize:           handlers.DefaultMaxFileSize,
+		DedupMemory:           dedup.DefaultMemoryLimit,
+		LockUserRedisKeysSpec: rediskey.DefaultLockUser,
+	}
+}
+
+// LoadConfig 按 默认值 → 配置文件 → 环境变量 → 命令行参数 的顺序加载配置并校验
+// 配置文件通过 --config 或 WEBBOT_CONFIG 指定，未指定时依次尝试当前目录的 webbot.yaml、webbot.toml
+func LoadConfig(args []string, extraFlags func(fs *flag.FlagSet)) (*Config, *configloader.Result, error) {
+	cfg := DefaultConfig()
+	result, err := configloader.Load(cfg, configloader.Options{
+		Args:          args,
+		FileEnv:       "WEBBOT_CONFIG",
+		DefaultFiles:  []string{"webbot.yaml", "webbot.yml", "webbot.toml"},
+		ExtraFlags:    extraFlags,
+		ErrorHandling: flag.ContinueOnError,
+	})
+	return cfg, result, err
+}
+
+// Validate 校验配置并解析派生字段
+func (c *Config) Validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("listen 不能为空")
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("workers 必须大于 0")
+	}
+	if c.MaxQueued < 0 {
+		return fmt.Errorf("max_queued 不能小于 0")
+	}
+	if c.TaskTimeout <= 0 {
+		return fmt.Errorf("task_timeout 必须大于 0")
+	}
+	if c.MaxFileSize <= 0 {
+		return fmt.Errorf("max_file_size 必须大于 0")
+	}
+	if c.DedupMemory <= 0 {
+		return fmt.Errorf("dedup_memory 必须大于 0")
+	}
+	if c.SessionTTL <= 0 {
+		return fmt.Errorf("session_ttl 必须大于 0")
+	}
+	if c.OIDC.Issuer != "" && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		return fmt.Errorf("启用 OIDC 时需要配置 oidc.client_id 和 oidc.redirect_url")
+	}
+
+	for _, fn := range c.ApprovalFunctions {
+		if _, ok := handlers.Functions[fn]; !ok {
+			return fmt.Errorf("approval_functions 中的功能不存在: %s", fn)
+		}
+	}
+
+	limits, err := queue.ParseLimits(c.FunctionLimitsSpec)
+	if err != nil {
+		return fmt.Errorf("function_limits 配置错误: %v", err)
+	}
+	c.FunctionLimits = limits
+
+	timeouts, err := queue.ParseTimeouts(c.TaskTimeoutsSpec)
+	if err != nil {
+		return fmt.Errorf("task_timeouts 配置错误: %v", err)
+	}
+	c.TaskTimeouts = timeouts
+
+	// key模板错误会导致删除错误的key，直接拒绝启动
+	lockUserRedisKeys, err := rediskey.ParseTemplates(c.LockUserRedisKeysSpec)
+	if err != nil {
+		return fmt.Errorf("lock_user_redis_keys 配置错误: %v", err)
+	}
+	c.LockUserRedisKeys = lockUserRedisKeys
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package events 任务事件总线，将任务的状态变化推送给订阅的页面和客户端
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	TypeState = "state" // 任务状态和进度
+	TypeLog   = "log"   // 处理过程中的一条日志
+	TypeDone  = "done"  // 任务结束，包含输出文件列表
+)
+
+// Event 任务事件，ID 在同一任务内递增，断线重连时用于补发遗漏的日志
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// subscriberBuffer 每个订阅者的缓冲事件数
+const subscriberBuffer = 256
+
+// topic 一个任务的事件
+// 只有 Open 创建的 topic 接收发布的事件；Subscribe 为未打开的任务创建的 topic 在最后一个订阅者退出后删除
+type topic struct {
+	seq     int64
+	logs    []Event // 最近的日志事件，重连和晚订阅时补发
+	subs    map[chan Event]struct{}
+	opened  bool
+	closed  bool
+	removal *time.Timer
+}
+
+// Bus 按任务划分的事件总线
+// 状态事件只推送给当前订阅者，最新状态由订阅方从任务存储读取；
+// 日志事件保留最近 historySize 条，任务结束后再保留 retention 供重连补发，之后删除，
+// 结束后的任务不再打开，之后发布的事件直接丢弃，不会重新创建 topic
+type Bus struct {
+	mu          sync.Mutex
+	topics      map[string]*topic
+	historySize int
+	retention   time.Duration
+}
+
+// New 创建事件总线
+func New(historySize int, retention time.Duration) *Bus {
+	return &Bus{
+		topics:      make(map[string]*topic),
+		historySize: historySize,
+		retention:   retention,
+	}
+}
+
+// topicLocked 返回任务的 topic，不存在时创建
+func (b *Bus) topicLocked(taskID string) *topic {
+	t, ok := b.topics[taskID]
+	if !ok {
+		t = &topic{subs: make(map[chan Event]struct{})}
+		b.topics[taskID] = t
+	}
+	return t
+}
+
+// Open 任务开始后打开 topic 接收事件，已打开时不做任何事
+// 调用方只能为未结束的任务调用，否则 topic 不会被删除
+func (b *Bus) Open(taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topicLocked(taskID).opened = true
+}
+
+// Publish 发布事件，不会阻塞
+// 没有打开或已关闭的任务的事件直接丢弃
+func (b *Bus) Publish(taskID, eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[taskID]
+	if !ok || !t.opened || t.closed {
+		return
+	}
+	t.seq++
+	event := Event{ID: t.seq, Type: eventType, Data: data}
+	if eventType == TypeLog {
+		t.logs = append(t.logs, event)
+		if len(t.logs) > b.historySize {
+			t.logs = append(t.logs[:0], t.logs[len(t.logs)-b.historySize:]...)
+		}
+	}
+	for ch := range t.subs {
+		select {
+		case ch <- event:
+		default:
+			// 状态事件之间可以互相替代，缓冲满时跳过；日志和结束事件不能丢，断开后由客户端重连补发
+			if eventType != TypeState {
+				delete(t.subs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// Close 任务结束后关闭所有订阅，retention 之后删除任务的事件
+// 之后的订阅只会收到补发的日志，通道直接关闭
+func (b *Bus) Close(taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[taskID]
+	if !ok {
+		return
+	}
+	t.closed = true
+	for ch := range t.subs {
+		delete(t.subs, ch)
+		close(ch)
+	}
+	if t.removal == nil {
+		t.removal = time.AfterFunc(b.retention, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.topics[taskID] == t {
+				delete(b.topics, taskID)
+			}
+		})
+	}
+}
+
+// Subscribe 订阅任务事件，返回 ID 大于 after 的日志和后续事件的通道
+// 任务已结束或订阅者处理太慢时通道会被关闭，调用方必须调用 cancel 释放订阅
+func (b *Bus) Subscribe(taskID string, after int64) (replay []Event, events <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(taskID)
+	for _, event := range t.logs {
+		if event.ID > after {
+			replay = append(replay, event)
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if t.closed {
+		close(ch)
+		return replay, ch, func() {}
+	}
+	t.subs[ch] = struct{}{}
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := t.subs[ch]; ok {
+				delete(t.subs, ch)
+				close(ch)
+			}
+			// 没有打开的任务不保留 topic，避免只订阅不处理的任务和已结束的任务一直占用内存
+			if len(t.subs) == 0 && !t.opened && b.topics[taskID] == t {
+				delete(b.topics, taskID)
+			}
+		})
+	}
+	return replay, ch, cancel
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// topicCount 返回当前保留的 topic 数量
+func (b *Bus) topicCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.topics)
+}
+
+func TestSubscribeReplayAndClose(t *testing.T) {
+	b := New(2, time.Minute)
+	b.Open("t1")
+	for _, msg := range []string{"a", "b", "c"} {
+		b.Publish("t1", TypeLog, msg)
+	}
+
+	// 只保留最近 historySize 条日志，按 after 过滤
+	replay, ch, cancel := b.Subscribe("t1", 2)
+	defer cancel()
+	if len(replay) != 1 || replay[0].ID != 3 || replay[0].Data != "c" {
+		t.Fatalf("replay = %+v", replay)
+	}
+
+	b.Publish("t1", TypeState, "running")
+	if event := <-ch; event.Type != TypeState || event.ID != 4 {
+		t.Errorf("event = %+v", event)
+	}
+	b.Close("t1")
+	if _, ok := <-ch; ok {
+		t.Error("Close 后通道没有关闭")
+	}
+
+	// 结束后订阅只补发日志，通道直接关闭
+	replay, ch, cancel = b.Subscribe("t1", 0)
+	defer cancel()
+	if _, ok := <-ch; ok || len(replay) != 2 {
+		t.Errorf("结束后订阅: replay = %d, 通道未关闭 = %v", len(replay), ok)
+	}
+}
+
+// 结束后发布的事件（例如审批）不会重新创建 topic，retention 之后 topic 被删除
+func TestPublishAfterClose(t *testing.T) {
+	const retention = 50 * time.Millisecond
+	b := New(10, retention)
+	b.Open("t1")
+	b.Publish("t1", TypeLog, "done")
+	b.Close("t1")
+
+	b.Publish("t1", TypeLog, "approved")
+	if replay, _, cancel := b.Subscribe("t1", 0); len(replay) != 1 {
+		t.Errorf("关闭后发布的日志被保留: %+v", replay)
+	} else {
+		cancel()
+	}
+
+	time.Sleep(2 * retention)
+	if n := b.topicCount(); n != 0 {
+		t.Fatalf("retention 之后 topic 数 = %d, want 0", n)
+	}
+	b.Publish("t1", TypeState, "approved")
+	b.Publish("t1", TypeLog, "approved")
+	b.Close("t1")
+	if n := b.topicCount(); n != 0 {
+		t.Errorf("删除后发布重新创建了 topic: %d", n)
+	}
+}
+
+// 未打开的任务只在有订阅者时保留 topic，发布的事件被丢弃
+func TestSubscribeUnopened(t *testing.T) {
+	b := New(10, time.Minute)
+	b.Publish("t1", TypeLog, "ignored")
+	if n := b.topicCount(); n != 0 {
+		t.Fatalf("未打开的任务创建了 topic: %d", n)
+	}
+
+	_, ch, cancel := b.Subscribe("t1", 0)
+	b.Publish("t1", TypeLog, "ignored")
+	select {
+	case event := <-ch:
+		t.Errorf("未打开的任务收到事件 %+v", event)
+	default:
+	}
+
+	// 订阅后任务开始处理，之后的事件正常推送
+	b.Open("t1")
+	b.Publish("t1", TypeLog, "started")
+	if event := <-ch; event.Data != "started" {
+		t.Errorf("event = %+v", event)
+	}
+	cancel()
+	if n := b.topicCount(); n != 1 {
+		t.Errorf("已打开的任务 topic 数 = %d, want 1", n)
+	}
+
+	_, _, cancel = b.Subscribe("t2", 0)
+	cancel()
+	if n := b.topicCount(); n != 1 {
+		t.Errorf("取消订阅后未打开的 topic 没有删除: %d", n)
+	}
+}
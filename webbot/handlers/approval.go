@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"shared/audit"
+	"shared/review"
+	"strings"
+	"time"
+	"webbot/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审批配置，由 SetApproval 设置
+var (
+	approvalFunctions = map[string]bool{}
+	auditLog          *audit.Log
+)
+
+// SetApproval 设置需要双人审批的功能和审计日志
+// 这些功能的输出会直接修改生产数据，处理完成后需要另一位有权限的用户审批通过才能下载
+func SetApproval(functions []string, log *audit.Log) {
+	approvalFunctions = make(map[string]bool, len(functions))
+	for _, fn := range functions {
+		approvalFunctions[fn] = true
+	}
+	auditLog = log
+}
+
+// requiresApproval 判断功能的输出是否需要审批
+func requiresApproval(functionID string) bool {
+	return approvalFunctions[functionID]
+}
+
+// canReview 判断当前用户能否审批任务：任务等待审批、不是自己提交的、有该功能的使用权限
+func canReview(c *gin.Context, task *TaskInfo) bool {
+	return task.AwaitingApproval() && task.SubmittedBy != currentUser(c).Username && canRun(c, task.Function)
+}
+
+// submitForApproval 处理完成后生成审核摘要并等待审批，摘要生成失败时任务标记为失败，不允许跳过审批
+func submitForApproval(taskID string, outputFiles []string) {
+	paths := make([]string, len(outputFiles))
+	for i, file := range outputFiles {
+		paths[i] = filepath.Join("uploads", file)
+	}
+	summary, err := review.Summarize(paths, review.DefaultSamples)
+	if err != nil {
+		finishTask(taskID, nil, err)
+		return
+	}
+
+	var task *TaskInfo
+	setTaskState(taskID, func(t *TaskInfo) {
+		now := time.Now()
+		t.EndTime = &now
+		t.Status = store.StatusCompleted
+		t.Progress = 100
+		t.Message = "处理完成，等待审批"
+		t.OutputFiles = outputFiles
+		t.Approval = &store.Approval{
+			Status:  store.ApprovalPending,
+			Summary: summary,
+		}
+		task = t.Clone()
+	})
+	if task != nil {
+		recordAudit(task.SubmittedBy, audit.ActionSubmit, task, summaryDetail(summary))
+	}
+}
+
+// summaryDetail 审计日志中记录的摘要
+func summaryDetail(summary *review.Summary) string {
+	return fmt.Sprintf("files=%d lines=%d errors=%d warnings=%d",
+		len(summary.Files), summary.TotalLines, summary.ErrorCount, summary.WarnCount)
+}
+
+// ApprovalsPageHandler 审批列表页面：待我审批、我提交的和最近的审批记录
+func ApprovalsPageHandler(c *gin.Context) {
+	all, err := tasks.List()
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "读取任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	user := currentUser(c)
+	var pending, mine, decided []*TaskInfo
+	for _, task := range all {
+		if task.Approval == nil {
+			continue
+		}
+		switch {
+		case canReview(c, task):
+			pending = append(pending, task)
+		case task.AwaitingApproval() && task.SubmittedBy == user.Username:
+			mine = append(mine, task)
+		case !task.AwaitingApproval() && canAccessTask(c, task) && len(decided) < 20:
+			decided = append(decided, task)
+		}
+	}
+
+	renderHTML(c, http.StatusOK, "approvals.html", gin.H{
+		"title":     "审批",
+		"pending":   pending,
+		"mine":      mine,
+		"decided":   decided,
+		"functions": Functions,
+	})
+}
+
+// ApproveTaskHandler 审批通过
+func ApproveTaskHandler(c *gin.Context) {
+	reviewTask(c, true)
+}
+
+// RejectTaskHandler 审批拒绝，必须填写原因
+func RejectTaskHandler(c *gin.Context) {
+	reviewTask(c, false)
+}
+
+// reviewTask 记录审批结果，两个用户同时审批时只有第一个生效
+func reviewTask(c *gin.Context, approve bool) {
+	taskID := c.Param("taskid")
+	comment := strings.TrimSpace(c.PostForm("comment"))
+
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return
+	}
+	user := currentUser(c)
+	switch {
+	case !task.AwaitingApproval():
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "任务不在待审批状态",
+		})
+		return
+	case task.SubmittedBy == user.Username:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "不能审批自己提交的任务",
+		})
+		return
+	case !canRun(c, task.Function):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "没有审批该功能的权限",
+		})
+		return
+	case !approve && comment == "":
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请填写拒绝原因",
+		})
+		return
+	}
+
+	status, action, message := store.ApprovalApproved, audit.ActionApprove, "审批通过，可以下载"
+	if !approve {
+		status, action, message = store.ApprovalRejected, audit.ActionReject, "审批被拒绝: "+comment
+	}
+
+	decided := false
+	err = updateTask(taskID, func(t *TaskInfo) {
+		if !t.AwaitingApproval() {
+			return
+		}
+		now := time.Now()
+		t.Approval.Status = status
+		t.Approval.ReviewedBy = user.Username
+		t.Approval.ReviewedAt = &now
+		t.Approval.Comment = comment
+		t.Message = message
+		task = t.Clone()
+		decided = true
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "保存审批结果失败: " + err.Error(),
+		})
+		return
+	}
+	if !decided {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "任务已被其他人审批",
+		})
+		return
+	}
+
+	recordAudit(user.Username, action, task, comment)
+
+	// 被拒绝的输出不会再被使用，直接删除
+	if !approve {
+		if err := os.RemoveAll(filepath.Join("uploads", taskID, "output")); err != nil {
+			log.Printf("清理被拒绝任务 %s 的输出失败: %v", taskID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"status":  status,
+		"message": message,
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"shared/audit"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit 记录审计事件，写入失败只记录日志
+func recordAudit(actor, action string, task *TaskInfo, detail string) {
+	log.Printf("审计: %s %s 任务 %s (%s) %s", actor, action, task.ID, task.Function, detail)
+	writeAudit(audit.Event{
+		Source:  "web",
+		Actor:   actor,
+		Action:  action,
+		Target:  task.ID,
+		Command: task.Function,
+		Detail:  detail,
+	})
+}
+
+// recordGenerate 记录生成的输出：操作人、输入和输出文件的 sha256、参数和受影响的用户ID
+// outputFiles 为去掉 uploads/ 前缀后的路径
+func recordGenerate(task *TaskInfo, outputFiles []string) {
+	event := audit.Event{
+		Source:    "web",
+		Actor:     task.SubmittedBy,
+		ActorName: task.SubmitterName,
+		Action:    audit.ActionGenerate,
+		Target:    task.ID,
+		Command:   task.Function,
+		Params:    functionParams(task.Function),
+	}
+	for k, v := range task.Options {
+		if event.Params == nil {
+			event.Params = make(map[string]string)
+		}
+		event.Params[k] = v
+	}
+	if input, err := audit.HashFile(task.InputFile); err == nil {
+		event.Input = &input
+	} else {
+		event.Detail = "计算输入文件哈希失败: " + err.Error()
+	}
+
+	paths := make([]string, len(outputFiles))
+	for i, file := range outputFiles {
+		paths[i] = filepath.Join("uploads", file)
+	}
+	outputs, err := audit.HashFiles(paths)
+	if err != nil {
+		event.Detail = "计算输出文件哈希失败: " + err.Error()
+	}
+	event.Outputs = outputs
+	ids, err := audit.ExtractAffectedIDs(paths)
+	if err != nil {
+		event.Detail = "提取受影响用户失败: " + err.Error()
+	}
+	event.AffectedIDs = ids
+
+	log.Printf("审计: %s 生成任务 %s (%s) 的输出，%d 个文件，影响 %d 个用户", task.SubmittedBy, task.ID, task.Function, len(outputs), len(ids))
+	writeAudit(event)
+}
+
+// writeAudit 写入审计日志
+func writeAudit(event audit.Event) {
+	if auditLog == nil {
+		return
+	}
+	if err := auditLog.Record(event); err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
+
+// AuditQueryHandler 查询审计日志，仅管理员可用
+// 参数: user_id 受影响的用户ID，date 日期 (2006-01-02)，actor 操作人，limit 最多返回条数（默认100）
+func AuditQueryHandler(c *gin.Context) {
+	if !currentUser(c).IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "只有管理员可以查询审计日志",
+		})
+		return
+	}
+	if auditLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "未启用审计日志",
+		})
+		return
+	}
+
+	filter := audit.Filter{
+		AffectedID: c.Query("user_id"),
+		Actor:      c.Query("actor"),
+		Limit:      100,
+	}
+	if date := c.Query("date"); date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "日期格式错误，应为 2006-01-02",
+			})
+			return
+		}
+		filter.Date = day
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit 必须是正整数",
+			})
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := auditLog.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询审计日志失败: " + err.Error(),
+		})
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count":  len(events),
+		"events": events,
+	})
+}
+
+// AuditVerifyHandler 校验审计日志的哈希链，仅管理员可用
+func AuditVerifyHandler(c *gin.Context) {
+	if !currentUser(c).IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "只有管理员可以校验审计日志",
+		})
+		return
+	}
+	if auditLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "未启用审计日志",
+		})
+		return
+	}
+
+	count, err := auditLog.Verify()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"valid":    false,
+			"verified": count,
+			"error":    err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"valid":    true,
+		"verified": count,
+	})
+}
+
+// functionParams 返回影响功能输出的配置参数，记录到审计日志中
+func functionParams(function string) map[string]string {
+	if function == "lockuser" {
+		return lockUserKeys.Params()
+	}
+	return nil
+}
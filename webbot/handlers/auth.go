@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"webbot/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionCookie   = "webbot_session"
+	loginCSRFCookie = "webbot_login_csrf"
+	oidcStateCookie = "webbot_oidc_state"
+	oidcNonceCookie = "webbot_oidc_nonce"
+
+	// sessionKey gin.Context 中保存当前会话的 key
+	sessionKey = "session"
+	// tokenNameKey gin.Context 中保存 API token 名称的 key
+	tokenNameKey = "token_name"
+)
+
+// 认证配置，由 InitAuth 初始化
+var (
+	accounts     *auth.Accounts
+	sessions     *auth.SessionStore
+	oidcProvider *auth.OIDCProvider
+	secureCookie bool
+)
+
+// InitAuth 初始化认证，oidc 为空时只支持本地账户登录
+func InitAuth(a *auth.Accounts, s *auth.SessionStore, oidc *auth.OIDCProvider, secure bool) {
+	accounts = a
+	sessions = s
+	oidcProvider = oidc
+	secureCookie = secure
+}
+
+// RequireLogin 要求登录的中间件，未登录时页面跳转到登录页，接口返回 401
+func RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var session *auth.Session
+		if id, err := c.Cookie(sessionCookie); err == nil {
+			session = sessions.Get(id)
+		}
+		if session == nil {
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") || c.Request.Method != http.MethodGet {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "请先登录",
+				})
+				return
+			}
+			c.Redirect(http.StatusFound, "/login?next="+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+		c.Set(sessionKey, session)
+		c.Next()
+	}
+}
+
+// RequireAPIToken /api/v1 接口的认证中间件，要求 Authorization: Bearer <token> 请求头
+// token 请求不使用 cookie，不需要 CSRF token；当前用户和角色取 token 所属的账户
+func RequireAPIToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		var user *auth.User
+		var name string
+		err := auth.ErrInvalidToken
+		if ok {
+			user, name, err = accounts.AuthenticateToken(strings.TrimSpace(token))
+		}
+		if err != nil {
+			log.Printf("API token 校验失败: %s %s (%s)", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.Header("WWW-Authenticate", `Bearer realm="webbot"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Set(sessionKey, &auth.Session{User: user})
+		c.Set(tokenNameKey, name)
+		c.Next()
+	}
+}
+
+// CSRFProtect 校验修改类请求的 CSRF token，token 可以放在 X-CSRF-Token 请求头或 csrf_token 表单字段中
+func CSRFProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		token := c.GetHeader("X-CSRF-Token")
+		if token == "" {
+			token = c.PostForm("csrf_token")
+		}
+		if !currentSession(c).ValidCSRF(token) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "CSRF 校验失败，请刷新页面后重试",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentSession 返回当前请求的会话，只能在 RequireLogin 之后调用
+func currentSession(c *gin.Context) *auth.Session {
+	return c.MustGet(sessionKey).(*auth.Session)
+}
+
+// currentUser 返回当前登录的用户
+func currentUser(c *gin.Context) *auth.User {
+	return currentSession(c).User
+}
+
+// canRun 判断当前用户是否可以使用指定功能
+func canRun(c *gin.Context, functionID string) bool {
+	return accounts.CanRun(currentUser(c), functionID)
+}
+
+// canAccessTask 判断当前用户是否可以查看任务，普通用户只能查看自己提交的任务
+// 需要审批的任务同时对有该功能权限的用户可见，便于审批；审批人只能获取输出文件，见 isTaskOwner
+func canAccessTask(c *gin.Context, task *TaskInfo) bool {
+	return isTaskOwner(c, task) || (task.Approval != nil && canRun(c, task.Function))
+}
+
+// isTaskOwner 判断当前用户是否为任务的提交人或管理员，上传的原始文件只对他们开放
+func isTaskOwner(c *gin.Context, task *TaskInfo) bool {
+	user := currentUser(c)
+	return user.IsAdmin() || task.SubmittedBy == user.Username
+}
+
+// renderHTML 渲染页面，附带当前用户和 CSRF token
+func renderHTML(c *gin.Context, code int, name string, data gin.H) {
+	if value, ok := c.Get(sessionKey); ok {
+		session := value.(*auth.Session)
+		data["user"] = session.User
+		data["csrf_token"] = session.CSRFToken
+	}
+	data["max_file_size_mb"] = maxFileSize / 1024 / 1024
+	c.HTML(code, name, data)
+}
+
+// LoginPageHandler 登录页面处理器
+func LoginPageHandler(c *gin.Context) {
+	renderLogin(c, http.StatusOK, "")
+}
+
+// renderLogin 渲染登录页，每次生成新的登录 CSRF token
+func renderLogin(c *gin.Context, code int, errMsg string) {
+	token := auth.RandomToken()
+	setCookie(c, loginCSRFCookie, token, 10*time.Minute)
+	c.HTML(code, "login.html", gin.H{
+		"title":      "登录",
+		"csrf_token": token,
+		"next":       safeNext(c.Query("next") + c.PostForm("next")),
+		"error":      errMsg,
+		"oidc":       oidcProvider != nil,
+	})
+}
+
+// LoginHandler 本地账户登录处理器
+func LoginHandler(c *gin.Context) {
+	cookieToken, err := c.Cookie(loginCSRFCookie)
+	if err != nil || cookieToken == "" || cookieToken != c.PostForm("csrf_token") {
+		renderLogin(c, http.StatusForbidden, "页面已过期，请重新登录")
+		return
+	}
+
+	username := strings.TrimSpace(c.PostForm("username"))
+	user, err := accounts.Authenticate(username, c.PostForm("password"))
+	if err != nil {
+		log.Printf("登录失败: %s (%s)", username, c.ClientIP())
+		renderLogin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	startSession(c, user)
+	c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+}
+
+// LogoutHandler 退出登录处理器
+func LogoutHandler(c *gin.Context) {
+	sessions.Delete(currentSession(c).ID)
+	setCookie(c, sessionCookie, "", -1)
+	c.Redirect(http.StatusFound, "/login")
+}
+
+// OIDCLoginHandler 跳转到 OIDC 身份提供方登录
+func OIDCLoginHandler(c *gin.Context) {
+	if oidcProvider == nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"error": "未启用 OIDC 登录",
+		})
+		return
+	}
+	state := auth.RandomToken()
+	nonce := auth.RandomToken()
+	setCookie(c, oidcStateCookie, state+"|"+safeNext(c.Query("next")), 10*time.Minute)
+	setCookie(c, oidcNonceCookie, nonce, 10*time.Minute)
+	c.Redirect(http.StatusFound, oidcProvider.AuthCodeURL(state, nonce))
+}
+
+// OIDCCallbackHandler OIDC 登录回调
+func OIDCCallbackHandler(c *gin.Context) {
+	if oidcProvider == nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"error": "未启用 OIDC 登录",
+		})
+		return
+	}
+
+	stateCookie, _ := c.Cookie(oidcStateCookie)
+	nonce, _ := c.Cookie(oidcNonceCookie)
+	setCookie(c, oidcStateCookie, "", -1)
+	setCookie(c, oidcNonceCookie, "", -1)
+
+	state, next, _ := strings.Cut(stateCookie, "|")
+	if state == "" || state != c.Query("state") {
+		renderLogin(c, http.StatusForbidden, "登录状态校验失败，请重新登录")
+		return
+	}
+
+	identity, err := oidcProvider.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if err != nil {
+		log.Printf("OIDC 登录失败: %v", err)
+		renderLogin(c, http.StatusUnauthorized, "OIDC 登录失败")
+		return
+	}
+
+	user := accounts.ExternalUser(identity.Subject, identity.Username, identity.Name, identity.Groups)
+	if len(user.Roles) == 0 {
+		log.Printf("OIDC 用户 %s (%s) 没有任何角色，拒绝登录", user.Username, identity.Username)
+		renderLogin(c, http.StatusForbidden, "账户未分配角色，请联系管理员")
+		return
+	}
+
+	startSession(c, user)
+	c.Redirect(http.StatusFound, safeNext(next))
+}
+
+// startSession 创建会话并写入 cookie
+func startSession(c *gin.Context, user *auth.User) {
+	session := sessions.Create(user)
+	setCookie(c, sessionCookie, session.ID, sessions.TTL())
+	setCookie(c, loginCSRFCookie, "", -1)
+	log.Printf("用户 %s 登录成功 (%s), 角色 %v", user.Username, c.ClientIP(), user.Roles)
+}
+
+// setCookie 写入 HttpOnly、SameSite=Lax 的 cookie，maxAge 小于 0 时删除
+func setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	seconds := int(maxAge.Seconds())
+	if maxAge < 0 {
+		seconds = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   seconds,
+		HttpOnly: true,
+		Secure:   secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// safeNext 只允许跳转到站内地址，防止开放重定向
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"shared/dedup"
+	"shared/split"
 	"time"
+	"webbot/store"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,6 +21,18 @@ type FunctionInfo struct {
 	OutputFormat string `json:"output_format"`
 	Icon         string `json:"icon"`
 	Example      string `json:"example"`
+	Batch        bool   `json:"batch"` // 支持一次上传多个文件或zip压缩包，合并后统一处理
+
+	Extensions []string        `json:"extensions,omitempty"` // 接受的文件扩展名，为空时接受任意格式
+	Params     []FunctionParam `json:"params,omitempty"`     // 处理参数，网页表单和 /api/v1 接口使用相同的名称
+}
+
+// FunctionParam 功能的处理参数，同时用于生成 OpenAPI 文档
+type FunctionParam struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Enum        []string `json:"enum,omitempty"`
+	Default     string   `json:"default,omitempty"`
 }
 
 // 所有可用功能
@@ -30,6 +45,7 @@ var Functions = map[string]FunctionInfo{
 		OutputFormat: "CSV",
 		Icon:         "📊",
 		Example:      "上传包含用户行为、支付流水等信息的日志文件",
+		Extensions:   []string{".txt"},
 	},
 	"lockuser": {
 		ID:           "lockuser",
@@ -39,6 +55,8 @@ var Functions = map[string]FunctionInfo{
 		OutputFormat: "SQL + Redis命令",
 		Icon:         "🔒",
 		Example:      "第一列包含需要锁定的用户ID",
+		Batch:        true,
+		Extensions:   []string{".csv"},
 	},
 	"sqlparse": {
 		ID:           "sqlparse",
@@ -48,24 +66,34 @@ var Functions = map[string]FunctionInfo{
 		OutputFormat: "去重SQL文件",
 		Icon:         "🗄️",
 		Example:      "包含数据库操作日志的文本文件",
+		Extensions:   []string{".txt"},
 	},
 	"filesplit": {
 		ID:           "filesplit",
 		Name:         "文件分割",
-		Description:  "将大文件按行数分割成多个小文件",
+		Description:  "将大文件按行数、大小、份数或ID分组分割成多个小文件，CSV/Excel每个文件保留表头",
 		InputFormat:  "任意格式",
 		OutputFormat: "多个小文件",
 		Icon:         "✂️",
-		Example:      "大型数据文件、Redis命令文件等",
+		Example:      "大型数据文件、Redis命令文件等，按ID分组时同一用户的del和set命令会在同一个文件中",
+		Params: []FunctionParam{
+			{Name: "split_mode", Description: "分割方式：lines 按行数、bytes 按大小、parts 按份数、key 按ID分组", Enum: []string{string(split.ByLines), string(split.ByBytes), string(split.ByParts), string(split.ByKey)}, Default: string(split.ByLines)},
+			{Name: "split_size", Description: "lines/key 为每个文件的行数，bytes 为每个文件的大小（支持 KB/MB），parts 为份数；为空时使用默认值"},
+			{Name: "split_header", Description: "CSV/Excel 第一行是否为表头，表头会写入每个分割文件", Enum: []string{string(split.HeaderAuto), string(split.HeaderYes), string(split.HeaderNo)}, Default: string(split.HeaderAuto)},
+			{Name: "split_column", Description: "key 方式 CSV/Excel 中作为ID的列，从 1 开始"},
+			{Name: "split_name", Description: "分割文件命名规则，{name} 原文件名、{n} 四位序号、{ext} 扩展名", Default: split.DefaultPattern},
+		},
 	},
 	"kycreview": {
 		ID:           "kycreview",
 		Name:         "KYC审核",
-		Description:  "处理KYC（身份验证）审核通过数据",
+		Description:  "按审核结论（通过/拒绝/锁定）生成KYC状态变更SQL",
 		InputFormat:  "Excel/CSV",
-		OutputFormat: "SQL更新语句",
+		OutputFormat: "SQL更新语句 + 结论统计",
 		Icon:         "📋",
-		Example:      "包含用户KYC审核结果的表格文件",
+		Example:      "表头为 user_id,id,decision,reason 的表格，decision 为 approve/reject/lock，为空时视为通过",
+		Batch:        true,
+		Extensions:   []string{".csv", ".xlsx"},
 	},
 	"redisdel": {
 		ID:           "redisdel",
@@ -75,6 +103,8 @@ var Functions = map[string]FunctionInfo{
 		OutputFormat: "Redis命令文件",
 		Icon:         "🗑️",
 		Example:      "包含需要清理数据的用户ID列表",
+		Batch:        true,
+		Extensions:   []string{".csv", ".xlsx"},
 	},
 	"redisadd": {
 		ID:           "redisadd",
@@ -84,39 +114,50 @@ var Functions = map[string]FunctionInfo{
 		OutputFormat: "Redis设置命令",
 		Icon:         "➕",
 		Example:      "包含用户ID、金额、比例等字段的CSV文件",
+		Batch:        true,
+		Extensions:   []string{".csv"},
 	},
 	"uiddedup": {
 		ID:           "uiddedup",
 		Name:         "UID去重",
-		Description:  "从用户ID列表中移除重复项",
+		Description:  "UID名单去重（保留一次、只保留唯一或重复出现的UID），或两个名单的并集、交集、差集",
 		InputFormat:  "CSV",
-		OutputFormat: "去重后的CSV",
+		OutputFormat: "按首次出现顺序排列的CSV和报告",
 		Icon:         "🔄",
-		Example:      "包含可能重复用户ID的CSV文件",
+		Example:      "每行一个用户ID的CSV文件；集合运算另外选择名单B",
+		Batch:        true,
+		Extensions:   []string{".csv"},
+		Params: []FunctionParam{
+			{Name: "dedup_mode", Description: "去重方式；union/intersect/minus 为集合运算，需要依次上传名单A和名单B两个文件", Enum: dedupModes(), Default: string(dedup.Distinct)},
+		},
 	},
 }
 
-// TaskInfo 任务信息
-type TaskInfo struct {
-	ID          string     `json:"id"`
-	Function    string     `json:"function"`
-	Status      string     `json:"status"` // pending, processing, completed, failed
-	Progress    int        `json:"progress"`
-	Message     string     `json:"message"`
-	InputFile   string     `json:"input_file"`
-	OutputFiles []string   `json:"output_files"`
-	StartTime   time.Time  `json:"start_time"`
-	EndTime     *time.Time `json:"end_time"`
+// dedupModes 返回所有去重方式的名称
+func dedupModes() []string {
+	modes := make([]string, len(dedup.Modes))
+	for i, m := range dedup.Modes {
+		modes[i] = string(m)
+	}
+	return modes
 }
 
-// 全局任务存储 (生产环境应使用数据库)
-var tasks = make(map[string]*TaskInfo)
+// TaskInfo 任务信息
+type TaskInfo = store.TaskInfo
+
+// 全局任务存储，启动时通过 SetTaskStore 替换为持久化存储
+var tasks store.TaskStore = store.NewMemoryStore()
+
+// SetTaskStore 设置任务存储
+func SetTaskStore(s store.TaskStore) {
+	tasks = s
+}
 
 // IndexHandler 主页处理器
 func IndexHandler(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
+	renderHTML(c, http.StatusOK, "index.html", gin.H{
 		"title":     "数据处理工具",
-		"functions": Functions,
+		"functions": allowedFunctions(c),
 	})
 }
 
@@ -126,13 +167,19 @@ func UploadPageHandler(c *gin.Context) {
 
 	function, exists := Functions[functionID]
 	if !exists {
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
+		renderHTML(c, http.StatusNotFound, "error.html", gin.H{
 			"error": "功能不存在",
 		})
 		return
 	}
+	if !canRun(c, functionID) {
+		renderHTML(c, http.StatusForbidden, "error.html", gin.H{
+			"error": "没有使用该功能的权限",
+		})
+		return
+	}
 
-	c.HTML(http.StatusOK, "upload.html", gin.H{
+	renderHTML(c, http.StatusOK, "upload.html", gin.H{
 		"title":    function.Name,
 		"function": function,
 	})
@@ -140,12 +187,23 @@ func UploadPageHandler(c *gin.Context) {
 
 // HelpHandler 帮助页面处理器
 func HelpHandler(c *gin.Context) {
-	c.HTML(http.StatusOK, "help.html", gin.H{
+	renderHTML(c, http.StatusOK, "help.html", gin.H{
 		"title":     "使用帮助",
 		"functions": Functions,
 	})
 }
 
+// allowedFunctions 返回当前用户可以使用的功能
+func allowedFunctions(c *gin.Context) map[string]FunctionInfo {
+	result := make(map[string]FunctionInfo)
+	for id, function := range Functions {
+		if canRun(c, id) {
+			result[id] = function
+		}
+	}
+	return result
+}
+
 // generateTaskID 生成任务ID
 func generateTaskID() string {
 	return fmt.Sprintf("task_%d", time.Now().UnixNano())
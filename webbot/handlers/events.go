@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"webbot/api"
+	"webbot/events"
+	"webbot/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// 任务事件推送的参数
+const (
+	eventHistory   = 200              // 每个任务保留的日志条数
+	eventRetention = 10 * time.Minute // 任务结束后保留日志的时间
+	eventRefresh   = 3 * time.Second  // 排队中的任务刷新排队位置的间隔
+	eventHeartbeat = 15 * time.Second // 没有事件时重新发送状态的间隔，防止代理断开空闲连接
+)
+
+// 全局任务事件总线
+var taskEvents = events.New(eventHistory, eventRetention)
+
+// taskLocks 每个任务一把锁，保证同一任务的修改和事件发布顺序一致，不同任务之间互不阻塞
+var (
+	taskLocksMu sync.Mutex
+	taskLocks   = make(map[string]*taskLock)
+)
+
+// taskLock 任务锁，refs 为持有或等待该锁的调用数，为 0 时从 taskLocks 中删除
+type taskLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockTask 锁定任务，返回解锁函数
+func lockTask(taskID string) func() {
+	taskLocksMu.Lock()
+	lock, ok := taskLocks[taskID]
+	if !ok {
+		lock = &taskLock{}
+		taskLocks[taskID] = lock
+	}
+	lock.refs++
+	taskLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		taskLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(taskLocks, taskID)
+		}
+		taskLocksMu.Unlock()
+	}
+}
+
+// updateTask 修改任务并推送事件：每次修改推送状态，提示信息变化时推送日志，任务结束时推送结果并关闭订阅
+// 所有任务状态修改都必须通过 updateTask 完成，订阅方才能收到完整的事件
+func updateTask(taskID string, fn func(t *TaskInfo)) error {
+	unlock := lockTask(taskID)
+	defer unlock()
+
+	var message string
+	var finished bool
+	var task *TaskInfo
+	err := tasks.Update(taskID, func(t *TaskInfo) {
+		message, finished = t.Message, t.IsFinished()
+		fn(t)
+		task = t.Clone()
+	})
+	if err != nil {
+		return err
+	}
+
+	// 结束后的任务不再打开 topic，之后的修改（例如审批）只更新存储，避免重新创建的 topic 无法删除
+	if !task.IsFinished() {
+		taskEvents.Open(taskID)
+	}
+	taskEvents.Publish(taskID, events.TypeState, progressView(task))
+	if task.Message != "" && task.Message != message {
+		taskEvents.Publish(taskID, events.TypeLog, taskLog{Time: time.Now(), Message: task.Message})
+	}
+	if task.IsFinished() && !finished {
+		taskEvents.Publish(taskID, events.TypeDone, resultView(task))
+		taskEvents.Close(taskID)
+	}
+	return nil
+}
+
+// taskLog 日志事件
+type taskLog struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// taskResult 结束事件，包含输出文件列表
+type taskResult struct {
+	Status       string         `json:"status"`
+	Message      string         `json:"message"`
+	Downloadable bool           `json:"downloadable"`
+	Approval     string         `json:"approval,omitempty"`
+	Artifacts    []api.Artifact `json:"artifacts"`
+}
+
+// progressView 填充排队位置，用于进度查询和状态事件
+func progressView(task *TaskInfo) *TaskInfo {
+	if task.Status == store.StatusQueued && jobQueue != nil {
+		if position := jobQueue.Position(task.ID); position > 0 {
+			task.QueuePosition = position
+			task.Message = fmt.Sprintf("排队中，前面还有 %d 个任务", position-1)
+		}
+	}
+	return task
+}
+
+// resultView 生成结束事件，输出文件的下载地址为网页使用的 /api/download
+func resultView(task *TaskInfo) taskResult {
+	result := taskResult{
+		Status:       task.Status,
+		Message:      task.Message,
+		Downloadable: task.Downloadable(),
+		Artifacts:    []api.Artifact{},
+	}
+	if task.Approval != nil {
+		result.Approval = task.Approval.Status
+	}
+	for _, file := range task.OutputFiles {
+		artifact := api.Artifact{Name: filepath.Base(file), URL: "/api/download/" + file}
+		if info, err := os.Stat(filepath.Join("uploads", file)); err == nil {
+			artifact.Size = info.Size()
+		}
+		result.Artifacts = append(result.Artifacts, artifact)
+	}
+	return result
+}
+
+// TaskEventsHandler 以 Server-Sent Events 推送任务进度
+// 事件类型为 state、log、done，断线重连时浏览器携带 Last-Event-ID，服务端补发之后的日志
+func TaskEventsHandler(c *gin.Context) {
+	task, ok := eventTask(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	streamTask(c.Request.Context(), task.ID, lastEventID(c), func(event events.Event) error {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		// 补发和重新发送的状态没有 ID，不改变浏览器记录的 Last-Event-ID
+		if event.ID > 0 {
+			fmt.Fprintf(c.Writer, "id: %d\n", event.ID)
+		}
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+}
+
+// TaskSocketHandler 以 WebSocket 推送任务进度，每条消息为一个 JSON 格式的 events.Event
+// 不支持 SSE 的环境使用，重连时通过 after 参数指定最后收到的事件 ID
+func TaskSocketHandler(c *gin.Context) {
+	task, ok := eventTask(c)
+	if !ok {
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: checkSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// 客户端不发送消息，读取失败说明连接已断开
+			ctx, cancel := context.WithCancel(c.Request.Context())
+			defer cancel()
+			go func() {
+				var discard string
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				cancel()
+			}()
+
+			streamTask(ctx, task.ID, lastEventID(c), func(event events.Event) error {
+				return websocket.JSON.Send(ws, event)
+			})
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkSocketOrigin 只允许同源页面建立 WebSocket 连接，防止其他站点借用登录会话
+func checkSocketOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != req.Host {
+		return fmt.Errorf("不允许跨站连接")
+	}
+	return nil
+}
+
+// eventTask 读取路径中的任务，不存在或无权访问时返回 404
+func eventTask(c *gin.Context) (*TaskInfo, bool) {
+	task, err := tasks.Get(c.Param("taskid"))
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return nil, false
+	}
+	return task, true
+}
+
+// lastEventID 读取客户端最后收到的事件 ID，SSE 使用 Last-Event-ID 请求头，WebSocket 使用 after 参数
+func lastEventID(c *gin.Context) int64 {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("after")
+	}
+	id, _ := strconv.ParseInt(value, 10, 64)
+	return id
+}
+
+// streamTask 推送任务事件直到任务结束或连接断开
+// 先发送当前状态和补发的日志，再推送后续事件；任务结束时以 done 事件结束
+func streamTask(ctx context.Context, taskID string, after int64, send func(events.Event) error) {
+	replay, ch, cancel := taskEvents.Subscribe(taskID, after)
+	defer func() { cancel() }()
+
+	// 先订阅再读取状态，两者之间的修改会在订阅通道中再收到一次
+	task, err := tasks.Get(taskID)
+	if err != nil {
+		return
+	}
+	if send(events.Event{Type: events.TypeState, Data: progressView(task)}) != nil {
+		return
+	}
+	lastID := after
+	for _, event := range replay {
+		if send(event) != nil {
+			return
+		}
+		lastID = event.ID
+	}
+	if task.IsFinished() {
+		send(events.Event{Type: events.TypeDone, Data: resultView(task)})
+		return
+	}
+
+	ticker := time.NewTicker(eventRefresh)
+	defer ticker.Stop()
+	position := task.QueuePosition
+	lastSent := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				// 任务已结束时发送结果；否则是推送太慢被断开，重新订阅并补发遗漏的日志
+				task, err := tasks.Get(taskID)
+				if err != nil {
+					return
+				}
+				if task.IsFinished() {
+					send(events.Event{Type: events.TypeDone, Data: resultView(task)})
+					return
+				}
+				cancel()
+				replay, ch, cancel = taskEvents.Subscribe(taskID, lastID)
+				for _, event := range replay {
+					if send(event) != nil {
+						return
+					}
+					lastID = event.ID
+				}
+				continue
+			}
+			if send(event) != nil {
+				return
+			}
+			lastID = event.ID
+			lastSent = time.Now()
+			if event.Type == events.TypeDone {
+				return
+			}
+		case <-ticker.C:
+			// 其他任务开始处理时排队位置会变化，这类变化没有事件，定时刷新
+			task, err := tasks.Get(taskID)
+			if err != nil {
+				return
+			}
+			task = progressView(task)
+			if task.QueuePosition == position && time.Since(lastSent) < eventHeartbeat {
+				continue
+			}
+			position = task.QueuePosition
+			if send(events.Event{Type: events.TypeState, Data: task}) != nil {
+				return
+			}
+			lastSent = time.Now()
+		}
+	}
+}
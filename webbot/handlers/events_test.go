@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	"webbot/store"
+)
+
+// createProcessingTask 创建处理中的任务
+func createProcessingTask(t *testing.T) string {
+	t.Helper()
+	task := &TaskInfo{
+		ID:          generateTaskID(),
+		Function:    "uiddedup",
+		Status:      store.StatusProcessing,
+		SubmittedBy: "alice",
+		StartTime:   time.Now(),
+	}
+	if err := tasks.Create(task); err != nil {
+		t.Fatal(err)
+	}
+	return task.ID
+}
+
+// 一个任务的更新被阻塞时，其他任务的更新不受影响；锁在没有调用方后删除
+func TestUpdateTaskLockPerTask(t *testing.T) {
+	blocked, other := createProcessingTask(t), createProcessingTask(t)
+
+	unlock := lockTask(blocked)
+	blockedDone := make(chan error, 1)
+	go func() {
+		blockedDone <- updateTask(blocked, func(t *TaskInfo) { t.Progress = 50 })
+	}()
+
+	otherDone := make(chan error, 1)
+	go func() {
+		otherDone <- updateTask(other, func(t *TaskInfo) { t.Progress = 50 })
+	}()
+	select {
+	case err := <-otherDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("其他任务的更新被阻塞")
+	}
+
+	select {
+	case <-blockedDone:
+		t.Fatal("持有任务锁时同一任务的更新没有等待")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-blockedDone; err != nil {
+		t.Fatal(err)
+	}
+
+	taskLocksMu.Lock()
+	defer taskLocksMu.Unlock()
+	if len(taskLocks) != 0 {
+		t.Errorf("更新结束后仍保留 %d 把任务锁", len(taskLocks))
+	}
+}
+
+// 并发更新同一任务时，订阅方收到的状态与修改顺序一致
+func TestUpdateTaskEventOrder(t *testing.T) {
+	taskID := createProcessingTask(t)
+	if err := updateTask(taskID, func(t *TaskInfo) {}); err != nil {
+		t.Fatal(err)
+	}
+	_, ch, cancel := taskEvents.Subscribe(taskID, 0)
+	defer cancel()
+
+	const updates = 20
+	done := make(chan error, updates)
+	for i := 0; i < updates; i++ {
+		go func() {
+			done <- updateTask(taskID, func(t *TaskInfo) { t.Progress++ })
+		}()
+	}
+	for i := 0; i < updates; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for want := 1; want <= updates; want++ {
+		event := <-ch
+		if view, ok := event.Data.(*TaskInfo); !ok || view.Progress != want {
+			t.Fatalf("第 %d 个状态事件 = %+v", want, event.Data)
+		}
+	}
+}
@@ -1,58 +1,203 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"shared/audit"
+	"shared/batch"
+	"shared/dedup"
+	"shared/split"
+	"slices"
 	"strings"
 	"time"
 	"webbot/processor"
+	"webbot/queue"
+	"webbot/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-const MaxFileSize = 50 * 1024 * 1024 // 50MB
+// DefaultMaxFileSize 默认的上传文件总大小上限
+const DefaultMaxFileSize = 50 * 1024 * 1024 // 50MB
+
+// maxFileSize 上传文件总大小上限，由 SetMaxFileSize 设置
+var maxFileSize int64 = DefaultMaxFileSize
+
+// SetMaxFileSize 设置上传文件总大小上限，JSON 请求体的上限随之调整
+func SetMaxFileSize(size int64) {
+	if size > 0 {
+		maxFileSize = size
+	}
+}
+
+// lockUserKeys 锁定用户时需要删除的Redis key模板，由 SetLockUserKeys 在启动时设置
+var lockUserKeys processor.LockUserKeys
+
+// SetLockUserKeys 设置锁定用户的key模板，应在启动任务队列之前调用
+func SetLockUserKeys(keys processor.LockUserKeys) {
+	lockUserKeys = keys
+}
 
 // UploadFileHandler 文件上传处理器
 func UploadFileHandler(c *gin.Context) {
-	functionID := c.PostForm("function")
+	// 获取上传的文件，支持批量处理的功能可以一次上传多个文件或一个zip压缩包
+	form, ok := parseMultipart(c)
+	if !ok {
+		return
+	}
+
+	req := taskRequest{
+		Function: c.PostForm("function"),
+		Files:    formFiles(form.File["file"]),
+		Param:    c.PostForm,
+	}
+	if snapshots := form.File["snapshot"]; len(snapshots) > 0 {
+		req.Snapshots = formFiles(snapshots)
+	}
+
+	task, isBatch, err := createTask(c, req)
+	if err != nil {
+		c.JSON(taskErrorCode(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.ID,
+		"batch":   isBatch,
+		"files":   len(req.Files),
+		"message": "文件上传成功",
+	})
+}
+
+// uploadFile 上传的文件，来自网页表单或 /api/v1 接口的 JSON 请求体
+type uploadFile struct {
+	Name string
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+// formFiles 转换表单中的文件
+func formFiles(headers []*multipart.FileHeader) []uploadFile {
+	files := make([]uploadFile, len(headers))
+	for i, header := range headers {
+		files[i] = uploadFile{
+			Name: header.Filename,
+			Size: header.Size,
+			Open: func() (io.ReadCloser, error) { return header.Open() },
+		}
+	}
+	return files
+}
+
+// taskRequest 创建任务的请求
+type taskRequest struct {
+	Function  string
+	Files     []uploadFile
+	Snapshots []uploadFile             // 数据库当前状态快照，最多一个
+	Param     func(name string) string // 读取处理参数
+}
+
+// taskError 创建任务失败的原因和对应的 HTTP 状态码
+type taskError struct {
+	code    int
+	message string
+}
+
+func (e *taskError) Error() string {
+	return e.message
+}
+
+// newTaskError 创建带状态码的错误
+func newTaskError(code int, format string, args ...interface{}) error {
+	return &taskError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// taskErrorCode 返回错误对应的 HTTP 状态码
+func taskErrorCode(err error) int {
+	var te *taskError
+	if errors.As(err, &te) {
+		return te.code
+	}
+	return http.StatusInternalServerError
+}
+
+// createTask 检查功能权限、处理参数和文件，保存文件并创建 pending 状态的任务，返回任务和是否为批量任务
+func createTask(c *gin.Context, req taskRequest) (*TaskInfo, bool, error) {
+	functionID := req.Function
 
 	// 验证功能是否存在
 	function, exists := Functions[functionID]
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "无效的功能类型",
-		})
-		return
+		return nil, false, newTaskError(http.StatusBadRequest, "无效的功能类型")
+	}
+	if !canRun(c, functionID) {
+		return nil, false, newTaskError(http.StatusForbidden, "没有使用该功能的权限")
+	}
+
+	headers := req.Files
+	if len(headers) == 0 {
+		return nil, false, newTaskError(http.StatusBadRequest, "文件上传失败: 没有上传文件")
 	}
 
-	// 获取上传的文件
-	file, header, err := c.Request.FormFile("file")
+	// 处理参数在上传时检查，避免排队后才发现参数错误
+	options, err := functionOptions(functionID, req.Param)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "文件上传失败: " + err.Error(),
-		})
-		return
+		return nil, false, newTaskError(http.StatusBadRequest, "参数错误: %v", err)
 	}
-	defer file.Close()
 
-	// 检查文件大小
-	if header.Size > MaxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("文件过大，最大支持 %d MB", MaxFileSize/1024/1024),
-		})
-		return
+	// 集合运算依次上传名单A和名单B，打包为一个zip作为任务的输入文件，处理时不合并
+	setOperation := processor.IsSetOperation(functionID, options)
+	if setOperation && len(headers) != 2 {
+		return nil, false, newTaskError(http.StatusBadRequest, "%s 需要上传名单A和名单B两个CSV文件", options["dedup_mode"])
+	}
+	isBatch := !setOperation && (len(headers) > 1 || processor.IsBatchInput(functionID, headers[0].Name, options))
+	if len(headers) > 1 && !processor.BatchSupported(functionID) {
+		return nil, false, newTaskError(http.StatusBadRequest, "%s功能不支持批量处理，请只上传一个文件", function.Name)
+	}
+	if len(headers) > batch.MaxFiles {
+		return nil, false, newTaskError(http.StatusBadRequest, "一次最多上传 %d 个文件", batch.MaxFiles)
 	}
 
-	// 验证文件类型
-	if !isValidFileForFunction(header.Filename, functionID) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("不支持的文件格式，%s功能要求%s格式", function.Name, function.InputFormat),
-		})
-		return
+	// 可以附带数据库当前状态的快照（CSV导出），单独保存，不参与批量合并
+	var snapshotHeader *uploadFile
+	if snapshots := req.Snapshots; len(snapshots) > 0 {
+		if !processor.SnapshotSupported(functionID) {
+			return nil, false, newTaskError(http.StatusBadRequest, "%s功能不支持对照快照", function.Name)
+		}
+		if len(snapshots) > 1 || !strings.EqualFold(filepath.Ext(snapshots[0].Name), ".csv") {
+			return nil, false, newTaskError(http.StatusBadRequest, "快照只能上传一个 %s 的CSV导出文件", processor.SnapshotTable(functionID))
+		}
+		snapshotHeader = &snapshots[0]
+	}
+
+	// 检查文件大小和类型，批量上传时限制的是总大小，包含快照
+	var totalSize int64
+	if snapshotHeader != nil {
+		totalSize = snapshotHeader.Size
+	}
+	for _, header := range headers {
+		totalSize += header.Size
+		valid := isValidFileForFunction(header.Name, functionID)
+		if isBatch {
+			valid = processor.BatchAccepts(functionID, header.Name) || (len(headers) == 1 && batch.IsZip(header.Name))
+		} else if setOperation {
+			valid = processor.BatchAccepts(functionID, header.Name)
+		}
+		if !valid {
+			return nil, false, newTaskError(http.StatusBadRequest, "不支持的文件格式 %s，%s功能要求%s格式", header.Name, function.Name, function.InputFormat)
+		}
+	}
+	if totalSize > maxFileSize {
+		return nil, false, newTaskError(http.StatusBadRequest, "文件过大，最大支持 %d MB", maxFileSize/1024/1024)
 	}
 
 	// 生成任务ID
@@ -61,140 +206,299 @@ func UploadFileHandler(c *gin.Context) {
 	// 创建上传目录
 	uploadDir := filepath.Join("uploads", taskID)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "创建上传目录失败",
-		})
-		return
+		return nil, false, newTaskError(http.StatusInternalServerError, "创建上传目录失败")
 	}
 
-	// 保存文件
-	filename := filepath.Join(uploadDir, header.Filename)
-	out, err := os.Create(filename)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "保存文件失败",
-		})
-		return
+	// 保存文件，多个文件打包为一个zip作为任务的输入文件，处理时再解压合并
+	var filename string
+	if len(headers) == 1 {
+		filename = filepath.Join(uploadDir, filepath.Base(headers[0].Name))
+		if err := saveUploadedFile(headers[0], filename); err != nil {
+			return nil, false, err
+		}
+	} else {
+		filename, err = saveBatchFiles(headers, uploadDir, functionID)
+		if err != nil {
+			return nil, false, err
+		}
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "写入文件失败",
-		})
-		return
+	// 快照路径保存在处理参数中，处理时读取
+	if snapshotHeader != nil {
+		snapshotPath := filepath.Join(uploadDir, "snapshot", filepath.Base(snapshotHeader.Name))
+		err := os.MkdirAll(filepath.Dir(snapshotPath), 0755)
+		if err == nil {
+			err = saveUploadedFile(*snapshotHeader, snapshotPath)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options["snapshot"] = snapshotPath
 	}
 
 	// 创建任务记录
 	task := &TaskInfo{
-		ID:        taskID,
-		Function:  functionID,
-		Status:    "pending",
-		Progress:  0,
-		Message:   "等待处理...",
-		InputFile: filename,
-		StartTime: time.Now(),
+		ID:            taskID,
+		Function:      functionID,
+		Status:        store.StatusPending,
+		Progress:      0,
+		Message:       "等待处理...",
+		InputFile:     filename,
+		Options:       options,
+		SubmittedBy:   currentUser(c).Username,
+		SubmitterName: currentUser(c).DisplayName(),
+		StartTime:     time.Now(),
+	}
+	if err := tasks.Create(task); err != nil {
+		return nil, false, fmt.Errorf("保存任务失败: %v", err)
 	}
-	tasks[taskID] = task
 
-	log.Printf("创建任务 %s: %s - %s", taskID, function.Name, header.Filename)
+	log.Printf("创建任务 %s: %s - %s，%d 个文件 (%s, %s)", taskID, function.Name, filepath.Base(filename), len(headers), task.SubmittedBy, c.ClientIP())
+	return task, isBatch, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"task_id": taskID,
-		"message": "文件上传成功",
-	})
+// functionOptions 读取功能的处理参数，没有参数的功能返回 nil
+func functionOptions(functionID string, param func(name string) string) (map[string]string, error) {
+	switch functionID {
+	case "filesplit":
+		opts, err := split.ParseOptions(param("split_mode"), param("split_size"), param("split_header"), param("split_column"), param("split_name"))
+		if err != nil {
+			return nil, err
+		}
+		return opts.Values(), nil
+	case "uiddedup":
+		mode, err := dedup.ParseMode(param("dedup_mode"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"dedup_mode": string(mode)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// saveUploadedFile 保存上传的文件
+func saveUploadedFile(upload uploadFile, dst string) error {
+	file, err := upload.Open()
+	if err != nil {
+		return fmt.Errorf("读取上传文件失败")
+	}
+	defer file.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("保存文件失败")
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, file); err != nil {
+		return fmt.Errorf("写入文件失败")
+	}
+	return nil
+}
+
+// saveBatchFiles 保存批量上传的多个文件并打包为一个zip，返回zip路径
+func saveBatchFiles(uploads []uploadFile, uploadDir, functionID string) (string, error) {
+	filesDir := filepath.Join(uploadDir, "upload")
+	if err := os.MkdirAll(filesDir, 0755); err != nil {
+		return "", fmt.Errorf("创建上传目录失败")
+	}
+	files := make([]batch.File, len(uploads))
+	for i, upload := range uploads {
+		// 本地文件名加序号，避免同名文件互相覆盖
+		name := filepath.Base(upload.Name)
+		files[i] = batch.File{Name: name, Path: filepath.Join(filesDir, fmt.Sprintf("%03d_%s", i+1, name))}
+		if err := saveUploadedFile(upload, files[i].Path); err != nil {
+			return "", err
+		}
+	}
+
+	zipPath := filepath.Join(uploadDir, fmt.Sprintf("%s-batch-%d.zip", functionID, len(files)))
+	if err := batch.Pack(zipPath, files); err != nil {
+		return "", err
+	}
+	// 打包后只保留zip
+	os.RemoveAll(filesDir)
+	return zipPath, nil
 }
 
 // ProcessFileHandler 文件处理处理器
+// 重复提交同一个任务是幂等的：只有 pending 状态的任务会进入队列，其余情况直接返回当前状态
 func ProcessFileHandler(c *gin.Context) {
 	taskID := c.PostForm("task_id")
 
-	task, exists := tasks[taskID]
-	if !exists {
+	if !checkTaskAccess(c, taskID) {
+		return
+	}
+
+	task, position, started, err := startTask(taskID)
+	if errors.Is(err, store.ErrTaskNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "任务不存在",
 		})
 		return
 	}
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
 
-	// 开始异步处理
-	go processFileAsync(task)
+	if !started {
+		c.JSON(http.StatusOK, gin.H{
+			"task_id":        taskID,
+			"status":         task.Status,
+			"queue_position": position,
+			"message":        "任务已开始处理，无需重复提交",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"task_id": taskID,
-		"message": "开始处理文件",
+		"task_id":        taskID,
+		"status":         store.StatusQueued,
+		"queue_position": position,
+		"message":        "开始处理文件",
+	})
+}
+
+// startTask 将 pending 状态的任务提交到队列，返回任务副本和排队位置
+// 任务已提交过时 started 为 false，返回当前状态；提交失败（包括队列已满）时任务标记为失败
+func startTask(taskID string) (*TaskInfo, int, bool, error) {
+	var task *TaskInfo
+	started := false
+	err := updateTask(taskID, func(t *TaskInfo) {
+		if t.Status == store.StatusPending {
+			t.Status = store.StatusQueued
+			t.Message = "排队中..."
+			started = true
+		}
+		task = t.Clone()
 	})
+	if err != nil {
+		return nil, 0, false, store.ErrTaskNotFound
+	}
+	if !started {
+		return task, jobQueue.Position(taskID), false, nil
+	}
+
+	position, err := jobQueue.Submit(taskID, task.Function)
+	if err != nil && !errors.Is(err, queue.ErrAlreadyQueued) {
+		finishTask(taskID, nil, err)
+		return nil, 0, false, fmt.Errorf("任务提交失败: %w", err)
+	}
+	task.Status = store.StatusQueued
+	return task, position, true, nil
 }
 
-// processFileAsync 异步处理文件
-func processFileAsync(task *TaskInfo) {
+// processFileAsync 执行队列中的任务
+// task 是任务的副本，只读取其中不会变化的字段，所有状态修改都通过 updateTask 完成
+func processFileAsync(ctx context.Context, taskID string) {
+	task, err := tasks.Get(taskID)
+	if err != nil {
+		log.Printf("任务 %s 不存在: %v", taskID, err)
+		return
+	}
+
+	// 提交后、开始处理前被取消的任务不再处理
+	if task.IsFinished() {
+		return
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
-			task.Status = "failed"
-			task.Message = fmt.Sprintf("处理过程中发生错误: %v", r)
-			now := time.Now()
-			task.EndTime = &now
+			finishTask(task.ID, nil, fmt.Errorf("处理过程中发生错误: %v", r))
 			log.Printf("任务 %s 处理失败: %v", task.ID, r)
 		}
 	}()
 
+	// 单个任务的处理时间上限
+	timeout := timeoutFor(task.Function)
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("处理超时（超过 %v）", timeout))
+	defer cancel()
+
 	// 更新任务状态
-	task.Status = "processing"
-	task.Progress = 10
-	task.Message = "正在初始化..."
+	setTaskState(task.ID, func(t *TaskInfo) {
+		now := time.Now()
+		t.Status = store.StatusProcessing
+		t.Progress = 10
+		t.Message = "正在初始化..."
+		t.ProcessingAt = &now
+	})
 
 	// 创建输出目录
 	outputDir := filepath.Join("uploads", task.ID, "output")
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		task.Status = "failed"
-		task.Message = "创建输出目录失败"
+		finishTask(task.ID, nil, fmt.Errorf("创建输出目录失败"))
 		return
 	}
 
 	// 根据功能类型调用对应的处理器
 	var outputFiles []string
-	var err error
-
-	task.Progress = 30
-	task.Message = "正在处理文件..."
-
-	switch task.Function {
-	case "logparse":
-		outputFiles, err = processor.ProcessLogParse(task.InputFile, outputDir, updateProgress(task))
-	case "lockuser":
-		outputFiles, err = processor.ProcessLockUser(task.InputFile, outputDir, updateProgress(task))
-	case "sqlparse":
-		outputFiles, err = processor.ProcessSQLParse(task.InputFile, outputDir, updateProgress(task))
-	case "filesplit":
-		outputFiles, err = processor.ProcessFileSplit(task.InputFile, outputDir, updateProgress(task))
-	case "kycreview":
-		outputFiles, err = processor.ProcessKYCReview(task.InputFile, outputDir, updateProgress(task))
-	case "redisdel":
-		outputFiles, err = processor.ProcessRedisDel(task.InputFile, outputDir, updateProgress(task))
-	case "redisadd":
-		outputFiles, err = processor.ProcessRedisAdd(task.InputFile, outputDir, updateProgress(task))
-	case "uiddedup":
-		outputFiles, err = processor.ProcessUIDDedup(task.InputFile, outputDir, updateProgress(task))
-	default:
-		err = fmt.Errorf("不支持的功能类型: %s", task.Function)
+
+	setTaskState(task.ID, func(t *TaskInfo) {
+		t.Progress = 30
+		t.Message = "正在处理文件..."
+	})
+
+	progress := updateProgress(task.ID)
+
+	// 批量任务先解压并合并所有文件，之后按单个文件处理合并结果
+	inputFile := task.InputFile
+	var batchReport *batch.Report
+	var batchReportFile string
+	if processor.IsBatchInput(task.Function, task.InputFile, task.Options) {
+		inputFile, batchReportFile, batchReport, err = processor.PrepareBatch(ctx, task.Function, task.InputFile, filepath.Join("uploads", task.ID, "batch"), outputDir, progress)
+		if err == nil {
+			setTaskState(task.ID, func(t *TaskInfo) {
+				t.Batch = batchReport
+			})
+		}
 	}
 
-	now := time.Now()
-	task.EndTime = &now
+	if err == nil {
+		switch task.Function {
+		case "logparse":
+			outputFiles, err = processor.ProcessLogParse(ctx, inputFile, outputDir, progress)
+		case "lockuser":
+			outputFiles, err = processor.ProcessLockUser(ctx, inputFile, outputDir, lockUserKeys, task.Options, progress)
+		case "sqlparse":
+			outputFiles, err = processor.ProcessSQLParse(ctx, inputFile, outputDir, progress)
+		case "filesplit":
+			outputFiles, err = processor.ProcessFileSplit(ctx, inputFile, outputDir, task.Options, progress)
+		case "kycreview":
+			outputFiles, err = processor.ProcessKYCReview(ctx, inputFile, outputDir, task.Options, progress)
+		case "redisdel":
+			outputFiles, err = processor.ProcessRedisDel(ctx, inputFile, outputDir, progress)
+		case "redisadd":
+			outputFiles, err = processor.ProcessRedisAdd(ctx, inputFile, outputDir, progress)
+		case "uiddedup":
+			outputFiles, err = processor.ProcessUIDDedup(ctx, inputFile, outputDir, task.Options, progress)
+		default:
+			err = fmt.Errorf("不支持的功能类型: %s", task.Function)
+		}
+	}
+	if err == nil && batchReportFile != "" {
+		outputFiles = append(outputFiles, batchReportFile)
+	}
 
 	if err != nil {
-		task.Status = "failed"
-		task.Message = "处理失败: " + err.Error()
+		if ctx.Err() != nil {
+			// 被取消或超时的任务使用原因作为提示，并删除已生成的部分结果
+			err = context.Cause(ctx)
+			if rmErr := os.RemoveAll(outputDir); rmErr != nil {
+				log.Printf("清理任务 %s 的输出目录失败: %v", task.ID, rmErr)
+			}
+		} else {
+			err = fmt.Errorf("处理失败: %v", err)
+		}
+		finishTask(task.ID, nil, err)
 		log.Printf("任务 %s 处理失败: %v", task.ID, err)
 		return
 	}
 
-	// 处理成功
-	task.Status = "completed"
-	task.Progress = 100
-	task.Message = "处理完成"
-
 	// 清理输出文件路径，移除 uploads/ 前缀以适配下载URL
 	cleanedOutputFiles := make([]string, len(outputFiles))
 	for i, file := range outputFiles {
@@ -204,20 +508,51 @@ func processFileAsync(task *TaskInfo) {
 			cleanedOutputFiles[i] = file
 		}
 	}
-	task.OutputFiles = cleanedOutputFiles
+	recordGenerate(task, cleanedOutputFiles)
+	if requiresApproval(task.Function) {
+		submitForApproval(task.ID, cleanedOutputFiles)
+	} else {
+		finishTask(task.ID, cleanedOutputFiles, nil)
+	}
 
 	log.Printf("任务 %s 处理成功，输出 %d 个文件", task.ID, len(outputFiles))
 }
 
+// setTaskState 修改任务状态，存储写入失败只记录日志，不中断处理
+func setTaskState(taskID string, fn func(t *TaskInfo)) {
+	if err := updateTask(taskID, fn); err != nil {
+		log.Printf("更新任务 %s 失败: %v", taskID, err)
+	}
+}
+
+// finishTask 记录任务结束状态，err 不为空时任务标记为失败
+func finishTask(taskID string, outputFiles []string, err error) {
+	setTaskState(taskID, func(t *TaskInfo) {
+		now := time.Now()
+		t.EndTime = &now
+		if err != nil {
+			t.Status = store.StatusFailed
+			t.Message = err.Error()
+			return
+		}
+		t.Status = store.StatusCompleted
+		t.Progress = 100
+		t.Message = "处理完成"
+		t.OutputFiles = outputFiles
+	})
+}
+
 // updateProgress 创建进度更新函数
-func updateProgress(task *TaskInfo) func(progress int, message string) {
+func updateProgress(taskID string) func(progress int, message string) {
 	return func(progress int, message string) {
-		if progress > task.Progress {
-			task.Progress = progress
-		}
-		if message != "" {
-			task.Message = message
-		}
+		setTaskState(taskID, func(t *TaskInfo) {
+			if progress > t.Progress {
+				t.Progress = progress
+			}
+			if message != "" {
+				t.Message = message
+			}
+		})
 	}
 }
 
@@ -225,24 +560,84 @@ func updateProgress(task *TaskInfo) func(progress int, message string) {
 func ProgressHandler(c *gin.Context) {
 	taskID := c.Param("taskid")
 
-	task, exists := tasks[taskID]
-	if !exists {
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "任务不存在",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, task)
+	c.JSON(http.StatusOK, progressView(task))
+}
+
+// CancelTaskHandler 取消任务处理器
+// 排队中和未提交的任务直接标记为已取消，处理中的任务在处理完当前行后退出，已结束的任务返回 409
+func CancelTaskHandler(c *gin.Context) {
+	taskID := c.Param("taskid")
+
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return
+	}
+	if task.IsFinished() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "任务已结束，无法取消",
+			"status": task.Status,
+		})
+		return
+	}
+
+	found, queued := jobQueue.Cancel(taskID)
+	switch {
+	case found && !queued:
+		// 处理协程检测到取消后负责更新状态和清理输出
+		log.Printf("取消处理中的任务 %s", taskID)
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_id": taskID,
+			"status":  store.StatusProcessing,
+			"message": "正在取消任务...",
+		})
+		return
+	default:
+		// 排队中的任务已移出队列；未找到说明任务还未提交处理或刚刚结束，已结束的任务保持原状态
+		cancelled := false
+		setTaskState(taskID, func(t *TaskInfo) {
+			if t.IsFinished() {
+				return
+			}
+			now := time.Now()
+			t.Status = store.StatusFailed
+			t.Message = queue.ErrCancelled.Error()
+			t.EndTime = &now
+			cancelled = true
+		})
+		if !cancelled {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "任务已结束，无法取消",
+			})
+			return
+		}
+		log.Printf("取消任务 %s", taskID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"status":  store.StatusFailed,
+		"message": queue.ErrCancelled.Error(),
+	})
 }
 
 // ResultHandler 结果页面处理器
 func ResultHandler(c *gin.Context) {
 	taskID := c.Param("taskid")
 
-	task, exists := tasks[taskID]
-	if !exists {
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		renderHTML(c, http.StatusNotFound, "error.html", gin.H{
 			"error": "任务不存在",
 		})
 		return
@@ -250,10 +645,12 @@ func ResultHandler(c *gin.Context) {
 
 	function := Functions[task.Function]
 
-	c.HTML(http.StatusOK, "result.html", gin.H{
-		"title":    "处理结果",
-		"task":     task,
-		"function": function,
+	renderHTML(c, http.StatusOK, "result.html", gin.H{
+		"title":       "处理结果",
+		"task":        task,
+		"function":    function,
+		"can_review":  canReview(c, task),
+		"can_preview": canPreview(c, task) && len(task.OutputFiles) > 0,
 	})
 }
 
@@ -274,6 +671,33 @@ func DownloadHandler(c *gin.Context) {
 		return
 	}
 
+	// 文件路径的第一级目录为任务ID，只能下载自己任务的文件
+	taskID, _, _ := strings.Cut(filePath, "/")
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return
+	}
+
+	// 审批人只能下载任务的输出文件，上传的原始文件（用户ID名单）只有提交人和管理员可以下载
+	if !isTaskOwner(c, task) && !slices.Contains(task.OutputFiles, filePath) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+		})
+		return
+	}
+
+	// 需要审批的任务只有审批通过后才能下载输出，上传的原始文件不受限制
+	isInput := filepath.Join("uploads", filePath) == task.InputFile
+	if !isInput && !task.Downloadable() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "任务结果尚未审批通过，不能下载",
+		})
+		return
+	}
+
 	// 构建完整的文件路径
 	fullPath := filepath.Join("uploads", filePath)
 
@@ -288,24 +712,34 @@ func DownloadHandler(c *gin.Context) {
 	// 设置下载响应头
 	c.Header("Content-Description", "File Transfer")
 	c.Header("Content-Transfer-Encoding", "binary")
+	if task.Approval != nil && !isInput {
+		recordAudit(currentUser(c).Username, audit.ActionDownload, task, filePath)
+	}
+
 	c.Header("Content-Disposition", "attachment; filename="+filepath.Base(filePath))
 	c.File(fullPath)
 }
 
-// isValidFileForFunction 检查文件是否适用于特定功能
-func isValidFileForFunction(filename, functionID string) bool {
-	ext := getFileExtension(filename)
+// checkTaskAccess 检查当前用户能否访问任务，不能访问时返回 404，不暴露任务是否存在
+func checkTaskAccess(c *gin.Context, taskID string) bool {
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return false
+	}
+	return true
+}
 
-	switch functionID {
-	case "logparse", "sqlparse":
-		return ext == ".txt"
-	case "lockuser", "redisadd", "uiddedup":
-		return ext == ".csv"
-	case "kycreview", "redisdel":
-		return ext == ".csv" || ext == ".xlsx"
-	case "filesplit":
-		return true // 支持任意格式
-	default:
+// isValidFileForFunction 检查文件是否适用于特定功能，功能没有限定扩展名时接受任意格式
+func isValidFileForFunction(filename, functionID string) bool {
+	function, ok := Functions[functionID]
+	if !ok {
 		return false
 	}
+	if len(function.Extensions) == 0 {
+		return true
+	}
+	return isValidFileType(filename, function.Extensions)
 }
\ No newline at end of file
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"shared/audit"
+	"sort"
+	"strings"
+	"webbot/api"
+	"webbot/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJSONBody JSON 请求体的大小上限，由上传文件大小上限推算：文件内容 base64 编码后约为原大小的 4/3
+func maxJSONBody() int64 {
+	return maxFileSize/3*4 + 1024*1024
+}
+
+// maxMultipartBody multipart 请求体的大小上限，上传文件大小上限加上表单字段和分隔符
+func maxMultipartBody() int64 {
+	return maxFileSize + 1024*1024
+}
+
+// parseMultipart 限制请求体大小后解析 multipart 表单，超出上限时返回 413
+func parseMultipart(c *gin.Context) (*multipart.Form, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMultipartBody())
+	form, err := c.MultipartForm()
+	if err != nil {
+		respondBodyError(c, "文件上传失败", err)
+		return nil, false
+	}
+	return form, true
+}
+
+// respondBodyError 返回请求体读取错误，超出大小上限时为 413
+func respondBodyError(c *gin.Context, prefix string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("文件过大，最大支持 %d MB", maxFileSize/1024/1024),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": prefix + ": " + err.Error(),
+	})
+}
+
+// CreateJobHandler 创建任务并直接提交处理
+// 支持 multipart/form-data（字段与网页上传相同）和 application/json（文件内容为 base64），返回 202 和任务状态
+func CreateJobHandler(c *gin.Context) {
+	var req taskRequest
+	var params []string
+	if c.ContentType() == "application/json" {
+		var body api.CreateJobRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxJSONBody()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			respondBodyError(c, "请求体格式错误", err)
+			return
+		}
+		files, err := jsonFiles(body.Files)
+		if err == nil && body.Snapshot != nil {
+			req.Snapshots, err = jsonFiles([]api.File{*body.Snapshot})
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		req.Function = body.Function
+		req.Files = files
+		req.Param = func(name string) string { return body.Params[name] }
+		for name := range body.Params {
+			params = append(params, name)
+		}
+	} else {
+		form, ok := parseMultipart(c)
+		if !ok {
+			return
+		}
+		req.Function = c.PostForm("function")
+		req.Files = formFiles(form.File["file"])
+		req.Snapshots = formFiles(form.File["snapshot"])
+		req.Param = c.PostForm
+		for name := range form.Value {
+			if name != "function" {
+				params = append(params, name)
+			}
+		}
+	}
+
+	// 脚本传错参数名时直接报错，避免静默使用默认值
+	if err := checkParamNames(req.Function, params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	task, _, err := createTask(c, req)
+	if err != nil {
+		c.JSON(taskErrorCode(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	task, position, _, err := startTask(task.ID)
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+	log.Printf("API 提交任务 %s (token %q)", task.ID, c.GetString(tokenNameKey))
+
+	job := toJob(task)
+	job.QueuePosition = position
+	c.Header("Location", "/api/v1/jobs/"+task.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// jsonFiles 转换 JSON 请求体中的文件
+func jsonFiles(files []api.File) ([]uploadFile, error) {
+	result := make([]uploadFile, len(files))
+	for i, f := range files {
+		name := filepath.Base(strings.TrimSpace(f.Name))
+		if name == "." || name == "/" {
+			return nil, fmt.Errorf("第 %d 个文件缺少文件名", i+1)
+		}
+		content := f.Content
+		result[i] = uploadFile{
+			Name: name,
+			Size: int64(len(content)),
+			Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(content)), nil },
+		}
+	}
+	return result, nil
+}
+
+// checkParamNames 检查参数名是否为功能支持的参数，功能不存在时由 createTask 报错
+func checkParamNames(functionID string, names []string) error {
+	function, ok := Functions[functionID]
+	if !ok {
+		return nil
+	}
+	known := make(map[string]bool, len(function.Params))
+	for _, p := range function.Params {
+		known[p.Name] = true
+	}
+	var unknown []string
+	for _, name := range names {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%s 不支持参数 %s", functionID, strings.Join(unknown, ", "))
+}
+
+// GetJobHandler 查询任务状态
+func GetJobHandler(c *gin.Context) {
+	task, ok := jobForRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toJob(task))
+}
+
+// ListArtifactsHandler 列出任务的输出文件
+// 任务未完成时返回 409，需要审批的任务在审批通过前返回 403
+func ListArtifactsHandler(c *gin.Context) {
+	task, ok := jobForRequest(c)
+	if !ok || !checkArtifactsReady(c, task) {
+		return
+	}
+
+	list := api.ArtifactList{JobID: task.ID, Artifacts: []api.Artifact{}}
+	for _, file := range task.OutputFiles {
+		name := filepath.Base(file)
+		artifact := api.Artifact{
+			Name: name,
+			URL:  fmt.Sprintf("/api/v1/jobs/%s/artifacts/%s", task.ID, url.PathEscape(name)),
+		}
+		if info, err := os.Stat(filepath.Join("uploads", file)); err == nil {
+			artifact.Size = info.Size()
+		}
+		list.Artifacts = append(list.Artifacts, artifact)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// DownloadArtifactHandler 下载任务的一个输出文件
+func DownloadArtifactHandler(c *gin.Context) {
+	task, ok := jobForRequest(c)
+	if !ok || !checkArtifactsReady(c, task) {
+		return
+	}
+
+	// gin 按解码后的路径匹配，文件名从转义的路径中读取后再解码，与列表中 url.PathEscape 生成的地址对应
+	escaped := c.Request.URL.EscapedPath()
+	name, err := url.PathUnescape(escaped[strings.LastIndex(escaped, "/")+1:])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "文件名无效",
+		})
+		return
+	}
+	for _, file := range task.OutputFiles {
+		if filepath.Base(file) != name {
+			continue
+		}
+		fullPath := filepath.Join("uploads", file)
+		if _, err := os.Stat(fullPath); err != nil {
+			break
+		}
+		if task.Approval != nil {
+			recordAudit(currentUser(c).Username, audit.ActionDownload, task, file)
+		}
+		c.FileAttachment(fullPath, name)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": "文件不存在",
+	})
+}
+
+// jobForRequest 读取路径中的任务，不存在或无权访问时返回 404
+func jobForRequest(c *gin.Context) (*TaskInfo, bool) {
+	task, err := tasks.Get(c.Param("id"))
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return nil, false
+	}
+	return task, true
+}
+
+// checkArtifactsReady 检查任务的输出文件是否可以列出和下载
+func checkArtifactsReady(c *gin.Context, task *TaskInfo) bool {
+	switch {
+	case task.Status == store.StatusFailed:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "任务失败: " + task.Message,
+			"status": task.Status,
+		})
+		return false
+	case task.Status != store.StatusCompleted:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "任务尚未完成",
+			"status": task.Status,
+		})
+		return false
+	case !task.Downloadable():
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "任务结果尚未审批通过，不能下载",
+			"approval": task.Approval.Status,
+		})
+		return false
+	}
+	return true
+}
+
+// toJob 转换为接口返回的任务信息，快照的服务器路径不返回
+func toJob(task *TaskInfo) api.Job {
+	job := api.Job{
+		ID:           task.ID,
+		Function:     task.Function,
+		Status:       task.Status,
+		Progress:     task.Progress,
+		Message:      task.Message,
+		SubmittedBy:  task.SubmittedBy,
+		Downloadable: task.Downloadable(),
+		CreatedAt:    task.StartTime,
+		StartedAt:    task.ProcessingAt,
+		FinishedAt:   task.EndTime,
+	}
+	for name, value := range task.Options {
+		if name == "snapshot" {
+			job.Snapshot = true
+			continue
+		}
+		if job.Params == nil {
+			job.Params = make(map[string]string)
+		}
+		job.Params[name] = value
+	}
+	if task.Approval != nil {
+		job.Approval = task.Approval.Status
+	}
+	if task.Status == store.StatusQueued {
+		job.QueuePosition = jobQueue.Position(task.ID)
+	}
+	return job
+}
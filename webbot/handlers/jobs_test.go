@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"webbot/api"
+	"webbot/auth"
+	"webbot/client"
+	"webbot/queue"
+	"webbot/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 测试用的 API token
+var aliceToken, bobToken, carolToken string
+
+// TestMain 在临时目录中运行，上传文件写入其中的 uploads；队列不执行任务，提交后保持排队状态
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "webbot-handlers")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+
+	var aliceHash, bobHash, carolHash string
+	aliceToken, aliceHash = auth.NewAPIToken()
+	bobToken, bobHash = auth.NewAPIToken()
+	carolToken, carolHash = auth.NewAPIToken()
+	users := fmt.Sprintf(`{
+		"roles": {"ops": ["*"], "analyst": ["logparse"]},
+		"users": [
+			{"username": "alice", "roles": ["ops"], "api_tokens": [{"name": "ci", "hash": %q}]},
+			{"username": "bob", "roles": ["ops"], "api_tokens": [{"name": "ci", "hash": %q}]},
+			{"username": "carol", "roles": ["analyst"], "api_tokens": [{"name": "ci", "hash": %q}]}
+		]
+	}`, aliceHash, bobHash, carolHash)
+	if err := os.WriteFile("users.json", []byte(users), 0600); err != nil {
+		log.Fatal(err)
+	}
+	accounts, err := auth.LoadAccounts("users.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	InitAuth(accounts, nil, nil, false)
+	jobQueue = queue.New(1, 0, nil, func(ctx context.Context, taskID string) {})
+
+	code := m.Run()
+	jobQueue.Close()
+	os.Exit(code)
+}
+
+// serveAPI 按 main.go 中的路由发送 /api/v1 请求
+func serveAPI(req *http.Request, token string) *httptest.ResponseRecorder {
+	r := gin.New()
+	jobs := r.Group("/api/v1/jobs", RequireAPIToken())
+	jobs.POST("", CreateJobHandler)
+	jobs.GET("/:id", GetJobHandler)
+	jobs.GET("/:id/artifacts", ListArtifactsHandler)
+	jobs.GET("/:id/artifacts/:name", DownloadArtifactHandler)
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// postJSON 以 JSON 请求体创建任务
+func postJSON(token string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	return serveAPI(req, token)
+}
+
+// postForm 以 multipart 表单创建任务，files 为文件名到内容的映射
+func postForm(token string, fields map[string]string, files map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	for name, content := range files {
+		part, _ := form.CreateFormFile("file", name)
+		part.Write([]byte(content))
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return serveAPI(req, token)
+}
+
+// get 发送 GET 请求
+func get(token, path string) *httptest.ResponseRecorder {
+	return serveAPI(httptest.NewRequest(http.MethodGet, path, nil), token)
+}
+
+// decodeJob 解析响应中的任务
+func decodeJob(t *testing.T, w *httptest.ResponseRecorder) api.Job {
+	t.Helper()
+	var job api.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, w.Body.String())
+	}
+	return job
+}
+
+func TestCreateJobJSON(t *testing.T) {
+	w := postJSON(aliceToken, api.CreateJobRequest{
+		Function: "uiddedup",
+		Params:   map[string]string{"dedup_mode": "distinct"},
+		Files:    []api.File{{Name: "uids.csv", Content: []byte("uid\n1\n2\n")}},
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	job := decodeJob(t, w)
+	if job.Status != api.StatusQueued || job.SubmittedBy != "alice" || job.Params["dedup_mode"] != "distinct" {
+		t.Errorf("job = %+v", job)
+	}
+	if location := w.Header().Get("Location"); location != "/api/v1/jobs/"+job.ID {
+		t.Errorf("Location = %s", location)
+	}
+
+	// 提交人可以查询，其他非管理员用户看不到
+	w = get(aliceToken, "/api/v1/jobs/"+job.ID)
+	if w.Code != http.StatusOK || decodeJob(t, w).ID != job.ID {
+		t.Errorf("查询任务 = %d: %s", w.Code, w.Body.String())
+	}
+	if w = get(bobToken, "/api/v1/jobs/"+job.ID); w.Code != http.StatusNotFound {
+		t.Errorf("其他用户查询 = %d", w.Code)
+	}
+	if w = get(aliceToken, "/api/v1/jobs/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的任务 = %d", w.Code)
+	}
+	// 任务未完成时不能列出输出文件
+	if w = get(aliceToken, "/api/v1/jobs/"+job.ID+"/artifacts"); w.Code != http.StatusConflict {
+		t.Errorf("未完成任务的输出文件 = %d", w.Code)
+	}
+}
+
+func TestCreateJobJSONRejects(t *testing.T) {
+	for name, tc := range map[string]struct {
+		token string
+		body  interface{}
+		code  int
+	}{
+		"未知字段":  {aliceToken, map[string]interface{}{"function": "uiddedup", "file": "x"}, http.StatusBadRequest},
+		"未知参数":  {aliceToken, api.CreateJobRequest{Function: "uiddedup", Params: map[string]string{"mode": "x"}, Files: []api.File{{Name: "a.csv", Content: []byte("1")}}}, http.StatusBadRequest},
+		"缺少文件名": {aliceToken, api.CreateJobRequest{Function: "uiddedup", Files: []api.File{{Content: []byte("1")}}}, http.StatusBadRequest},
+		"没有权限":  {carolToken, api.CreateJobRequest{Function: "uiddedup", Files: []api.File{{Name: "a.csv", Content: []byte("1")}}}, http.StatusForbidden},
+	} {
+		if w := postJSON(tc.token, tc.body); w.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d: %s", name, w.Code, tc.code, w.Body.String())
+		}
+	}
+}
+
+func TestCreateJobMultipart(t *testing.T) {
+	w := postForm(aliceToken, map[string]string{"function": "uiddedup", "dedup_mode": "singletons"}, map[string]string{"uids.csv": "uid\n1\n"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if job := decodeJob(t, w); job.Function != "uiddedup" || job.Params["dedup_mode"] != "singletons" {
+		t.Errorf("job = %+v", job)
+	}
+
+	if w := postForm(aliceToken, map[string]string{"function": "uiddedup", "mode": "x"}, map[string]string{"uids.csv": "1"}); w.Code != http.StatusBadRequest {
+		t.Errorf("未知参数 = %d", w.Code)
+	}
+	if w := postForm(aliceToken, map[string]string{"function": "uiddedup"}, map[string]string{"uids.txt": "1"}); w.Code != http.StatusBadRequest {
+		t.Errorf("不支持的格式 = %d", w.Code)
+	}
+}
+
+// 请求体超过上传大小上限时在读取过程中拒绝，返回 413
+func TestCreateJobBodyLimit(t *testing.T) {
+	defer SetMaxFileSize(maxFileSize)
+	SetMaxFileSize(1024 * 1024)
+
+	large := strings.Repeat("1\n", 1024*1024+1)
+	w := postForm(aliceToken, map[string]string{"function": "uiddedup"}, map[string]string{"uids.csv": large})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("multipart = %d: %s", w.Code, w.Body.String())
+	}
+	w = postJSON(aliceToken, api.CreateJobRequest{Function: "uiddedup", Files: []api.File{{Name: "uids.csv", Content: []byte(large)}}})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("JSON = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPITokenRejected(t *testing.T) {
+	for name, token := range map[string]string{
+		"缺少 token": "",
+		"未登记":      "wbt_unknown",
+		"前缀错误":     strings.TrimPrefix(aliceToken, "wbt_"),
+	} {
+		w := get(token, "/api/v1/jobs/missing")
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: status = %d, WWW-Authenticate = %q", name, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/missing", nil)
+	req.Header.Set("Authorization", "Basic "+aliceToken)
+	if w := serveAPI(req, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Basic 认证 = %d", w.Code)
+	}
+}
+
+// createCompletedTask 创建已完成的任务并写入输出文件，files 为文件名到内容的映射
+func createCompletedTask(t *testing.T, approval *store.Approval, files map[string]string) *TaskInfo {
+	t.Helper()
+	id := generateTaskID()
+	now := time.Now()
+	task := &TaskInfo{
+		ID:          id,
+		Function:    "uiddedup",
+		Status:      store.StatusCompleted,
+		SubmittedBy: "alice",
+		StartTime:   now,
+		EndTime:     &now,
+		Approval:    approval,
+	}
+	for name, content := range files {
+		path := filepath.Join(id, "out", name)
+		if err := os.MkdirAll(filepath.Join("uploads", id, "out"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("uploads", path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		task.OutputFiles = append(task.OutputFiles, path)
+	}
+	if err := tasks.Create(task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+// 文件名中的特殊字符在下载地址中转义，按列表返回的地址可以下载到对应文件
+func TestArtifacts(t *testing.T) {
+	files := map[string]string{
+		"result.csv":      "1\n",
+		"a b?#%c.csv":     "2\n",
+		"报告 100%.txt":     "3\n",
+		"%2e%2e.csv":      "4\n",
+		"semi;colon+.csv": "5\n",
+	}
+	task := createCompletedTask(t, nil, files)
+
+	w := get(aliceToken, "/api/v1/jobs/"+task.ID+"/artifacts")
+	if w.Code != http.StatusOK {
+		t.Fatalf("列出输出文件 = %d: %s", w.Code, w.Body.String())
+	}
+	var list api.ArtifactList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.JobID != task.ID || len(list.Artifacts) != len(files) {
+		t.Fatalf("list = %+v", list)
+	}
+	for _, artifact := range list.Artifacts {
+		if strings.ContainsAny(strings.TrimPrefix(artifact.URL, "/api/v1/jobs/"+task.ID+"/artifacts/"), "/?# ") {
+			t.Errorf("%s: 地址没有转义: %s", artifact.Name, artifact.URL)
+		}
+		w := get(aliceToken, artifact.URL)
+		if w.Code != http.StatusOK || w.Body.String() != files[artifact.Name] {
+			t.Errorf("下载 %s (%s) = %d: %q", artifact.Name, artifact.URL, w.Code, w.Body.String())
+		}
+		if artifact.Size != int64(len(files[artifact.Name])) {
+			t.Errorf("%s: size = %d", artifact.Name, artifact.Size)
+		}
+	}
+
+	if w := get(aliceToken, "/api/v1/jobs/"+task.ID+"/artifacts/missing.csv"); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的文件 = %d", w.Code)
+	}
+	if w := get(bobToken, "/api/v1/jobs/"+task.ID+"/artifacts"); w.Code != http.StatusNotFound {
+		t.Errorf("其他用户列出输出文件 = %d", w.Code)
+	}
+}
+
+// 需要审批的任务在审批通过前不能列出和下载输出文件
+func TestArtifactsAwaitingApproval(t *testing.T) {
+	task := createCompletedTask(t, &store.Approval{Status: store.ApprovalPending}, map[string]string{"lock.sql": "UPDATE"})
+	for _, path := range []string{"/artifacts", "/artifacts/lock.sql"} {
+		if w := get(aliceToken, "/api/v1/jobs/"+task.ID+path); w.Code != http.StatusForbidden {
+			t.Errorf("%s = %d", path, w.Code)
+		}
+	}
+
+	err := tasks.Update(task.ID, func(t *TaskInfo) { t.Approval.Status = store.ApprovalApproved })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(aliceToken, "/api/v1/jobs/"+task.ID+"/artifacts/lock.sql"); w.Code != http.StatusOK || w.Body.String() != "UPDATE" {
+		t.Errorf("审批通过后下载 = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// Go 客户端通过真实的接口创建任务、等待完成并下载输出文件
+func TestClientRoundTrip(t *testing.T) {
+	r := gin.New()
+	jobs := r.Group("/api/v1/jobs", RequireAPIToken())
+	jobs.POST("", CreateJobHandler)
+	jobs.GET("/:id", GetJobHandler)
+	jobs.GET("/:id/artifacts", ListArtifactsHandler)
+	jobs.GET("/:id/artifacts/:name", DownloadArtifactHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	input := filepath.Join(t.TempDir(), "uids.csv")
+	if err := os.WriteFile(input, []byte("uid\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(srv.URL+"/", aliceToken)
+	ctx := context.Background()
+	job, err := c.CreateJob(ctx, client.JobRequest{
+		Function: "uiddedup",
+		Params:   map[string]string{"dedup_mode": "duplicates"},
+		Files:    []string{input},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != api.StatusQueued || job.Params["dedup_mode"] != "duplicates" {
+		t.Errorf("job = %+v", job)
+	}
+
+	// 模拟任务处理完成
+	name := "uids 去重 #1.csv"
+	if err := os.WriteFile(filepath.Join("uploads", job.ID, name), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = tasks.Update(job.ID, func(t *TaskInfo) {
+		t.Status = store.StatusCompleted
+		t.OutputFiles = []string{filepath.Join(job.ID, name)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = c.Wait(ctx, job.ID, 10*time.Millisecond)
+	if err != nil || !job.Finished() || !job.Downloadable {
+		t.Fatalf("Wait = %+v, %v", job, err)
+	}
+	list, err := c.Artifacts(ctx, job.ID)
+	if err != nil || len(list.Artifacts) != 1 || list.Artifacts[0].Name != name {
+		t.Fatalf("Artifacts = %+v, %v", list, err)
+	}
+	var buf bytes.Buffer
+	if err := c.Download(ctx, list.Artifacts[0], &buf); err != nil || buf.String() != "1\n" {
+		t.Errorf("Download = %q, %v", buf.String(), err)
+	}
+
+	// 错误响应转换为 *client.Error
+	_, err = client.New(srv.URL, bobToken).Job(ctx, job.ID)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "任务不存在" {
+		t.Errorf("其他用户查询 err = %v", err)
+	}
+	if _, err := client.New(srv.URL, "wbt_unknown").Job(ctx, job.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("无效 token err = %v", err)
+	}
+	if _, err := c.CreateJob(ctx, client.JobRequest{Function: "uiddedup"}); err == nil {
+		t.Error("没有输入文件时应返回错误")
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"webbot/processor"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIHandler 返回 /api/v1 接口的 OpenAPI 文档
+func OpenAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, OpenAPISpec())
+}
+
+// OpenAPISpec 根据 Functions 中的功能定义生成 /api/v1 接口的 OpenAPI 3.0 文档
+// 功能列表、每个功能的参数和可选值都来自功能定义，新增功能或参数后文档自动更新
+func OpenAPISpec() map[string]interface{} {
+	ids := make([]string, 0, len(Functions))
+	for id := range Functions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// 功能说明
+	var lines []string
+	for _, id := range ids {
+		f := Functions[id]
+		var notes []string
+		if len(f.Extensions) > 0 {
+			notes = append(notes, strings.Join(f.Extensions, "/"))
+		} else {
+			notes = append(notes, "任意格式")
+		}
+		if f.Batch {
+			notes = append(notes, "支持多个文件或zip")
+		}
+		if processor.SnapshotSupported(id) {
+			notes = append(notes, "可附带 "+processor.SnapshotTable(id)+" 快照")
+		}
+		lines = append(lines, fmt.Sprintf("- `%s` %s：%s（%s）", id, f.Name, f.Description, strings.Join(notes, "，")))
+	}
+	functionSchema := map[string]interface{}{
+		"type":        "string",
+		"enum":        ids,
+		"description": "功能ID：\n" + strings.Join(lines, "\n"),
+	}
+
+	// 参数，名称在所有功能中唯一，说明中注明适用的功能
+	params := map[string]interface{}{}
+	for _, id := range ids {
+		for _, p := range Functions[id].Params {
+			schema := map[string]interface{}{
+				"type":        "string",
+				"description": fmt.Sprintf("%s（%s）", p.Description, id),
+			}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			if p.Default != "" {
+				schema["default"] = p.Default
+			}
+			params[p.Name] = schema
+		}
+	}
+
+	// multipart 表单：功能、文件、快照和参数字段
+	formProperties := map[string]interface{}{
+		"function": functionSchema,
+		"file": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "format": "binary"},
+			"description": "输入文件；批量功能可以上传多个文件或一个zip，集合运算依次上传名单A和名单B",
+		},
+		"snapshot": map[string]interface{}{
+			"type":        "string",
+			"format":      "binary",
+			"description": "可选，数据库当前状态的CSV导出，只为执行后会变更的记录生成SQL",
+		},
+	}
+	for name, schema := range params {
+		formProperties[name] = schema
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "WebBot API",
+			"version":     "1.0.0",
+			"description": "数据处理任务接口。创建任务后轮询状态，完成后列出并下载输出文件；需要审批的功能在网页上审批通过后才能下载。",
+		},
+		"security": []interface{}{map[string]interface{}{"apiToken": []string{}}},
+		"paths": map[string]interface{}{
+			"/api/v1/jobs": map[string]interface{}{
+				"post": map[string]interface{}{
+					"operationId": "createJob",
+					"summary":     "创建任务并提交处理",
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							"multipart/form-data": map[string]interface{}{
+								"schema": map[string]interface{}{
+									"type":       "object",
+									"required":   []string{"function", "file"},
+									"properties": formProperties,
+								},
+							},
+							"application/json": map[string]interface{}{
+								"schema": schemaRef("CreateJobRequest"),
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"202": jsonResponse("任务已提交，Location 为任务地址", "Job"),
+						"400": jsonResponse("功能、参数或文件不符合要求", "Error"),
+						"401": jsonResponse("API token 无效", "Error"),
+						"403": jsonResponse("没有使用该功能的权限", "Error"),
+						"413": jsonResponse("上传文件总大小超过上限", "Error"),
+						"503": jsonResponse("任务队列已满（带 Retry-After 头）或已关闭", "Error"),
+					},
+				},
+			},
+			"/api/v1/jobs/{id}": map[string]interface{}{
+				"parameters": []interface{}{pathParam("id", "任务ID")},
+				"get": map[string]interface{}{
+					"operationId": "getJob",
+					"summary":     "查询任务状态",
+					"responses": map[string]interface{}{
+						"200": jsonResponse("任务状态", "Job"),
+						"401": jsonResponse("API token 无效", "Error"),
+						"404": jsonResponse("任务不存在或无权访问", "Error"),
+					},
+				},
+			},
+			"/api/v1/jobs/{id}/artifacts": map[string]interface{}{
+				"parameters": []interface{}{pathParam("id", "任务ID")},
+				"get": map[string]interface{}{
+					"operationId": "listArtifacts",
+					"summary":     "列出任务的输出文件",
+					"responses": map[string]interface{}{
+						"200": jsonResponse("输出文件列表", "ArtifactList"),
+						"401": jsonResponse("API token 无效", "Error"),
+						"403": jsonResponse("任务结果尚未审批通过", "Error"),
+						"404": jsonResponse("任务不存在或无权访问", "Error"),
+						"409": jsonResponse("任务尚未完成或已失败", "Error"),
+					},
+				},
+			},
+			"/api/v1/jobs/{id}/artifacts/{name}": map[string]interface{}{
+				"parameters": []interface{}{pathParam("id", "任务ID"), pathParam("name", "输出文件名，按 URL 路径转义")},
+				"get": map[string]interface{}{
+					"operationId": "downloadArtifact",
+					"summary":     "下载一个输出文件",
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "文件内容",
+							"content": map[string]interface{}{
+								"application/octet-stream": map[string]interface{}{
+									"schema": map[string]interface{}{"type": "string", "format": "binary"},
+								},
+							},
+						},
+						"401": jsonResponse("API token 无效", "Error"),
+						"403": jsonResponse("任务结果尚未审批通过", "Error"),
+						"404": jsonResponse("任务或文件不存在", "Error"),
+						"409": jsonResponse("任务尚未完成或已失败", "Error"),
+					},
+				},
+			},
+			"/api/v1/openapi.json": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "getOpenAPI",
+					"summary":     "本文档",
+					"security":    []interface{}{},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{"description": "OpenAPI 文档"},
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"apiToken": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "账户文件中 api_tokens 配置的 token，通过 go run . -new-api-token 生成",
+				},
+			},
+			"schemas": map[string]interface{}{
+				"Job":          jobSchema(),
+				"Artifact":     artifactSchema(),
+				"ArtifactList": artifactListSchema(),
+				"Error": objectSchema([]string{"error"}, map[string]interface{}{
+					"error": stringSchema("错误信息"),
+				}),
+				"File": objectSchema([]string{"name", "content"}, map[string]interface{}{
+					"name":    stringSchema("文件名，扩展名决定文件格式"),
+					"content": map[string]interface{}{"type": "string", "format": "byte", "description": "base64 编码的文件内容"},
+				}),
+				"CreateJobRequest": objectSchema([]string{"function", "files"}, map[string]interface{}{
+					"function": functionSchema,
+					"params": map[string]interface{}{
+						"type":                 "object",
+						"properties":           params,
+						"additionalProperties": false,
+					},
+					"files":    map[string]interface{}{"type": "array", "items": schemaRef("File")},
+					"snapshot": schemaRef("File"),
+				}),
+			},
+		},
+	}
+}
+
+// jobSchema 任务结构，与 api.Job 一致
+func jobSchema() map[string]interface{} {
+	nullableTime := map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+	return objectSchema([]string{"id", "function", "status", "progress", "message", "submitted_by", "downloadable", "created_at"}, map[string]interface{}{
+		"id":       stringSchema("任务ID"),
+		"function": stringSchema("功能ID"),
+		"status": map[string]interface{}{
+			"type": "string",
+			"enum": []string{"pending", "queued", "processing", "completed", "failed"},
+		},
+		"progress":       map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 100},
+		"message":        stringSchema("当前进度说明，失败时为失败原因"),
+		"params":         map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+		"snapshot":       map[string]interface{}{"type": "boolean", "description": "是否附带了数据库当前状态快照"},
+		"submitted_by":   stringSchema("提交任务的用户"),
+		"queue_position": map[string]interface{}{"type": "integer", "description": "排队位置，仅 queued 状态返回"},
+		"approval": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"pending", "approved", "rejected"},
+			"description": "需要审批的功能才有",
+		},
+		"downloadable": map[string]interface{}{"type": "boolean", "description": "结果是否可以下载"},
+		"created_at":   map[string]interface{}{"type": "string", "format": "date-time"},
+		"started_at":   nullableTime,
+		"finished_at":  nullableTime,
+	})
+}
+
+// artifactSchema 输出文件结构，与 api.Artifact 一致
+func artifactSchema() map[string]interface{} {
+	return objectSchema([]string{"name", "size", "url"}, map[string]interface{}{
+		"name": stringSchema("文件名"),
+		"size": map[string]interface{}{"type": "integer", "format": "int64"},
+		"url":  stringSchema("下载地址，相对于服务根地址"),
+	})
+}
+
+// artifactListSchema 输出文件列表结构，与 api.ArtifactList 一致
+func artifactListSchema() map[string]interface{} {
+	return objectSchema([]string{"job_id", "artifacts"}, map[string]interface{}{
+		"job_id":    stringSchema("任务ID"),
+		"artifacts": map[string]interface{}{"type": "array", "items": schemaRef("Artifact")},
+	})
+}
+
+// objectSchema 生成对象结构
+func objectSchema(required []string, properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"required":   required,
+		"properties": properties,
+	}
+}
+
+// stringSchema 生成带说明的字符串结构
+func stringSchema(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+// schemaRef 引用 components 中的结构
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// jsonResponse 生成 JSON 响应
+func jsonResponse(description, schema string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemaRef(schema)},
+		},
+	}
+}
+
+// pathParam 生成路径参数
+func pathParam(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// collectRefs 收集文档中所有的 $ref
+func collectRefs(v interface{}, refs map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && key == "$ref" {
+				refs[s] = true
+			}
+			collectRefs(value, refs)
+		}
+	case []interface{}:
+		for _, value := range v {
+			collectRefs(value, refs)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	// 经过 JSON 编码后检查，与 /api/v1/openapi.json 返回的内容一致
+	data, err := json.Marshal(OpenAPISpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := spec["paths"].(map[string]interface{})
+	for _, path := range []string{"/api/v1/jobs", "/api/v1/jobs/{id}", "/api/v1/jobs/{id}/artifacts", "/api/v1/jobs/{id}/artifacts/{name}"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("缺少接口 %s", path)
+		}
+	}
+
+	// 引用的结构都已定义
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	refs := make(map[string]bool)
+	collectRefs(spec, refs)
+	for ref := range refs {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, defined := schemas[name]; !ok || !defined {
+			t.Errorf("引用的结构不存在: %s", ref)
+		}
+	}
+
+	// 每个功能和参数都出现在 multipart 表单中
+	form := paths["/api/v1/jobs"].(map[string]interface{})["post"].(map[string]interface{})["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["multipart/form-data"].(map[string]interface{})["schema"].(map[string]interface{})["properties"].(map[string]interface{})
+	enum := form["function"].(map[string]interface{})["enum"].([]interface{})
+	if len(enum) != len(Functions) {
+		t.Errorf("功能数 = %d, want %d", len(enum), len(Functions))
+	}
+	for id, f := range Functions {
+		for _, p := range f.Params {
+			if _, ok := form[p.Name]; !ok {
+				t.Errorf("%s 的参数 %s 不在表单中", id, p.Name)
+			}
+		}
+	}
+}
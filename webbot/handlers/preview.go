@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"webbot/preview"
+	"webbot/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewHandler 预览输出文件：表格的前几行、脚本的前几条语句、压缩包的文件列表和统计信息
+// 参数 rows 为展示的行数，entry 为压缩包中要预览的文件
+// 等待审批的任务只有审批人和管理员可以预览，避免提交人在审批前通过预览拿到完整脚本
+func PreviewHandler(c *gin.Context) {
+	filePath := strings.TrimPrefix(c.Param("filepath"), "/")
+	if filepath.IsAbs(filePath) || filepath.Clean(filePath) != filePath {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的文件路径",
+		})
+		return
+	}
+
+	taskID, _, _ := strings.Cut(filePath, "/")
+	task, err := tasks.Get(taskID)
+	if err != nil || !canAccessTask(c, task) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "任务不存在",
+		})
+		return
+	}
+	if !canPreview(c, task) && task.AwaitingApproval() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "任务结果尚未审批通过，只有审批人可以预览",
+		})
+		return
+	}
+	if !canPreview(c, task) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "任务没有可以预览的结果",
+			"status": task.Status,
+		})
+		return
+	}
+	if !slices.Contains(task.OutputFiles, filePath) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+		})
+		return
+	}
+
+	fullPath := filepath.Join("uploads", filePath)
+	if _, err := os.Stat(fullPath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+		})
+		return
+	}
+
+	rows, _ := strconv.Atoi(c.Query("rows"))
+	var result *preview.Preview
+	if entry := c.Query("entry"); entry != "" {
+		result, err = preview.ZipEntry(fullPath, entry, rows)
+	} else {
+		result, err = preview.File(fullPath, rows)
+	}
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.Is(err, preview.ErrUnsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "预览失败: " + err.Error(),
+		})
+	}
+}
+
+// canPreview 任务已完成且当前用户可以查看输出：被拒绝的任务输出已删除，
+// 等待审批的任务只对提交人以外有审批权限的用户和管理员开放
+func canPreview(c *gin.Context, task *TaskInfo) bool {
+	if task.Status != store.StatusCompleted {
+		return false
+	}
+	switch {
+	case task.Approval == nil:
+		return true
+	case task.Approval.Status == store.ApprovalRejected:
+		return false
+	case task.Approval.Status == store.ApprovalPending:
+		return currentUser(c).IsAdmin() || canReview(c, task)
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"webbot/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTaskTimeout 默认任务超时时间
+const DefaultTaskTimeout = 30 * time.Minute
+
+// 全局任务队列，由 InitJobQueue 初始化
+var jobQueue *queue.Queue
+
+// 任务超时配置，由 SetTaskTimeouts 设置
+var (
+	taskTimeout  = DefaultTaskTimeout
+	taskTimeouts = map[string]time.Duration{}
+)
+
+// SetTaskTimeouts 设置默认任务超时时间和每个功能的超时时间
+func SetTaskTimeouts(defaultTimeout time.Duration, perFunction map[string]time.Duration) {
+	if defaultTimeout > 0 {
+		taskTimeout = defaultTimeout
+	}
+	taskTimeouts = perFunction
+	log.Printf("任务超时: 默认 %v, 按功能 %v", taskTimeout, perFunction)
+}
+
+// timeoutFor 返回功能的超时时间
+func timeoutFor(function string) time.Duration {
+	if timeout, ok := taskTimeouts[function]; ok {
+		return timeout
+	}
+	return taskTimeout
+}
+
+// InitJobQueue 初始化任务队列
+// workers 为同时处理的任务数，maxQueued 为排队等待的任务数上限（0 为不限制），limits 为每个功能的并发上限
+func InitJobQueue(workers, maxQueued int, limits map[string]int) {
+	jobQueue = queue.New(workers, maxQueued, limits, processFileAsync)
+	log.Printf("任务队列已启动: %d 个 worker, 排队上限 %d, 功能并发上限 %v", workers, maxQueued, limits)
+}
+
+// queueFullRetryAfter 队列已满时建议客户端重试的间隔（秒）
+const queueFullRetryAfter = "30"
+
+// respondSubmitError 返回任务提交失败的 503 响应，队列已满时带上 Retry-After
+func respondSubmitError(c *gin.Context, err error) {
+	if errors.Is(err, queue.ErrQueueFull) {
+		c.Header("Retry-After", queueFullRetryAfter)
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// ShutdownJobQueue 关闭任务队列，中断运行中的任务并将未开始的任务标记为失败
+func ShutdownJobQueue() {
+	if jobQueue == nil {
+		return
+	}
+	for _, taskID := range jobQueue.Close() {
+		finishTask(taskID, nil, queue.ErrClosed)
+	}
+}
@@ -1,16 +1,106 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"shared/audit"
+	"shared/configloader"
+	"strings"
+	"syscall"
+	"time"
+	"webbot/auth"
+	"webbot/config"
 	"webbot/handlers"
+	"webbot/processor"
+	"webbot/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	var hashPassword, newAPIToken, printOpenAPI bool
+	cfg, result, err := config.LoadConfig(os.Args[1:], func(fs *flag.FlagSet) {
+		fs.BoolVar(&hashPassword, "hash-password", false, "从标准输入读取密码，输出写入账户文件的 bcrypt 哈希")
+		fs.BoolVar(&newAPIToken, "new-api-token", false, "生成 API token，输出 token 和写入账户文件 api_tokens 的哈希")
+		fs.BoolVar(&printOpenAPI, "openapi", false, "输出 /api/v1 接口的 OpenAPI 文档")
+	})
+	if configloader.IsHelp(err) {
+		return
+	}
+	if hashPassword {
+		printPasswordHash()
+		return
+	}
+	if newAPIToken {
+		printNewAPIToken()
+		return
+	}
+	if printOpenAPI {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(handlers.OpenAPISpec()); err != nil {
+			log.Fatalf("输出 OpenAPI 文档失败: %v", err)
+		}
+		return
+	}
+	if result != nil && result.PrintConfig {
+		configloader.Print(os.Stdout, cfg, result)
+		if err != nil {
+			log.Fatalf("配置无效: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 打开任务数据库，上次运行中断的任务会被标记为失败
+	taskStore, err := store.OpenBoltStore(cfg.TaskDBPath)
+	if err != nil {
+		log.Fatalf("初始化任务存储失败: %v", err)
+	}
+	defer taskStore.Close()
+	handlers.SetTaskStore(taskStore)
+
+	// 锁定用户的key模板在启动任务队列之前设置，处理任务时只读
+	handlers.SetLockUserKeys(processor.LockUserKeys{Spec: cfg.LockUserRedisKeysSpec, Targets: cfg.LockUserRedisKeys})
+
+	// 启动任务队列
+	handlers.SetTaskTimeouts(cfg.TaskTimeout, cfg.TaskTimeouts)
+	handlers.InitJobQueue(cfg.Workers, cfg.MaxQueued, cfg.FunctionLimits)
+	handlers.SetMaxFileSize(cfg.MaxFileSize)
+	processor.SetDedupMemoryLimit(cfg.DedupMemory)
+
+	// 审计日志和双人审批
+	auditLog, err := audit.Open(cfg.AuditFile)
+	if err != nil {
+		log.Fatalf("初始化审计日志失败: %v", err)
+	}
+	defer auditLog.Close()
+	if count, err := auditLog.Verify(); err != nil {
+		log.Printf("⚠️ 审计日志校验失败（已校验 %d 条）: %v", count, err)
+	}
+	if cfg.Approval {
+		handlers.SetApproval(cfg.ApprovalFunctions, auditLog)
+		log.Printf("以下功能需要审批后才能下载: %s", strings.Join(cfg.ApprovalFunctions, ", "))
+	} else {
+		handlers.SetApproval(nil, auditLog)
+	}
+
+	// 初始化登录认证
+	if err := initAuth(cfg); err != nil {
+		log.Fatalf("初始化登录认证失败: %v", err)
+	}
+
 	// 设置 Gin 模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -20,42 +110,159 @@ func main() {
 	// 设置模板函数
 	r.SetFuncMap(template.FuncMap{
 		"base": filepath.Base,
+		"dict": templateDict,
 	})
 
 	// 加载 HTML 模板
 	r.LoadHTMLGlob("templates/*")
 
-	// 静态文件服务
+	// 静态文件服务，上传文件只能通过校验权限的下载接口访问
 	r.Static("/static", "./static")
-	r.Static("/uploads", "./uploads")
 
 	// 路由设置
 	setupRoutes(r)
-	host := "0.0.0.0:9088"
-	log.Println("🚀 WebBot 服务启动成功!")
-	log.Println("📱 访问地址: " + host)
-	log.Fatal(r.Run(host))
+	host := cfg.Listen
+	server := &http.Server{Addr: host, Handler: r}
+
+	go func() {
+		log.Println("🚀 WebBot 服务启动成功!")
+		log.Println("📱 访问地址: " + host)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("服务启动失败: %v", err)
+		}
+	}()
+
+	// 收到退出信号后停止接收请求，中断正在处理的任务
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	log.Println("正在关闭 WebBot 服务...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("关闭HTTP服务失败: %v", err)
+	}
+	handlers.ShutdownJobQueue()
+}
+
+// initAuth 加载账户文件，配置了 OIDC 时同时启用 OIDC 登录
+func initAuth(cfg *config.Config) error {
+	accounts, err := auth.LoadAccounts(cfg.UsersFile)
+	if err != nil {
+		return fmt.Errorf("%v（可参考 users.example.json 创建账户文件）", err)
+	}
+
+	var oidcProvider *auth.OIDCProvider
+	if cfg.OIDC.Issuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		oidcProvider, err = auth.NewOIDCProvider(ctx, auth.OIDCConfig{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			RolesClaim:   cfg.OIDC.RolesClaim,
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("已启用 OIDC 登录: %s", cfg.OIDC.Issuer)
+	}
+
+	handlers.InitAuth(accounts, auth.NewSessionStore(cfg.SessionTTL), oidcProvider, cfg.CookieSecure)
+	return nil
+}
+
+// templateDict 在模板中组装 map，用于向子模板传递多个参数，参数为 key、value 交替
+func templateDict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict 参数个数必须为偶数")
+	}
+	result := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict 的 key 必须是字符串")
+		}
+		result[key] = pairs[i+1]
+	}
+	return result, nil
+}
+
+// printPasswordHash 从标准输入读取密码并输出 bcrypt 哈希
+func printPasswordHash() {
+	fmt.Fprint(os.Stderr, "请输入密码: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("读取密码失败: %v", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Println(hash)
+}
+
+// printNewAPIToken 生成 API token，token 只显示这一次，账户文件中只保存哈希
+func printNewAPIToken() {
+	token, hash := auth.NewAPIToken()
+	fmt.Fprintln(os.Stderr, "API token（只显示这一次，请妥善保存）:")
+	fmt.Println(token)
+	fmt.Fprintln(os.Stderr, "\n写入账户文件对应用户的 api_tokens:")
+	fmt.Fprintf(os.Stderr, "{\"name\": \"<用途>\", \"hash\": \"%s\"}\n", hash)
 }
 
 func setupRoutes(r *gin.Engine) {
+	// 登录路由
+	r.GET("/login", handlers.LoginPageHandler)
+	r.POST("/login", handlers.LoginHandler)
+	r.GET("/auth/oidc/login", handlers.OIDCLoginHandler)
+	r.GET("/auth/oidc/callback", handlers.OIDCCallbackHandler)
+
+	// 以下路由需要登录，修改类请求需要携带 CSRF token
+	authed := r.Group("/", handlers.RequireLogin(), handlers.CSRFProtect())
+
 	// 主页路由
-	r.GET("/", handlers.IndexHandler)
+	authed.GET("/", handlers.IndexHandler)
+	authed.POST("/logout", handlers.LogoutHandler)
 
 	// 功能页面路由
-	r.GET("/upload/:function", handlers.UploadPageHandler)
-	r.POST("/process/:function", handlers.ProcessFileHandler)
-	r.GET("/result/:taskid", handlers.ResultHandler)
+	authed.GET("/upload/:function", handlers.UploadPageHandler)
+	authed.POST("/process/:function", handlers.ProcessFileHandler)
+	authed.GET("/result/:taskid", handlers.ResultHandler)
+	authed.GET("/approvals", handlers.ApprovalsPageHandler)
 
 	// API 路由
-	api := r.Group("/api")
+	api := authed.Group("/api")
 	{
 		api.POST("/upload", handlers.UploadFileHandler)
 		api.GET("/progress/:taskid", handlers.ProgressHandler)
+		api.GET("/events/:taskid", handlers.TaskEventsHandler)
+		api.GET("/ws/:taskid", handlers.TaskSocketHandler)
+		api.DELETE("/task/:taskid", handlers.CancelTaskHandler)
+		api.POST("/task/:taskid/approve", handlers.ApproveTaskHandler)
+		api.POST("/task/:taskid/reject", handlers.RejectTaskHandler)
 		api.GET("/download/*filepath", handlers.DownloadHandler)
+		api.GET("/preview/*filepath", handlers.PreviewHandler)
+		api.GET("/audit", handlers.AuditQueryHandler)
+		api.GET("/audit/verify", handlers.AuditVerifyHandler)
+	}
+
+	// 供脚本调用的版本化接口，使用 API token 认证，不需要登录会话和 CSRF token
+	v1 := r.Group("/api/v1")
+	{
+		v1.GET("/openapi.json", handlers.OpenAPIHandler)
+
+		jobs := v1.Group("/jobs", handlers.RequireAPIToken())
+		jobs.POST("", handlers.CreateJobHandler)
+		jobs.GET("/:id", handlers.GetJobHandler)
+		jobs.GET("/:id/artifacts", handlers.ListArtifactsHandler)
+		jobs.GET("/:id/artifacts/:name", handlers.DownloadArtifactHandler)
 	}
 
 	// 帮助页面
-	r.GET("/help", handlers.HelpHandler)
+	authed.GET("/help", handlers.HelpHandler)
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
@@ -0,0 +1,314 @@
+// Package preview 生成输出文件的预览：表格的前几行、脚本的前几条语句、压缩包的文件列表和统计信息
+// 所有预览都从磁盘流式读取，只保留展示的行和去重用的ID集合，不会把整个文件读入内存
+package preview
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 预览行数
+const (
+	DefaultRows = 50
+	MaxRows     = 500
+)
+
+// 预览类型
+const (
+	KindTable   = "table"   // CSV/XLSX，按表格展示
+	KindScript  = "script"  // SQL/Redis 命令，按语句高亮展示
+	KindArchive = "archive" // zip，展示文件列表
+	KindText    = "text"    // 其他文本文件，按行展示
+)
+
+const (
+	// maxDistinctIDs 统计不同ID的上限，超过后只报告下限，避免超大文件占用过多内存
+	maxDistinctIDs = 1000000
+	// maxCellRunes 单元格和语句展示的最大字符数
+	maxCellRunes = 1000
+	// sniffSize 判断 .txt 文件内容时读取的字节数
+	sniffSize = 4096
+	// maxZipXLSX 压缩包中的 Excel 需要整体读入内存才能解析，超过该大小不预览
+	maxZipXLSX = 50 * 1024 * 1024
+)
+
+// ErrUnsupported 文件格式不支持预览
+var ErrUnsupported = errors.New("该文件格式不支持预览")
+
+// Preview 文件预览
+type Preview struct {
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"`
+	Size       int64       `json:"size"`
+	Columns    []string    `json:"columns,omitempty"`    // table
+	Rows       [][]string  `json:"rows,omitempty"`       // table
+	Statements []Statement `json:"statements,omitempty"` // script
+	Lines      []string    `json:"lines,omitempty"`      // text
+	Entries    []Entry     `json:"entries,omitempty"`    // archive
+	Truncated  bool        `json:"truncated"`            // 只展示了前一部分
+	Stats      Stats       `json:"stats"`
+}
+
+// Entry 压缩包中的文件
+type Entry struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	Compressed  int64  `json:"compressed"`
+	Previewable bool   `json:"previewable"`
+}
+
+// Stats 统计信息，扫描整个文件得到
+type Stats struct {
+	Rows        int         `json:"rows"`                   // 表格的数据行数、脚本的语句数或文本的行数
+	IDColumn    string      `json:"id_column,omitempty"`    // 表格中统计不同ID的列
+	DistinctIDs int         `json:"distinct_ids,omitempty"` // 不同用户ID的数量
+	IDsCapped   bool        `json:"ids_capped,omitempty"`   // 不同ID超过统计上限，DistinctIDs 为下限
+	Commands    []VerbCount `json:"commands,omitempty"`     // 脚本中每种语句的数量
+	Files       int         `json:"files,omitempty"`        // 压缩包中的文件数
+}
+
+// VerbCount 一种语句的数量，例如 UPDATE 或 DEL
+type VerbCount struct {
+	Verb  string `json:"verb"`
+	Count int    `json:"count"`
+}
+
+// File 预览磁盘上的文件，rows 为展示的行数
+func File(path string, rows int) (*Preview, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	name := filepath.Base(path)
+	rows = clampRows(rows)
+
+	switch kindOf(name) {
+	case KindArchive:
+		return previewZip(path, name, info.Size())
+	case KindTable:
+		if strings.EqualFold(filepath.Ext(name), ".xlsx") {
+			return previewXLSX(path, name, info.Size(), rows)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	return previewReader(name, info.Size(), file, rows)
+}
+
+// ZipEntry 预览压缩包中的一个文件，解压时流式读取
+func ZipEntry(path, entry string, rows int) (*Preview, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包失败: %v", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != entry || f.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Base(f.Name)
+		size := int64(f.UncompressedSize64)
+		if !previewable(name) {
+			return nil, ErrUnsupported
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("读取压缩包文件 %s 失败: %v", f.Name, err)
+		}
+		defer rc.Close()
+
+		if strings.EqualFold(filepath.Ext(name), ".xlsx") {
+			if size > maxZipXLSX {
+				return nil, fmt.Errorf("压缩包中的 Excel 文件超过 %d MB，请下载后查看", maxZipXLSX/1024/1024)
+			}
+			return previewXLSXReader(rc, name, size, clampRows(rows))
+		}
+		return previewReader(name, size, rc, clampRows(rows))
+	}
+	return nil, fmt.Errorf("压缩包中没有文件 %s", entry)
+}
+
+// clampRows 限制预览行数
+func clampRows(rows int) int {
+	if rows <= 0 {
+		return DefaultRows
+	}
+	if rows > MaxRows {
+		return MaxRows
+	}
+	return rows
+}
+
+// kindOf 按扩展名判断预览类型，Redis 命令文件为 .txt
+func kindOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".xlsx":
+		return KindTable
+	case ".sql", ".txt", ".redis":
+		return KindScript
+	case ".zip":
+		return KindArchive
+	default:
+		return KindText
+	}
+}
+
+// previewable 压缩包中的文件是否可以预览，不支持嵌套的压缩包
+func previewable(name string) bool {
+	return kindOf(name) != KindArchive
+}
+
+// previewReader 按类型预览文本文件
+func previewReader(name string, size int64, r io.Reader, rows int) (*Preview, error) {
+	p := &Preview{Name: name, Kind: kindOf(name), Size: size}
+	// .txt 也可能是日志解析结果或处理报告，不是 Redis 命令时按文本展示
+	if p.Kind == KindScript && !strings.EqualFold(filepath.Ext(name), ".sql") {
+		br := bufio.NewReaderSize(r, sniffSize)
+		head, _ := br.Peek(sniffSize)
+		if !looksLikeRedis(head) {
+			p.Kind = KindText
+		}
+		r = br
+	}
+	var err error
+	switch p.Kind {
+	case KindTable:
+		err = p.readCSV(r, rows)
+	case KindScript:
+		err = p.readScript(r, rows)
+	default:
+		err = p.readText(r, rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// previewZip 列出压缩包中的文件
+func previewZip(path, name string, size int64) (*Preview, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包失败: %v", err)
+	}
+	defer zr.Close()
+
+	p := &Preview{Name: name, Kind: KindArchive, Size: size, Entries: []Entry{}}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		p.Entries = append(p.Entries, Entry{
+			Name:        f.Name,
+			Size:        int64(f.UncompressedSize64),
+			Compressed:  int64(f.CompressedSize64),
+			Previewable: previewable(f.Name),
+		})
+	}
+	p.Stats.Files = len(p.Entries)
+	return p, nil
+}
+
+// readText 按行预览文本文件，包含 NUL 字符的文件视为二进制文件
+func (p *Preview) readText(r io.Reader, rows int) error {
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if p.Stats.Rows == 0 {
+			line = bytes.TrimPrefix(line, []byte("\ufeff"))
+		}
+		if bytes.IndexByte(line, 0) >= 0 || !utf8.Valid(line) {
+			return ErrUnsupported
+		}
+		p.Stats.Rows++
+		if len(p.Lines) < rows {
+			p.Lines = append(p.Lines, truncate(string(line)))
+		} else {
+			p.Truncated = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", p.Name, err)
+	}
+	return nil
+}
+
+// newScanner 创建按行读取的 scanner，单行最长 10MB
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	return scanner
+}
+
+// truncate 截断过长的内容，按字符截断避免切开多字节字符
+func truncate(s string) string {
+	if utf8.RuneCountInString(s) <= maxCellRunes {
+		return s
+	}
+	return string([]rune(s)[:maxCellRunes]) + "…"
+}
+
+// idCounter 统计不同ID的数量，数字ID按 uint64 保存以节省内存
+type idCounter struct {
+	numbers map[uint64]struct{}
+	others  map[string]struct{}
+	capped  bool
+}
+
+func newIDCounter() *idCounter {
+	return &idCounter{numbers: make(map[uint64]struct{}), others: make(map[string]struct{})}
+}
+
+// add 记录一个ID，达到上限后不再记录
+func (c *idCounter) add(id string) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return
+	}
+	if c.count() >= maxDistinctIDs {
+		c.capped = true
+		return
+	}
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		c.numbers[n] = struct{}{}
+		return
+	}
+	c.others[id] = struct{}{}
+}
+
+func (c *idCounter) count() int {
+	return len(c.numbers) + len(c.others)
+}
+
+// verbCounter 统计每种语句的数量
+type verbCounter map[string]int
+
+// sorted 按数量从多到少排序，数量相同时按名称排序
+func (v verbCounter) sorted() []VerbCount {
+	result := make([]VerbCount, 0, len(v))
+	for verb, count := range v {
+		result = append(result, VerbCount{Verb: verb, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Verb < result[j].Verb
+	})
+	return result
+}
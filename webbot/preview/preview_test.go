@@ -0,0 +1,234 @@
+package preview
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// describe 汇总预览中测试关心的字段
+func describe(p *Preview) string {
+	s := fmt.Sprintf("kind=%s rows=%d shown=%d truncated=%v", p.Kind, p.Stats.Rows, len(p.Rows)+len(p.Statements)+len(p.Lines), p.Truncated)
+	if p.Columns != nil {
+		s += fmt.Sprintf(" columns=%s", strings.Join(p.Columns, "|"))
+	}
+	if p.Stats.IDColumn != "" || p.Stats.DistinctIDs > 0 {
+		s += fmt.Sprintf(" ids=%s:%d", p.Stats.IDColumn, p.Stats.DistinctIDs)
+	}
+	for _, c := range p.Stats.Commands {
+		s += fmt.Sprintf(" %s=%d", c.Verb, c.Count)
+	}
+	return s
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		rows    int
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "空CSV",
+			file:    "empty.csv",
+			content: "",
+			want:    "kind=table rows=0 shown=0 truncated=false",
+		},
+		{
+			name:    "CSV表头和ID统计，超过行数时截断",
+			file:    "users.csv",
+			content: "\ufeffname,user_id\na,1\nb,2\n,\nc,1\n",
+			rows:    2,
+			want:    "kind=table rows=3 shown=2 truncated=true columns=name|user_id ids=user_id:2",
+		},
+		{
+			name:    "没有表头的UID名单按第一列统计，列数不一致时补齐列名",
+			file:    "uids.csv",
+			content: "1\n2,x\n2\n",
+			want:    "kind=table rows=3 shown=3 truncated=false columns=列1|列2 ids=列1:2",
+		},
+		{
+			name:    "不规范的引号宽松解析",
+			file:    "bad.csv",
+			content: "id,name\n1,a\"b\n",
+			want:    "kind=table rows=1 shown=1 truncated=false columns=id|name ids=id:1",
+		},
+		{
+			name:    "SQL语句统计",
+			file:    "lock.sql",
+			content: "-- 注释\nUPDATE b_user SET status = -1 WHERE id = 7;\n\nupdate b_kyc set is_lock = 1 where user_id = 8 and id = 1;\nDELETE FROM t WHERE user_id = 7;\n",
+			rows:    1,
+			want:    "kind=script rows=3 shown=1 truncated=true ids=:2 UPDATE=2 DELETE=1",
+		},
+		{
+			name:    "Redis命令文件",
+			file:    "redis_db0.txt",
+			content: "# 注释\ndel user:token:{1} user:info:{1}\ndel 23056048\nset a:{2} 1\n",
+			want:    "kind=script rows=3 shown=3 truncated=false ids=:3 DEL=2 SET=1",
+		},
+		{
+			name:    "不是Redis命令的txt按文本展示",
+			file:    "report.txt",
+			content: "处理完成\n共 2 行\n",
+			rows:    1,
+			want:    "kind=text rows=2 shown=1 truncated=true",
+		},
+		{name: "包含NUL的文件", file: "data.bin", content: "abc\x00def\n", wantErr: ErrUnsupported.Error()},
+		{name: "无效的UTF-8", file: "data.log", content: "abc\xff\n", wantErr: ErrUnsupported.Error()},
+		{name: "单行超过10MB", file: "huge.log", content: strings.Repeat("x", 10*1024*1024+1), wantErr: "读取 huge.log 失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := File(path, tt.rows)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("File 错误 = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(p); got != tt.want {
+				t.Errorf("File = %s\nwant   %s", got, tt.want)
+			}
+			if p.Size != int64(len(tt.content)) {
+				t.Errorf("Size = %d, want %d", p.Size, len(tt.content))
+			}
+		})
+	}
+}
+
+// 过长的单元格和语句按字符截断，行数参数限制在 1 到 MaxRows 之间
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		rows    int
+		shown   int
+	}{
+		{"过长的单元格", "long.csv", "id,name\n1," + strings.Repeat("长", maxCellRunes+1) + "\n", 0, 1},
+		{"过长的语句", "long.sql", "UPDATE t SET a = '" + strings.Repeat("长", maxCellRunes) + "';\n", 0, 1},
+		{"默认行数", "many.log", strings.Repeat("x\n", DefaultRows+1), 0, DefaultRows},
+		{"行数上限", "many.log", strings.Repeat("x\n", MaxRows+1), MaxRows + 100, MaxRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p, err := File(path, tt.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			for _, row := range p.Rows {
+				texts = append(texts, row[len(row)-1])
+			}
+			for _, stmt := range p.Statements {
+				var sb strings.Builder
+				for _, token := range stmt.Tokens {
+					sb.WriteString(token.Text)
+				}
+				texts = append(texts, sb.String())
+			}
+			texts = append(texts, p.Lines...)
+			if len(texts) != tt.shown {
+				t.Fatalf("展示了 %d 行, want %d", len(texts), tt.shown)
+			}
+			for _, text := range texts {
+				if n := len([]rune(text)); n > maxCellRunes+1 {
+					t.Errorf("展示内容 %d 个字符，超过 %d", n, maxCellRunes+1)
+				}
+				if strings.Contains(tt.file, "long") && !strings.HasSuffix(text, "…") {
+					t.Errorf("截断的内容没有省略号: %q", text[len(text)-10:])
+				}
+			}
+		})
+	}
+}
+
+func TestZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockuser-files.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(file)
+	for name, content := range map[string]string{
+		"lockuser-files/lockUser-db_user库.sql":  "UPDATE b_user SET status = -1 WHERE id = 1;\n",
+		"lockuser-files/lockUser-redis_db0.txt": "del user:token:{1}\n",
+		"lockuser-files/nested.zip":             "PK",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if _, err := zw.Create("lockuser-files/empty/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	p, err := File(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previewable := 0
+	for _, e := range p.Entries {
+		if e.Previewable {
+			previewable++
+		}
+	}
+	if p.Kind != KindArchive || p.Stats.Files != 3 || previewable != 2 {
+		t.Errorf("压缩包预览 = %+v", p)
+	}
+
+	tests := []struct {
+		entry   string
+		want    string
+		wantErr string
+	}{
+		{entry: "lockuser-files/lockUser-redis_db0.txt", want: "kind=script rows=1 shown=1 truncated=false ids=:1 DEL=1"},
+		{entry: "lockuser-files/lockUser-db_user库.sql", want: "kind=script rows=1 shown=1 truncated=false ids=:1 UPDATE=1"},
+		{entry: "lockuser-files/nested.zip", wantErr: ErrUnsupported.Error()},
+		{entry: "lockuser-files/empty/", wantErr: "压缩包中没有文件"},
+		{entry: "../etc/passwd", wantErr: "压缩包中没有文件"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			p, err := ZipEntry(path, tt.entry, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ZipEntry 错误 = %v, want %s", err, tt.wantErr)
+				}
+				if tt.wantErr == ErrUnsupported.Error() && !errors.Is(err, ErrUnsupported) {
+					t.Errorf("ZipEntry 错误 = %v, want ErrUnsupported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(p); got != tt.want {
+				t.Errorf("ZipEntry = %s\nwant        %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"shared/audit"
+	"strings"
+	"unicode"
+)
+
+// 高亮的词法类型，页面按类型设置颜色
+const (
+	TokenPlain   = "plain"
+	TokenKeyword = "keyword" // SQL 关键字
+	TokenCommand = "command" // Redis 命令
+	TokenKey     = "key"     // Redis key
+	TokenString  = "string"
+	TokenNumber  = "number"
+	TokenComment = "comment"
+)
+
+// Statement 一条语句，Line 为在文件中的行号
+type Statement struct {
+	Line   int     `json:"line"`
+	Tokens []Token `json:"tokens"`
+}
+
+// Token 高亮的一段文本
+type Token struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// sqlKeywords 高亮的 SQL 关键字
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range strings.Fields(`SELECT INSERT INTO VALUES UPDATE SET DELETE FROM WHERE AND OR NOT IN IS NULL
+		LIKE BETWEEN LIMIT ORDER BY GROUP HAVING AS ON JOIN LEFT RIGHT INNER OUTER REPLACE IGNORE DUPLICATE KEY
+		CREATE ALTER DROP TRUNCATE TABLE INDEX BEGIN COMMIT ROLLBACK START TRANSACTION USE CASE WHEN THEN ELSE END
+		NOW DEFAULT DISTINCT UNION ALL EXISTS`) {
+		sqlKeywords[kw] = true
+	}
+}
+
+// redisCommands 识别 Redis 命令文件的命令
+var redisCommands = map[string]bool{}
+
+func init() {
+	for _, cmd := range strings.Fields(`DEL UNLINK SET SETEX SETNX PSETEX GET MSET GETSET INCR INCRBY DECR DECRBY APPEND
+		EXPIRE PEXPIRE EXPIREAT PERSIST EXISTS TTL TYPE RENAME HSET HSETNX HMSET HGET HDEL HINCRBY
+		SADD SREM ZADD ZREM ZINCRBY LPUSH RPUSH LPOP RPOP LREM LSET LTRIM SELECT`) {
+		redisCommands[cmd] = true
+	}
+}
+
+// looksLikeRedis 根据第一条非空、非注释的行判断 .txt 文件是否为 Redis 命令文件
+func looksLikeRedis(head []byte) bool {
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		return redisCommands[strings.ToUpper(verb)]
+	}
+	return false
+}
+
+// readScript 流式读取 SQL 或 Redis 命令文件，空行和注释行不计入语句数
+func (p *Preview) readScript(r io.Reader, rows int) error {
+	sql := strings.EqualFold(filepath.Ext(p.Name), ".sql")
+	verbs := verbCounter{}
+	ids := newIDCounter()
+
+	scanner := newScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		p.Stats.Rows++
+		verb, _, _ := strings.Cut(trimmed, " ")
+		verbs[strings.ToUpper(strings.TrimRight(verb, ";"))]++
+		matched := audit.LineAffectedIDs(trimmed)
+		for _, id := range matched {
+			ids.add(id)
+		}
+		// lockuser 生成的 Redis 命令直接以用户ID为 key，例如 del 23056048
+		if !sql && len(matched) == 0 {
+			if fields := strings.Fields(trimmed); len(fields) == 2 && isDigits(fields[1]) {
+				ids.add(fields[1])
+			}
+		}
+
+		if len(p.Statements) >= rows {
+			p.Truncated = true
+			continue
+		}
+		text := truncate(trimmed)
+		var tokens []Token
+		if sql {
+			tokens = tokenizeSQL(text)
+		} else {
+			tokens = tokenizeRedis(text)
+		}
+		p.Statements = append(p.Statements, Statement{Line: lineNum, Tokens: tokens})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", p.Name, err)
+	}
+
+	p.Stats.Commands = verbs.sorted()
+	p.Stats.DistinctIDs = ids.count()
+	p.Stats.IDsCapped = ids.capped
+	return nil
+}
+
+// tokens 合并相邻的同类文本
+type tokens []Token
+
+func (t *tokens) add(typ, text string) {
+	if text == "" {
+		return
+	}
+	if n := len(*t); n > 0 && (*t)[n-1].Type == typ {
+		(*t)[n-1].Text += text
+		return
+	}
+	*t = append(*t, Token{Type: typ, Text: text})
+}
+
+// tokenizeSQL 拆分一行 SQL：关键字、字符串、数字和行尾注释
+func tokenizeSQL(line string) []Token {
+	var result tokens
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			result.add(TokenComment, string(runes[i:]))
+			i = len(runes)
+		case r == '\'' || r == '"':
+			end := quoteEnd(runes, i)
+			result.add(TokenString, string(runes[i:end]))
+			i = end
+		case r == '`':
+			end := quoteEnd(runes, i)
+			result.add(TokenPlain, string(runes[i:end]))
+			i = end
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			result.add(TokenNumber, string(runes[i:end]))
+			i = end
+		case r == '_' || unicode.IsLetter(r):
+			end := i
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			word := string(runes[i:end])
+			if sqlKeywords[strings.ToUpper(word)] {
+				result.add(TokenKeyword, word)
+			} else {
+				result.add(TokenPlain, word)
+			}
+			i = end
+		default:
+			result.add(TokenPlain, string(r))
+			i++
+		}
+	}
+	return result
+}
+
+// quoteEnd 返回从 start 开始的引号内容的结束位置，支持重复引号和反斜杠转义，没有闭合时到行尾
+func quoteEnd(runes []rune, start int) int {
+	quote := runes[start]
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(runes) && runes[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+// tokenizeRedis 拆分一行 Redis 命令：命令、key 和参数，参数中的数字和带引号的字符串分别高亮
+func tokenizeRedis(line string) []Token {
+	var result tokens
+	runes := []rune(line)
+	arg := 0
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			end := i
+			for end < len(runes) && unicode.IsSpace(runes[end]) {
+				end++
+			}
+			result.add(TokenPlain, string(runes[i:end]))
+			i = end
+			continue
+		}
+
+		end := i
+		if runes[i] == '"' || runes[i] == '\'' {
+			end = quoteEnd(runes, i)
+		} else {
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+		}
+		word := string(runes[i:end])
+		switch {
+		case arg == 0:
+			result.add(TokenCommand, word)
+		case arg == 1:
+			result.add(TokenKey, word)
+		case runes[i] == '"' || runes[i] == '\'':
+			result.add(TokenString, word)
+		case isNumber(word):
+			result.add(TokenNumber, word)
+		default:
+			result.add(TokenPlain, word)
+		}
+		arg++
+		i = end
+	}
+	return result
+}
+
+// isDigits 是否全部为数字
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
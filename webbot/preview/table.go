@@ -0,0 +1,194 @@
+package preview
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// idColumnNames 表头中表示用户ID的列名
+var idColumnNames = map[string]bool{
+	"uid":     true,
+	"user_id": true,
+	"userid":  true,
+	"id":      true,
+	"用户id":    true,
+}
+
+// table 逐行读取表格，第一行全部不是数字时作为表头
+type table struct {
+	p     *Preview
+	rows  int
+	first bool
+	idCol int
+	ids   *idCounter
+}
+
+func newTable(p *Preview, rows int) *table {
+	return &table{p: p, rows: rows, first: true, idCol: -1, ids: newIDCounter()}
+}
+
+// add 处理一行
+func (t *table) add(fields []string) {
+	if t.first {
+		t.first = false
+		if len(fields) > 0 {
+			fields[0] = strings.TrimPrefix(fields[0], "\ufeff")
+		}
+		if isHeader(fields) {
+			t.p.Columns = truncateAll(fields)
+			for i, name := range fields {
+				if idColumnNames[strings.ToLower(strings.TrimSpace(name))] {
+					t.idCol = i
+					t.p.Stats.IDColumn = name
+					break
+				}
+			}
+			return
+		}
+		// 没有表头时第一列为数字的文件（例如UID名单）按第一列统计
+		if len(fields) > 0 && isNumber(fields[0]) {
+			t.idCol = 0
+			t.p.Stats.IDColumn = "列1"
+		}
+	}
+
+	if isBlank(fields) {
+		return
+	}
+	t.p.Stats.Rows++
+	if t.idCol >= 0 && t.idCol < len(fields) {
+		t.ids.add(fields[t.idCol])
+	}
+	if len(t.p.Rows) < t.rows {
+		t.p.Rows = append(t.p.Rows, truncateAll(fields))
+	} else {
+		t.p.Truncated = true
+	}
+}
+
+// finish 补齐列名并写入统计
+func (t *table) finish() {
+	width := len(t.p.Columns)
+	for _, row := range t.p.Rows {
+		width = max(width, len(row))
+	}
+	for i := len(t.p.Columns); i < width; i++ {
+		t.p.Columns = append(t.p.Columns, fmt.Sprintf("列%d", i+1))
+	}
+	if t.idCol >= 0 {
+		t.p.Stats.DistinctIDs = t.ids.count()
+		t.p.Stats.IDsCapped = t.ids.capped
+	}
+}
+
+// readCSV 流式读取 CSV，字段数不一致的行也会展示
+func (p *Preview) readCSV(r io.Reader, rows int) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	t := newTable(p, rows)
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", p.Name, err)
+		}
+		t.add(fields)
+	}
+	t.finish()
+	return nil
+}
+
+// previewXLSX 预览 Excel 文件的第一个工作表，按行流式读取
+func previewXLSX(path, name string, size int64, rows int) (*Preview, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开 Excel 文件失败: %v", err)
+	}
+	defer f.Close()
+	return readXLSX(f, name, size, rows)
+}
+
+// previewXLSXReader 预览压缩包中的 Excel 文件
+func previewXLSXReader(r io.Reader, name string, size int64, rows int) (*Preview, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("打开 Excel 文件失败: %v", err)
+	}
+	defer f.Close()
+	return readXLSX(f, name, size, rows)
+}
+
+// readXLSX 读取第一个工作表
+func readXLSX(f *excelize.File, name string, size int64, rows int) (*Preview, error) {
+	sheet := f.GetSheetName(0)
+	iter, err := f.Rows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("读取工作表 %s 失败: %v", sheet, err)
+	}
+	defer iter.Close()
+
+	p := &Preview{Name: name, Kind: KindTable, Size: size}
+	t := newTable(p, rows)
+	for iter.Next() {
+		fields, err := iter.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("读取工作表 %s 失败: %v", sheet, err)
+		}
+		t.add(fields)
+	}
+	if err := iter.Error(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("读取工作表 %s 失败: %v", sheet, err)
+	}
+	t.finish()
+	return p, nil
+}
+
+// isHeader 第一行的非空字段都不是数字时视为表头
+func isHeader(fields []string) bool {
+	found := false
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if isNumber(field) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// isNumber 是否为数字
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+// isBlank 是否为空行
+func isBlank(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// truncateAll 复制并截断每个字段
+func truncateAll(fields []string) []string {
+	result := make([]string, len(fields))
+	for i, field := range fields {
+		result[i] = truncate(field)
+	}
+	return result
+}
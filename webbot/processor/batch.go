@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shared/batch"
+	"shared/dedup"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// MaxBatchExtractSize 批量任务压缩包解压后的大小上限
+const MaxBatchExtractSize = 500 * 1024 * 1024 // 500MB
+
+// batchSpecs 支持批量处理的功能及合并规则，与各功能读取输入文件的方式保持一致
+var batchSpecs = map[string]batch.Spec{
+	// 第一列为用户ID，没有表头
+	"lockuser": {Extensions: []string{".csv"}, Header: batch.NoHeader, KeyColumns: []int{0}, MinColumns: 1, Columns: 1},
+	// 第一行为表头，user_id 和 id 共同确定一条审核记录；保留审核结论和原因等所有列，各文件的表头必须一致
+	// 合并时保留重复行，同一条记录的结论不同时由审核逻辑报错，而不是只保留第一个结论
+	"kycreview": {Extensions: []string{".csv", ".xlsx"}, Header: batch.Header, KeyColumns: []int{0, 1}, MinColumns: 2, KeepDuplicates: true},
+	// 第一列为用户ID，第一行不是数字时视为表头
+	"redisdel": {Extensions: []string{".csv", ".xlsx"}, Header: batch.AutoHeader, KeyColumns: []int{0}, MinColumns: 1, Columns: 1},
+	// 第一行为表头，每个用户只保留一行流水数据
+	"redisadd": {Extensions: []string{".csv"}, Header: batch.Header, KeyColumns: []int{0}, MinColumns: 4, Columns: 4},
+	// 去重逻辑需要统计每个UID在所有文件中的出现次数，合并时保留重复行
+	"uiddedup": {Extensions: []string{".csv"}, Header: batch.NoHeader, KeepDuplicates: true},
+}
+
+// BatchSupported 功能是否支持一次上传多个文件
+func BatchSupported(function string) bool {
+	_, ok := batchSpecs[function]
+	return ok
+}
+
+// BatchAccepts 检查批量任务中的单个文件格式是否适用于该功能
+func BatchAccepts(function, filename string) bool {
+	spec, ok := batchSpecs[function]
+	return ok && spec.Accepts(filename)
+}
+
+// IsBatchInput 输入文件是否为批量任务的压缩包，集合运算的压缩包按名单A、名单B处理，不合并
+func IsBatchInput(function, inputFile string, options map[string]string) bool {
+	return BatchSupported(function) && batch.IsZip(inputFile) && !IsSetOperation(function, options)
+}
+
+// IsSetOperation UID去重任务是否为两个名单之间的集合运算
+func IsSetOperation(function string, options map[string]string) bool {
+	if function != "uiddedup" {
+		return false
+	}
+	mode, err := dedup.ParseMode(options["dedup_mode"])
+	return err == nil && mode.SetOperation()
+}
+
+// PrepareBatch 解压批量任务的压缩包，校验所有文件后按ID去重合并为一个输入文件
+// 合并文件写入 workDir，每个文件的统计写入 outputDir/batch_report.csv，返回合并文件和报告文件路径
+func PrepareBatch(ctx context.Context, function, inputFile, workDir, outputDir string, callback ProgressCallback) (string, string, *batch.Report, error) {
+	spec := batchSpecs[function]
+
+	callback(12, "正在解压批量文件...")
+	files, err := batch.Extract(inputFile, filepath.Join(workDir, "files"), MaxBatchExtractSize)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	mergedFile := filepath.Join(workDir, "merged.csv")
+	report, err := batch.Merge(ctx, spec, files, readRows, mergedFile, func(index int, name string) {
+		callback(15+index*10/len(files), fmt.Sprintf("正在合并第 %d/%d 个文件: %s", index+1, len(files), name))
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	reportFile := filepath.Join(outputDir, "batch_report.csv")
+	if err := report.WriteCSV(reportFile); err != nil {
+		return "", "", nil, err
+	}
+
+	callback(25, report.Summary())
+	return mergedFile, reportFile, report, nil
+}
+
+// readRows 读取批量任务中的 CSV 或 Excel 文件（第一个工作表）的所有行
+func readRows(path string) ([][]string, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".xlsx" {
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("打开Excel文件失败: %v", err)
+		}
+		defer f.Close()
+		return f.GetRows(f.GetSheetName(0))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开CSV文件失败: %v", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	// 不同文件、不同行的列数可以不一致，由合并规则统一
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
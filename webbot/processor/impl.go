@@ -2,11 +2,15 @@ package processor
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"shared/kyc"
+	"shared/pack"
+	"shared/rediskey"
+	"shared/snapshot"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,7 +25,7 @@ func getCurrentDateString() string {
 }
 
 // processLogFile 处理日志文件的具体实现
-func processLogFile(inputFile, outputFile string, callback ProgressCallback) error {
+func processLogFile(ctx context.Context, inputFile, outputFile string, callback ProgressCallback) error {
 	callback(20, "打开日志文件...")
 
 	// 打开输入文件
@@ -59,6 +63,10 @@ func processLogFile(inputFile, outputFile string, callback ProgressCallback) err
 	processedLines := 0
 
 	for scanner.Scan() {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		lineNum++
 		line := scanner.Text()
 
@@ -196,14 +204,14 @@ func hasValidData(row []string) bool {
 	return false
 }
 
-// processLockUserFile 处理用户锁定文件
-func processLockUserFile(inputFile, sqlFile, redisFile string, callback ProgressCallback) error {
+// processLockUserFile 处理用户锁定文件，Redis命令按DB写入 outputDir/lockUser-redis_db{N}.txt
+func processLockUserFile(ctx context.Context, inputFile, sqlFile, outputDir string, targets []rediskey.Template, users *snapshot.Snapshot, callback ProgressCallback) ([]string, *snapshot.Report, error) {
 	callback(20, "读取用户ID列表...")
 
 	// 读取CSV文件
 	file, err := os.Open(inputFile)
 	if err != nil {
-		return fmt.Errorf("打开CSV文件失败: %v", err)
+		return nil, nil, fmt.Errorf("打开CSV文件失败: %v", err)
 	}
 	defer file.Close()
 
@@ -212,40 +220,57 @@ func processLockUserFile(inputFile, sqlFile, redisFile string, callback Progress
 
 	records, err := reader.ReadAll()
 	if err != nil {
-		return fmt.Errorf("读取CSV失败: %v", err)
+		return nil, nil, fmt.Errorf("读取CSV失败: %v", err)
 	}
 
 	// 提取第一列的用户ID
 	for _, record := range records {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		if len(record) > 0 && record[0] != "" {
 			userIds = append(userIds, strings.TrimSpace(record[0]))
 		}
 	}
 
 	if len(userIds) == 0 {
-		return fmt.Errorf("未找到有效的用户ID")
+		return nil, nil, fmt.Errorf("未找到有效的用户ID")
+	}
+
+	// 对照快照，只为会被锁定的用户生成SQL，Redis删除命令仍为所有用户生成
+	lockIds := userIds
+	var report *snapshot.Report
+	if users != nil {
+		lockIds, report = snapshot.CheckLock(users, userIds)
+		callback(35, fmt.Sprintf("对照快照：%d 个用户会被锁定，%d 个跳过", len(lockIds), len(report.Skipped)))
 	}
 
 	callback(40, fmt.Sprintf("找到 %d 个用户ID，生成SQL语句...", len(userIds)))
 
 	// 生成SQL文件
-	sqlContent := generateLockUserSQL(userIds)
+	sqlContent := generateLockUserSQL(lockIds)
 	err = os.WriteFile(sqlFile, []byte(sqlContent), 0644)
 	if err != nil {
-		return fmt.Errorf("写入SQL文件失败: %v", err)
+		return nil, nil, fmt.Errorf("写入SQL文件失败: %v", err)
 	}
 
 	callback(70, "生成Redis命令...")
 
-	// 生成Redis命令文件
-	redisContent := generateLockUserRedis(userIds)
-	err = os.WriteFile(redisFile, []byte(redisContent), 0644)
-	if err != nil {
-		return fmt.Errorf("写入Redis文件失败: %v", err)
+	// 按DB生成Redis命令文件
+	var redisFiles []string
+	for _, target := range targets {
+		redisContent := generateLockUserRedis(userIds, target.Templates)
+		redisFile := filepath.Join(outputDir, fmt.Sprintf("lockUser-redis_db%d.txt", target.DB))
+		err = os.WriteFile(redisFile, []byte(redisContent), 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("写入Redis文件失败: %v", err)
+		}
+		redisFiles = append(redisFiles, redisFile)
 	}
 
-	callback(95, "用户锁定处理完成")
-	return nil
+	callback(75, fmt.Sprintf("已生成 %d 个DB的Redis命令文件", len(redisFiles)))
+	return redisFiles, report, nil
 }
 
 // generateLockUserSQL 生成用户锁定SQL语句
@@ -261,20 +286,13 @@ func generateLockUserSQL(userIds []string) string {
 	return strings.Join(sqlStatements, "\n")
 }
 
-// generateLockUserRedis 生成用户Redis删除命令
-func generateLockUserRedis(userIds []string) string {
-	var redisCommands []string
-
-	for _, userId := range userIds {
-		command := fmt.Sprintf("del %s", userId)
-		redisCommands = append(redisCommands, command)
-	}
-
-	return strings.Join(redisCommands, "\n")
+// generateLockUserRedis 按key模板生成用户Redis删除命令，同一用户的命令相邻
+func generateLockUserRedis(userIds []string, templates []string) string {
+	return strings.Join(rediskey.DelCommands(templates, userIds), "\n")
 }
 
 // processSQLFile 处理SQL文件的具体实现
-func processSQLFile(inputFile, outputFile string, callback ProgressCallback) error {
+func processSQLFile(ctx context.Context, inputFile, outputFile string, callback ProgressCallback) error {
 	callback(20, "打开SQL日志文件...")
 
 	// 打开输入文件
@@ -303,6 +321,10 @@ func processSQLFile(inputFile, outputFile string, callback ProgressCallback) err
 	lineNum := 0
 
 	for scanner.Scan() {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		lineNum++
 		line := scanner.Text()
 
@@ -360,255 +382,62 @@ func processSQLFile(inputFile, outputFile string, callback ProgressCallback) err
 	return nil
 }
 
-func processFileSplitLogic(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
-	callback(20, "开始分析文件...")
-
-	// 打开输入文件
-	file, err := os.Open(inputFile)
-	if err != nil {
-		return nil, fmt.Errorf("打开文件失败: %v", err)
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	// 增加缓冲区大小以处理超长的行
-	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
-	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
-
-	var currentFileIndex int = 1
-	var currentLineCount int = 0
-	var currentOutputFile *os.File
-	var outputFiles []string
-
-	// 获取原文件名（不含路径）
-	baseFileName := filepath.Base(inputFile)
-	// 获取原文件扩展名
-	fileExt := filepath.Ext(baseFileName)
-	// 去掉原文件扩展名
-	nameWithoutExt := strings.TrimSuffix(baseFileName, fileExt)
-
-	callback(30, "开始文件分割...")
-
-	// 创建第一个输出文件
-	outputFileName := filepath.Join(outputDir, fmt.Sprintf("%s_part_%04d%s", nameWithoutExt, currentFileIndex, fileExt))
-	currentOutputFile, err = os.Create(outputFileName)
-	if err != nil {
-		return nil, fmt.Errorf("创建输出文件失败: %v", err)
-	}
-	outputFiles = append(outputFiles, outputFileName)
-
-	totalLines := 0
-
-	// 逐行读取并写入
-	for scanner.Scan() {
-		line := scanner.Text()
-		totalLines++
-		currentLineCount++
-
-		// 写入当前输出文件
-		_, err := currentOutputFile.WriteString(line + "\n")
-		if err != nil {
-			currentOutputFile.Close()
-			return nil, fmt.Errorf("写入文件失败: %v", err)
-		}
-
-		// 如果当前文件已达到10000行，创建新文件
-		if currentLineCount >= 10000 {
-			currentOutputFile.Close()
-			currentFileIndex++
-			currentLineCount = 0
-
-			// 创建新的输出文件
-			outputFileName = filepath.Join(outputDir, fmt.Sprintf("%s_part_%04d%s", nameWithoutExt, currentFileIndex, fileExt))
-			currentOutputFile, err = os.Create(outputFileName)
-			if err != nil {
-				return nil, fmt.Errorf("创建输出文件失败: %v", err)
-			}
-			outputFiles = append(outputFiles, outputFileName)
-
-			// 更新进度
-			progress := 30 + (totalLines*60/100000) // 假设最多100000行
-			if progress > 90 {
-				progress = 90
-			}
-			callback(progress, fmt.Sprintf("正在创建第 %d 个分割文件，已处理 %d 行...", currentFileIndex, totalLines))
-		}
-
-		// 定期更新进度
-		if totalLines%1000 == 0 {
-			progress := 30 + (totalLines*60/100000)
-			if progress > 90 {
-				progress = 90
-			}
-			callback(progress, fmt.Sprintf("已处理 %d 行数据...", totalLines))
-		}
-	}
-
-	// 关闭最后一个输出文件
-	if currentOutputFile != nil {
-		currentOutputFile.Close()
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("读取文件时发生错误: %v", err)
-	}
-
-	callback(95, fmt.Sprintf("文件分割完成！总计 %d 行数据，分割为 %d 个文件", totalLines, currentFileIndex))
-	return outputFiles, nil
-}
-
-func processKYCFile(inputFile, outputFile string, callback ProgressCallback) error {
+func processKYCFile(ctx context.Context, inputFile, outputFile, summaryFile string, current *snapshot.Snapshot, callback ProgressCallback) (*snapshot.Report, error) {
 	callback(20, "开始处理KYC审核数据...")
 
 	// 检查文件格式
 	ext := strings.ToLower(filepath.Ext(inputFile))
 	if ext != ".xlsx" && ext != ".csv" {
-		return fmt.Errorf("只支持Excel (.xlsx) 或CSV格式的文件")
-	}
-
-	// 创建输出文件
-	outFile, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %v", err)
+		return nil, fmt.Errorf("只支持Excel (.xlsx) 或CSV格式的文件")
 	}
-	defer outFile.Close()
 
 	callback(30, "正在读取文件数据...")
-
-	var sqlCount int
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
-
-	if ext == ".xlsx" {
-		// 处理Excel文件
-		err = processKYCExcelFile(inputFile, outFile, currentTime, &sqlCount, callback)
-	} else if ext == ".csv" {
-		// 处理CSV文件
-		err = processKYCCSVFile(inputFile, outFile, currentTime, &sqlCount, callback)
-	}
-
+	rows, err := readRows(inputFile)
 	if err != nil {
-		return fmt.Errorf("处理文件失败: %v", err)
+		return nil, fmt.Errorf("处理文件失败: %v", err)
 	}
-
-	callback(95, fmt.Sprintf("KYC审核处理完成！共生成 %d 条SQL语句", sqlCount))
-	return nil
-}
-
-// processKYCExcelFile 处理Excel格式的KYC文件
-func processKYCExcelFile(inputFile string, outFile *os.File, currentTime string, sqlCount *int, callback ProgressCallback) error {
-	f, err := excelize.OpenFile(inputFile)
-	if err != nil {
-		return fmt.Errorf("打开Excel文件失败: %v", err)
-	}
-	defer f.Close()
-
-	// 获取第一个工作表的名称
-	sheetName := f.GetSheetName(0)
-	if sheetName == "" {
-		return fmt.Errorf("获取工作表失败")
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// 获取所有行
-	rows, err := f.GetRows(sheetName)
+	// 检查审核结论和允许的状态变更，任一行有误时不生成SQL
+	callback(50, "正在检查审核结论...")
+	batch, err := kyc.Parse(rows)
 	if err != nil {
-		return fmt.Errorf("读取工作表数据失败: %v", err)
+		return nil, err
 	}
 
-	callback(50, "正在生成SQL语句...")
-
-	// 跳过标题行，处理数据行
-	for i, row := range rows {
-		if i == 0 {
-			continue // 跳过标题行
-		}
-
-		// 确保行有足够的列数据
-		if len(row) >= 2 {
-			// 假设第1列是 user_id，第2列是 id
-			userId := strings.TrimSpace(row[0])
-			recordId := strings.TrimSpace(row[1])
-
-			// 生成 SQL 语句
-			if userId != "" && recordId != "" {
-				sql := fmt.Sprintf("UPDATE b_kyc set audit_status = 1,audit_at = '%s' where audit_status = 2 and is_lock = 0 and user_id = %s and id = %s;\n",
-					currentTime, userId, recordId)
-
-				_, err := outFile.WriteString(sql)
-				if err != nil {
-					return fmt.Errorf("写入SQL语句失败: %v", err)
-				}
-				*sqlCount++
-			}
-		}
-
-		// 每处理1000行更新进度
-		if i%1000 == 0 && i > 0 {
-			progress := 50 + (i*40/len(rows))
-			if progress > 90 {
-				progress = 90
-			}
-			callback(progress, fmt.Sprintf("已处理 %d 行KYC数据，生成 %d 条SQL...", i, *sqlCount))
+	// 对照快照，去掉不会变更的记录
+	var report *snapshot.Report
+	if current != nil {
+		report = batch.Check(current)
+		if len(batch.Records) == 0 {
+			return nil, fmt.Errorf("对照快照后没有会变更的记录，未生成SQL（%s）", strings.ReplaceAll(report.Summary(), "\n", "，"))
 		}
+		callback(60, strings.ReplaceAll(report.Summary(), "\n", "，"))
 	}
 
-	return nil
-}
-
-// processKYCCSVFile 处理CSV格式的KYC文件
-func processKYCCSVFile(inputFile string, outFile *os.File, currentTime string, sqlCount *int, callback ProgressCallback) error {
-	csvFile, err := os.Open(inputFile)
+	// 创建输出文件
+	outFile, err := os.Create(outputFile)
 	if err != nil {
-		return fmt.Errorf("打开CSV文件失败: %v", err)
+		return nil, fmt.Errorf("创建输出文件失败: %v", err)
 	}
-	defer csvFile.Close()
+	defer outFile.Close()
 
-	reader := csv.NewReader(csvFile)
-	records, err := reader.ReadAll()
+	callback(70, fmt.Sprintf("正在生成 %d 条SQL语句...", len(batch.Records)))
+	sqlCount, err := batch.WriteSQL(outFile, time.Now())
 	if err != nil {
-		return fmt.Errorf("读取CSV数据失败: %v", err)
+		return nil, err
 	}
-
-	callback(50, "正在生成SQL语句...")
-
-	// 跳过标题行，处理数据行
-	for i, record := range records {
-		if i == 0 {
-			continue // 跳过标题行
-		}
-
-		// 确保行有足够的列数据
-		if len(record) >= 2 {
-			// 假设第1列是 user_id，第2列是 id
-			userId := strings.TrimSpace(record[0])
-			recordId := strings.TrimSpace(record[1])
-
-			// 生成 SQL 语句
-			if userId != "" && recordId != "" {
-				sql := fmt.Sprintf("UPDATE b_kyc set audit_status = 1,audit_at = '%s' where audit_status = 2 and is_lock = 0 and user_id = %s and id = %s;\n",
-					currentTime, userId, recordId)
-
-				_, err := outFile.WriteString(sql)
-				if err != nil {
-					return fmt.Errorf("写入SQL语句失败: %v", err)
-				}
-				*sqlCount++
-			}
-		}
-
-		// 每处理1000行更新进度
-		if i%1000 == 0 && i > 0 {
-			progress := 50 + (i*40/len(records))
-			if progress > 90 {
-				progress = 90
-			}
-			callback(progress, fmt.Sprintf("已处理 %d 行KYC数据，生成 %d 条SQL...", i, *sqlCount))
-		}
+	if err := batch.WriteSummary(summaryFile); err != nil {
+		return nil, err
 	}
 
-	return nil
+	callback(95, fmt.Sprintf("KYC审核处理完成！共生成 %d 条SQL语句（%s）", sqlCount, strings.ReplaceAll(batch.Summary(), "\n", "，")))
+	return report, nil
 }
 
-func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+func processRedisDelLogic(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始Redis删除命令生成流程...")
 
 	// 检查文件格式
@@ -632,10 +461,10 @@ func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback
 
 	if ext == ".xlsx" {
 		// 处理Excel文件
-		err = processRedisDelExcelFile(inputFile, outFile, &totalCount, callback)
+		err = processRedisDelExcelFile(ctx, inputFile, outFile, &totalCount, callback)
 	} else if ext == ".csv" {
 		// 处理CSV文件
-		err = processRedisDelCSVFile(inputFile, outFile, &totalCount, callback)
+		err = processRedisDelCSVFile(ctx, inputFile, outFile, &totalCount, callback)
 	}
 
 	if err != nil {
@@ -647,7 +476,7 @@ func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback
 	callback(60, fmt.Sprintf("步骤1完成：成功生成 %d 条Redis命令", totalCount*2))
 
 	// 步骤2：分割Redis命令文件
-	callback(65, "步骤2：分割Redis命令文件（每10,000行一个文件）...")
+	callback(65, "步骤2：按哈希槽分割Redis命令文件（每个文件约10,000行）...")
 
 	// 创建分割目录
 	splitDir := filepath.Join(outputDir, "redis-split")
@@ -656,7 +485,7 @@ func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback
 	}
 
 	// 分割文件
-	splitFiles, err := splitRedisCommandFile(redisCommandsFile, splitDir, callback)
+	splitFiles, err := splitRedisCommandFile(ctx, redisCommandsFile, splitDir, callback)
 	if err != nil {
 		return nil, fmt.Errorf("分割Redis命令文件失败: %v", err)
 	}
@@ -685,8 +514,19 @@ func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback
 	// 步骤4：压缩分割目录
 	callback(92, "步骤4：压缩redis-split文件夹...")
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 只打包分割文件、槽位索引和执行脚本，执行脚本运行前按 MANIFEST.json 校验
+	packFiles := append(splitFiles, filepath.Join(splitDir, rediskey.SlotIndexFileName), scriptDst)
 	zipFile := filepath.Join(outputDir, "redis-split.zip")
-	err = createZipFile(splitDir, zipFile, callback)
+	manifest := &pack.Manifest{
+		Operation: "redisdel",
+		Params:    map[string]string{"split_mode": "slot", "split_size": strconv.Itoa(redisSplitLines)},
+		Dir:       "redis-split",
+	}
+	err = manifest.Zip(zipFile, pack.Paths(packFiles...))
 	if err != nil {
 		return nil, fmt.Errorf("压缩文件夹失败: %v", err)
 	}
@@ -703,7 +543,7 @@ func processRedisDelLogic(inputFile, outputDir string, callback ProgressCallback
 }
 
 // processRedisDelExcelFile 处理Excel格式的Redis删除文件
-func processRedisDelExcelFile(inputFile string, outFile *os.File, totalCount *int, callback ProgressCallback) error {
+func processRedisDelExcelFile(ctx context.Context, inputFile string, outFile *os.File, totalCount *int, callback ProgressCallback) error {
 	f, err := excelize.OpenFile(inputFile)
 	if err != nil {
 		return fmt.Errorf("打开Excel文件失败: %v", err)
@@ -729,6 +569,10 @@ func processRedisDelExcelFile(inputFile string, outFile *os.File, totalCount *in
 
 	// 遍历所有行
 	for rowIndex, row := range rows {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// 跳过空行
 		if len(row) == 0 {
 			continue
@@ -780,7 +624,7 @@ func processRedisDelExcelFile(inputFile string, outFile *os.File, totalCount *in
 }
 
 // processRedisDelCSVFile 处理CSV格式的Redis删除文件
-func processRedisDelCSVFile(inputFile string, outFile *os.File, totalCount *int, callback ProgressCallback) error {
+func processRedisDelCSVFile(ctx context.Context, inputFile string, outFile *os.File, totalCount *int, callback ProgressCallback) error {
 	csvFile, err := os.Open(inputFile)
 	if err != nil {
 		return fmt.Errorf("打开CSV文件失败: %v", err)
@@ -794,6 +638,10 @@ func processRedisDelCSVFile(inputFile string, outFile *os.File, totalCount *int,
 	rowIndex := 0
 
 	for scanner.Scan() {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		line := strings.TrimSpace(scanner.Text())
 
 		// 跳过空行
@@ -861,7 +709,7 @@ func isNumeric(s string) bool {
 	return err == nil
 }
 
-func processRedisAddLogic(inputFile, outputFile string, callback ProgressCallback) error {
+func processRedisAddLogic(ctx context.Context, inputFile, outputFile string, callback ProgressCallback) error {
 	callback(20, "开始Redis增加命令生成...")
 
 	// 检查文件格式
@@ -898,6 +746,10 @@ func processRedisAddLogic(inputFile, outputFile string, callback ProgressCallbac
 
 	// 跳过标题行，处理数据行
 	for i, record := range records {
+		// 每行检查一次任务是否被取消或超时
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if i == 0 {
 			continue // 跳过标题行
 		}
@@ -984,121 +836,6 @@ func processRedisAddLogic(inputFile, outputFile string, callback ProgressCallbac
 	return nil
 }
 
-func processUIDDedupLogic(inputFile, outputFile, reportFile string, callback ProgressCallback) error {
-	callback(20, "开始UID去重处理...")
-
-	// 检查文件格式
-	ext := strings.ToLower(filepath.Ext(inputFile))
-	if ext != ".csv" {
-		return fmt.Errorf("只支持CSV格式的文件")
-	}
-
-	callback(30, "正在读取和统计UID...")
-
-	// 打开输入文件
-	inFile, err := os.Open(inputFile)
-	if err != nil {
-		return fmt.Errorf("打开输入文件失败: %v", err)
-	}
-	defer inFile.Close()
-
-	// 统计每个uid的出现次数
-	uidCounts := make(map[string]int)
-
-	scanner := bufio.NewScanner(inFile)
-	totalLines := 0
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			uidCounts[line]++
-			totalLines++
-
-			// 每处理10000行显示一次进度
-			if totalLines%10000 == 0 {
-				progress := 30 + (totalLines*30/100000) // 假设最多100000行
-				if progress > 60 {
-					progress = 60
-				}
-				callback(progress, fmt.Sprintf("已读取 %d 行数据...", totalLines))
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取文件时出错: %v", err)
-	}
-
-	callback(70, "正在分析重复情况...")
-
-	// 统计重复情况
-	uniqueCount := 0
-	duplicateCount := 0
-	duplicateExamples := make(map[string]int)
-	exampleCount := 0
-
-	for uid, count := range uidCounts {
-		if count == 1 {
-			uniqueCount++
-		} else {
-			duplicateCount++
-			// 收集前10个重复uid作为示例
-			if exampleCount < 10 {
-				duplicateExamples[uid] = count
-				exampleCount++
-			}
-		}
-	}
-
-	callback(80, fmt.Sprintf("分析完成！总行数: %d, 不同UID: %d, 唯一UID: %d, 重复UID: %d", totalLines, len(uidCounts), uniqueCount, duplicateCount))
-
-	// 创建去重后的输出文件
-	outFile, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %v", err)
-	}
-	defer outFile.Close()
-
-	// 写入唯一的uid
-	writtenCount := 0
-	for uid, count := range uidCounts {
-		if count == 1 {
-			_, err := outFile.WriteString(uid + "\n")
-			if err != nil {
-				return fmt.Errorf("写入文件时出错: %v", err)
-			}
-			writtenCount++
-		}
-	}
-
-	callback(90, "正在生成去重报告...")
-
-	// 创建去重报告文件
-	report, err := os.Create(reportFile)
-	if err != nil {
-		return fmt.Errorf("创建报告文件失败: %v", err)
-	}
-	defer report.Close()
-
-	// 写入详细报告
-	report.WriteString("UID去重处理报告\n")
-	report.WriteString("==================\n\n")
-	report.WriteString(fmt.Sprintf("总共读取了 %d 行数据\n", totalLines))
-	report.WriteString(fmt.Sprintf("发现 %d 个不同的UID\n", len(uidCounts)))
-	report.WriteString(fmt.Sprintf("唯一UID数量: %d\n", uniqueCount))
-	report.WriteString(fmt.Sprintf("重复UID数量: %d\n\n", duplicateCount))
-
-	if len(duplicateExamples) > 0 {
-		report.WriteString("重复UID示例（前10个）:\n")
-		for uid, count := range duplicateExamples {
-			report.WriteString(fmt.Sprintf("UID: %s, 出现次数: %d\n", uid, count))
-		}
-	}
-
-	callback(95, fmt.Sprintf("UID去重完成！成功写入 %d 个唯一UID，原始数据: %d 行，去重后: %d 个唯一UID", writtenCount, totalLines, uniqueCount))
-	return nil
-}
-
 // SQL解析相关的辅助函数
 
 // generateSQLKey 生成SQL的唯一标识，用于去重
@@ -1259,80 +996,23 @@ func extractFieldName(condition string) string {
 	return ""
 }
 
-// splitRedisCommandFile 分割Redis命令文件为多个小文件
-func splitRedisCommandFile(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
-	// 打开输入文件
-	file, err := os.Open(inputFile)
-	if err != nil {
-		return nil, fmt.Errorf("打开输入文件失败: %v", err)
-	}
-	defer file.Close()
-
-	var outputFiles []string
-	scanner := bufio.NewScanner(file)
+// redisSplitLines Redis命令分割后每个文件的行数
+const redisSplitLines = 10000
 
-	// 增加缓冲区大小以处理超长的行
-	buf := make([]byte, 0, 1024*1024) // 1MB 缓冲区
-	scanner.Buffer(buf, 1024*1024)    // 最大 1MB
-
-	var currentFileIndex int = 1
-	var currentLineCount int = 0
-	var currentOutputFile *os.File
-
-	totalLines := 0
-
-	// 创建第一个输出文件
-	outputFileName := filepath.Join(outputDir, fmt.Sprintf("redis_commands_part_%04d.txt", currentFileIndex))
-	currentOutputFile, err = os.Create(outputFileName)
+// splitRedisCommandFile 按哈希槽分割Redis命令文件为多个小文件
+// 同一用户的命令使用相同的哈希标签，会被写入同一个分割文件
+func splitRedisCommandFile(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+	parts, err := rediskey.SplitBySlot(inputFile, outputDir, redisSplitLines)
 	if err != nil {
-		return nil, fmt.Errorf("创建输出文件失败: %v", err)
+		return nil, err
 	}
-	outputFiles = append(outputFiles, outputFileName)
 
-	// 逐行读取并写入
-	for scanner.Scan() {
-		line := scanner.Text()
-		totalLines++
-		currentLineCount++
-
-		// 写入当前输出文件
-		_, err := currentOutputFile.WriteString(line + "\n")
-		if err != nil {
-			currentOutputFile.Close()
-			return nil, fmt.Errorf("写入文件失败: %v", err)
-		}
-
-		// 如果当前文件已达到10000行，创建新文件
-		if currentLineCount >= 10000 {
-			currentOutputFile.Close()
-			currentFileIndex++
-			currentLineCount = 0
-
-			// 创建新的输出文件
-			outputFileName = filepath.Join(outputDir, fmt.Sprintf("redis_commands_part_%04d.txt", currentFileIndex))
-			currentOutputFile, err = os.Create(outputFileName)
-			if err != nil {
-				return nil, fmt.Errorf("创建输出文件失败: %v", err)
-			}
-			outputFiles = append(outputFiles, outputFileName)
-
-			// 更新进度 (65% -> 80% 之间)
-			progress := 65 + (currentFileIndex*15/100)
-			if progress > 80 {
-				progress = 80
-			}
-			callback(progress, fmt.Sprintf("正在创建第 %d 个分割文件，已处理 %d 行...", currentFileIndex, totalLines))
-		}
+	outputFiles := make([]string, 0, len(parts))
+	for _, part := range parts {
+		outputFiles = append(outputFiles, part.File)
 	}
 
-	// 关闭最后一个输出文件
-	if currentOutputFile != nil {
-		currentOutputFile.Close()
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("读取文件时发生错误: %v", err)
-	}
+	callback(78, fmt.Sprintf("按哈希槽分割为 %d 个文件，槽位索引: %s", len(parts), rediskey.SlotIndexFileName))
 
 	return outputFiles, nil
 }
@@ -1353,39 +1033,4 @@ func copyFile(src, dst string) error {
 
 	_, err = sourceFile.WriteTo(destFile)
 	return err
-}
-
-// createZipFile 创建ZIP压缩文件
-func createZipFile(sourceDir, zipPath string, callback ProgressCallback) error {
-	// 使用绝对路径
-	absSourceDir, err := filepath.Abs(sourceDir)
-	if err != nil {
-		return fmt.Errorf("获取源目录绝对路径失败: %v", err)
-	}
-
-	absZipPath, err := filepath.Abs(zipPath)
-	if err != nil {
-		return fmt.Errorf("获取压缩文件绝对路径失败: %v", err)
-	}
-
-	// 切换到源目录的父目录
-	parentDir := filepath.Dir(absSourceDir)
-	sourceDirName := filepath.Base(absSourceDir)
-
-	// 使用系统zip命令进行压缩
-	zipCmd := exec.Command("zip", "-r", absZipPath, sourceDirName)
-	zipCmd.Dir = parentDir
-
-	// 执行命令并获取详细错误信息
-	output, err := zipCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("压缩文件失败: %v, 输出: %s", err, string(output))
-	}
-
-	// 检查压缩文件是否创建成功
-	if _, err := os.Stat(absZipPath); os.IsNotExist(err) {
-		return fmt.Errorf("压缩文件创建失败，文件不存在: %s", absZipPath)
-	}
-
-	return nil
 }
\ No newline at end of file
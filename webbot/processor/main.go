@@ -1,24 +1,37 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"shared/batch"
+	"shared/dedup"
+	"shared/kyc"
+	"shared/pack"
+	"shared/snapshot"
+	"shared/split"
+	"strings"
 )
 
 // ProgressCallback 进度回调函数类型
 type ProgressCallback func(progress int, message string)
 
 // ProcessLogParse 处理日志解析
-func ProcessLogParse(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+func ProcessLogParse(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始日志解析...")
 
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// 创建输出文件路径
 	outputFile := filepath.Join(outputDir, "parsed_data.csv")
 
 	// 调用实际的日志解析逻辑
 	// 这里需要复用 tgbot 中的实际处理逻辑
-	err := processLogFile(inputFile, outputFile, callback)
+	err := processLogFile(ctx, inputFile, outputFile, callback)
 	if err != nil {
 		return nil, err
 	}
@@ -27,46 +40,59 @@ func ProcessLogParse(inputFile, outputDir string, callback ProgressCallback) ([]
 	return []string{outputFile}, nil
 }
 
-// ProcessLockUser 处理用户锁定
-func ProcessLockUser(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+// ProcessLockUser 处理用户锁定，keys 为需要删除的Redis key模板，options["snapshot"] 为 b_user 快照时只为快照中存在且未锁定的用户生成SQL
+func ProcessLockUser(ctx context.Context, inputFile, outputDir string, keys LockUserKeys, options map[string]string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始用户锁定处理...")
 
-	// 生成输出文件
-	sqlFile := filepath.Join(outputDir, "lockUser-db_user库.sql")
-	redisFile := filepath.Join(outputDir, "lockUser-redis_db0.txt")
+	if len(keys.Targets) == 0 {
+		return nil, fmt.Errorf("未配置锁定用户的Redis key模板")
+	}
 
-	// 调用实际的用户锁定处理逻辑
-	err := processLockUserFile(inputFile, sqlFile, redisFile, callback)
-	if err != nil {
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	callback(80, "正在创建压缩包...")
+	var users *snapshot.Snapshot
+	if path := options["snapshot"]; path != "" {
+		var err error
+		if users, err = snapshot.LoadUsers(path); err != nil {
+			return nil, err
+		}
+	}
 
-	// 创建压缩包目录
+	// 创建压缩包目录，SQL和按DB分组的Redis命令文件直接生成到该目录
 	lockUserDir := filepath.Join(outputDir, "lockuser-files")
 	if err := os.MkdirAll(lockUserDir, 0755); err != nil {
 		return nil, fmt.Errorf("创建锁定文件目录失败: %v", err)
 	}
 
-	// 复制文件到压缩目录
-	sqlDst := filepath.Join(lockUserDir, "lockUser-db_user库.sql")
-	redisDst := filepath.Join(lockUserDir, "lockUser-redis_db0.txt")
+	sqlFile := filepath.Join(lockUserDir, "lockUser-db_user库.sql")
 
-	if err := copyFile(sqlFile, sqlDst); err != nil {
-		return nil, fmt.Errorf("复制SQL文件失败: %v", err)
+	// 调用实际的用户锁定处理逻辑
+	redisFiles, report, err := processLockUserFile(ctx, inputFile, sqlFile, lockUserDir, keys.Targets, users, callback)
+	if err != nil {
+		return nil, err
+	}
+	outputs := append([]string{sqlFile}, redisFiles...)
+	if report != nil {
+		reportFile, err := writeSnapshotReport(lockUserDir, "lockuser", report)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, reportFile)
 	}
 
-	if err := copyFile(redisFile, redisDst); err != nil {
-		return nil, fmt.Errorf("复制Redis文件失败: %v", err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	callback(90, "正在压缩文件...")
 
-	// 压缩整个目录
+	// 只打包SQL和Redis命令文件，清单记录每个文件的行数和校验和
 	zipFile := filepath.Join(outputDir, "lockuser-files.zip")
-	err = createZipFile(lockUserDir, zipFile, callback)
-	if err != nil {
+	manifest := &pack.Manifest{Operation: "lockuser", Params: keys.Params(), Dir: "lockuser-files"}
+	if err := manifest.Zip(zipFile, pack.Paths(outputs...)); err != nil {
 		return nil, fmt.Errorf("压缩文件失败: %v", err)
 	}
 
@@ -79,12 +105,17 @@ func ProcessLockUser(inputFile, outputDir string, callback ProgressCallback) ([]
 }
 
 // ProcessSQLParse 处理SQL解析
-func ProcessSQLParse(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+func ProcessSQLParse(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始SQL解析...")
 
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	outputFile := filepath.Join(outputDir, "parsed_sql.log")
 
-	err := processSQLFile(inputFile, outputFile, callback)
+	err := processSQLFile(ctx, inputFile, outputFile, callback)
 	if err != nil {
 		return nil, err
 	}
@@ -93,40 +124,89 @@ func ProcessSQLParse(inputFile, outputDir string, callback ProgressCallback) ([]
 	return []string{outputFile}, nil
 }
 
-// ProcessFileSplit 处理文件分割
-func ProcessFileSplit(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+// ProcessFileSplit 处理文件分割，options 为上传时提交的分割参数
+func ProcessFileSplit(ctx context.Context, inputFile, outputDir string, options map[string]string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始文件分割...")
 
-	outputFiles, err := processFileSplitLogic(inputFile, outputDir, callback)
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opts, err := SplitOptions(options)
 	if err != nil {
 		return nil, err
 	}
 
-	callback(100, "文件分割完成")
-	return outputFiles, nil
+	callback(30, fmt.Sprintf("开始文件分割：%s", opts))
+	result, err := split.Run(ctx, inputFile, outputDir, opts, func(done, total int64, rows, parts int) {
+		progress := 30
+		if total > 0 {
+			progress += int(done * 60 / total)
+		}
+		callback(progress, fmt.Sprintf("已处理 %d 行，生成 %d 个分割文件...", rows, parts))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	callback(100, fmt.Sprintf("文件分割完成！%s", result.Summary()))
+	return result.Files(), nil
+}
+
+// SplitOptions 解析文件分割参数，参数为空时按每10000行分割
+func SplitOptions(options map[string]string) (split.Options, error) {
+	return split.ParseOptions(options["split_mode"], options["split_size"], options["split_header"], options["split_column"], options["split_name"])
 }
 
-// ProcessKYCReview 处理KYC审核
-func ProcessKYCReview(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+// ProcessKYCReview 处理KYC审核，options["snapshot"] 为 b_kyc 快照时只为会变更的记录生成SQL
+func ProcessKYCReview(ctx context.Context, inputFile, outputDir string, options map[string]string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始KYC审核处理...")
 
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var current *snapshot.Snapshot
+	if path := options["snapshot"]; path != "" {
+		var err error
+		if current, err = kyc.LoadSnapshot(path); err != nil {
+			return nil, err
+		}
+	}
+
 	// 生成带日期的文件名
 	outputFile := filepath.Join(outputDir, fmt.Sprintf("kyc-%s.sql", getCurrentDateString()))
+	summaryFile := filepath.Join(outputDir, fmt.Sprintf("kyc-summary-%s.csv", getCurrentDateString()))
 
-	err := processKYCFile(inputFile, outputFile, callback)
+	report, err := processKYCFile(ctx, inputFile, outputFile, summaryFile, current, callback)
 	if err != nil {
 		return nil, err
 	}
+	outputs := []string{outputFile, summaryFile}
+	if report != nil {
+		reportFile, err := writeSnapshotReport(outputDir, "kycreview", report)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, reportFile)
+	}
 
 	callback(100, "KYC审核处理完成")
-	return []string{outputFile}, nil
+	return outputs, nil
 }
 
 // ProcessRedisDel 处理Redis删除
-func ProcessRedisDel(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+func ProcessRedisDel(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始Redis删除命令生成...")
 
-	outputFiles, err := processRedisDelLogic(inputFile, outputDir, callback)
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	outputFiles, err := processRedisDelLogic(ctx, inputFile, outputDir, callback)
 	if err != nil {
 		return nil, err
 	}
@@ -136,12 +216,17 @@ func ProcessRedisDel(inputFile, outputDir string, callback ProgressCallback) ([]
 }
 
 // ProcessRedisAdd 处理Redis增加
-func ProcessRedisAdd(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+func ProcessRedisAdd(ctx context.Context, inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始Redis增加命令生成...")
 
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	outputFile := filepath.Join(outputDir, "redis_add_commands.txt")
 
-	err := processRedisAddLogic(inputFile, outputFile, callback)
+	err := processRedisAddLogic(ctx, inputFile, outputFile, callback)
 	if err != nil {
 		return nil, err
 	}
@@ -150,44 +235,87 @@ func ProcessRedisAdd(inputFile, outputDir string, callback ProgressCallback) ([]
 	return []string{outputFile}, nil
 }
 
-// ProcessUIDDedup 处理UID去重
-func ProcessUIDDedup(inputFile, outputDir string, callback ProgressCallback) ([]string, error) {
+// dedupMemoryLimit UID去重的内存预算，由 SetDedupMemoryLimit 设置
+var dedupMemoryLimit int64 = dedup.DefaultMemoryLimit
+
+// SetDedupMemoryLimit 设置UID去重的内存预算，超出时按UID哈希分区写入临时文件处理
+func SetDedupMemoryLimit(limit int64) {
+	if limit > 0 {
+		dedupMemoryLimit = limit
+	}
+}
+
+// ProcessUIDDedup 处理UID去重，options["dedup_mode"] 为去重方式
+// 集合运算的输入是名单A和名单B打包成的压缩包，结果和报告打包为带 MANIFEST.json 的压缩包
+func ProcessUIDDedup(ctx context.Context, inputFile, outputDir string, options map[string]string, callback ProgressCallback) ([]string, error) {
 	callback(10, "开始UID去重处理...")
 
-	outputFile := filepath.Join(outputDir, "dedup_uids.csv")
-	reportFile := filepath.Join(outputDir, "dedup_report.txt")
+	// 排队期间任务可能已被取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	err := processUIDDedupLogic(inputFile, outputFile, reportFile, callback)
+	mode, err := dedup.ParseMode(options["dedup_mode"])
 	if err != nil {
 		return nil, err
 	}
 
-	callback(80, "正在创建压缩包...")
-
-	// 创建压缩包目录
-	dedupDir := filepath.Join(outputDir, "dedup-files")
-	if err := os.MkdirAll(dedupDir, 0755); err != nil {
-		return nil, fmt.Errorf("创建去重文件目录失败: %v", err)
+	inputs := []string{inputFile}
+	var names []string
+	if mode.SetOperation() {
+		if !batch.IsZip(inputFile) {
+			return nil, fmt.Errorf("%s 需要上传名单A和名单B两个文件", string(mode))
+		}
+		files, err := batch.Extract(inputFile, filepath.Join(filepath.Dir(outputDir), "lists"), MaxBatchExtractSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) != 2 {
+			return nil, fmt.Errorf("%s 需要 2 个名单，压缩包中有 %d 个文件", string(mode), len(files))
+		}
+		inputs, names = []string{files[0].Path, files[1].Path}, []string{files[0].Name, files[1].Name}
+	} else if strings.ToLower(filepath.Ext(inputFile)) != ".csv" {
+		return nil, fmt.Errorf("只支持CSV格式的文件")
 	}
 
-	// 复制文件到压缩目录
-	uidDst := filepath.Join(dedupDir, "dedup_uids.csv")
-	reportDst := filepath.Join(dedupDir, "dedup_report.txt")
+	callback(20, fmt.Sprintf("正在读取和统计UID：%s", mode))
+
+	outputFile := filepath.Join(outputDir, "dedup_uids.csv")
+	if mode == dedup.Duplicates {
+		outputFile = filepath.Join(outputDir, "duplicate_uids.csv")
+	}
+	result, err := dedup.Run(ctx, mode, inputs, outputFile, dedup.Options{MemoryLimit: dedupMemoryLimit}, func(list int, done, total int64, lines int) {
+		// 读取进度占 20%-70%，集合运算的两个名单各占一半
+		progress := 20
+		if total > 0 {
+			progress += int(done * int64(50/len(inputs)) / total)
+		}
+		progress += list * 50 / len(inputs)
+		callback(progress, fmt.Sprintf("已读取 %d 行数据...", lines))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		result.Lists[i].Name = name
+	}
 
-	if err := copyFile(outputFile, uidDst); err != nil {
-		return nil, fmt.Errorf("复制去重文件失败: %v", err)
+	callback(75, "正在生成去重报告...")
+	reportFile := filepath.Join(outputDir, "dedup_report.txt")
+	if err := result.WriteReport(reportFile); err != nil {
+		return nil, err
 	}
 
-	if err := copyFile(reportFile, reportDst); err != nil {
-		return nil, fmt.Errorf("复制报告文件失败: %v", err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	callback(90, "正在压缩文件...")
 
-	// 压缩整个目录
+	// 只打包结果和报告，清单记录去重方式
 	zipFile := filepath.Join(outputDir, "dedup-files.zip")
-	err = createZipFile(dedupDir, zipFile, callback)
-	if err != nil {
+	manifest := pack.Manifest{Operation: "uiddedup", Params: options, Dir: "dedup-files"}
+	if err := manifest.Zip(zipFile, pack.Paths(outputFile, reportFile)); err != nil {
 		return nil, fmt.Errorf("压缩文件失败: %v", err)
 	}
 
@@ -195,6 +323,6 @@ func ProcessUIDDedup(inputFile, outputDir string, callback ProgressCallback) ([]
 	taskID := filepath.Base(filepath.Dir(outputDir))
 	relativeZipPath := filepath.Join(taskID, "output", "dedup-files.zip")
 
-	callback(100, "UID去重处理完成，文件已打包压缩")
+	callback(100, fmt.Sprintf("UID去重完成！%s 结果 %d 个UID，文件已打包压缩", string(mode), result.Written))
 	return []string{relativeZipPath}, nil
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package processor
+
+import (
+	"shared/rediskey"
+)
+
+// LockUserKeys 锁定用户时需要删除的Redis key模板，由 config 在启动时解析校验后传给 ProcessLockUser
+type LockUserKeys struct {
+	Spec    string              // 原始配置，记录到审计日志和清单中
+	Targets []rediskey.Template // 按DB分组的key模板
+}
+
+// Params 返回影响锁定用户输出的配置参数，记录到审计日志中
+func (k LockUserKeys) Params() map[string]string {
+	return map[string]string{"lock_user_redis_keys": k.Spec}
+}
@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"shared/kyc"
+	"shared/snapshot"
+)
+
+// snapshotTables 支持对照快照的功能及快照对应的表
+var snapshotTables = map[string]string{
+	"lockuser":  snapshot.UserTable,
+	"kycreview": kyc.Table,
+}
+
+// SnapshotSupported 功能是否支持上传数据库当前状态的快照，对照快照后只为会变更的ID生成SQL
+func SnapshotSupported(function string) bool {
+	_, ok := snapshotTables[function]
+	return ok
+}
+
+// SnapshotTable 返回功能的快照对应的表
+func SnapshotTable(function string) string {
+	return snapshotTables[function]
+}
+
+// writeSnapshotReport 写出未生成SQL的ID及原因，返回报告路径
+func writeSnapshotReport(outputDir, function string, report *snapshot.Report) (string, error) {
+	reportFile := filepath.Join(outputDir, fmt.Sprintf("%s-snapshot-check.csv", function))
+	if err := report.WriteCSV(reportFile); err != nil {
+		return "", err
+	}
+	return reportFile, nil
+}
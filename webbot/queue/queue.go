@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyQueued 任务已在队列中或正在处理
+var ErrAlreadyQueued = errors.New("任务已在队列中或正在处理")
+
+// ErrClosed 队列已关闭，关闭时被中断的任务的 ctx 也以此为原因结束
+var ErrClosed = errors.New("服务关闭，任务已中断")
+
+// ErrCancelled 任务被用户取消
+var ErrCancelled = errors.New("任务已取消")
+
+// ErrQueueFull 排队等待的任务数已达上限
+var ErrQueueFull = errors.New("任务队列已满，请稍后重新提交")
+
+// RunFunc 任务执行函数，ctx 在任务被取消或队列关闭时结束，context.Cause(ctx) 为 ErrCancelled 或 ErrClosed
+type RunFunc func(ctx context.Context, taskID string)
+
+// job 队列中的任务
+type job struct {
+	taskID   string
+	function string
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+}
+
+// Queue 有界任务队列
+// 固定数量的 worker 按提交顺序取任务，同一功能同时运行的任务数不超过该功能的并发上限，
+// 达到上限的功能的任务会让出位置给后面其他功能的任务；排队的任务数达到上限时拒绝提交
+type Queue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	run        RunFunc
+	limits     map[string]int // 每个功能的并发上限，未配置的功能只受 worker 数量限制
+	maxPending int            // 排队等待的任务数上限，<=0 时不限制
+	pending    []*job
+	running    map[string]*job
+	active     map[string]int // 每个功能正在运行的任务数
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+// New 创建任务队列并启动 workers 个 worker，maxPending 为排队等待的任务数上限，<=0 时不限制
+func New(workers, maxPending int, limits map[string]int, run RunFunc) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		run:        run,
+		limits:     limits,
+		maxPending: maxPending,
+		running:    make(map[string]*job),
+		active:     make(map[string]int),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Submit 提交任务，返回排队位置（从 1 开始）
+// 同一任务重复提交时返回 ErrAlreadyQueued，不会重复执行；排队的任务数达到上限时返回 ErrQueueFull
+func (q *Queue) Submit(taskID, function string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrClosed
+	}
+	if _, ok := q.running[taskID]; ok {
+		return 0, ErrAlreadyQueued
+	}
+	for _, j := range q.pending {
+		if j.taskID == taskID {
+			return 0, ErrAlreadyQueued
+		}
+	}
+	if q.maxPending > 0 && len(q.pending) >= q.maxPending {
+		return 0, ErrQueueFull
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	q.pending = append(q.pending, &job{taskID: taskID, function: function, ctx: ctx, cancel: cancel})
+	q.cond.Signal()
+	return len(q.pending), nil
+}
+
+// Position 返回任务的排队位置（从 1 开始），不在等待队列中时返回 0
+func (q *Queue) Position(taskID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, j := range q.pending {
+		if j.taskID == taskID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Stats 返回等待中和运行中的任务数
+func (q *Queue) Stats() (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), len(q.running)
+}
+
+// Cancel 取消任务
+// 排队中的任务直接移出队列，返回 queued=true；运行中的任务取消其 ctx，由执行函数负责退出
+func (q *Queue) Cancel(taskID string) (found, queued bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, j := range q.pending {
+		if j.taskID == taskID {
+			j.cancel(ErrCancelled)
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true, true
+		}
+	}
+	if j, ok := q.running[taskID]; ok {
+		j.cancel(ErrCancelled)
+		return true, false
+	}
+	return false, false
+}
+
+// Close 停止接收新任务，取消全部排队和运行中的任务并等待 worker 退出
+// 返回被移出队列、从未开始执行的任务ID
+func (q *Queue) Close() []string {
+	q.mu.Lock()
+	q.closed = true
+	var dropped []string
+	for _, j := range q.pending {
+		j.cancel(ErrClosed)
+		dropped = append(dropped, j.taskID)
+	}
+	q.pending = nil
+	for _, j := range q.running {
+		j.cancel(ErrClosed)
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	return dropped
+}
+
+// next 取出第一个所属功能未达到并发上限的任务，调用方需持有锁
+func (q *Queue) next() *job {
+	for i, j := range q.pending {
+		if limit, ok := q.limits[j.function]; ok && limit > 0 && q.active[j.function] >= limit {
+			continue
+		}
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		return j
+	}
+	return nil
+}
+
+// worker 循环执行任务直到队列关闭
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		var j *job
+		for {
+			if q.closed {
+				q.mu.Unlock()
+				return
+			}
+			if j = q.next(); j != nil {
+				break
+			}
+			q.cond.Wait()
+		}
+		q.running[j.taskID] = j
+		q.active[j.function]++
+		q.mu.Unlock()
+
+		q.run(j.ctx, j.taskID)
+		j.cancel(nil)
+
+		q.mu.Lock()
+		delete(q.running, j.taskID)
+		q.active[j.function]--
+		// 功能并发数释放后，之前被跳过的任务可能可以执行了
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// ParseLimits 解析功能并发上限配置，格式: "logparse=1,sqlparse=1"
+func ParseLimits(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		function, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("并发上限格式错误: %s", item)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("并发上限必须为正整数: %s", item)
+		}
+		limits[strings.TrimSpace(function)] = limit
+	}
+	return limits, nil
+}
+
+// ParseTimeouts 解析功能超时配置，格式: "logparse=1h,sqlparse=45m"
+func ParseTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		function, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("超时配置格式错误: %s", item)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("超时时间无效: %s", item)
+		}
+		timeouts[strings.TrimSpace(function)] = timeout
+	}
+	return timeouts, nil
+}
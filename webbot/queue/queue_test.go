@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// 排队的任务数达到上限时拒绝提交，有任务开始运行或取消后可以再次提交
+func TestSubmitRejectsWhenFull(t *testing.T) {
+	started := make(chan string)
+	release := make(chan struct{})
+	q := New(1, 2, nil, func(ctx context.Context, taskID string) {
+		started <- taskID
+		<-release
+	})
+	defer q.Close()
+
+	if _, err := q.Submit("running", "filesplit"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	for i, id := range []string{"a", "b"} {
+		if position, err := q.Submit(id, "filesplit"); err != nil || position != i+1 {
+			t.Fatalf("Submit(%s) = %d, %v", id, position, err)
+		}
+	}
+	if _, err := q.Submit("c", "filesplit"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("队列已满时 Submit = %v", err)
+	}
+	// 已在队列中的任务重复提交仍返回 ErrAlreadyQueued
+	if _, err := q.Submit("a", "filesplit"); !errors.Is(err, ErrAlreadyQueued) {
+		t.Errorf("重复提交 = %v", err)
+	}
+
+	if found, queued := q.Cancel("b"); !found || !queued {
+		t.Fatalf("Cancel = %v, %v", found, queued)
+	}
+	if position, err := q.Submit("c", "filesplit"); err != nil || position != 2 {
+		t.Fatalf("取消后 Submit = %d, %v", position, err)
+	}
+
+	close(release)
+	for _, want := range []string{"a", "c"} {
+		if got := <-started; got != want {
+			t.Errorf("执行顺序 %s, want %s", got, want)
+		}
+	}
+}
+
+func TestSubmitUnlimited(t *testing.T) {
+	release := make(chan struct{})
+	q := New(1, 0, nil, func(ctx context.Context, taskID string) { <-release })
+	defer q.Close()
+	defer close(release)
+
+	for i := 0; i < 1000; i++ {
+		if _, err := q.Submit(fmt.Sprintf("task_%d", i), "filesplit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
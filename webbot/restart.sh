@@ -9,8 +9,13 @@ echo "📡 检查端口 9088 占用情况..."
 PID=$(lsof -ti:9088)
 if [ ! -z "$PID" ]; then
     echo "⚡ 发现进程 $PID 占用端口 9088，正在停止..."
-    kill -9 $PID
-    sleep 2
+    # 先发送 SIGTERM，让服务中断正在处理的任务并保存任务状态
+    kill $PID
+    for i in $(seq 1 15); do
+        kill -0 $PID 2>/dev/null || break
+        sleep 1
+    done
+    kill -0 $PID 2>/dev/null && kill -9 $PID
     echo "✅ 进程已停止"
 else
     echo "ℹ️  端口 9088 未被占用"
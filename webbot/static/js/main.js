@@ -1,5 +1,14 @@
 // 全局 JavaScript 功能
 
+// 修改类请求自动携带 CSRF token
+$.ajaxSetup({
+    beforeSend: function(xhr, settings) {
+        if (!/^(GET|HEAD|OPTIONS)$/i.test(settings.type)) {
+            xhr.setRequestHeader('X-CSRF-Token', $('meta[name="csrf-token"]').attr('content'));
+        }
+    }
+});
+
 // 页面加载完成后执行
 $(document).ready(function() {
     // 初始化提示工具
@@ -317,6 +326,91 @@ function updateProgressBar(selector, progress, animated = true) {
     }
 }
 
+// 订阅任务进度，默认使用 SSE，transport 为 'websocket' 或浏览器不支持 SSE 时使用 WebSocket
+// handlers: onState(task)、onLog(log)、onDone(result)、onError(message)，返回的函数用于取消订阅
+function watchTask(taskId, handlers, transport) {
+    let lastId = 0;
+    let finished = false;
+    let source = null;
+    let socket = null;
+    let retries = 0;
+
+    function dispatch(type, id, data) {
+        if (id) {
+            lastId = id;
+        }
+        retries = 0;
+        if (type === 'state' && handlers.onState) {
+            handlers.onState(data);
+        } else if (type === 'log' && handlers.onLog) {
+            handlers.onLog(data);
+        } else if (type === 'done') {
+            finished = true;
+            stop();
+            if (handlers.onDone) {
+                handlers.onDone(data);
+            }
+        }
+    }
+
+    // 连接断开且任务未结束时重连，服务端补发 lastId 之后的日志
+    function reconnect() {
+        stop();
+        if (finished) {
+            return;
+        }
+        if (++retries > 5) {
+            if (handlers.onError) {
+                handlers.onError('进度连接已断开');
+            }
+            return;
+        }
+        setTimeout(connect, 1000 * retries);
+    }
+
+    function connect() {
+        if (finished) {
+            return;
+        }
+        if (transport !== 'websocket' && window.EventSource) {
+            // EventSource 自动重连时会携带 Last-Event-ID，这里统一由 reconnect 处理以便限制重试次数
+            source = new EventSource('/api/events/' + taskId + '?after=' + lastId);
+            ['state', 'log', 'done'].forEach(function(type) {
+                source.addEventListener(type, function(e) {
+                    dispatch(type, parseInt(e.lastEventId, 10) || 0, JSON.parse(e.data));
+                });
+            });
+            source.onerror = reconnect;
+        } else {
+            const scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+            socket = new WebSocket(scheme + location.host + '/api/ws/' + taskId + '?after=' + lastId);
+            socket.onmessage = function(e) {
+                const event = JSON.parse(e.data);
+                dispatch(event.type, event.id, event.data);
+            };
+            socket.onclose = reconnect;
+        }
+    }
+
+    function stop() {
+        if (source) {
+            source.close();
+            source = null;
+        }
+        if (socket) {
+            socket.onclose = null;
+            socket.close();
+            socket = null;
+        }
+    }
+
+    connect();
+    return function() {
+        finished = true;
+        stop();
+    };
+}
+
 // 文件类型图标
 function getFileTypeIcon(filename) {
     const ext = filename.split('.').pop().toLowerCase();
@@ -390,6 +484,7 @@ window.WebBotUtils = {
     setLoadingState,
     handleAjaxError,
     updateProgressBar,
+    watchTask,
     getFileTypeIcon,
     debounce,
     throttle,
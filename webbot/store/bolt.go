@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// tasksBucket BoltDB 中保存任务的 bucket
+var tasksBucket = []byte("tasks")
+
+// BoltStore 基于 BoltDB 的任务存储
+// 内存中保留全部任务的缓存，每次修改同步写入磁盘
+type BoltStore struct {
+	mu    sync.RWMutex
+	db    *bolt.DB
+	tasks map[string]*TaskInfo
+}
+
+// OpenBoltStore 打开（或创建）任务数据库，并将上次运行中断的任务标记为失败
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开任务数据库失败: %v", err)
+	}
+
+	s := &BoltStore{db: db, tasks: make(map[string]*TaskInfo)}
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.failInterrupted(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 读取数据库中的全部任务
+func (s *BoltStore) load() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(tasksBucket)
+		if err != nil {
+			return fmt.Errorf("创建任务表失败: %v", err)
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var task TaskInfo
+			if err := json.Unmarshal(v, &task); err != nil {
+				return fmt.Errorf("解析任务 %s 失败: %v", k, err)
+			}
+			s.tasks[task.ID] = &task
+			return nil
+		})
+	})
+}
+
+// failInterrupted 服务重启时排队中和正在处理的任务已经中断，标记为失败
+func (s *BoltStore) failInterrupted() error {
+	now := time.Now()
+	for id, task := range s.tasks {
+		if task.Status != StatusQueued && task.Status != StatusProcessing {
+			continue
+		}
+		task.Status = StatusFailed
+		task.Message = "服务重启，任务处理已中断，请重新上传"
+		task.EndTime = &now
+		if err := s.put(task); err != nil {
+			return fmt.Errorf("更新中断任务 %s 失败: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// put 将任务写入数据库
+func (s *BoltStore) put(task *TaskInfo) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %v", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(task.ID), data)
+	})
+}
+
+// Create 保存新任务
+func (s *BoltStore) Create(task *TaskInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clone := task.Clone()
+	if err := s.put(clone); err != nil {
+		return err
+	}
+	s.tasks[task.ID] = clone
+	return nil
+}
+
+// Get 获取任务副本
+func (s *BoltStore) Get(id string) (*TaskInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return task.Clone(), nil
+}
+
+// Update 在锁内修改任务并写入数据库，写入失败时内存中的任务保持不变
+func (s *BoltStore) Update(id string, fn func(task *TaskInfo)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	updated := task.Clone()
+	fn(updated)
+	if err := s.put(updated); err != nil {
+		return err
+	}
+	s.tasks[id] = updated
+	return nil
+}
+
+// List 按创建时间倒序返回全部任务副本
+func (s *BoltStore) List() ([]*TaskInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*TaskInfo, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		result = append(result, task.Clone())
+	}
+	sortTasks(result)
+	return result, nil
+}
+
+// Close 关闭数据库
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore 内存任务存储，重启后数据丢失，仅用于开发调试
+type MemoryStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*TaskInfo
+}
+
+// NewMemoryStore 创建内存任务存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tasks: make(map[string]*TaskInfo)}
+}
+
+// Create 保存新任务
+func (s *MemoryStore) Create(task *TaskInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.ID] = task.Clone()
+	return nil
+}
+
+// Get 获取任务副本
+func (s *MemoryStore) Get(id string) (*TaskInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return task.Clone(), nil
+}
+
+// Update 在锁内修改任务
+func (s *MemoryStore) Update(id string, fn func(task *TaskInfo)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	fn(task)
+	return nil
+}
+
+// List 按创建时间倒序返回全部任务副本
+func (s *MemoryStore) List() ([]*TaskInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*TaskInfo, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		result = append(result, task.Clone())
+	}
+	sortTasks(result)
+	return result, nil
+}
+
+// Close 关闭存储
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sortTasks 按创建时间倒序排序
+func sortTasks(tasks []*TaskInfo) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].StartTime.After(tasks[j].StartTime)
+	})
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openStores 返回需要测试的所有任务存储
+func openStores(t *testing.T) map[string]TaskStore {
+	t.Helper()
+	bolt, err := OpenBoltStore(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]TaskStore{"memory": NewMemoryStore(), "bolt": bolt}
+}
+
+// 处理协程更新进度时，页面同时查询任务和任务列表，go test -race 检查数据竞争
+func TestStoreConcurrentAccess(t *testing.T) {
+	const tasks, updates = 8, 50
+	for name, s := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < tasks; i++ {
+				id := fmt.Sprintf("task_%d", i)
+				if err := s.Create(&TaskInfo{ID: id, Status: StatusQueued, StartTime: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for j := 1; j <= updates; j++ {
+						err := s.Update(id, func(task *TaskInfo) {
+							task.Status = StatusProcessing
+							task.Progress = j * 100 / updates
+							task.OutputFiles = append(task.OutputFiles, fmt.Sprintf("out_%d.csv", j))
+							if j == updates {
+								now := time.Now()
+								task.Status = StatusCompleted
+								task.EndTime = &now
+							}
+						})
+						if err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < updates; j++ {
+						task, err := s.Get(id)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						// 副本的修改不影响存储中的任务
+						task.OutputFiles = append(task.OutputFiles, "copy.csv")
+						task.Progress = -1
+						if _, err := s.List(); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			list, err := s.List()
+			if err != nil || len(list) != tasks {
+				t.Fatalf("List = %d, %v", len(list), err)
+			}
+			for _, task := range list {
+				if task.Status != StatusCompleted || task.Progress != 100 || len(task.OutputFiles) != updates || task.EndTime == nil {
+					t.Errorf("任务 %s: 状态 %s, 进度 %d, 输出 %d 个", task.ID, task.Status, task.Progress, len(task.OutputFiles))
+				}
+			}
+			if _, err := s.Get("missing"); !errors.Is(err, ErrTaskNotFound) {
+				t.Errorf("Get 不存在的任务 = %v", err)
+			}
+			if err := s.Update("missing", func(*TaskInfo) {}); !errors.Is(err, ErrTaskNotFound) {
+				t.Errorf("Update 不存在的任务 = %v", err)
+			}
+		})
+	}
+}
+
+// 重启前排队中和正在处理的任务在重新打开时标记为失败，其他任务保持不变
+func TestBoltStoreFailsInterruptedTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	end := start.Add(time.Minute)
+	for _, task := range []*TaskInfo{
+		{ID: "pending", Status: StatusPending, StartTime: start},
+		{ID: "queued", Status: StatusQueued, StartTime: start},
+		{ID: "processing", Status: StatusProcessing, Progress: 40, StartTime: start, ProcessingAt: &start},
+		{ID: "completed", Status: StatusCompleted, Progress: 100, StartTime: start, EndTime: &end, OutputFiles: []string{"result.csv"}},
+		{ID: "failed", Status: StatusFailed, Message: "处理失败", StartTime: start, EndTime: &end},
+	} {
+		if err := s.Create(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { s.Close() }()
+
+	for _, id := range []string{"queued", "processing"} {
+		task, err := s.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Status != StatusFailed || task.Message != "服务重启，任务处理已中断，请重新上传" || task.EndTime == nil {
+			t.Errorf("中断的任务 %s: 状态 %s, 消息 %q, 结束时间 %v", id, task.Status, task.Message, task.EndTime)
+		}
+	}
+	for id, want := range map[string]string{"pending": StatusPending, "completed": StatusCompleted, "failed": StatusFailed} {
+		task, err := s.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Status != want {
+			t.Errorf("任务 %s 的状态 = %s, want %s", id, task.Status, want)
+		}
+	}
+	if task, _ := s.Get("completed"); len(task.OutputFiles) != 1 || !task.EndTime.Equal(end) {
+		t.Errorf("已完成的任务被修改: %+v", task)
+	}
+	if task, _ := s.Get("failed"); task.Message != "处理失败" {
+		t.Errorf("已失败任务的消息 = %q", task.Message)
+	}
+
+	// 标记结果已写入数据库，再次打开时保持不变
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task, err := s.Get("processing"); err != nil || task.Status != StatusFailed {
+		t.Errorf("再次打开后 processing = %+v, %v", task, err)
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"shared/batch"
+	"shared/review"
+	"time"
+)
+
+// 任务状态
+const (
+	StatusPending    = "pending"
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// 审批状态
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ErrTaskNotFound 任务不存在
+var ErrTaskNotFound = errors.New("任务不存在")
+
+// TaskInfo 任务信息
+type TaskInfo struct {
+	ID            string            `json:"id"`
+	Function      string            `json:"function"`
+	Status        string            `json:"status"` // pending, queued, processing, completed, failed
+	Progress      int               `json:"progress"`
+	Message       string            `json:"message"`
+	InputFile     string            `json:"input_file"`
+	Options       map[string]string `json:"options,omitempty"` // 上传时提交的处理参数，例如文件分割方式
+	OutputFiles   []string          `json:"output_files"`
+	SubmittedBy   string            `json:"submitted_by"`
+	SubmitterName string            `json:"submitter_name,omitempty"` // 提交人显示名称，未关联本地账户的 OIDC 用户名为 oidc:<sub>
+	StartTime     time.Time         `json:"start_time"`               // 任务创建时间
+	ProcessingAt  *time.Time        `json:"processing_at,omitempty"`  // 开始处理时间
+	EndTime       *time.Time        `json:"end_time"`
+	Approval      *Approval         `json:"approval,omitempty"` // 需要审批的功能才有
+	Batch         *batch.Report     `json:"batch,omitempty"`    // 批量任务每个输入文件的统计
+
+	// QueuePosition 排队位置，只在查询时填充，不持久化
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// Approval 输出文件的审批信息，审批通过前不能下载
+type Approval struct {
+	Status     string          `json:"status"` // pending, approved, rejected
+	Summary    *review.Summary `json:"summary,omitempty"`
+	ReviewedBy string          `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time      `json:"reviewed_at,omitempty"`
+	Comment    string          `json:"comment,omitempty"`
+}
+
+// Clone 深拷贝任务信息，调用方可以在锁外安全读取
+func (t *TaskInfo) Clone() *TaskInfo {
+	clone := *t
+	if t.OutputFiles != nil {
+		clone.OutputFiles = append([]string(nil), t.OutputFiles...)
+	}
+	if t.ProcessingAt != nil {
+		processingAt := *t.ProcessingAt
+		clone.ProcessingAt = &processingAt
+	}
+	if t.EndTime != nil {
+		endTime := *t.EndTime
+		clone.EndTime = &endTime
+	}
+	// Options 创建任务后不再修改，Batch 合并完成后不再修改，副本之间可以共享
+	if t.Approval != nil {
+		// Summary 生成后不再修改，副本之间可以共享
+		approval := *t.Approval
+		if t.Approval.ReviewedAt != nil {
+			reviewedAt := *t.Approval.ReviewedAt
+			approval.ReviewedAt = &reviewedAt
+		}
+		clone.Approval = &approval
+	}
+	return &clone
+}
+
+// IsFinished 任务是否已结束
+func (t *TaskInfo) IsFinished() bool {
+	return t.Status == StatusCompleted || t.Status == StatusFailed
+}
+
+// AwaitingApproval 任务是否已处理完成、等待审批
+func (t *TaskInfo) AwaitingApproval() bool {
+	return t.Status == StatusCompleted && t.Approval != nil && t.Approval.Status == ApprovalPending
+}
+
+// Downloadable 任务结果是否可以下载：不需要审批或已审批通过
+func (t *TaskInfo) Downloadable() bool {
+	return t.Status == StatusCompleted && (t.Approval == nil || t.Approval.Status == ApprovalApproved)
+}
+
+// TaskStore 任务存储
+// Get/List 返回的是副本，修改任务必须通过 Update 完成
+type TaskStore interface {
+	// Create 保存新任务
+	Create(task *TaskInfo) error
+	// Get 获取任务副本，不存在时返回 ErrTaskNotFound
+	Get(id string) (*TaskInfo, error)
+	// Update 在锁内修改任务并持久化
+	Update(id string, fn func(task *TaskInfo)) error
+	// List 按创建时间倒序返回全部任务副本
+	List() ([]*TaskInfo, error)
+	// Close 关闭存储
+	Close() error
+}